@@ -8,38 +8,29 @@ import (
 	"syscall"
 	"time"
 
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-
 	"backend-hexagonal/internal/adapters/grpc"
-	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/app"
 	"backend-hexagonal/internal/config"
-	"backend-hexagonal/internal/service"
 )
 
 func main() {
 	// Load environment variables from .env file
 	config.LoadEnv()
 
-	// Connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI()))
+	// Setup repository -> service -> server
+	a, err := app.New(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer client.Disconnect(context.Background())
-
-	db := client.Database(config.DBName())
-
-	// Setup repository -> service -> server
-	userRepo := mongoadapter.NewUserRepository(db)
-	userSvc := service.NewUserService(userRepo)
-	authSvc := service.NewAuthService(userRepo)
+	defer a.Close()
+	a.Start()
 
 	// Create gRPC server
-	grpcServer := grpc.NewServer(userSvc, authSvc, config.GRPCPort())
+	grpcServer := grpc.NewServer(a.Users, a.Auth, a.Search, a.Preferences, config.GRPCPort()).
+		WithUserChanges(a.UserChanges)
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
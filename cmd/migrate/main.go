@@ -0,0 +1,191 @@
+// Command migrate applies and reverts the versioned migrations of the Mongo
+// database:
+//
+//	migrate up            apply every pending migration
+//	migrate down          revert the most recently applied migration
+//	migrate status        list the migrations and when they were applied
+//	migrate to <version>  apply or revert until that version is the latest
+//
+// `migrate to 0` reverts them all. The servers run `migrate up` themselves
+// on startup unless MIGRATE_ON_START=false. The sqlite and postgres storages
+// are upgraded by the SQL migrations embedded in the binary instead, which
+// only go up, so for them only `migrate up` is supported.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/migrations"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// Load environment variables from .env file
+	config.LoadEnv()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "up", "down", "status":
+		if len(args) != 0 {
+			usage()
+		}
+	case "to":
+		if len(args) != 1 {
+			usage()
+		}
+	default:
+		usage()
+	}
+
+	switch storage := config.Storage(); storage {
+	case "sqlite", "postgres":
+		os.Exit(runSQL(ctx, storage, command))
+	case "memory":
+		log.Print("memory storage has nothing to migrate")
+		os.Exit(1)
+	}
+	os.Exit(run(ctx, command, args))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate up | down | status | to <version>")
+	os.Exit(2)
+}
+
+func run(ctx context.Context, command string, args []string) int {
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(connectCtx, options.Client().ApplyURI(config.MongoURI()))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(config.DBName())
+	migrator := migrations.New(mongoadapter.NewMigrationStore(db), mongoadapter.Migrations(db))
+
+	switch command {
+	case "status":
+		err = printStatus(ctx, migrator)
+	case "down":
+		var reverted *migrations.Migration
+		reverted, err = migrator.Down(ctx)
+		if reverted != nil {
+			log.Printf("reverted %d %s", reverted.Version, reverted.Name)
+		} else if err == nil {
+			log.Print("no migration is applied")
+		}
+	case "up":
+		var applied []migrations.Migration
+		applied, err = migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("applied %d %s", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			log.Print("no migration is pending")
+		}
+	case "to":
+		version, parseErr := strconv.Atoi(args[0])
+		if parseErr != nil || version < 0 {
+			usage()
+		}
+		err = runTo(ctx, migrator, version)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// runTo migrates to version, reporting whether each migration was applied
+// or reverted
+func runTo(ctx context.Context, migrator *migrations.Migrator, version int) error {
+	before, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	wasApplied := make(map[int]bool, len(before))
+	for _, s := range before {
+		wasApplied[s.Version] = s.Applied
+	}
+
+	done, err := migrator.To(ctx, version)
+	for _, m := range done {
+		if wasApplied[m.Version] {
+			log.Printf("reverted %d %s", m.Version, m.Name)
+		} else {
+			log.Printf("applied %d %s", m.Version, m.Name)
+		}
+	}
+	if err == nil && len(done) == 0 {
+		log.Printf("already at version %d", version)
+	}
+	return err
+}
+
+func printStatus(ctx context.Context, migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		switch {
+		case s.Applied && s.Up == nil:
+			applied = s.AppliedAt.Format(time.RFC3339) + " (unknown to this release)"
+		case s.Applied:
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
+
+// runSQL upgrades a relational database with its embedded migrations
+func runSQL(ctx context.Context, storage, command string) int {
+	if command != "up" {
+		log.Printf("the SQL migrations only go up, so %s storage only supports `migrate up`", storage)
+		return 1
+	}
+
+	db, err := sqladapter.Open(storage, config.SQLDSN())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := db.Migrate(ctx); err != nil {
+		log.Print(err)
+		return 1
+	}
+	log.Print("the schema is up to date")
+	return 0
+}
@@ -6,12 +6,14 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
+	"backend-hexagonal/internal/adapters/blob"
 	"backend-hexagonal/internal/adapters/http"
-	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/adapters/http/scim"
+	"backend-hexagonal/internal/app"
 	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/ports"
 	"backend-hexagonal/internal/service"
 )
 
@@ -22,40 +24,88 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI()))
+	// setup repository -> service -> handler
+	a, err := app.New(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	db := client.Database(config.DBName())
+	defer a.Close()
+	a.Start()
 
-	// setup repository -> service -> handler
-	userRepo := mongoadapter.NewUserRepository(db)
-	userSvc := service.NewUserService(userRepo)
-	authSvc := service.NewAuthService(userRepo)
+	blobs, err := newBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	userSvc, authSvc, schema := a.Users, a.Auth, a.Schema
+	avatarSvc := service.NewAvatarService(a.UserRepo, blobs, config.AvatarMaxBytes()).WithTransactor(a.Transactor).WithOutbox(a.Outbox)
+	privacySvc := service.NewPrivacyService(a.UserRepo, a.Tombstones, avatarSvc, a.Preferences).WithTransactor(a.Transactor).WithOutbox(a.Outbox)
+	bulkSvc := service.NewBulkService(a.UserRepo).WithAttributeSchema(schema).WithTransactor(a.Transactor).WithOutbox(a.Outbox)
 
 	userHandler := http.NewUserHandler(userSvc)
 	authHandler := http.NewAuthHandler(authSvc)
+	adminHandler := http.NewAdminHandler(userSvc)
+	privacyHandler := http.NewPrivacyHandler(privacySvc)
+	searchHandler := http.NewSearchHandler(a.Search, schema)
+	avatarHandler := http.NewAvatarHandler(avatarSvc, schema)
+	bulkHandler := http.NewBulkHandler(bulkSvc)
+	preferenceHandler := http.NewPreferenceHandler(a.Preferences)
 
-	app := fiber.New()
-	http.RegisterRoutes(app, userHandler, authHandler, authSvc)
+	// Leave room for avatar uploads with their multipart framing, and bulk
+	// imports
+	server := fiber.New(fiber.Config{
+		BodyLimit:    max(fiber.DefaultBodyLimit, int(config.AvatarMaxBytes())+64<<10, int(config.ImportMaxBytes())),
+		ErrorHandler: problem.ErrorHandler,
+	})
+	http.RegisterRoutes(server, userHandler, authHandler, adminHandler, privacyHandler, searchHandler, avatarHandler, bulkHandler, preferenceHandler, authSvc)
+
+	// SCIM provisioning is only exposed when a client token is configured
+	if token := config.SCIMToken(); token != "" {
+		http.RegisterSCIMRoutes(server, scim.NewHandler(userSvc), token)
+	}
 
 	// optional: background goroutine example: log user count every 10s
 	go func() {
 		ticker := time.NewTicker(10 * time.Second)
 		defer ticker.Stop()
 		for range ticker.C {
-			users, err := userSvc.GetAllUsers(context.Background())
+			page, err := userSvc.ListUsers(context.Background(), ports.UserQuery{Limit: 1})
 			if err != nil {
 				log.Println("background user list error:", err)
 				continue
 			}
-			log.Printf("users count: %d\n", len(users))
+			log.Printf("users count: %d\n", page.Total)
+		}
+	}()
+
+	// Permanently remove soft deleted users once their retention has passed
+	go func() {
+		retention := config.DeletedUserRetention()
+		ticker := time.NewTicker(config.PurgeInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := userSvc.PurgeDeletedUsers(context.Background(), retention)
+			if err != nil {
+				log.Println("purge deleted users error:", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("purged %d deleted users\n", purged)
+			}
 		}
 	}()
 
 	port := config.Port()
 	log.Printf("server running on %s", port)
-	if err := app.Listen(port); err != nil {
+	if err := server.Listen(port); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// newBlobStore opens the configured store for uploaded files
+func newBlobStore() (ports.BlobStore, error) {
+	if config.BlobBackend() == "s3" {
+		return blob.NewS3Store(blob.S3ConfigFromEnv())
+	}
+	return blob.NewFileSystemStore(config.BlobDir(), config.BlobPublicURL())
+}
@@ -0,0 +1,338 @@
+// Command users imports and exports users in bulk, straight against the
+// database:
+//
+//	users import [-format csv|ndjson] [-dry-run] [-report errors.csv] <file|->
+//	users export [-format csv|ndjson] [-password-hashes] [-o file]
+//	users normalize-emails [-apply]
+//
+// The import exits with status 1 if any record failed. normalize-emails
+// lists the stored emails that are not yet normalized or that several
+// users share, and rewrites them with -apply; it must succeed before the
+// migration creating the unique index on email can.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"backend-hexagonal/internal/adapters/ids"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	// Load environment variables from .env file
+	config.LoadEnv()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch os.Args[1] {
+	case "import":
+		os.Exit(runImport(ctx, os.Args[2:]))
+	case "export":
+		os.Exit(runExport(ctx, os.Args[2:]))
+	case "normalize-emails":
+		os.Exit(runNormalizeEmails(ctx, os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: users import [-format csv|ndjson] [-dry-run] [-report errors.csv] <file|->")
+	fmt.Fprintln(os.Stderr, "       users export [-format csv|ndjson] [-password-hashes] [-o file]")
+	fmt.Fprintln(os.Stderr, "       users normalize-emails [-apply]")
+	os.Exit(2)
+}
+
+func runImport(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	formatName := flags.String("format", "", "csv or ndjson; guessed from the file extension when empty")
+	dryRun := flags.Bool("dry-run", false, "validate every record without writing anything")
+	reportPath := flags.String("report", "", "write the failed records to this CSV file")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+	path := flags.Arg(0)
+
+	if *formatName == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*formatName = "csv"
+		case ".ndjson", ".jsonl":
+			*formatName = "ndjson"
+		default:
+			log.Print("cannot tell the format from the file name, use -format")
+			return 2
+		}
+	}
+	format, err := service.ParseBulkFormat(*formatName)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	bulkSvc, disconnect, err := newBulkService(ctx)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer disconnect()
+
+	report, err := bulkSvc.ImportUsers(ctx, bufio.NewReader(input), service.ImportOptions{
+		Format: format,
+		DryRun: *dryRun,
+	})
+	if report != nil {
+		mode := ""
+		if report.DryRun {
+			mode = " (dry run)"
+		}
+		log.Printf("%d records%s: %d created, %d updated, %d unchanged, %d failed",
+			report.Records, mode, report.Created, report.Updated, report.Unchanged, report.Failed)
+
+		if *reportPath != "" {
+			if err := writeReport(*reportPath, report); err != nil {
+				log.Print(err)
+				return 1
+			}
+		} else {
+			for _, e := range report.Errors {
+				log.Printf("line %d: %s", e.Line, e.Error)
+			}
+		}
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func writeReport(path string, report *service.ImportReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteCSV(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func runExport(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String("format", "ndjson", "csv or ndjson")
+	passwordHashes := flags.Bool("password-hashes", false, "include bcrypt password hashes")
+	outputPath := flags.String("o", "-", "write to this file instead of standard output")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		usage()
+	}
+
+	format, err := service.ParseBulkFormat(*formatName)
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	bulkSvc, disconnect, err := newBulkService(ctx)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer disconnect()
+
+	output := os.Stdout
+	if *outputPath != "-" {
+		output, err = os.Create(*outputPath)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	w := bufio.NewWriter(output)
+	err = bulkSvc.ExportUsers(ctx, w, service.ExportOptions{
+		Format:                format,
+		IncludePasswordHashes: *passwordHashes,
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if output != os.Stdout {
+		if closeErr := output.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+func runNormalizeEmails(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("normalize-emails", flag.ExitOnError)
+	apply := flags.Bool("apply", false, "rewrite the emails instead of only listing them")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		usage()
+	}
+
+	db, err := connectDatabase(ctx)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer db.close()
+
+	report, err := service.NewEmailMigrationService(db.users).NormalizeEmails(ctx, *apply)
+	if report != nil {
+		for _, change := range report.Changes {
+			if change.IsDuplicate() {
+				log.Printf("%s: %s -> %s (duplicate of %s)", change.UserID.String(), change.From, change.To, change.KeptBy.String())
+			} else {
+				log.Printf("%s: %s -> %s", change.UserID.String(), change.From, change.To)
+			}
+		}
+		mode := " (dry run, use -apply to rewrite them)"
+		if report.Applied {
+			mode = ""
+		}
+		log.Printf("%d users: %d emails to rewrite, %d shared by several users%s",
+			report.Users, len(report.Changes), report.Duplicates, mode)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
+
+// newBulkService connects to the configured database. Imported users get
+// their events appended to the outbox, for the servers to publish.
+func newBulkService(ctx context.Context) (*service.BulkService, func(), error) {
+	schema, err := loadAttributeSchema(config.UserSchemaFile())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := connectDatabase(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	bulkSvc := service.NewBulkService(db.users).
+		WithAttributeSchema(schema).
+		WithTransactor(db.transactor).
+		WithOutbox(db.outbox)
+	return bulkSvc, db.close, nil
+}
+
+// userStore is what the subcommands need of the user repository
+type userStore interface {
+	ports.UserRepository
+	ports.UserEmailStore
+}
+
+// database is what the subcommands need of the configured database
+type database struct {
+	users      userStore
+	transactor ports.Transactor
+	outbox     ports.OutboxRepository
+	close      func()
+}
+
+// connectDatabase connects to the configured database
+func connectDatabase(ctx context.Context) (*database, error) {
+	if storage := config.Storage(); storage == "sqlite" || storage == "postgres" {
+		db, err := sqladapter.Open(storage, config.SQLDSN())
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Migrate(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &database{
+			users:      sqladapter.NewUserRepository(db, ids.NewObjectIDGenerator()),
+			transactor: sqladapter.NewTransactor(db),
+			outbox:     sqladapter.NewOutboxRepository(db),
+			close:      func() { db.Close() },
+		}, nil
+	}
+
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(connectCtx, options.Client().ApplyURI(config.MongoURI()))
+	if err != nil {
+		return nil, err
+	}
+	disconnect := func() { client.Disconnect(context.Background()) }
+
+	transactor, err := mongoadapter.NewTransactor(connectCtx, client, config.MongoAllowNoTransactions())
+	if err != nil {
+		disconnect()
+		return nil, err
+	}
+	db := client.Database(config.DBName())
+	return &database{
+		users:      mongoadapter.NewUserRepository(db),
+		transactor: transactor,
+		outbox:     mongoadapter.NewOutboxRepository(db),
+		close:      disconnect,
+	}, nil
+}
+
+// loadAttributeSchema reads the custom user attribute schema, if a file is
+// configured
+func loadAttributeSchema(path string) (*domain.AttributeSchema, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return domain.ParseAttributeSchema(data)
+}
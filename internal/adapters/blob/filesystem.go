@@ -0,0 +1,123 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"backend-hexagonal/internal/ports"
+)
+
+// ErrInvalidKey is returned for keys that are empty, absolute or contain
+// "." or ".." elements
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// validKey reports whether key is a clean, relative, slash separated path,
+// so it can't escape the store's root directory or bucket prefix
+func validKey(key string) bool {
+	return key != "." && fs.ValidPath(key) && !strings.Contains(key, `\`)
+}
+
+// FileSystemStore keeps blobs as files below a root directory. They are
+// served by the application itself under baseURL.
+type FileSystemStore struct {
+	root    string
+	baseURL string
+}
+
+func NewFileSystemStore(root, baseURL string) (*FileSystemStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSystemStore{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (s *FileSystemStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *FileSystemStore) Put(ctx context.Context, key string, data io.Reader, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so readers never see a
+	// partially written blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileSystemStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, ports.ErrBlobNotFound
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ports.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		file.Close()
+		return nil, ports.ErrBlobNotFound
+	}
+	return file, nil
+}
+
+func (s *FileSystemStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Remove the directories the blob leaves empty. Remove fails on the
+	// first one that still has entries.
+	for dir := filepath.Dir(path); dir != filepath.Clean(s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *FileSystemStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,137 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/ports"
+)
+
+// S3Config configures an S3Store
+type S3Config struct {
+	// Endpoint of an S3-compatible service such as MinIO. Empty means AWS.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// UsePathStyle addresses buckets as endpoint/bucket rather than as a
+	// subdomain, which most S3-compatible services need
+	UsePathStyle bool
+	// BaseURL is where clients fetch blobs from
+	BaseURL string
+}
+
+// S3ConfigFromEnv reads the S3 settings from the environment
+func S3ConfigFromEnv() S3Config {
+	return S3Config{
+		Endpoint:        config.S3Endpoint(),
+		Region:          config.S3Region(),
+		Bucket:          config.S3Bucket(),
+		AccessKeyID:     config.S3AccessKeyID(),
+		SecretAccessKey: config.S3SecretAccessKey(),
+		UsePathStyle:    config.S3UsePathStyle(),
+		BaseURL:         config.BlobPublicURL(),
+	}
+}
+
+// S3Store keeps blobs as objects in an S3 bucket
+type S3Store struct {
+	client  *s3.Client
+	bucket  string
+	baseURL string
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+
+	options := s3.Options{
+		Region:       cfg.Region,
+		UsePathStyle: cfg.UsePathStyle,
+		// Only send checksums when an operation requires them, since not
+		// every S3-compatible service supports the newer checksum headers
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	}
+	if cfg.AccessKeyID != "" {
+		options.Credentials = credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+	}
+	if cfg.Endpoint != "" {
+		options.BaseEndpoint = aws.String(cfg.Endpoint)
+	}
+
+	return &S3Store{
+		client:  s3.New(options),
+		bucket:  cfg.Bucket,
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data io.Reader, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	// Request signing hashes the body, which needs a seekable reader
+	body, ok := data.(io.ReadSeeker)
+	if !ok {
+		buf, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ports.ErrBlobNotFound
+	}
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var status interface{ HTTPStatusCode() int }
+		if errors.As(err, &status) && status.HTTPStatusCode() == 404 {
+			return nil, ports.ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3Store) URL(key string) string {
+	return s.baseURL + "/" + key
+}
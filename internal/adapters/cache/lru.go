@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"container/list"
+	"time"
+
+	"backend-hexagonal/internal/domain"
+)
+
+// entry is a cached lookup. A nil user records that there was none.
+type entry struct {
+	key     string
+	user    *domain.User
+	expires time.Time
+}
+
+// lru holds up to size entries, dropping the least recently used one to
+// make room. onRemove is called with every entry that leaves, whether it
+// was dropped, expired or removed.
+type lru struct {
+	size     int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+	onRemove func(*entry)
+}
+
+func newLRU(size int, onRemove func(*entry)) *lru {
+	return &lru{
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		onRemove: onRemove,
+	}
+}
+
+// get returns the entry of key unless it is missing or expired
+func (c *lru) get(key string, now time.Time) (*entry, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry)
+	if !now.Before(e.expires) {
+		c.removeElement(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return e, true
+}
+
+func (c *lru) put(key string, user *domain.User, expires time.Time) {
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, user: user, expires: expires})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lru) remove(key string) {
+	if element, ok := c.entries[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+func (c *lru) clear() {
+	for c.order.Len() > 0 {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
+
+func (c *lru) removeElement(element *list.Element) {
+	e := c.order.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	c.onRemove(e)
+}
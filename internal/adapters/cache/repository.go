@@ -0,0 +1,370 @@
+// Package cache keeps recently read users in memory, in front of the
+// repository that stores them.
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// Config sizes a Repository
+type Config struct {
+	// Size is how many lookups are kept, by ID and by email together
+	Size int
+	// TTL is how long a user is kept
+	TTL time.Duration
+	// NegativeTTL is how long a lookup that found no user is kept, so
+	// repeated lookups of a missing user don't all reach the database
+	NegativeTTL time.Duration
+}
+
+// Stats counts the lookups of a Repository since it was created
+type Stats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+}
+
+// Repository caches the users GetByID and GetByEmail return, wrapping a
+// UserRepository. Concurrent lookups of a user who is not cached share one
+// read. Writes through the Repository drop what they change, but writes
+// made elsewhere, such as by another server, are only seen once the
+// entries expire.
+//
+// Transactions must run through the Transactor the Repository wraps, see
+// Transactor. Lookups made within one read through without caching what
+// they read, which may never be committed, and the entries its writes
+// drop are dropped again once it ends, so that lookups racing the commit
+// don't keep the user as they were.
+type Repository struct {
+	ports.UserRepository
+	config Config
+
+	mu     sync.Mutex
+	lru    *lru
+	emails map[domain.UserID]string // key of the cached lookup by email of each user
+	// generation changes with every write, so lookups that started before
+	// it don't cache what they read
+	generation uint64
+	group      singleflight.Group
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func NewRepository(repo ports.UserRepository, config Config) *Repository {
+	r := &Repository{
+		UserRepository: repo,
+		config:         config,
+		emails:         make(map[domain.UserID]string),
+	}
+	r.lru = newLRU(config.Size, r.removed)
+	return r
+}
+
+func (r *Repository) Stats() Stats {
+	r.mu.Lock()
+	entries := r.lru.len()
+	r.mu.Unlock()
+	return Stats{Hits: r.hits.Load(), Misses: r.misses.Load(), Entries: entries}
+}
+
+func (r *Repository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	return r.lookup(ctx, idKey(id), func(ctx context.Context) (*domain.User, error) {
+		return r.UserRepository.GetByID(ctx, id)
+	})
+}
+
+func (r *Repository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.lookup(ctx, emailKey(email), func(ctx context.Context) (*domain.User, error) {
+		return r.UserRepository.GetByEmail(ctx, email)
+	})
+}
+
+func (r *Repository) Create(ctx context.Context, user *domain.User) error {
+	err := r.UserRepository.Create(ctx, user)
+	r.invalidate(ctx, []domain.UserID{user.ID}, user.Email)
+	return err
+}
+
+func (r *Repository) Update(ctx context.Context, id domain.UserID, user *domain.User) error {
+	err := r.UserRepository.Update(ctx, id, user)
+	r.invalidate(ctx, []domain.UserID{id}, user.Email)
+	return err
+}
+
+func (r *Repository) Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	user, err := r.UserRepository.Patch(ctx, id, patch)
+	r.invalidate(ctx, []domain.UserID{id}, patchEmails(patch)...)
+	return user, err
+}
+
+func (r *Repository) PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error) {
+	changed, err := r.UserRepository.PatchMany(ctx, patches)
+	ids := make([]domain.UserID, 0, len(patches))
+	var emails []string
+	for id, patch := range patches {
+		ids = append(ids, id)
+		emails = append(emails, patchEmails(patch)...)
+	}
+	r.invalidate(ctx, ids, emails...)
+	return changed, err
+}
+
+func (r *Repository) UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error) {
+	updated, err := r.UserRepository.UpdateStatus(ctx, id, user)
+	r.invalidate(ctx, []domain.UserID{id})
+	return updated, err
+}
+
+func (r *Repository) SetAvatar(ctx context.Context, id domain.UserID, avatar *domain.Avatar) (*domain.User, error) {
+	user, err := r.UserRepository.SetAvatar(ctx, id, avatar)
+	r.invalidate(ctx, []domain.UserID{id})
+	return user, err
+}
+
+func (r *Repository) Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	err := r.UserRepository.Delete(ctx, id, expectedVersion)
+	r.invalidate(ctx, []domain.UserID{id})
+	return err
+}
+
+func (r *Repository) DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error) {
+	deleted, err := r.UserRepository.DeleteMany(ctx, expectedVersions)
+	ids := make([]domain.UserID, 0, len(expectedVersions))
+	for id := range expectedVersions {
+		ids = append(ids, id)
+	}
+	r.invalidate(ctx, ids)
+	return deleted, err
+}
+
+func (r *Repository) Restore(ctx context.Context, id domain.UserID) error {
+	if err := r.UserRepository.Restore(ctx, id); err != nil {
+		r.invalidate(ctx, []domain.UserID{id})
+		return err
+	}
+
+	// Lookups by email may have cached the restored user as missing
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil {
+		r.invalidateAll(ctx)
+		return nil
+	}
+	r.invalidate(ctx, []domain.UserID{id}, user.Email)
+	return nil
+}
+
+func (r *Repository) Erase(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := r.UserRepository.Erase(ctx, id)
+	r.invalidate(ctx, []domain.UserID{id})
+	return user, err
+}
+
+// Invalidate drops the lookups of a user changed without going through the
+// Repository, such as by another server
+func (r *Repository) Invalidate(change domain.UserChange) {
+	ctx := context.Background()
+	if change.User != nil {
+		r.invalidate(ctx, []domain.UserID{change.UserID}, change.User.Email)
+		return
+	}
+	r.invalidate(ctx, []domain.UserID{change.UserID})
+}
+
+// lookup returns the cached user of key, or loads and caches them. Only
+// one load of a key runs at a time; the lookups arriving meanwhile share
+// its result. A user who is not found is cached as missing, for lookups to
+// return ErrNotFound until their NegativeTTL passes. Within a transaction it
+// always loads, and caches nothing.
+func (r *Repository) lookup(ctx context.Context, key string, load func(ctx context.Context) (*domain.User, error)) (*domain.User, error) {
+	if inTransaction(ctx) {
+		return load(ctx)
+	}
+
+	r.mu.Lock()
+	if e, ok := r.lru.get(key, time.Now()); ok {
+		r.mu.Unlock()
+		r.hits.Add(1)
+		return found(e.user)
+	}
+	generation := r.generation
+	r.mu.Unlock()
+	r.misses.Add(1)
+
+	// The load is shared, so it must not be cut short by the first caller
+	// giving up; each caller stops waiting when its own context ends
+	loadCtx := context.WithoutCancel(ctx)
+	result := r.group.DoChan(key, func() (interface{}, error) {
+		user, err := load(loadCtx)
+		if errors.Is(err, ports.ErrNotFound) {
+			user, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.store(key, user, generation)
+		return user, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return found(res.Val.(*domain.User))
+	}
+}
+
+// found returns a copy of a cached user, or ErrNotFound if they are cached
+// as missing
+func found(user *domain.User) (*domain.User, error) {
+	if user == nil {
+		return nil, ports.ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+// store caches a user loaded for key, unless a write happened since the
+// load started
+func (r *Repository) store(key string, user *domain.User, generation uint64) {
+	ttl := r.config.TTL
+	if user == nil {
+		ttl = r.config.NegativeTTL
+	}
+	if ttl <= 0 || r.config.Size <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation != generation {
+		return
+	}
+	r.lru.put(key, cloneUser(user), time.Now().Add(ttl))
+	if user != nil && strings.HasPrefix(key, emailPrefix) {
+		if previous, ok := r.emails[user.ID]; ok && previous != key {
+			r.lru.remove(previous)
+		}
+		r.emails[user.ID] = key
+	}
+}
+
+// invalidate drops the lookups of the users by ID and by their cached
+// email, and the lookups of the given emails, which may be cached as
+// missing. Within a transaction they are dropped again when it ends.
+func (r *Repository) invalidate(ctx context.Context, ids []domain.UserID, emails ...string) {
+	if tx := transactionOf(ctx); tx != nil {
+		tx.add(ids, emails)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+
+	var keys []string
+	for _, id := range ids {
+		keys = append(keys, idKey(id))
+		if key, ok := r.emails[id]; ok {
+			keys = append(keys, key)
+		}
+	}
+	for _, email := range emails {
+		keys = append(keys, emailKey(email))
+	}
+	for _, key := range keys {
+		r.lru.remove(key)
+		// Lookups from now on must not share a load that started before
+		r.group.Forget(key)
+	}
+}
+
+func (r *Repository) invalidateAll(ctx context.Context) {
+	if tx := transactionOf(ctx); tx != nil {
+		tx.addAll()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	r.lru.clear()
+}
+
+// removed keeps emails in step with the entries leaving the cache. It is
+// called with mu held.
+func (r *Repository) removed(e *entry) {
+	if e.user != nil && r.emails[e.user.ID] == e.key {
+		delete(r.emails, e.user.ID)
+	}
+}
+
+const (
+	idPrefix    = "id:"
+	emailPrefix = "email:"
+)
+
+func idKey(id domain.UserID) string {
+	return idPrefix + id.String()
+}
+
+func emailKey(email string) string {
+	return emailPrefix + email
+}
+
+// patchEmails returns the email a patch sets, if any
+func patchEmails(patch domain.UserPatch) []string {
+	if patch.Email == nil {
+		return nil
+	}
+	return []string{*patch.Email}
+}
+
+// cloneUser copies a user along with everything it points to, so callers
+// can't change the cached user
+func cloneUser(user *domain.User) *domain.User {
+	if user == nil {
+		return nil
+	}
+	clone := *user
+	if user.Roles != nil {
+		clone.Roles = append([]string(nil), user.Roles...)
+	}
+	clone.StatusChangedAt = cloneTime(user.StatusChangedAt)
+	clone.DeletedAt = cloneTime(user.DeletedAt)
+	if user.Attributes != nil {
+		clone.Attributes = make(map[string]interface{}, len(user.Attributes))
+		for name, value := range user.Attributes {
+			clone.Attributes[name] = value
+		}
+	}
+	if user.Avatar != nil {
+		avatar := *user.Avatar
+		if user.Avatar.Thumbnails != nil {
+			avatar.Thumbnails = make(map[string]string, len(user.Avatar.Thumbnails))
+			for size, url := range user.Avatar.Thumbnails {
+				avatar.Thumbnails[size] = url
+			}
+		}
+		avatar.Keys = append([]string(nil), user.Avatar.Keys...)
+		clone.Avatar = &avatar
+	}
+	return &clone
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// transactionKey is the context key of the transaction a context belongs to
+type transactionKey struct{}
+
+// transaction collects the lookups the writes of a transaction dropped
+type transaction struct {
+	mu     sync.Mutex
+	ids    []domain.UserID
+	emails []string
+	all    bool
+}
+
+func (t *transaction) add(ids []domain.UserID, emails []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids = append(t.ids, ids...)
+	t.emails = append(t.emails, emails...)
+}
+
+func (t *transaction) addAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.all = true
+}
+
+func transactionOf(ctx context.Context) *transaction {
+	tx, _ := ctx.Value(transactionKey{}).(*transaction)
+	return tx
+}
+
+func inTransaction(ctx context.Context) bool {
+	return transactionOf(ctx) != nil
+}
+
+// Transactor wraps the Transactor of the storage behind a Repository, so
+// that the Repository knows which lookups and writes belong to a
+// transaction
+type Transactor struct {
+	ports.Transactor
+	repo *Repository
+}
+
+// Transactor wraps the Transactor of the storage behind the Repository.
+// Services must use it rather than the storage's, or the Repository caches
+// reads that are rolled back.
+func (r *Repository) Transactor(transactor ports.Transactor) *Transactor {
+	return &Transactor{Transactor: transactor, repo: r}
+}
+
+// WithinTransaction runs fn in a transaction of the wrapped Transactor and,
+// once it has committed or rolled back, drops the lookups its writes
+// changed again
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if inTransaction(ctx) {
+		return t.Transactor.WithinTransaction(ctx, fn)
+	}
+
+	tx := &transaction{}
+	err := t.Transactor.WithinTransaction(context.WithValue(ctx, transactionKey{}, tx), fn)
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	switch {
+	case tx.all:
+		t.repo.invalidateAll(ctx)
+	case len(tx.ids) > 0 || len(tx.emails) > 0:
+		t.repo.invalidate(ctx, tx.ids, tx.emails...)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend-hexagonal/internal/domain"
+)
+
+// LogPublisher writes events to the server log, for development and for
+// deployments that ship logs to where the events are needed
+type LogPublisher struct{}
+
+func NewLogPublisher() *LogPublisher {
+	return &LogPublisher{}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	log.Printf("event %s\n", body)
+	return nil
+}
+
+// WebhookPublisher POSTs every event as JSON to a URL. A response outside
+// of 2xx fails the delivery, so the relay tries it again. The Event-ID
+// header carries the event ID for receivers to ignore redeliveries.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookPublisher(url string) (*WebhookPublisher, error) {
+	if url == "" {
+		return nil, errors.New("webhook: URL is required")
+	}
+	return &WebhookPublisher{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Event-ID", event.ID)
+	req.Header.Set("Event-Type", string(event.Type))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s answered %s", p.url, resp.Status)
+	}
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"backend-hexagonal/internal/adapters/grpc/rpcerror"
+	"backend-hexagonal/internal/domain"
 	"backend-hexagonal/internal/service"
 )
 
@@ -16,6 +18,7 @@ import (
 type AuthInterceptor struct {
 	authService   *service.AuthService
 	publicMethods map[string]bool
+	adminMethods  map[string]bool
 }
 
 func NewAuthInterceptor(authService *service.AuthService) *AuthInterceptor {
@@ -24,9 +27,19 @@ func NewAuthInterceptor(authService *service.AuthService) *AuthInterceptor {
 		"/user.UserService/CreateUser": true, // Allow user creation without auth
 	}
 
+	// Define methods that require the admin role
+	adminMethods := map[string]bool{
+		"/user.UserService/SuspendUser":      true,
+		"/user.UserService/DeactivateUser":   true,
+		"/user.UserService/ReactivateUser":   true,
+		"/user.UserService/BatchDeleteUsers": true,
+		"/user.UserService/WatchUsers":       true,
+	}
+
 	return &AuthInterceptor{
 		authService:   authService,
 		publicMethods: publicMethods,
+		adminMethods:  adminMethods,
 	}
 }
 
@@ -48,17 +61,13 @@ func (interceptor *AuthInterceptor) UnaryInterceptor(
 		return nil, err
 	}
 
-	// Validate token
-	claims, err := interceptor.authService.ValidateToken(token)
+	// Validate token and check the account is still active
+	claims, err := interceptor.authenticate(ctx, token, info.FullMethod)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid token")
+		return nil, err
 	}
 
-	// Add user info to context
-	ctx = context.WithValue(ctx, "user_id", claims.UserID)
-	ctx = context.WithValue(ctx, "email", claims.Email)
-
-	return handler(ctx, req)
+	return handler(withClaims(ctx, claims), req)
 }
 
 // StreamInterceptor intercepts streaming gRPC calls for authentication
@@ -79,25 +88,72 @@ func (interceptor *AuthInterceptor) StreamInterceptor(
 		return err
 	}
 
-	// Validate token
-	claims, err := interceptor.authService.ValidateToken(token)
+	// Validate token and check the account is still active
+	claims, err := interceptor.authenticate(ss.Context(), token, info.FullMethod)
 	if err != nil {
-		return status.Error(codes.Unauthenticated, "invalid token")
+		return err
 	}
 
-	// Create new context with user info
-	ctx := context.WithValue(ss.Context(), "user_id", claims.UserID)
-	ctx = context.WithValue(ctx, "email", claims.Email)
-
 	// Wrap the stream with new context
 	wrappedStream := &wrappedServerStream{
 		ServerStream: ss,
-		ctx:          ctx,
+		ctx:          withClaims(ss.Context(), claims),
 	}
 
 	return handler(srv, wrappedStream)
 }
 
+// Authorize applies the rules of the interceptors to a call of method
+// carrying the given Authorization header, for the HTTP gateway, which
+// calls the RPCs directly. It returns ctx with the caller's identity.
+func (interceptor *AuthInterceptor) Authorize(ctx context.Context, authHeader, method string) (context.Context, error) {
+	if interceptor.publicMethods[method] {
+		return ctx, nil
+	}
+
+	token, err := bearerToken(authHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := interceptor.authenticate(ctx, token, method)
+	if err != nil {
+		return nil, err
+	}
+	return withClaims(ctx, claims), nil
+}
+
+// withClaims adds the caller's identity to ctx
+func withClaims(ctx context.Context, claims *domain.JWTClaims) context.Context {
+	ctx = context.WithValue(ctx, "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "email", claims.Email)
+	return context.WithValue(ctx, "roles", claims.Roles)
+}
+
+// authenticate validates the token, rejects inactive accounts and enforces
+// the admin role on admin methods
+func (interceptor *AuthInterceptor) authenticate(ctx context.Context, token, method string) (*domain.JWTClaims, error) {
+	claims, err := interceptor.authService.Authenticate(ctx, token)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	if interceptor.adminMethods[method] && !hasRole(claims.Roles, domain.RoleAdmin) {
+		return nil, status.Error(codes.PermissionDenied, "insufficient permissions")
+	}
+
+	return claims, nil
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // extractToken extracts JWT token from gRPC metadata
 func (interceptor *AuthInterceptor) extractToken(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
@@ -111,7 +167,11 @@ func (interceptor *AuthInterceptor) extractToken(ctx context.Context) (string, e
 		return "", status.Error(codes.Unauthenticated, "missing authorization header")
 	}
 
-	authHeader := authHeaders[0]
+	return bearerToken(authHeaders[0])
+}
+
+// bearerToken extracts the JWT token from an authorization header
+func bearerToken(authHeader string) (string, error) {
 	if !strings.HasPrefix(authHeader, "Bearer ") {
 		return "", status.Error(codes.Unauthenticated, "invalid authorization header format")
 	}
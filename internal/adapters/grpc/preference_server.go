@@ -0,0 +1,92 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"backend-hexagonal/internal/adapters/grpc/rpcerror"
+	"backend-hexagonal/internal/domain"
+)
+
+type GetPreferencesRequest struct {
+	Namespace string `json:"namespace"`
+}
+
+type UpdatePreferencesRequest struct {
+	Namespace string                 `json:"namespace"`
+	Values    map[string]interface{} `json:"values"`
+}
+
+// PreferencesResponse has the namespace's defaults with the caller's
+// settings merged over them
+type PreferencesResponse struct {
+	Namespace string                 `json:"namespace"`
+	Values    map[string]interface{} `json:"values"`
+}
+
+func (s *UserServer) GetPreferences(ctx context.Context, req *GetPreferencesRequest) (*PreferencesResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.preferenceService.GetPreferences(ctx, userID, req.Namespace)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	return &PreferencesResponse{
+		Namespace: req.Namespace,
+		Values:    values,
+	}, nil
+}
+
+// ReplacePreferences replaces every setting the caller has set in the
+// namespace
+func (s *UserServer) ReplacePreferences(ctx context.Context, req *UpdatePreferencesRequest) (*PreferencesResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.preferenceService.ReplacePreferences(ctx, userID, req.Namespace, req.Values)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	return &PreferencesResponse{
+		Namespace: req.Namespace,
+		Values:    values,
+	}, nil
+}
+
+// PatchPreferences merges the values into the caller's settings, returning
+// those set to null to their defaults
+func (s *UserServer) PatchPreferences(ctx context.Context, req *UpdatePreferencesRequest) (*PreferencesResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.preferenceService.PatchPreferences(ctx, userID, req.Namespace, req.Values)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	return &PreferencesResponse{
+		Namespace: req.Namespace,
+		Values:    values,
+	}, nil
+}
+
+// callerID returns the ID of the authenticated caller. Calls through the
+// HTTP gateway are unauthenticated and have none.
+func callerID(ctx context.Context) (domain.UserID, error) {
+	id, ok := ctx.Value("user_id").(domain.UserID)
+	if !ok || id.IsZero() {
+		return "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+	return id, nil
+}
@@ -0,0 +1,93 @@
+// Package rpcerror converts errors to gRPC statuses, choosing the code from
+// the error's domain.ErrorKind so every RPC reports the same error the same
+// way. Each status carries an ErrorInfo detail naming the specific error.
+package rpcerror
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"backend-hexagonal/internal/domain"
+)
+
+// Domain is the ErrorInfo domain of the errors of this service
+const Domain = "backend-hexagonal"
+
+var kindCodes = map[domain.ErrorKind]codes.Code{
+	domain.KindNotFound:         codes.NotFound,
+	domain.KindConflict:         codes.AlreadyExists,
+	domain.KindInvalidArgument:  codes.InvalidArgument,
+	domain.KindUnauthenticated:  codes.Unauthenticated,
+	domain.KindPermissionDenied: codes.PermissionDenied,
+	domain.KindUnavailable:      codes.Unavailable,
+}
+
+// errorCodes holds the errors gRPC has a more precise code for than the one
+// of their kind
+var errorCodes = map[string]codes.Code{
+	// The client should read the user again and retry
+	"version_conflict": codes.Aborted,
+	// The user's state has to change before the request can succeed
+	"invalid_status_transition": codes.FailedPrecondition,
+}
+
+// Code returns the gRPC code for err: Internal unless it has a kind
+func Code(err error) codes.Code {
+	if code, ok := errorCodes[domain.CodeOf(err)]; ok {
+		return code
+	}
+	if code, ok := kindCodes[domain.KindOf(err)]; ok {
+		return code
+	}
+	return codes.Internal
+}
+
+// Status converts err to a status error. Internal and unavailable errors
+// are logged and described only by their code, so their causes don't leak
+// to clients.
+func Status(err error) error {
+	code, message := Describe(err)
+	st := status.New(code, message)
+	if detailed, detailErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: strings.ToUpper(domain.CodeOf(err)),
+		Domain: Domain,
+	}); detailErr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// Describe returns the code and message to report err with, for responses
+// that list several outcomes, such as batches
+func Describe(err error) (codes.Code, string) {
+	code := Code(err)
+	switch domain.KindOf(err) {
+	case domain.KindInternal:
+		log.Printf("reported as %s: %v", code, err)
+		return code, "internal error"
+	case domain.KindUnavailable:
+		log.Printf("reported as %s: %v", code, err)
+		return code, "service unavailable"
+	}
+	return code, err.Error()
+}
+
+// Reason returns the ErrorInfo reason of a status error in lower case, as
+// the domain names it, or "" if it has none
+func Reason(err error) string {
+	var statusErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &statusErr) {
+		return ""
+	}
+	for _, detail := range statusErr.GRPCStatus().Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == Domain {
+			return strings.ToLower(info.Reason)
+		}
+	}
+	return ""
+}
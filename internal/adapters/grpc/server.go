@@ -1,27 +1,37 @@
 package grpc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
 	"backend-hexagonal/internal/adapters/grpc/middleware"
+	"backend-hexagonal/internal/adapters/grpc/rpcerror"
+	"backend-hexagonal/internal/adapters/http/problem"
 	"backend-hexagonal/internal/service"
 )
 
 type Server struct {
-	grpcServer  *grpc.Server
-	userServer  *UserServer
-	authService *service.AuthService
-	port        string
+	grpcServer      *grpc.Server
+	userServer      *UserServer
+	authService     *service.AuthService
+	authInterceptor *middleware.AuthInterceptor
+	port            string
 }
 
-func NewServer(userService *service.UserService, authService *service.AuthService, port string) *Server {
+func NewServer(userService *service.UserService, authService *service.AuthService, searchService *service.SearchService, preferenceService *service.PreferenceService, port string) *Server {
 	// Create auth interceptor
 	authInterceptor := middleware.NewAuthInterceptor(authService)
 
@@ -32,19 +42,26 @@ func NewServer(userService *service.UserService, authService *service.AuthServic
 	)
 
 	// Create user server
-	userServer := NewUserServer(userService, authService)
+	userServer := NewUserServer(userService, authService, searchService, preferenceService)
 
 	// Enable reflection for testing with tools like grpcurl
 	reflection.Register(grpcServer)
 
 	return &Server{
-		grpcServer:  grpcServer,
-		userServer:  userServer,
-		authService: authService,
-		port:        port,
+		grpcServer:      grpcServer,
+		userServer:      userServer,
+		authService:     authService,
+		authInterceptor: authInterceptor,
+		port:            port,
 	}
 }
 
+// WithUserChanges serves WatchUsers from the changes published on bus
+func (s *Server) WithUserChanges(bus *service.UserChangeBus) *Server {
+	s.userServer.changes = bus
+	return s
+}
+
 func (s *Server) Start() error {
 	// Start HTTP server for gRPC-Web and REST endpoints
 	go s.startHTTPServer()
@@ -68,15 +85,98 @@ func (s *Server) Stop() {
 func (s *Server) startHTTPServer() {
 	httpPort := ":8081" // Different port for HTTP
 
+	log.Printf("gRPC HTTP gateway starting on %s", httpPort)
+	if err := http.ListenAndServe(httpPort, s.HTTPHandler()); err != nil {
+		log.Printf("HTTP server error: %v", err)
+	}
+}
+
+// HTTPHandler returns the REST-like endpoints of the HTTP gateway
+func (s *Server) HTTPHandler() http.Handler {
 	mux := http.NewServeMux()
 
 	// Add REST-like endpoints that call gRPC methods
 	mux.HandleFunc("/grpc/users", s.handleUsers)
+	mux.HandleFunc("/grpc/users/search", s.handleSearchUsers)
+	mux.HandleFunc("/grpc/users/batch/get", s.handleBatchGetUsers)
+	mux.HandleFunc("/grpc/users/batch/delete", s.handleBatchDeleteUsers)
+	mux.HandleFunc("/grpc/users/watch", s.handleWatchUsers)
 	mux.HandleFunc("/grpc/users/", s.handleUserByID)
+	return mux
+}
 
-	log.Printf("gRPC HTTP gateway starting on %s", httpPort)
-	if err := http.ListenAndServe(httpPort, mux); err != nil {
-		log.Printf("HTTP server error: %v", err)
+// authorize authenticates a gateway request the way the interceptors
+// authenticate calls of method, writing the error if it fails
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, method string) (context.Context, bool) {
+	ctx, err := s.authInterceptor.Authorize(r.Context(), r.Header.Get("Authorization"), method)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+	return ctx, true
+}
+
+// handleWatchUsers handles GET for following the changes to users, sending
+// them as newline delimited JSON, one UserChange per line, until the client
+// goes away. The response ends early when the client falls behind.
+func (s *Server) handleWatchUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Only admins may watch other users
+	ctx, ok := s.authorize(w, r, "/user.UserService/WatchUsers")
+	if !ok {
+		return
+	}
+
+	req := &WatchUsersRequest{}
+	for _, v := range r.URL.Query()["ids"] {
+		for _, id := range strings.Split(v, ",") {
+			if id != "" {
+				req.IDs = append(req.IDs, id)
+			}
+		}
+	}
+	subscription, ids, err := s.userServer.subscribeChanges(req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	stream := &gatewayWatchStream{ctx: ctx, w: w}
+	stream.flush()
+
+	if err := s.userServer.sendChanges(subscription, ids, stream); err != nil {
+		log.Printf("watch of user changes ended: %v", err)
+	}
+}
+
+// gatewayWatchStream sends the changes of WatchUsers over an HTTP response
+type gatewayWatchStream struct {
+	ctx context.Context
+	w   http.ResponseWriter
+}
+
+func (s *gatewayWatchStream) Send(change *UserChange) error {
+	if err := json.NewEncoder(s.w).Encode(change); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *gatewayWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *gatewayWatchStream) flush() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
 	}
 }
 
@@ -87,10 +187,15 @@ func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		// List users
-		req := &ListUsersRequest{Page: 1, Limit: 100}
+		req, err := listUsersRequestFromQuery(r.URL.Query())
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
 		resp, err := s.userServer.ListUsers(r.Context(), req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 		json.NewEncoder(w).Encode(resp)
@@ -99,13 +204,13 @@ func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
 		// Create user
 		var req CreateUserRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON")
 			return
 		}
 
 		resp, err := s.userServer.CreateUser(r.Context(), &req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
@@ -113,32 +218,214 @@ func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(resp)
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
-// handleUserByID handles GET for specific user by ID
-func (s *Server) handleUserByID(w http.ResponseWriter, r *http.Request) {
+// listUsersRequestFromQuery maps gateway query parameters onto a
+// ListUsersRequest, using the same names as its JSON fields
+func listUsersRequestFromQuery(values url.Values) (*ListUsersRequest, error) {
+	req := &ListUsersRequest{
+		Page:         1,
+		Limit:        100,
+		PageToken:    values.Get("page_token"),
+		SortBy:       values.Get("sort_by"),
+		Descending:   values.Get("descending") == "true",
+		EmailPrefix:  values.Get("email_prefix"),
+		NameContains: values.Get("name_contains"),
+	}
+
+	for key, target := range map[string]*int32{"page": &req.Page, "limit": &req.Limit} {
+		if v := values.Get(key); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			*target = int32(n)
+		}
+	}
+
+	for key, target := range map[string]**time.Time{"created_after": &req.CreatedAfter, "created_before": &req.CreatedBefore} {
+		if v := values.Get(key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", key)
+			}
+			*target = &t
+		}
+	}
+
+	return req, nil
+}
+
+// handleSearchUsers handles GET for searching users by name and email
+func (s *Server) handleSearchUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	// Extract user ID from URL path
-	userID := r.URL.Path[len("/grpc/users/"):]
-	if userID == "" {
-		http.Error(w, "User ID required", http.StatusBadRequest)
+	req := &SearchUsersRequest{Query: r.URL.Query().Get("q")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		req.Limit = int32(limit)
+	}
+
+	resp, err := s.userServer.SearchUsers(r.Context(), req)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	req := &GetUserRequest{ID: userID}
-	resp, err := s.userServer.GetUser(r.Context(), req)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleBatchGetUsers handles POST for reading several users by ID
+func (s *Server) handleBatchGetUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ctx, ok := s.authorize(w, r, "/user.UserService/BatchGetUsers")
+	if !ok {
+		return
+	}
+
+	var req BatchGetUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	resp, err := s.userServer.BatchGetUsers(ctx, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleBatchDeleteUsers handles POST for deleting several users
+func (s *Server) handleBatchDeleteUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Only admins may delete other users
+	ctx, ok := s.authorize(w, r, "/user.UserService/BatchDeleteUsers")
+	if !ok {
+		return
+	}
+
+	var req BatchDeleteUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	resp, err := s.userServer.BatchDeleteUsers(ctx, &req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(resp)
 }
+
+// handleUserByID handles GET (get) and PUT (update) for specific user by ID
+func (s *Server) handleUserByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Extract user ID from URL path
+	userID := r.URL.Path[len("/grpc/users/"):]
+	if userID == "" {
+		writeProblem(w, r, http.StatusBadRequest, "User ID required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		req := &GetUserRequest{ID: userID}
+		resp, err := s.userServer.GetUser(r.Context(), req)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(resp)
+
+	case http.MethodPut:
+		var req UpdateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		req.ID = userID
+
+		resp, err := s.userServer.UpdateUser(r.Context(), &req)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(resp)
+
+	default:
+		writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// writeError writes the status error of an RPC as problem details
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	writeProblemCode(w, r, httpStatusFromCode(st.Code()), rpcerror.Reason(err), st.Message())
+}
+
+// writeProblem writes problem details for an error the gateway detected
+// itself, such as a body that doesn't parse
+func writeProblem(w http.ResponseWriter, r *http.Request, statusCode int, detail string) {
+	writeProblemCode(w, r, statusCode, "", detail)
+}
+
+func writeProblemCode(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	w.Header().Set("Content-Type", problem.ContentType)
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(problem.New(statusCode, code, detail, r.URL.RequestURI()))
+}
+
+// httpStatusFromCode maps the gRPC codes of the user RPCs to HTTP statuses
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.Aborted:
+		return http.StatusPreconditionFailed
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
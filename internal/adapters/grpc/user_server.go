@@ -4,11 +4,12 @@ import (
 	"context"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"backend-hexagonal/internal/adapters/grpc/rpcerror"
 	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
 	"backend-hexagonal/internal/service"
 )
 
@@ -17,13 +18,32 @@ type User struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
+	Status    string    `json:"status"`
 	CreatedAt time.Time `json:"created_at"`
+	Version   int64     `json:"version"`
+
+	DisplayName string                 `json:"display_name,omitempty"`
+	Locale      string                 `json:"locale,omitempty"`
+	Timezone    string                 `json:"timezone,omitempty"`
+	Phone       string                 `json:"phone,omitempty"`
+	Bio         string                 `json:"bio,omitempty"`
+	Attributes  map[string]interface{} `json:"attributes,omitempty"`
+
+	AvatarURL        string            `json:"avatar_url,omitempty"`
+	AvatarThumbnails map[string]string `json:"avatar_thumbnails,omitempty"`
 }
 
 type CreateUserRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+
+	DisplayName string                 `json:"display_name"`
+	Locale      string                 `json:"locale"`
+	Timezone    string                 `json:"timezone"`
+	Phone       string                 `json:"phone"`
+	Bio         string                 `json:"bio"`
+	Attributes  map[string]interface{} `json:"attributes"`
 }
 
 type CreateUserResponse struct {
@@ -42,24 +62,141 @@ type GetUserResponse struct {
 type ListUsersRequest struct {
 	Page  int32 `json:"page"`
 	Limit int32 `json:"limit"`
+	// PageToken continues from a previous response and takes precedence
+	// over Page
+	PageToken     string     `json:"page_token"`
+	SortBy        string     `json:"sort_by"`
+	Descending    bool       `json:"descending"`
+	EmailPrefix   string     `json:"email_prefix"`
+	NameContains  string     `json:"name_contains"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
 }
 
 type ListUsersResponse struct {
-	Users []*User `json:"users"`
-	Total int32   `json:"total"`
-	Page  int32   `json:"page"`
-	Limit int32   `json:"limit"`
+	Users         []*User `json:"users"`
+	Total         int32   `json:"total"`
+	Page          int32   `json:"page"`
+	Limit         int32   `json:"limit"`
+	NextPageToken string  `json:"next_page_token"`
+}
+
+type UpdateUserRequest struct {
+	ID string `json:"id"`
+	// Empty fields are left unchanged
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	ExpectedVersion int64  `json:"expected_version"`
+
+	// Profile fields are cleared by setting them to ""
+	DisplayName *string `json:"display_name,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+	Timezone    *string `json:"timezone,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+	// Attributes to set; nil values remove an attribute
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type UpdateUserResponse struct {
+	User    *User  `json:"user"`
+	Message string `json:"message"`
+}
+
+type ChangeUserStatusRequest struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type ChangeUserStatusResponse struct {
+	User    *User  `json:"user"`
+	Message string `json:"message"`
+}
+
+type SearchUsersRequest struct {
+	Query string `json:"query"`
+	Limit int32  `json:"limit"`
+}
+
+type SearchResult struct {
+	User  *User   `json:"user"`
+	Score float64 `json:"score"`
+}
+
+type SearchUsersResponse struct {
+	Results []*SearchResult `json:"results"`
+}
+
+type BatchGetUsersRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// BatchUserResult is the outcome for one user of a batch, in the order of
+// the request. Code is OK, or the code the single-user RPC would have
+// failed with.
+type BatchUserResult struct {
+	ID      string     `json:"id"`
+	User    *User      `json:"user,omitempty"`
+	Code    codes.Code `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+type BatchGetUsersResponse struct {
+	Results []*BatchUserResult `json:"results"`
+}
+
+type UserDeletion struct {
+	ID              string `json:"id"`
+	ExpectedVersion int64  `json:"expected_version"`
+}
+
+type BatchDeleteUsersRequest struct {
+	Deletes []*UserDeletion `json:"deletes"`
+}
+
+type BatchDeleteUsersResponse struct {
+	Results []*BatchUserResult `json:"results"`
+}
+
+type WatchUsersRequest struct {
+	// IDs limits the changes to these users; empty watches every user
+	IDs []string `json:"ids"`
+}
+
+type UserChange struct {
+	// Type is created, updated or deleted
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+	// User is the user after the change, unset once they are erased or
+	// purged
+	User       *User     `json:"user,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// WatchUsersStream is the stream WatchUsers sends changes on
+type WatchUsersStream interface {
+	Send(*UserChange) error
+	Context() context.Context
 }
 
+// watchBuffer is how many changes a WatchUsers client may fall behind by
+// before it is ended
+const watchBuffer = 256
+
 type UserServer struct {
-	userService *service.UserService
-	authService *service.AuthService
+	userService       *service.UserService
+	authService       *service.AuthService
+	searchService     *service.SearchService
+	preferenceService *service.PreferenceService
+	changes           *service.UserChangeBus
 }
 
-func NewUserServer(userService *service.UserService, authService *service.AuthService) *UserServer {
+func NewUserServer(userService *service.UserService, authService *service.AuthService, searchService *service.SearchService, preferenceService *service.PreferenceService) *UserServer {
 	return &UserServer{
-		userService: userService,
-		authService: authService,
+		userService:       userService,
+		authService:       authService,
+		searchService:     searchService,
+		preferenceService: preferenceService,
 	}
 }
 
@@ -74,20 +211,23 @@ func (s *UserServer) CreateUser(ctx context.Context, req *CreateUserRequest) (*C
 		Name:     req.Name,
 		Email:    req.Email,
 		Password: req.Password,
+		Profile: domain.Profile{
+			DisplayName: req.DisplayName,
+			Locale:      req.Locale,
+			Timezone:    req.Timezone,
+			Phone:       req.Phone,
+			Bio:         req.Bio,
+		},
+		Attributes: req.Attributes,
 	}
 
 	authResponse, err := s.authService.Register(ctx, registerReq)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, rpcerror.Status(err)
 	}
 
 	// Convert domain user to gRPC user
-	grpcUser := &User{
-		ID:        authResponse.User.ID.Hex(),
-		Name:      authResponse.User.Name,
-		Email:     authResponse.User.Email,
-		CreatedAt: authResponse.User.CreatedAt,
-	}
+	grpcUser := s.toUser(ctx, authResponse.User)
 
 	return &CreateUserResponse{
 		User:    grpcUser,
@@ -101,54 +241,354 @@ func (s *UserServer) GetUser(ctx context.Context, req *GetUserRequest) (*GetUser
 		return nil, status.Error(codes.InvalidArgument, "user ID is required")
 	}
 
-	// Convert string ID to ObjectID
-	objectID, err := primitive.ObjectIDFromHex(req.ID)
+	// Parse the user ID
+	id, err := domain.ParseUserID(req.ID)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "invalid user ID format")
 	}
 
 	// Get user from service
-	domainUser, err := s.userService.GetUserByID(ctx, objectID)
+	domainUser, err := s.userService.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, status.Error(codes.NotFound, "user not found")
+		return nil, rpcerror.Status(err)
 	}
 
 	// Convert domain user to gRPC user
-	grpcUser := &User{
-		ID:        domainUser.ID.Hex(),
-		Name:      domainUser.Name,
-		Email:     domainUser.Email,
-		CreatedAt: domainUser.CreatedAt,
-	}
+	grpcUser := s.toUser(ctx, domainUser)
 
 	return &GetUserResponse{
 		User: grpcUser,
 	}, nil
 }
 
+func (s *UserServer) BatchGetUsers(ctx context.Context, req *BatchGetUsersRequest) (*BatchGetUsersResponse, error) {
+	if len(req.IDs) > service.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d users can be requested at once", service.MaxBatchSize)
+	}
+
+	results := make([]*BatchUserResult, len(req.IDs))
+	ids, positions := parseBatchIDs(req.IDs, results)
+
+	found, err := s.userService.GetUsers(ctx, ids)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+	for j, r := range found {
+		result := results[positions[j]]
+		if r.Err != nil {
+			result.Code, result.Message = rpcerror.Describe(r.Err)
+			continue
+		}
+		result.User = s.toUser(ctx, r.User)
+	}
+
+	return &BatchGetUsersResponse{
+		Results: results,
+	}, nil
+}
+
+func (s *UserServer) BatchDeleteUsers(ctx context.Context, req *BatchDeleteUsersRequest) (*BatchDeleteUsersResponse, error) {
+	if len(req.Deletes) > service.MaxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d users can be deleted at once", service.MaxBatchSize)
+	}
+
+	rawIDs := make([]string, len(req.Deletes))
+	for i, d := range req.Deletes {
+		rawIDs[i] = d.ID
+	}
+	results := make([]*BatchUserResult, len(req.Deletes))
+	ids, positions := parseBatchIDs(rawIDs, results)
+
+	deletes := make([]service.UserDelete, len(ids))
+	for j, id := range ids {
+		deletes[j] = service.UserDelete{ID: id, ExpectedVersion: req.Deletes[positions[j]].ExpectedVersion}
+	}
+
+	deleted, err := s.userService.DeleteUsers(ctx, deletes)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+	for j, r := range deleted {
+		result := results[positions[j]]
+		if r.Err != nil {
+			result.Code, result.Message = rpcerror.Describe(r.Err)
+		}
+	}
+
+	return &BatchDeleteUsersResponse{
+		Results: results,
+	}, nil
+}
+
+// parseBatchIDs creates the result of every item, failing those with an
+// invalid ID, and returns the valid IDs with the position of their item
+func parseBatchIDs(rawIDs []string, results []*BatchUserResult) ([]domain.UserID, []int) {
+	ids := make([]domain.UserID, 0, len(rawIDs))
+	positions := make([]int, 0, len(rawIDs))
+	for i, raw := range rawIDs {
+		results[i] = &BatchUserResult{ID: raw}
+		id, err := domain.ParseUserID(raw)
+		if err != nil {
+			results[i].Code, results[i].Message = codes.InvalidArgument, "invalid user ID format"
+			continue
+		}
+		ids = append(ids, id)
+		positions = append(positions, i)
+	}
+	return ids, positions
+}
+
 func (s *UserServer) ListUsers(ctx context.Context, req *ListUsersRequest) (*ListUsersResponse, error) {
-	// Get all users from service
-	domainUsers, err := s.userService.GetAllUsers(ctx)
+	query := ports.UserQuery{
+		Limit:         int(req.Limit),
+		Cursor:        req.PageToken,
+		SortBy:        sortFieldFromProto(req.SortBy),
+		Descending:    req.Descending,
+		EmailPrefix:   req.EmailPrefix,
+		NameContains:  req.NameContains,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+	}
+
+	// Page numbers are 1-based and only used without a page token
+	if req.PageToken == "" && req.Page > 1 && req.Limit > 0 {
+		query.Offset = int(req.Page-1) * int(req.Limit)
+	}
+
+	// Get a page of users from service
+	page, err := s.userService.ListUsers(ctx, query)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to fetch users")
+		return nil, rpcerror.Status(err)
 	}
 
 	// Convert domain users to gRPC users
 	var grpcUsers []*User
-	for _, domainUser := range domainUsers {
-		grpcUser := &User{
-			ID:        domainUser.ID.Hex(),
-			Name:      domainUser.Name,
-			Email:     domainUser.Email,
-			CreatedAt: domainUser.CreatedAt,
-		}
+	for _, domainUser := range page.Users {
+		grpcUser := s.toUser(ctx, domainUser)
 		grpcUsers = append(grpcUsers, grpcUser)
 	}
 
 	return &ListUsersResponse{
-		Users: grpcUsers,
-		Total: int32(len(grpcUsers)),
-		Page:  req.Page,
-		Limit: req.Limit,
+		Users:         grpcUsers,
+		Total:         int32(page.Total),
+		Page:          req.Page,
+		Limit:         req.Limit,
+		NextPageToken: page.NextCursor,
+	}, nil
+}
+
+func (s *UserServer) SearchUsers(ctx context.Context, req *SearchUsersRequest) (*SearchUsersResponse, error) {
+	results, err := s.searchService.SearchUsers(ctx, req.Query, int(req.Limit))
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	// Convert search results to gRPC results
+	grpcResults := make([]*SearchResult, 0, len(results))
+	for _, result := range results {
+		grpcResults = append(grpcResults, &SearchResult{
+			User:  s.toUser(ctx, result.User),
+			Score: result.Score,
+		})
+	}
+
+	return &SearchUsersResponse{
+		Results: grpcResults,
+	}, nil
+}
+
+func (s *UserServer) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*UpdateUserResponse, error) {
+	// Validate input
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+
+	// Parse the user ID
+	id, err := domain.ParseUserID(req.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID format")
+	}
+
+	patch := domain.UserPatch{
+		DisplayName: req.DisplayName,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+		Phone:       req.Phone,
+		Bio:         req.Bio,
+		Attributes:  req.Attributes,
+		Version:     req.ExpectedVersion,
+	}
+	if req.Name != "" {
+		patch.Name = &req.Name
+	}
+	if req.Email != "" {
+		patch.Email = &req.Email
+	}
+
+	audience := callerAudience(ctx, &domain.User{ID: id})
+	if err := s.userService.AttributeSchema().CheckWritable(patch.Attributes, audience); err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	domainUser, err := s.userService.PatchUser(ctx, id, patch)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	// Convert domain user to gRPC user
+	grpcUser := s.toUser(ctx, domainUser)
+
+	return &UpdateUserResponse{
+		User:    grpcUser,
+		Message: "User updated successfully",
+	}, nil
+}
+
+// WatchUsers streams the changes to users made through any server until the
+// client goes away. A client that falls behind is ended with UNAVAILABLE and
+// may watch again, having missed the changes in between.
+func (s *UserServer) WatchUsers(req *WatchUsersRequest, stream WatchUsersStream) error {
+	subscription, ids, err := s.subscribeChanges(req)
+	if err != nil {
+		return err
+	}
+	defer subscription.Close()
+	return s.sendChanges(subscription, ids, stream)
+}
+
+// subscribeChanges checks a WatchUsers request and subscribes to the
+// changes, returning the users to send the changes of, or none for all
+func (s *UserServer) subscribeChanges(req *WatchUsersRequest) (*service.UserChangeSubscription, map[domain.UserID]bool, error) {
+	if s.changes == nil {
+		return nil, nil, status.Error(codes.Unimplemented, "user changes are not followed by this server")
+	}
+
+	ids := make(map[domain.UserID]bool, len(req.IDs))
+	for _, rawID := range req.IDs {
+		id, err := domain.ParseUserID(rawID)
+		if err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, "invalid user ID format")
+		}
+		ids[id] = true
+	}
+	return s.changes.Subscribe(watchBuffer), ids, nil
+}
+
+// sendChanges sends the changes of a subscription to the users in ids, or
+// to any user if ids is empty, until the stream's context is done
+func (s *UserServer) sendChanges(subscription *service.UserChangeSubscription, ids map[domain.UserID]bool, stream WatchUsersStream) error {
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case change, ok := <-subscription.C:
+			if !ok {
+				return rpcerror.Status(subscription.Err())
+			}
+			if len(ids) > 0 && !ids[change.UserID] {
+				continue
+			}
+			if err := stream.Send(s.toUserChange(ctx, change)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *UserServer) toUserChange(ctx context.Context, change domain.UserChange) *UserChange {
+	c := &UserChange{
+		Type:       string(change.Type),
+		UserID:     change.UserID.String(),
+		OccurredAt: change.OccurredAt,
+	}
+	if change.User != nil {
+		c.User = s.toUser(ctx, change.User)
+	}
+	return c
+}
+
+// toUser converts a domain user to a gRPC user, keeping only the custom
+// attributes the caller may read
+func (s *UserServer) toUser(ctx context.Context, user *domain.User) *User {
+	u := &User{
+		ID:          user.ID.String(),
+		Name:        user.Name,
+		Email:       user.Email,
+		Status:      string(user.CurrentStatus()),
+		CreatedAt:   user.CreatedAt,
+		Version:     user.Version,
+		DisplayName: user.DisplayName,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		Phone:       user.Phone,
+		Bio:         user.Bio,
+		Attributes:  s.userService.AttributeSchema().Visible(user.Attributes, callerAudience(ctx, user)),
+	}
+	if user.Avatar != nil {
+		u.AvatarURL = user.Avatar.URL
+		u.AvatarThumbnails = user.Avatar.Thumbnails
+	}
+	return u
+}
+
+// callerAudience returns how the authenticated caller relates to the user.
+// Calls through the HTTP gateway are unauthenticated and see public
+// attributes only.
+func callerAudience(ctx context.Context, user *domain.User) domain.Audience {
+	callerID, _ := ctx.Value("user_id").(domain.UserID)
+	roles, _ := ctx.Value("roles").([]string)
+	return domain.AudienceFor(callerID, roles, user)
+}
+
+// sortFieldFromProto maps the snake_case sort_by values of the proto onto
+// repository sort fields
+func sortFieldFromProto(sortBy string) ports.UserSortField {
+	if sortBy == "created_at" {
+		return ports.SortByCreatedAt
+	}
+	return ports.UserSortField(sortBy)
+}
+
+func (s *UserServer) SuspendUser(ctx context.Context, req *ChangeUserStatusRequest) (*ChangeUserStatusResponse, error) {
+	return s.changeUserStatus(ctx, req, domain.UserStatusSuspended, "User suspended successfully")
+}
+
+func (s *UserServer) DeactivateUser(ctx context.Context, req *ChangeUserStatusRequest) (*ChangeUserStatusResponse, error) {
+	return s.changeUserStatus(ctx, req, domain.UserStatusDeactivated, "User deactivated successfully")
+}
+
+func (s *UserServer) ReactivateUser(ctx context.Context, req *ChangeUserStatusRequest) (*ChangeUserStatusResponse, error) {
+	return s.changeUserStatus(ctx, req, domain.UserStatusActive, "User reactivated successfully")
+}
+
+func (s *UserServer) changeUserStatus(ctx context.Context, req *ChangeUserStatusRequest, newStatus domain.UserStatus, message string) (*ChangeUserStatusResponse, error) {
+	// Validate input
+	if req.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+
+	// Parse the user ID
+	id, err := domain.ParseUserID(req.ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid user ID format")
+	}
+
+	// Admins can't lock themselves out
+	if currentUserID, ok := ctx.Value("user_id").(domain.UserID); ok && currentUserID == id {
+		return nil, status.Error(codes.FailedPrecondition, "cannot change the status of your own account")
+	}
+
+	domainUser, err := s.userService.ChangeUserStatus(ctx, id, newStatus, req.Reason)
+	if err != nil {
+		return nil, rpcerror.Status(err)
+	}
+
+	// Convert domain user to gRPC user
+	grpcUser := s.toUser(ctx, domainUser)
+
+	return &ChangeUserStatusResponse{
+		User:    grpcUser,
+		Message: message,
 	}, nil
 }
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AdminHandler struct {
+	userService *service.UserService
+}
+
+type ChangeStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+func NewAdminHandler(userService *service.UserService) *AdminHandler {
+	return &AdminHandler{
+		userService: userService,
+	}
+}
+
+func (h *AdminHandler) SuspendUser(c *fiber.Ctx) error {
+	return h.changeStatus(c, domain.UserStatusSuspended)
+}
+
+func (h *AdminHandler) DeactivateUser(c *fiber.Ctx) error {
+	return h.changeStatus(c, domain.UserStatusDeactivated)
+}
+
+func (h *AdminHandler) ReactivateUser(c *fiber.Ctx) error {
+	return h.changeStatus(c, domain.UserStatusActive)
+}
+
+func (h *AdminHandler) changeStatus(c *fiber.Ctx, status domain.UserStatus) error {
+	idParam := c.Params("id")
+	id, err := domain.ParseUserID(idParam)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Admins can't lock themselves out
+	if currentUserID, ok := c.Locals("user_id").(domain.UserID); ok && currentUserID == id {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Cannot change the status of your own account")
+	}
+
+	var req ChangeStatusRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+
+	user, err := h.userService.ChangeUserStatus(c.Context(), id, status, req.Reason)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	// Remove password from response
+	user.Password = ""
+	return c.JSON(user)
+}
+
+func (h *AdminHandler) ListDeletedUsers(c *fiber.Ctx) error {
+	users, err := h.userService.GetDeletedUsers(c.Context())
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	// Remove passwords from response
+	for _, user := range users {
+		user.Password = ""
+	}
+
+	return c.JSON(users)
+}
+
+func (h *AdminHandler) RestoreUser(c *fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := domain.ParseUserID(idParam)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	user, err := h.userService.RestoreUser(c.Context(), id)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	// Remove password from response
+	user.Password = ""
+	return c.JSON(user)
+}
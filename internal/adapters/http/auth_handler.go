@@ -1,6 +1,7 @@
 package http
 
 import (
+	"backend-hexagonal/internal/adapters/http/problem"
 	"backend-hexagonal/internal/domain"
 	"backend-hexagonal/internal/service"
 
@@ -20,16 +21,12 @@ func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req domain.RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
 	}
 
 	response, err := h.authService.Register(c.Context(), &req)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem.Write(c, err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(response)
@@ -38,16 +35,12 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req domain.AuthRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
 	}
 
 	response, err := h.authService.Login(c.Context(), &req)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem.Write(c, err)
 	}
 
 	return c.JSON(response)
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"path"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AvatarHandler struct {
+	avatarService *service.AvatarService
+	schema        *domain.AttributeSchema
+}
+
+func NewAvatarHandler(avatarService *service.AvatarService, schema *domain.AttributeSchema) *AvatarHandler {
+	return &AvatarHandler{
+		avatarService: avatarService,
+		schema:        schema,
+	}
+}
+
+// UploadMe handles PUT /users/me/avatar. The image is the request body, or
+// the "avatar" field of a multipart form.
+func (h *AvatarHandler) UploadMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+
+	var image io.Reader = bytes.NewReader(c.Body())
+	if mediaType(c.Get(fiber.HeaderContentType)) == fiber.MIMEMultipartForm {
+		header, err := c.FormFile("avatar")
+		if err != nil {
+			return problem.WriteStatus(c, fiber.StatusBadRequest, "The multipart form must have an avatar file")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid avatar file")
+		}
+		defer file.Close()
+		image = file
+	}
+
+	user, err := h.avatarService.UploadAvatar(c.Context(), userID, image)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	return h.writeUser(c, user)
+}
+
+// DeleteMe handles DELETE /users/me/avatar
+func (h *AvatarHandler) DeleteMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+
+	user, err := h.avatarService.DeleteAvatar(c.Context(), userID)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	return h.writeUser(c, user)
+}
+
+// ServeBlob handles GET /media/*, serving stored images to clients. Keys
+// change whenever an avatar does, so responses can be cached indefinitely.
+func (h *AvatarHandler) ServeBlob(c *fiber.Ctx) error {
+	key := c.Params("*")
+
+	blob, err := h.avatarService.GetBlob(c.Context(), key)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = fiber.MIMEOctetStream
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.Send(data)
+}
+
+// writeUser sends the user with their ETag, like UserHandler does
+func (h *AvatarHandler) writeUser(c *fiber.Ctx, user *domain.User) error {
+	c.Set(fiber.HeaderETag, userETag(user))
+	presentUser(c, h.schema, user)
+	return c.JSON(user)
+}
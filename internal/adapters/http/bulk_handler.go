@@ -0,0 +1,95 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+type BulkHandler struct {
+	bulkService *service.BulkService
+}
+
+func NewBulkHandler(bulkService *service.BulkService) *BulkHandler {
+	return &BulkHandler{
+		bulkService: bulkService,
+	}
+}
+
+// Import handles POST /admin/users/import?format=&dryRun=. The format
+// defaults to the one named by the Content-Type. The report is JSON, or a
+// CSV of the failed records when the client accepts text/csv.
+func (h *BulkHandler) Import(c *fiber.Ctx) error {
+	name := c.Query("format")
+	if name == "" {
+		switch mediaType(c.Get(fiber.HeaderContentType)) {
+		case mimeCSV:
+			name = string(service.BulkFormatCSV)
+		case mimeNDJSON, "application/ndjson":
+			name = string(service.BulkFormatNDJSON)
+		}
+	}
+	format, err := service.ParseBulkFormat(name)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	report, err := h.bulkService.ImportUsers(c.Context(), bytes.NewReader(c.Body()), service.ImportOptions{
+		Format: format,
+		DryRun: c.QueryBool("dryRun"),
+	})
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	if c.Accepts(fiber.MIMEApplicationJSON, mimeCSV) == mimeCSV {
+		var buf bytes.Buffer
+		if err := report.WriteCSV(&buf); err != nil {
+			return problem.Write(c, err)
+		}
+		c.Set(fiber.HeaderContentType, mimeCSV)
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="import-report.csv"`)
+		return c.Send(buf.Bytes())
+	}
+	return c.JSON(report)
+}
+
+// Export handles GET /admin/users/export?format=, streaming every user as
+// NDJSON (the default) or CSV
+func (h *BulkHandler) Export(c *fiber.Ctx) error {
+	format, err := service.ParseBulkFormat(c.Query("format", string(service.BulkFormatNDJSON)))
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	contentType, filename := mimeNDJSON, "users.ndjson"
+	if format == service.BulkFormatCSV {
+		contentType, filename = mimeCSV, "users.csv"
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+
+	// The writer runs after the handler returns, when the request context
+	// is no longer valid. A failure can only truncate the response.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		err := h.bulkService.ExportUsers(context.Background(), w, service.ExportOptions{Format: format})
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Printf("user export failed: %v", err)
+		}
+	})
+	return nil
+}
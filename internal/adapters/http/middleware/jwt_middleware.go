@@ -3,6 +3,7 @@ package middleware
 import (
 	"strings"
 
+	"backend-hexagonal/internal/adapters/http/problem"
 	"backend-hexagonal/internal/service"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,37 +14,30 @@ func JWTMiddleware(authService *service.AuthService) fiber.Handler {
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing authorization header",
-			})
+			return problem.WriteStatus(c, fiber.StatusUnauthorized, "Missing authorization header")
 		}
 
 		// Check if it starts with "Bearer "
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization header format",
-			})
+			return problem.WriteStatus(c, fiber.StatusUnauthorized, "Invalid authorization header format")
 		}
 
 		// Extract token
 		token := strings.TrimPrefix(authHeader, "Bearer ")
 		if token == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing token",
-			})
+			return problem.WriteStatus(c, fiber.StatusUnauthorized, "Missing token")
 		}
 
-		// Validate token
-		claims, err := authService.ValidateToken(token)
+		// Validate token and check the account is still active
+		claims, err := authService.Authenticate(c.Context(), token)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
-			})
+			return problem.Write(c, err)
 		}
 
 		// Store user info in context
 		c.Locals("user_id", claims.UserID)
 		c.Locals("email", claims.Email)
+		c.Locals("roles", claims.Roles)
 
 		return c.Next()
 	}
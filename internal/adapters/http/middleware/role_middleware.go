@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"backend-hexagonal/internal/adapters/http/problem"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole only admits users whose token carries the given role. It must
+// run after JWTMiddleware.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		roles, _ := c.Locals("roles").([]string)
+		for _, r := range roles {
+			if r == role {
+				return c.Next()
+			}
+		}
+
+		return problem.WriteStatus(c, fiber.StatusForbidden, "Insufficient permissions")
+	}
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"encoding/json"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PreferenceHandler struct {
+	preferenceService *service.PreferenceService
+}
+
+func NewPreferenceHandler(preferenceService *service.PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{
+		preferenceService: preferenceService,
+	}
+}
+
+// GetMe handles GET /users/me/preferences/:namespace, returning the
+// namespace's defaults with the current user's settings merged over them
+func (h *PreferenceHandler) GetMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+
+	values, err := h.preferenceService.GetPreferences(c.Context(), userID, c.Params("namespace"))
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	return c.JSON(values)
+}
+
+// ReplaceMe handles PUT /users/me/preferences/:namespace with a JSON object
+// of every setting the user sets
+func (h *PreferenceHandler) ReplaceMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+
+	values, ok := preferencesBody(c)
+	if !ok {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "The preferences must be a JSON object")
+	}
+
+	resolved, err := h.preferenceService.ReplacePreferences(c.Context(), userID, c.Params("namespace"), values)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	return c.JSON(resolved)
+}
+
+// PatchMe handles PATCH /users/me/preferences/:namespace with a JSON Merge
+// Patch (RFC 7396) of the user's settings
+func (h *PreferenceHandler) PatchMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+
+	switch mediaType(c.Get(fiber.HeaderContentType)) {
+	case mergePatchContentType, fiber.MIMEApplicationJSON:
+	default:
+		c.Set("Accept-Patch", mergePatchContentType)
+		return problem.WriteStatus(c, fiber.StatusUnsupportedMediaType, "Use "+mergePatchContentType)
+	}
+
+	patch, ok := preferencesBody(c)
+	if !ok {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "The patch must be a JSON object")
+	}
+
+	resolved, err := h.preferenceService.PatchPreferences(c.Context(), userID, c.Params("namespace"), patch)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	return c.JSON(resolved)
+}
+
+// preferencesBody decodes a request body that must be a JSON object
+func preferencesBody(c *fiber.Ctx) (map[string]interface{}, bool) {
+	var values map[string]interface{}
+	if err := json.Unmarshal(c.Body(), &values); err != nil || values == nil {
+		return nil, false
+	}
+	return values, true
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PrivacyHandler struct {
+	privacyService *service.PrivacyService
+}
+
+func NewPrivacyHandler(privacyService *service.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+	}
+}
+
+// ExportMe returns a zip archive of everything held about the current user
+func (h *PrivacyHandler) ExportMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+
+	var archive bytes.Buffer
+	if err := h.privacyService.ExportUserData(c.Context(), userID, &archive); err != nil {
+		return problem.Write(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="user-%s-export.zip"`, userID.String()))
+	return c.Send(archive.Bytes())
+}
+
+// EraseMe erases the current user at their own request
+func (h *PrivacyHandler) EraseMe(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(domain.UserID)
+	return h.erase(c, userID, userID)
+}
+
+// EraseUser erases a user on behalf of a data-subject request
+func (h *PrivacyHandler) EraseUser(c *fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := domain.ParseUserID(idParam)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	requestedBy := c.Locals("user_id").(domain.UserID)
+	return h.erase(c, id, requestedBy)
+}
+
+func (h *PrivacyHandler) erase(c *fiber.Ctx, id, requestedBy domain.UserID) error {
+	tombstone, err := h.privacyService.EraseUser(c.Context(), id, requestedBy)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	return c.JSON(tombstone)
+}
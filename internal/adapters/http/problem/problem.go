@@ -0,0 +1,124 @@
+// Package problem writes errors as RFC 7807 problem details, choosing the
+// status code from the error's domain.ErrorKind so every handler reports
+// the same error the same way.
+package problem
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"backend-hexagonal/internal/domain"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ContentType is the media type of problem details responses
+const ContentType = "application/problem+json"
+
+// Details is an RFC 7807 problem details object. Code is an extension
+// member naming the specific error, such as "email_taken".
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
+
+var kindStatus = map[domain.ErrorKind]int{
+	domain.KindNotFound:         fiber.StatusNotFound,
+	domain.KindConflict:         fiber.StatusConflict,
+	domain.KindInvalidArgument:  fiber.StatusBadRequest,
+	domain.KindUnauthenticated:  fiber.StatusUnauthorized,
+	domain.KindPermissionDenied: fiber.StatusForbidden,
+	domain.KindUnavailable:      fiber.StatusServiceUnavailable,
+}
+
+// codeStatus holds the errors HTTP has a more precise status for than the
+// one of their kind
+var codeStatus = map[string]int{
+	// Versions are compared because of If-Match
+	"version_conflict": fiber.StatusPreconditionFailed,
+	// Well-formed requests for entities that break the domain rules
+	"invalid_user":        fiber.StatusUnprocessableEntity,
+	"invalid_preferences": fiber.StatusUnprocessableEntity,
+	"invalid_image":       fiber.StatusUnprocessableEntity,
+	"avatar_too_large":    fiber.StatusRequestEntityTooLarge,
+	"unsupported_image":   fiber.StatusUnsupportedMediaType,
+}
+
+// Status returns the status code for err: 500 unless it has a kind
+func Status(err error) int {
+	if status, ok := codeStatus[domain.CodeOf(err)]; ok {
+		return status
+	}
+	if status, ok := kindStatus[domain.KindOf(err)]; ok {
+		return status
+	}
+	return fiber.StatusInternalServerError
+}
+
+// Write responds with the problem for err. Internal and unavailable errors
+// are logged and described only by their status, so their causes don't
+// leak to clients.
+func Write(c *fiber.Ctx, err error) error {
+	status := Status(err)
+	if hidden(err) {
+		log.Printf("%s %s: %v", c.Method(), c.Path(), err)
+		return send(c, status, domain.CodeOf(err), "")
+	}
+	return send(c, status, domain.CodeOf(err), err.Error())
+}
+
+// Describe returns the status and message to report err with in responses
+// that list several outcomes, such as batches, hiding causes like Write
+func Describe(err error) (int, string) {
+	status := Status(err)
+	if hidden(err) {
+		log.Printf("reported as %d: %v", status, err)
+		return status, http.StatusText(status)
+	}
+	return status, err.Error()
+}
+
+func hidden(err error) bool {
+	kind := domain.KindOf(err)
+	return kind == domain.KindInternal || kind == domain.KindUnavailable
+}
+
+// WriteStatus responds with a problem the handler detected itself, such as
+// a body that doesn't parse
+func WriteStatus(c *fiber.Ctx, status int, detail string) error {
+	return send(c, status, "", detail)
+}
+
+// ErrorHandler is a fiber.Config ErrorHandler. It writes the errors that
+// handlers return rather than respond with, including fiber's own such as
+// unknown routes, as problems.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return send(c, fiberErr.Code, "", fiberErr.Message)
+	}
+	return Write(c, err)
+}
+
+// New returns the problem details of a response with the status, for
+// servers other than fiber that answer with problems too
+func New(status int, code, detail, instance string) Details {
+	return Details{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+	}
+}
+
+func send(c *fiber.Ctx, status int, code, detail string) error {
+	c.Status(status)
+	return c.JSON(New(status, code, detail, c.OriginalURL()), ContentType)
+}
@@ -2,13 +2,15 @@ package http
 
 import (
 	"backend-hexagonal/internal/adapters/http/middleware"
+	"backend-hexagonal/internal/adapters/http/scim"
 	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/domain"
 	"backend-hexagonal/internal/service"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func RegisterRoutes(app *fiber.App, userHandler *UserHandler, authHandler *AuthHandler, authService *service.AuthService) {
+func RegisterRoutes(app *fiber.App, userHandler *UserHandler, authHandler *AuthHandler, adminHandler *AdminHandler, privacyHandler *PrivacyHandler, searchHandler *SearchHandler, avatarHandler *AvatarHandler, bulkHandler *BulkHandler, preferenceHandler *PreferenceHandler, authService *service.AuthService) {
 	// Apply logging middleware to all routes
 	if config.IsJSONLogging() {
 		app.Use(middleware.JSONLoggingMiddleware())
@@ -23,6 +25,9 @@ func RegisterRoutes(app *fiber.App, userHandler *UserHandler, authHandler *AuthH
 	app.Get("/health", healthHandler.Health)
 	app.Get("/ready", healthHandler.Ready)
 
+	// Stored images such as avatars (no auth required)
+	app.Get("/media/*", avatarHandler.ServeBlob)
+
 	api := app.Group("/api/v1")
 
 	// Public auth routes
@@ -34,9 +39,58 @@ func RegisterRoutes(app *fiber.App, userHandler *UserHandler, authHandler *AuthH
 	users := api.Group("/users")
 	users.Use(middleware.JWTMiddleware(authService)) // Apply JWT middleware to all user routes
 	users.Get("/me", userHandler.GetMe)
+	users.Get("/me/export", privacyHandler.ExportMe)
+	users.Post("/me/erase", privacyHandler.EraseMe)
+	users.Put("/me/avatar", avatarHandler.UploadMe)
+	users.Delete("/me/avatar", avatarHandler.DeleteMe)
+	users.Get("/me/preferences/:namespace", preferenceHandler.GetMe)
+	users.Put("/me/preferences/:namespace", preferenceHandler.ReplaceMe)
+	users.Patch("/me/preferences/:namespace", preferenceHandler.PatchMe)
+	users.Get("/search", searchHandler.SearchUsers)
+	users.Get("/attributes", userHandler.Attributes)
+	users.Post("/batch/get", userHandler.BatchGet)
+	users.Post("/batch/update", userHandler.BatchUpdate)
+	// Like the gRPC BatchDeleteUsers, deleting other users in bulk is for admins
+	users.Post("/batch/delete", middleware.RequireRole(domain.RoleAdmin), userHandler.BatchDelete)
 	users.Post("/", userHandler.Create)
 	users.Get("/", userHandler.List)
 	users.Get("/:id", userHandler.Get)
 	users.Put("/:id", userHandler.Update)
+	users.Patch("/:id", userHandler.Patch)
 	users.Delete("/:id", userHandler.Delete)
+
+	// Admin-only account management routes
+	admin := api.Group("/admin")
+	admin.Use(middleware.JWTMiddleware(authService))
+	admin.Use(middleware.RequireRole(domain.RoleAdmin))
+	admin.Post("/users/:id/suspend", adminHandler.SuspendUser)
+	admin.Post("/users/:id/deactivate", adminHandler.DeactivateUser)
+	admin.Post("/users/:id/reactivate", adminHandler.ReactivateUser)
+	admin.Get("/users/deleted", adminHandler.ListDeletedUsers)
+	admin.Post("/users/:id/restore", adminHandler.RestoreUser)
+	admin.Post("/users/:id/erase", privacyHandler.EraseUser)
+	admin.Post("/users/import", bulkHandler.Import)
+	admin.Get("/users/export", bulkHandler.Export)
+}
+
+// RegisterSCIMRoutes exposes the SCIM 2.0 provisioning API, authenticated
+// with the provisioning client's bearer token
+func RegisterSCIMRoutes(app *fiber.App, scimHandler *scim.Handler, token string) {
+	v2 := app.Group("/scim/v2")
+	v2.Use(scim.BearerAuth(token))
+
+	// Discovery endpoints
+	v2.Get("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+	v2.Get("/ResourceTypes", scimHandler.ResourceTypes)
+	v2.Get("/ResourceTypes/:id", scimHandler.ResourceType)
+	v2.Get("/Schemas", scimHandler.Schemas)
+	v2.Get("/Schemas/:id", scimHandler.Schema)
+
+	// User provisioning
+	v2.Get("/Users", scimHandler.ListUsers)
+	v2.Post("/Users", scimHandler.CreateUser)
+	v2.Get("/Users/:id", scimHandler.GetUser)
+	v2.Put("/Users/:id", scimHandler.ReplaceUser)
+	v2.Patch("/Users/:id", scimHandler.PatchUser)
+	v2.Delete("/Users/:id", scimHandler.DeleteUser)
 }
@@ -0,0 +1,27 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BearerAuth only admits requests carrying the provisioning client's token
+func BearerAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="scim"`)
+			return writeError(c, newError(fiber.StatusUnauthorized, "", "Missing bearer token"))
+		}
+
+		provided := strings.TrimPrefix(authHeader, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="scim", error="invalid_token"`)
+			return writeError(c, newError(fiber.StatusUnauthorized, "", "Invalid bearer token"))
+		}
+
+		return c.Next()
+	}
+}
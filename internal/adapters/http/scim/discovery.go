@@ -0,0 +1,210 @@
+package scim
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+type supported struct {
+	Supported bool `json:"supported"`
+}
+
+type filterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type bulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type authenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+type serviceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 supported              `json:"patch"`
+	Bulk                  bulkSupport            `json:"bulk"`
+	Filter                filterSupport          `json:"filter"`
+	ChangePassword        supported              `json:"changePassword"`
+	Sort                  supported              `json:"sort"`
+	ETag                  supported              `json:"etag"`
+	AuthenticationSchemes []authenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+type resourceType struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Endpoint    string   `json:"endpoint"`
+	Description string   `json:"description"`
+	Schema      string   `json:"schema"`
+	Meta        Meta     `json:"meta"`
+}
+
+type attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Description   string      `json:"description"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []attribute `json:"subAttributes,omitempty"`
+}
+
+type schema struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []attribute `json:"attributes"`
+	Meta        Meta        `json:"meta"`
+}
+
+func stringAttribute(name, description, mutability, uniqueness string, required bool) attribute {
+	return attribute{
+		Name:        name,
+		Type:        "string",
+		Description: description,
+		Required:    required,
+		Mutability:  mutability,
+		Returned:    "default",
+		Uniqueness:  uniqueness,
+	}
+}
+
+// userSchemaDefinition describes the subset of the core User schema this
+// service stores
+var userSchemaDefinition = schema{
+	Schemas:     []string{SchemaSchema},
+	ID:          UserSchema,
+	Name:        "User",
+	Description: "User Account",
+	Attributes: []attribute{
+		stringAttribute("userName", "Unique identifier for the User, always the user's email address.", "readWrite", "server", true),
+		{
+			Name:        "name",
+			Type:        "complex",
+			Description: "The components of the user's name.",
+			Mutability:  "readWrite",
+			Returned:    "default",
+			Uniqueness:  "none",
+			SubAttributes: []attribute{
+				stringAttribute("formatted", "The full name.", "readWrite", "none", false),
+				stringAttribute("givenName", "The given name, combined with familyName on write.", "writeOnly", "none", false),
+				stringAttribute("familyName", "The family name, combined with givenName on write.", "writeOnly", "none", false),
+			},
+		},
+		stringAttribute("displayName", "The name of the User, suitable for display to end-users.", "readWrite", "none", false),
+		{
+			Name:        "emails",
+			Type:        "complex",
+			MultiValued: true,
+			Description: "Email addresses for the user. Only the primary value is stored.",
+			Mutability:  "readWrite",
+			Returned:    "default",
+			Uniqueness:  "none",
+			SubAttributes: []attribute{
+				stringAttribute("value", "Email address.", "readWrite", "none", false),
+				stringAttribute("type", "A label indicating the email's function.", "readWrite", "none", false),
+				{Name: "primary", Type: "boolean", Description: "Indicates the primary email.", Mutability: "readWrite", Returned: "default", Uniqueness: "none"},
+			},
+		},
+		{
+			Name:        "active",
+			Type:        "boolean",
+			Description: "The user's administrative status. Setting it to false suspends the account.",
+			Mutability:  "readWrite",
+			Returned:    "default",
+			Uniqueness:  "none",
+		},
+		{
+			Name:        "password",
+			Type:        "string",
+			Description: "The user's initial password. Only accepted on creation.",
+			Mutability:  "writeOnly",
+			Returned:    "never",
+			Uniqueness:  "none",
+		},
+	},
+	Meta: Meta{ResourceType: "Schema", Location: basePath + "/Schemas/" + UserSchema},
+}
+
+var userResourceTypeDefinition = resourceType{
+	Schemas:     []string{ResourceTypeSchema},
+	ID:          userResourceType,
+	Name:        userResourceType,
+	Endpoint:    "/Users",
+	Description: "User Account",
+	Schema:      UserSchema,
+	Meta:        Meta{ResourceType: "ResourceType", Location: basePath + "/ResourceTypes/" + userResourceType},
+}
+
+// ServiceProviderConfig describes the SCIM features this service supports
+func (h *Handler) ServiceProviderConfig(c *fiber.Ctx) error {
+	return c.JSON(serviceProviderConfig{
+		Schemas:        []string{ServiceProviderConfigSchema},
+		Patch:          supported{Supported: true},
+		Bulk:           bulkSupport{Supported: false},
+		Filter:         filterSupport{Supported: true, MaxResults: maxCount},
+		ChangePassword: supported{Supported: false},
+		Sort:           supported{Supported: false},
+		ETag:           supported{Supported: true},
+		AuthenticationSchemes: []authenticationScheme{
+			{
+				Type:        "oauthbearertoken",
+				Name:        "OAuth Bearer Token",
+				Description: "Authentication using the provisioning client's bearer token",
+				Primary:     true,
+			},
+		},
+		Meta: Meta{ResourceType: "ServiceProviderConfig", Location: basePath + "/ServiceProviderConfig"},
+	}, ContentType)
+}
+
+// ResourceTypes lists the resource types exposed over SCIM
+func (h *Handler) ResourceTypes(c *fiber.Ctx) error {
+	return c.JSON(ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: 1,
+		StartIndex:   1,
+		ItemsPerPage: 1,
+		Resources:    []resourceType{userResourceTypeDefinition},
+	}, ContentType)
+}
+
+// ResourceType returns a single resource type by ID
+func (h *Handler) ResourceType(c *fiber.Ctx) error {
+	if c.Params("id") != userResourceType {
+		return writeError(c, newError(fiber.StatusNotFound, "", "Resource type not found"))
+	}
+	return c.JSON(userResourceTypeDefinition, ContentType)
+}
+
+// Schemas lists the schemas exposed over SCIM
+func (h *Handler) Schemas(c *fiber.Ctx) error {
+	return c.JSON(ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: 1,
+		StartIndex:   1,
+		ItemsPerPage: 1,
+		Resources:    []schema{userSchemaDefinition},
+	}, ContentType)
+}
+
+// Schema returns a single schema by URN
+func (h *Handler) Schema(c *fiber.Ctx) error {
+	if c.Params("id") != UserSchema {
+		return writeError(c, newError(fiber.StatusNotFound, "", "Schema not found"))
+	}
+	return c.JSON(userSchemaDefinition, ContentType)
+}
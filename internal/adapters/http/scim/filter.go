@@ -0,0 +1,623 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"backend-hexagonal/internal/ports"
+)
+
+// Filter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2)
+type Filter interface {
+	Match(resource map[string]interface{}) bool
+}
+
+// ErrInvalidFilter is wrapped by every filter and path parse error
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// ParseFilter parses a SCIM filter such as `userName eq "bjensen"` or
+// `emails[type eq "work" and value co "@example.com"]`
+func ParseFilter(input string) (Filter, error) {
+	p, err := newParser(input)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return f, nil
+}
+
+// Path is a parsed PATCH operation path: attr[filter].sub
+type Path struct {
+	Attr   string
+	Filter Filter
+	Sub    string
+}
+
+// ParsePath parses a SCIM PATCH path such as `name.givenName` or
+// `emails[type eq "work"].value`
+func ParsePath(input string) (*Path, error) {
+	p, err := newParser(input)
+	if err != nil {
+		return nil, err
+	}
+	if p.done() || p.peek().kind != tokenWord {
+		return nil, p.errorf("missing attribute path")
+	}
+
+	attr, sub := splitAttrPath(p.next().text)
+	path := &Path{Attr: attr, Sub: sub}
+
+	if p.accept(tokenLBracket) {
+		if sub != "" {
+			return nil, p.errorf("value filter must follow a top level attribute")
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(tokenRBracket) {
+			return nil, p.errorf("missing ]")
+		}
+		path.Filter = f
+
+		if !p.done() {
+			tok := p.next()
+			if tok.kind != tokenWord || !strings.HasPrefix(tok.text, ".") || len(tok.text) < 2 {
+				return nil, p.errorf("unexpected %q", tok.text)
+			}
+			path.Sub = tok.text[1:]
+		}
+	}
+
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return path, nil
+}
+
+// splitAttrPath splits "name.givenName" into its attribute and
+// sub-attribute after removing any core schema URN prefix
+func splitAttrPath(path string) (string, string) {
+	path = stripSchemaPrefix(path)
+	if i := strings.Index(path, "."); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case r == '[':
+			tokens = append(tokens, token{tokenLBracket, "["})
+			i++
+		case r == ']':
+			tokens = append(tokens, token{tokenRBracket, "]"})
+			i++
+		case r == '"':
+			// Find the closing quote, honouring backslash escapes, and let
+			// strconv decode the JSON-compatible escape sequences
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == '\\' {
+					j++
+					continue
+				}
+				if runes[j] == '"' {
+					break
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			value, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, string(runes[i:j+1]))
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()[]"`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenWord, string(runes[i:j])})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	input  string
+	tokens []token
+	pos    int
+}
+
+func newParser(input string) (*parser, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{input: input, tokens: tokens}, nil
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *parser) accept(kind tokenKind) bool {
+	if !p.done() && p.peek().kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if !p.done() && p.peek().kind == tokenWord && strings.EqualFold(p.peek().text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s in %q", ErrInvalidFilter, fmt.Sprintf(format, args...), p.input)
+}
+
+// parseOr handles the lowest precedence operator
+func (p *parser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Filter, error) {
+	if p.done() {
+		return nil, p.errorf("unexpected end of filter")
+	}
+
+	if p.acceptKeyword("not") {
+		if !p.accept(tokenLParen) {
+			return nil, p.errorf("not must be followed by (")
+		}
+		inner, err := p.parseGroupTail()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{inner}, nil
+	}
+
+	if p.accept(tokenLParen) {
+		return p.parseGroupTail()
+	}
+
+	return p.parseAttrExp()
+}
+
+// parseGroupTail parses the contents of a parenthesised group after the
+// opening parenthesis has been consumed
+func (p *parser) parseGroupTail() (Filter, error) {
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(tokenRParen) {
+		return nil, p.errorf("missing )")
+	}
+	return inner, nil
+}
+
+func (p *parser) parseAttrExp() (Filter, error) {
+	tok := p.next()
+	if tok.kind != tokenWord {
+		return nil, p.errorf("expected attribute path, got %q", tok.text)
+	}
+	attr, sub := splitAttrPath(tok.text)
+
+	if p.accept(tokenLBracket) {
+		if sub != "" {
+			return nil, p.errorf("value filter must follow a top level attribute")
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(tokenRBracket) {
+			return nil, p.errorf("missing ]")
+		}
+		return valuePathFilter{attr: attr, filter: inner}, nil
+	}
+
+	if p.done() || p.peek().kind != tokenWord {
+		return nil, p.errorf("missing operator after %q", tok.text)
+	}
+	op := strings.ToLower(p.next().text)
+
+	if op == "pr" {
+		return presentFilter{attr: attr, sub: sub}, nil
+	}
+	if !isComparisonOperator(op) {
+		return nil, p.errorf("unknown operator %q", op)
+	}
+
+	if p.done() {
+		return nil, p.errorf("missing value after %q", op)
+	}
+	value, err := parseLiteral(p.next())
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+
+	return compareFilter{attr: attr, sub: sub, op: op, value: value}, nil
+}
+
+func isComparisonOperator(op string) bool {
+	switch op {
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+		return true
+	}
+	return false
+}
+
+func parseLiteral(tok token) (interface{}, error) {
+	if tok.kind == tokenString {
+		return tok.text, nil
+	}
+	if tok.kind != tokenWord {
+		return nil, fmt.Errorf("expected value, got %q", tok.text)
+	}
+
+	switch strings.ToLower(tok.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	n, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", tok.text)
+	}
+	return n, nil
+}
+
+// narrowQuery translates as much of filter as the user repository can
+// evaluate into a listing query. exact reports whether the query selects
+// exactly the users filter matches; otherwise it selects more, and filter
+// must still be applied to them.
+func narrowQuery(filter Filter) (query ports.UserQuery, exact bool) {
+	switch f := filter.(type) {
+	case nil:
+		return query, true
+
+	case compareFilter:
+		value, ok := f.value.(string)
+		if !ok {
+			return query, false
+		}
+		switch {
+		case isEmailAttribute(f.attr, f.sub) && (f.op == "sw" || f.op == "eq"):
+			query.EmailPrefix = value
+			return query, f.op == "sw"
+		case isNameAttribute(f.attr, f.sub) && (f.op == "co" || f.op == "sw" || f.op == "ew" || f.op == "eq"):
+			query.NameContains = value
+			return query, f.op == "co"
+		}
+
+	case andFilter:
+		left, leftExact := narrowQuery(f.left)
+		right, rightExact := narrowQuery(f.right)
+		if (left.EmailPrefix != "" && right.EmailPrefix != "") || (left.NameContains != "" && right.NameContains != "") {
+			return left, false
+		}
+		if right.EmailPrefix != "" {
+			left.EmailPrefix = right.EmailPrefix
+		}
+		if right.NameContains != "" {
+			left.NameContains = right.NameContains
+		}
+		return left, leftExact && rightExact
+	}
+
+	return query, false
+}
+
+// isEmailAttribute reports whether attr.sub holds the user's email, which
+// is also their userName
+func isEmailAttribute(attr, sub string) bool {
+	return (strings.EqualFold(attr, "userName") && sub == "") ||
+		(strings.EqualFold(attr, "emails") && (sub == "" || strings.EqualFold(sub, "value")))
+}
+
+// isNameAttribute reports whether attr.sub holds the user's full name
+func isNameAttribute(attr, sub string) bool {
+	return (strings.EqualFold(attr, "displayName") && sub == "") ||
+		(strings.EqualFold(attr, "name") && strings.EqualFold(sub, "formatted"))
+}
+
+type andFilter struct{ left, right Filter }
+
+func (f andFilter) Match(r map[string]interface{}) bool {
+	return f.left.Match(r) && f.right.Match(r)
+}
+
+type orFilter struct{ left, right Filter }
+
+func (f orFilter) Match(r map[string]interface{}) bool {
+	return f.left.Match(r) || f.right.Match(r)
+}
+
+type notFilter struct{ inner Filter }
+
+func (f notFilter) Match(r map[string]interface{}) bool {
+	return !f.inner.Match(r)
+}
+
+type presentFilter struct{ attr, sub string }
+
+func (f presentFilter) Match(r map[string]interface{}) bool {
+	for _, v := range resolve(r, f.attr, f.sub) {
+		if !isEmpty(v) {
+			return true
+		}
+	}
+	return false
+}
+
+type valuePathFilter struct {
+	attr   string
+	filter Filter
+}
+
+func (f valuePathFilter) Match(r map[string]interface{}) bool {
+	for _, elem := range elements(lookup(r, f.attr)) {
+		if m, ok := elem.(map[string]interface{}); ok && f.filter.Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+type compareFilter struct {
+	attr, sub string
+	op        string
+	value     interface{}
+}
+
+func (f compareFilter) Match(r map[string]interface{}) bool {
+	values := resolve(r, f.attr, f.sub)
+
+	if f.op == "ne" {
+		// ne matches when no value of the attribute equals the operand
+		for _, v := range values {
+			if compare(f.attr, v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, v := range values {
+		if compare(f.attr, v, f.op, f.value) {
+			return true
+		}
+	}
+	if len(values) == 0 && f.op == "eq" && f.value == nil {
+		return true
+	}
+	return false
+}
+
+// compare applies a single comparison between an attribute value and the
+// filter operand, following the attribute's JSON type
+func compare(attr string, actual interface{}, op string, operand interface{}) bool {
+	switch want := operand.(type) {
+	case nil:
+		return op == "eq" && isEmpty(actual)
+
+	case bool:
+		got, ok := actual.(bool)
+		return ok && op == "eq" && got == want
+
+	case float64:
+		got, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		return compareOrdered(op, got-want)
+
+	case string:
+		got, ok := actual.(string)
+		if !ok {
+			return false
+		}
+
+		// Timestamps are compared chronologically rather than lexically
+		if isOrdering(op) {
+			if gt, err := time.Parse(time.RFC3339, got); err == nil {
+				if wt, err := time.Parse(time.RFC3339, want); err == nil {
+					return compareOrdered(op, float64(gt.Sub(wt)))
+				}
+			}
+		}
+
+		// Only "id" is caseExact among the attributes this service exposes
+		if !strings.EqualFold(attr, "id") {
+			got = strings.ToLower(got)
+			want = strings.ToLower(want)
+		}
+
+		switch op {
+		case "eq":
+			return got == want
+		case "co":
+			return strings.Contains(got, want)
+		case "sw":
+			return strings.HasPrefix(got, want)
+		case "ew":
+			return strings.HasSuffix(got, want)
+		default:
+			return compareOrdered(op, float64(strings.Compare(got, want)))
+		}
+	}
+
+	return false
+}
+
+func isOrdering(op string) bool {
+	return op == "gt" || op == "ge" || op == "lt" || op == "le"
+}
+
+func compareOrdered(op string, diff float64) bool {
+	switch op {
+	case "eq":
+		return diff == 0
+	case "gt":
+		return diff > 0
+	case "ge":
+		return diff >= 0
+	case "lt":
+		return diff < 0
+	case "le":
+		return diff <= 0
+	}
+	return false
+}
+
+// lookup returns the value of an attribute using case-insensitive names,
+// as required by RFC 7643 section 2.1
+func lookup(m map[string]interface{}, name string) interface{} {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// elements flattens a possibly multi-valued attribute into a slice
+func elements(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// resolve returns every value addressed by attr.sub. A complex attribute
+// referenced without a sub-attribute resolves to its "value" sub-attribute.
+func resolve(r map[string]interface{}, attr, sub string) []interface{} {
+	var values []interface{}
+	for _, elem := range elements(lookup(r, attr)) {
+		m, isComplex := elem.(map[string]interface{})
+		switch {
+		case sub != "" && isComplex:
+			values = append(values, elements(lookup(m, sub))...)
+		case sub != "":
+			// A simple attribute has no sub-attributes
+		case isComplex:
+			values = append(values, elements(lookup(m, "value"))...)
+		default:
+			values = append(values, elem)
+		}
+	}
+	return values
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
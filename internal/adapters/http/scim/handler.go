@@ -0,0 +1,426 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+)
+
+// Handler exposes UserService as SCIM 2.0 /Users resources
+type Handler struct {
+	userService *service.UserService
+}
+
+func NewHandler(userService *service.UserService) *Handler {
+	return &Handler{
+		userService: userService,
+	}
+}
+
+// ListUsers handles GET /Users with filter, startIndex and count
+func (h *Handler) ListUsers(c *fiber.Ctx) error {
+	var filter Filter
+	if expr := c.Query("filter"); expr != "" {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			return writeError(c, newError(fiber.StatusBadRequest, "invalidFilter", err.Error()))
+		}
+		filter = f
+	}
+
+	// startIndex is 1-based; values below 1 are treated as 1 (RFC 7644 3.4.2.4)
+	startIndex := c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := c.QueryInt("count", defaultCount)
+	if count < 0 {
+		count = 0
+	}
+	if count > maxCount {
+		count = maxCount
+	}
+
+	page, total, err := h.listUsers(c.Context(), filter, startIndex, count)
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	return c.JSON(ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}, ContentType)
+}
+
+// listUsers returns up to count users matching filter from the 1-based
+// startIndex on, and how many match in all. The repository pages through
+// the users, filtering them as far as narrowQuery can express filter; the
+// rest of it is applied to each page.
+func (h *Handler) listUsers(ctx context.Context, filter Filter, startIndex, count int) ([]*User, int, error) {
+	query, exact := narrowQuery(filter)
+	query.Limit = service.MaxListLimit
+	if exact {
+		// The repository counts and skips the matches itself
+		query.Offset = startIndex - 1
+	}
+
+	resources := []*User{}
+	total := 0
+	for {
+		page, err := h.userService.ListUsers(ctx, query)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, user := range page.Users {
+			resource := toResource(user)
+			if !exact {
+				m, err := toMap(resource)
+				if err != nil {
+					return nil, 0, newError(fiber.StatusInternalServerError, "", "Failed to evaluate filter")
+				}
+				if !filter.Match(m) {
+					continue
+				}
+				total++
+				if total < startIndex {
+					continue
+				}
+			}
+			if len(resources) < count {
+				resources = append(resources, resource)
+			}
+		}
+
+		if exact {
+			total = int(page.Total)
+			if len(resources) >= count {
+				return resources, total, nil
+			}
+		}
+		if page.NextCursor == "" {
+			return resources, total, nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// GetUser handles GET /Users/:id
+func (h *Handler) GetUser(c *fiber.Ctx) error {
+	user, err := h.lookupUser(c)
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	tag := etag(user)
+	if c.Get(fiber.HeaderIfNoneMatch) == tag {
+		c.Set(fiber.HeaderETag, tag)
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return h.writeUser(c, fiber.StatusOK, user)
+}
+
+// CreateUser handles POST /Users
+func (h *Handler) CreateUser(c *fiber.Ctx) error {
+	var req User
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request body"))
+	}
+	if req.UserName == "" {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidValue", "userName is required"))
+	}
+	name, email, err := attributesFrom(&req)
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	// Clients may provision accounts up front and enable them later
+	var status domain.UserStatus
+	if req.Active != nil {
+		status = activeStatus(*req.Active)
+	}
+
+	user, err := h.userService.ProvisionUser(c.Context(), name, email, req.Password, status, provisioningReason)
+	if err != nil {
+		if errors.Is(err, service.ErrUserExists) {
+			return writeError(c, newError(fiber.StatusConflict, "uniqueness", "userName is already taken"))
+		}
+		return writeError(c, err)
+	}
+
+	c.Location(basePath + "/Users/" + user.ID.String())
+	return h.writeUser(c, fiber.StatusCreated, user)
+}
+
+// ReplaceUser handles PUT /Users/:id
+func (h *Handler) ReplaceUser(c *fiber.Ctx) error {
+	user, err := h.lookupUser(c)
+	if err != nil {
+		return writeError(c, err)
+	}
+	if err := checkPrecondition(c, user); err != nil {
+		return writeError(c, err)
+	}
+
+	var req User
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request body"))
+	}
+	if req.UserName == "" {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidValue", "userName is required"))
+	}
+	if err := checkUnsupported(&req); err != nil {
+		return writeError(c, err)
+	}
+
+	name, email, err := attributesFrom(&req)
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	return h.saveUser(c, user, name, email, req.Active)
+}
+
+// PatchUser handles PATCH /Users/:id
+func (h *Handler) PatchUser(c *fiber.Ctx) error {
+	user, err := h.lookupUser(c)
+	if err != nil {
+		return writeError(c, err)
+	}
+	if err := checkPrecondition(c, user); err != nil {
+		return writeError(c, err)
+	}
+
+	var req PatchRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidSyntax", "Invalid request body"))
+	}
+	if !containsSchema(req.Schemas, PatchOpSchema) {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidSyntax", "Missing PatchOp schema"))
+	}
+
+	original := toResource(user)
+	resource, err := toMap(original)
+	if err != nil {
+		return writeError(c, newError(fiber.StatusInternalServerError, "", "Failed to apply patch"))
+	}
+
+	if err := ApplyPatch(resource, req.Operations); err != nil {
+		var patchErr *PatchError
+		if errors.As(err, &patchErr) {
+			return writeError(c, newError(fiber.StatusBadRequest, patchErr.ScimType, patchErr.Detail))
+		}
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidValue", err.Error()))
+	}
+
+	patched, err := fromMap(resource)
+	if err != nil {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidValue", "Patched resource is not a valid User"))
+	}
+
+	if patched.ID != original.ID || !sameMeta(patched.Meta, original.Meta) {
+		return writeError(c, newError(fiber.StatusBadRequest, "mutability", "id and meta are read-only"))
+	}
+	if err := checkUnsupported(patched); err != nil {
+		return writeError(c, err)
+	}
+
+	name, email := changedAttributes(original, patched)
+	return h.saveUser(c, user, name, email, patched.Active)
+}
+
+// DeleteUser handles DELETE /Users/:id, which deprovisions the account
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	user, err := h.lookupUser(c)
+	if err != nil {
+		return writeError(c, err)
+	}
+	if err := checkPrecondition(c, user); err != nil {
+		return writeError(c, err)
+	}
+
+	// The user must still be at the version If-Match was checked against
+	if err := h.userService.DeleteUserAtVersion(c.Context(), user.ID, user.Version); err != nil {
+		return writeError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// lookupUser loads the user named by the :id route parameter
+func (h *Handler) lookupUser(c *fiber.Ctx) (*domain.User, error) {
+	id, err := domain.ParseUserID(c.Params("id"))
+	if err != nil {
+		return nil, newError(fiber.StatusNotFound, "", "User not found")
+	}
+
+	user, err := h.userService.GetUserByID(c.Context(), id)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return nil, newError(fiber.StatusNotFound, "", "User not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// saveUser persists a new name, email and active flag in one transaction,
+// enforcing email uniqueness. The user must still be at the version the
+// request was checked and applied against, or it fails with 412.
+func (h *Handler) saveUser(c *fiber.Ctx, user *domain.User, name, email string, active *bool) error {
+	if name == "" || email == "" {
+		return writeError(c, newError(fiber.StatusBadRequest, "invalidValue", "userName and a name are required"))
+	}
+
+	var status domain.UserStatus
+	if active != nil && *active != user.IsActive() {
+		status = activeStatus(*active)
+	}
+
+	updated, err := h.userService.ReplaceProvisionedUser(c.Context(), user.ID, user.Version, name, email, status, provisioningReason)
+	switch {
+	case errors.Is(err, service.ErrUserExists):
+		return writeError(c, newError(fiber.StatusConflict, "uniqueness", "userName is already taken"))
+	case errors.Is(err, service.ErrInvalidStatusTransition):
+		return writeError(c, newError(fiber.StatusBadRequest, "mutability", err.Error()))
+	case err != nil:
+		return writeError(c, err)
+	}
+	return h.writeUser(c, fiber.StatusOK, updated)
+}
+
+// activeStatus maps the SCIM active flag onto the account status. Inactive
+// accounts are suspended rather than deactivated so that the client can
+// enable them again.
+func activeStatus(active bool) domain.UserStatus {
+	if active {
+		return domain.UserStatusActive
+	}
+	return domain.UserStatusSuspended
+}
+
+func (h *Handler) writeUser(c *fiber.Ctx, status int, user *domain.User) error {
+	c.Set(fiber.HeaderETag, etag(user))
+	return c.Status(status).JSON(toResource(user), ContentType)
+}
+
+// checkPrecondition enforces If-Match against the current ETag
+func checkPrecondition(c *fiber.Ctx, user *domain.User) error {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+
+	current := etag(user)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == current {
+			return nil
+		}
+	}
+	return newError(fiber.StatusPreconditionFailed, "", "Resource version does not match If-Match")
+}
+
+// checkUnsupported rejects writes to attributes this service cannot change
+func checkUnsupported(u *User) error {
+	if u.Password != "" {
+		return newError(fiber.StatusBadRequest, "mutability", "Password changes are not supported")
+	}
+	return nil
+}
+
+// attributesFrom extracts the stored name and email from a full resource
+func attributesFrom(u *User) (string, string, error) {
+	email := u.email()
+	if email == "" {
+		return "", "", newError(fiber.StatusBadRequest, "invalidValue", "An email is required")
+	}
+	if !strings.EqualFold(email, u.UserName) {
+		return "", "", newError(fiber.StatusBadRequest, "invalidValue", "userName must match the primary email")
+	}
+	return u.displayName(), email, nil
+}
+
+// changedAttributes works out the stored name and email after a patch.
+// The same value is exposed through several SCIM attributes, so whichever
+// one the client changed wins.
+func changedAttributes(original, patched *User) (string, string) {
+	name := original.DisplayName
+	switch {
+	case patched.DisplayName != original.DisplayName && patched.DisplayName != "":
+		name = patched.DisplayName
+	case patched.Name != nil && patched.Name.Formatted != original.Name.Formatted && patched.Name.Formatted != "":
+		name = patched.Name.Formatted
+	case patched.Name != nil && (patched.Name.GivenName != "" || patched.Name.FamilyName != ""):
+		name = strings.TrimSpace(patched.Name.GivenName + " " + patched.Name.FamilyName)
+	}
+
+	email := original.UserName
+	if patched.UserName != original.UserName {
+		email = patched.UserName
+	} else if e := patched.email(); e != original.UserName {
+		email = e
+	}
+
+	return name, email
+}
+
+func sameMeta(a, b *Meta) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func containsSchema(schemas []string, want string) bool {
+	for _, s := range schemas {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// scimError is an error that carries its SCIM response status and type
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func newError(status int, scimType, detail string) *scimError {
+	return &scimError{status: status, scimType: scimType, detail: detail}
+}
+
+func (e *scimError) Error() string {
+	return e.detail
+}
+
+// writeError writes err as a SCIM error response. Errors that did not
+// originate in this package get the status of their kind, like the rest of
+// the API.
+func writeError(c *fiber.Ctx, err error) error {
+	var se *scimError
+	if !errors.As(err, &se) {
+		status, detail := problem.Describe(err)
+		se = newError(status, "", detail)
+	}
+
+	return c.Status(se.status).JSON(Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(se.status),
+		ScimType: se.scimType,
+		Detail:   se.detail,
+	}, ContentType)
+}
@@ -0,0 +1,221 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PatchRequest is the body of a SCIM PATCH request (RFC 7644 section 3.5.2)
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, replace or remove operation
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// PatchError reports why an operation could not be applied, using the
+// scimType values from RFC 7644 section 3.12
+type PatchError struct {
+	ScimType string
+	Detail   string
+}
+
+func (e *PatchError) Error() string {
+	return e.Detail
+}
+
+func patchErrorf(scimType, format string, args ...interface{}) *PatchError {
+	return &PatchError{ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// ApplyPatch applies the operations in order to a generic resource map
+func ApplyPatch(resource map[string]interface{}, ops []PatchOperation) error {
+	for _, op := range ops {
+		if err := applyOperation(resource, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyOperation(resource map[string]interface{}, op PatchOperation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return patchErrorf("invalidSyntax", "unsupported patch op %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return patchErrorf("noTarget", "remove requires a path")
+		}
+
+		// Without a path the value is an object whose keys are paths
+		values, ok := op.Value.(map[string]interface{})
+		if !ok {
+			return patchErrorf("invalidValue", "%s without a path requires an object value", op.Op)
+		}
+		for key, value := range values {
+			sub := PatchOperation{Op: kind, Path: key, Value: value}
+			if err := applyOperation(resource, sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := ParsePath(op.Path)
+	if err != nil {
+		if errors.Is(err, ErrInvalidFilter) {
+			return patchErrorf("invalidPath", "%v", err)
+		}
+		return err
+	}
+	if kind != "remove" && op.Value == nil {
+		return patchErrorf("invalidValue", "%s on %q requires a value", op.Op, op.Path)
+	}
+
+	if path.Filter != nil {
+		return applyFiltered(resource, kind, path, op.Value)
+	}
+	if path.Sub != "" {
+		return applySubAttribute(resource, kind, path, op.Value)
+	}
+	return applyAttribute(resource, kind, path.Attr, op.Value)
+}
+
+// applyAttribute handles a path naming a top level attribute
+func applyAttribute(resource map[string]interface{}, kind, attr string, value interface{}) error {
+	key := resolveKey(resource, attr)
+
+	switch kind {
+	case "remove":
+		delete(resource, key)
+
+	case "add":
+		existing := resource[key]
+		if list, ok := existing.([]interface{}); ok {
+			resource[key] = append(list, elements(value)...)
+			return nil
+		}
+		if current, ok := existing.(map[string]interface{}); ok {
+			if incoming, ok := value.(map[string]interface{}); ok {
+				mergeInto(current, incoming)
+				return nil
+			}
+		}
+		resource[key] = value
+
+	case "replace":
+		resource[key] = value
+	}
+	return nil
+}
+
+// applySubAttribute handles paths such as name.givenName
+func applySubAttribute(resource map[string]interface{}, kind string, path *Path, value interface{}) error {
+	key := resolveKey(resource, path.Attr)
+
+	switch existing := resource[key].(type) {
+	case nil:
+		if kind == "remove" {
+			return nil
+		}
+		resource[key] = map[string]interface{}{path.Sub: value}
+
+	case map[string]interface{}:
+		setSubAttribute(existing, kind, path.Sub, value)
+
+	case []interface{}:
+		// A sub-attribute of a multi-valued attribute applies to every value
+		for _, elem := range existing {
+			if m, ok := elem.(map[string]interface{}); ok {
+				setSubAttribute(m, kind, path.Sub, value)
+			}
+		}
+
+	default:
+		return patchErrorf("invalidPath", "%q has no sub-attributes", path.Attr)
+	}
+	return nil
+}
+
+// applyFiltered handles value selection paths such as emails[type eq "work"]
+func applyFiltered(resource map[string]interface{}, kind string, path *Path, value interface{}) error {
+	key := resolveKey(resource, path.Attr)
+	list := elements(resource[key])
+
+	var kept []interface{}
+	matched := false
+	for _, elem := range list {
+		m, ok := elem.(map[string]interface{})
+		if !ok || !path.Filter.Match(m) {
+			kept = append(kept, elem)
+			continue
+		}
+		matched = true
+
+		switch {
+		case path.Sub != "":
+			setSubAttribute(m, kind, path.Sub, value)
+			kept = append(kept, m)
+		case kind == "remove":
+			// Drop the matching value
+		default:
+			incoming, ok := value.(map[string]interface{})
+			if !ok {
+				return patchErrorf("invalidValue", "value for %q must be an object", path.Attr)
+			}
+			if kind == "replace" {
+				m = map[string]interface{}{}
+			}
+			mergeInto(m, incoming)
+			kept = append(kept, m)
+		}
+	}
+
+	if !matched {
+		return patchErrorf("noTarget", "no value of %q matches the filter", path.Attr)
+	}
+
+	if len(kept) == 0 {
+		delete(resource, key)
+	} else {
+		resource[key] = kept
+	}
+	return nil
+}
+
+func setSubAttribute(m map[string]interface{}, kind, sub string, value interface{}) {
+	key := resolveKey(m, sub)
+	if kind == "remove" {
+		delete(m, key)
+		return
+	}
+	m[key] = value
+}
+
+func mergeInto(dst, src map[string]interface{}) {
+	for k, v := range src {
+		dst[resolveKey(dst, k)] = v
+	}
+}
+
+// resolveKey returns the existing key matching name case-insensitively so
+// that patches never create duplicate attributes differing only in case
+func resolveKey(m map[string]interface{}, name string) string {
+	if _, ok := m[name]; ok {
+		return name
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
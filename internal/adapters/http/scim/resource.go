@@ -0,0 +1,185 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-hexagonal/internal/domain"
+)
+
+// Schema URNs defined by RFC 7643 and RFC 7644
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ResourceTypeSchema          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+)
+
+// ContentType is the media type of SCIM request and response bodies
+const ContentType = "application/scim+json"
+
+const (
+	basePath         = "/scim/v2"
+	userResourceType = "User"
+	workEmailType    = "work"
+	defaultCount     = 100
+	maxCount         = 200
+
+	// provisioningReason is recorded on status changes made over SCIM
+	provisioningReason = "Changed by SCIM provisioning"
+)
+
+// Name is the SCIM complex "name" attribute
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is a single value of the SCIM multi-valued "emails" attribute
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// Meta is the SCIM resource metadata
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+	Version      string `json:"version,omitempty"`
+}
+
+// User is the SCIM representation of a domain user
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// ListResponse wraps query results
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// Error is the SCIM error response body
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// toResource converts a domain user to its SCIM representation
+func toResource(user *domain.User) *User {
+	active := user.IsActive()
+	created := user.CreatedAt.UTC().Format(time.RFC3339)
+	id := user.ID.String()
+
+	return &User{
+		Schemas:     []string{UserSchema},
+		ID:          id,
+		UserName:    user.Email,
+		Name:        &Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails: []Email{
+			{Value: user.Email, Type: workEmailType, Primary: true},
+		},
+		Active: &active,
+		Meta: &Meta{
+			ResourceType: userResourceType,
+			Created:      created,
+			LastModified: created,
+			Location:     basePath + "/Users/" + id,
+			Version:      etag(user),
+		},
+	}
+}
+
+// etag returns the entity tag of the user's current version, the same one
+// the REST API sends
+func etag(user *domain.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// displayName picks the best human readable name from a SCIM user
+func (u *User) displayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name == nil {
+		return ""
+	}
+	if u.Name.Formatted != "" {
+		return u.Name.Formatted
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+// email picks the primary email of a SCIM user, falling back to userName
+func (u *User) email() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return u.UserName
+}
+
+// toMap returns the generic JSON object form of a resource, which is what
+// filters and patch operations are evaluated against
+func toMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fromMap converts a generic JSON object back into a SCIM user
+func fromMap(m map[string]interface{}) (*User, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var u User
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// stripSchemaPrefix removes the core User schema URN from a fully
+// qualified attribute path
+func stripSchemaPrefix(path string) string {
+	prefix := UserSchema + ":"
+	if len(path) > len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+		return path[len(prefix):]
+	}
+	return path
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SearchHandler struct {
+	searchService *service.SearchService
+	schema        *domain.AttributeSchema
+}
+
+type SearchResult struct {
+	User  *domain.User `json:"user"`
+	Score float64      `json:"score"`
+}
+
+type SearchUsersResponse struct {
+	Results []*SearchResult `json:"results"`
+}
+
+// NewSearchHandler creates a SearchHandler. The schema decides which custom
+// attributes of the results each caller can read.
+func NewSearchHandler(searchService *service.SearchService, schema *domain.AttributeSchema) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+		schema:        schema,
+	}
+}
+
+// SearchUsers handles GET /users/search?q=&limit=
+func (h *SearchHandler) SearchUsers(c *fiber.Ctx) error {
+	results, err := h.searchService.SearchUsers(c.Context(), c.Query("q"), c.QueryInt("limit"))
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	response := SearchUsersResponse{Results: make([]*SearchResult, 0, len(results))}
+	for _, result := range results {
+		// Remove password and hidden attributes from response
+		presentUser(c, h.schema, result.User)
+		response.Results = append(response.Results, &SearchResult{
+			User:  result.User,
+			Score: result.Score,
+		})
+	}
+
+	return c.JSON(response)
+}
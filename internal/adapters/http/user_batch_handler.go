@@ -0,0 +1,250 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gofiber/fiber/v2"
+)
+
+type BatchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type BatchUpdateItem struct {
+	ID string `json:"id"`
+	// Version, unless zero, is the version the user must be at, like an
+	// If-Match header
+	Version int64 `json:"version"`
+	// Patch is a JSON Merge Patch object or a JSON Patch array
+	Patch json.RawMessage `json:"patch"`
+}
+
+type BatchUpdateRequest struct {
+	Updates []BatchUpdateItem `json:"updates"`
+}
+
+type BatchDeleteItem struct {
+	ID      string `json:"id"`
+	Version int64  `json:"version"`
+}
+
+type BatchDeleteRequest struct {
+	Deletes []BatchDeleteItem `json:"deletes"`
+}
+
+// BatchItemResult is the outcome of one item of a batch, with the status
+// code the single-user endpoint would have answered
+type BatchItemResult struct {
+	ID     string       `json:"id"`
+	Status int          `json:"status"`
+	User   *domain.User `json:"user,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// BatchResponse lists the item results in the order of the request
+type BatchResponse struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+// BatchGet handles POST /users/batch/get
+func (h *UserHandler) BatchGet(c *fiber.Ctx) error {
+	var req BatchGetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.IDs) > service.MaxBatchSize {
+		return writeBatchTooLarge(c)
+	}
+
+	results := make([]BatchItemResult, len(req.IDs))
+	ids, positions := parseBatchIDs(req.IDs, results)
+
+	found, err := h.userService.GetUsers(c.Context(), ids)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	for j, r := range found {
+		result := &results[positions[j]]
+		if r.Err != nil {
+			result.Status, result.Error = problem.Describe(r.Err)
+			continue
+		}
+		presentUser(c, h.userService.AttributeSchema(), r.User)
+		result.Status, result.User = fiber.StatusOK, r.User
+	}
+	return c.JSON(BatchResponse{Results: results})
+}
+
+// BatchUpdate handles POST /users/batch/update. Each patch applies to its
+// user like PATCH /users/:id, and the valid ones are written together.
+func (h *UserHandler) BatchUpdate(c *fiber.Ctx) error {
+	var req BatchUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Updates) > service.MaxBatchSize {
+		return writeBatchTooLarge(c)
+	}
+
+	results := make([]BatchItemResult, len(req.Updates))
+	rawIDs := make([]string, len(req.Updates))
+	for i, item := range req.Updates {
+		rawIDs[i] = item.ID
+	}
+	ids, positions := parseBatchIDs(rawIDs, results)
+
+	found, err := h.userService.GetUsers(c.Context(), ids)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	var updates []service.UserUpdate
+	var updatePositions []int
+	for j, r := range found {
+		i := positions[j]
+		result := &results[i]
+		if r.Err != nil {
+			result.Status, result.Error = fiber.StatusNotFound, "User not found"
+			continue
+		}
+		patch, status, message := h.batchPatch(c, r.User, req.Updates[i])
+		if status != 0 {
+			result.Status, result.Error = status, message
+			continue
+		}
+		updates = append(updates, service.UserUpdate{ID: r.ID, Patch: patch})
+		updatePositions = append(updatePositions, i)
+	}
+
+	updated, err := h.userService.PatchUsers(c.Context(), updates)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	for j, r := range updated {
+		result := &results[updatePositions[j]]
+		if r.Err != nil {
+			result.Status, result.Error = problem.Describe(r.Err)
+			continue
+		}
+		presentUser(c, h.userService.AttributeSchema(), r.User)
+		result.Status, result.User = fiber.StatusOK, r.User
+	}
+	return c.JSON(BatchResponse{Results: results})
+}
+
+// batchPatch turns one item of a batch update into a patch of the user,
+// or returns the status and error message to report for it instead
+func (h *UserHandler) batchPatch(c *fiber.Ctx, user *domain.User, item BatchUpdateItem) (domain.UserPatch, int, string) {
+	if item.Version != 0 && item.Version != user.Version {
+		status, message := problem.Describe(ports.ErrVersionConflict)
+		return domain.UserPatch{}, status, message
+	}
+
+	// Patches apply to the user as the caller sees them
+	presentUser(c, h.userService.AttributeSchema(), user)
+	original, err := json.Marshal(user)
+	if err != nil {
+		status, message := problem.Describe(err)
+		return domain.UserPatch{}, status, message
+	}
+
+	var patched []byte
+	switch body := bytes.TrimSpace(item.Patch); {
+	case len(body) > 0 && body[0] == '{':
+		patched, err = jsonpatch.MergePatch(original, body)
+	case len(body) > 0 && body[0] == '[':
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(body)
+		if err == nil {
+			patched, err = ops.Apply(original)
+		}
+	default:
+		return domain.UserPatch{}, fiber.StatusBadRequest, "Invalid patch: use a merge patch object or a JSON Patch array"
+	}
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return domain.UserPatch{}, fiber.StatusConflict, err.Error()
+		}
+		return domain.UserPatch{}, fiber.StatusBadRequest, "Invalid patch: " + err.Error()
+	}
+
+	patch, err := userPatchFrom(original, patched)
+	if err != nil {
+		return domain.UserPatch{}, fiber.StatusUnprocessableEntity, err.Error()
+	}
+	if err := h.userService.AttributeSchema().CheckWritable(patch.Attributes, callerAudience(c, user)); err != nil {
+		status, message := problem.Describe(err)
+		return domain.UserPatch{}, status, message
+	}
+
+	patch.Version = item.Version
+	return patch, 0, ""
+}
+
+// BatchDelete handles POST /users/batch/delete
+func (h *UserHandler) BatchDelete(c *fiber.Ctx) error {
+	var req BatchDeleteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Deletes) > service.MaxBatchSize {
+		return writeBatchTooLarge(c)
+	}
+
+	results := make([]BatchItemResult, len(req.Deletes))
+	rawIDs := make([]string, len(req.Deletes))
+	for i, item := range req.Deletes {
+		rawIDs[i] = item.ID
+	}
+	ids, positions := parseBatchIDs(rawIDs, results)
+
+	deletes := make([]service.UserDelete, len(ids))
+	for j, id := range ids {
+		deletes[j] = service.UserDelete{ID: id, ExpectedVersion: req.Deletes[positions[j]].Version}
+	}
+
+	deleted, err := h.userService.DeleteUsers(c.Context(), deletes)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	for j, r := range deleted {
+		result := &results[positions[j]]
+		if r.Err != nil {
+			result.Status, result.Error = problem.Describe(r.Err)
+			continue
+		}
+		result.Status = fiber.StatusNoContent
+	}
+	return c.JSON(BatchResponse{Results: results})
+}
+
+// parseBatchIDs fills in the result of every item with an invalid ID and
+// returns the valid IDs with the position of their item
+func parseBatchIDs(rawIDs []string, results []BatchItemResult) ([]domain.UserID, []int) {
+	ids := make([]domain.UserID, 0, len(rawIDs))
+	positions := make([]int, 0, len(rawIDs))
+	for i, raw := range rawIDs {
+		results[i].ID = raw
+		id, err := domain.ParseUserID(raw)
+		if err != nil {
+			results[i].Status, results[i].Error = fiber.StatusBadRequest, "Invalid user ID"
+			continue
+		}
+		ids = append(ids, id)
+		positions = append(positions, i)
+	}
+	return ids, positions
+}
+
+func writeBatchTooLarge(c *fiber.Ctx) error {
+	return problem.WriteStatus(c, fiber.StatusBadRequest, fmt.Sprintf("A batch can name at most %d users", service.MaxBatchSize))
+}
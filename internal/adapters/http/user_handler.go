@@ -1,10 +1,22 @@
 package http
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
 	"backend-hexagonal/internal/service"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserHandler struct {
@@ -17,6 +29,12 @@ type CreateUserRequest struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+type ListUsersResponse struct {
+	Users      []*domain.User `json:"users"`
+	Total      int64          `json:"total"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
 type UpdateUserRequest struct {
 	Name  string `json:"name" validate:"required"`
 	Email string `json:"email" validate:"required,email"`
@@ -29,104 +47,383 @@ func NewUserHandler(userService *service.UserService) *UserHandler {
 }
 
 func (h *UserHandler) Create(c *fiber.Ctx) error {
-	return c.Status(fiber.StatusMethodNotAllowed).JSON(fiber.Map{
-		"error": "Use /api/v1/auth/register to create users",
-	})
+	return problem.WriteStatus(c, fiber.StatusMethodNotAllowed, "Use /api/v1/auth/register to create users")
 }
 
 func (h *UserHandler) Get(c *fiber.Ctx) error {
 	idParam := c.Params("id")
-	id, err := primitive.ObjectIDFromHex(idParam)
+	id, err := domain.ParseUserID(idParam)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
 	}
 
 	user, err := h.userService.GetUserByID(c.Context(), id)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return problem.Write(c, err)
 	}
 
-	// Remove password from response
-	user.Password = ""
-	return c.JSON(user)
+	return h.writeUser(c, user)
 }
 
 func (h *UserHandler) GetMe(c *fiber.Ctx) error {
-	userID := c.Locals("user_id").(primitive.ObjectID)
+	userID := c.Locals("user_id").(domain.UserID)
 
 	user, err := h.userService.GetUserByID(c.Context(), userID)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return problem.Write(c, err)
 	}
 
-	// Remove password from response
-	user.Password = ""
-	return c.JSON(user)
+	return h.writeUser(c, user)
 }
 
+// List handles GET /users?limit=&cursor=&sort=&order=&emailPrefix=&nameContains=&createdAfter=&createdBefore=
 func (h *UserHandler) List(c *fiber.Ctx) error {
-	users, err := h.userService.GetAllUsers(c.Context())
+	query := ports.UserQuery{
+		Limit:        c.QueryInt("limit"),
+		Cursor:       c.Query("cursor"),
+		SortBy:       ports.UserSortField(c.Query("sort")),
+		EmailPrefix:  c.Query("emailPrefix"),
+		NameContains: c.Query("nameContains"),
+	}
+
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "order must be asc or desc")
+	}
+
+	var err error
+	if query.CreatedAfter, err = parseTimeQuery(c, "createdAfter"); err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "createdAfter must be an RFC 3339 timestamp")
+	}
+	if query.CreatedBefore, err = parseTimeQuery(c, "createdBefore"); err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "createdBefore must be an RFC 3339 timestamp")
+	}
+
+	page, err := h.userService.ListUsers(c.Context(), query)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch users",
-		})
+		return problem.Write(c, err)
 	}
 
-	// Remove passwords from response
-	for _, user := range users {
-		user.Password = ""
+	// Remove passwords and hidden attributes from response
+	for _, user := range page.Users {
+		presentUser(c, h.userService.AttributeSchema(), user)
 	}
 
-	return c.JSON(users)
+	return c.JSON(ListUsersResponse{
+		Users:      page.Users,
+		Total:      page.Total,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// parseTimeQuery parses an optional RFC 3339 query parameter
+func parseTimeQuery(c *fiber.Ctx, key string) (*time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 func (h *UserHandler) Update(c *fiber.Ctx) error {
 	idParam := c.Params("id")
-	id, err := primitive.ObjectIDFromHex(idParam)
+	id, err := domain.ParseUserID(idParam)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusPreconditionFailed, err.Error())
 	}
 
 	var req UpdateUserRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid request body")
 	}
 
-	user, err := h.userService.UpdateUser(c.Context(), id, req.Name, req.Email)
+	// A replacement is a patch of every writable field
+	user, err := h.userService.PatchUser(c.Context(), id, domain.UserPatch{
+		Name:    &req.Name,
+		Email:   &req.Email,
+		Version: version,
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update user",
-		})
+		return problem.Write(c, err)
 	}
 
-	return c.JSON(user)
+	return h.writeUser(c, user)
+}
+
+// Patch handles PATCH /users/:id with either a JSON Merge Patch (RFC 7396)
+// or a JSON Patch (RFC 6902) against the user's JSON representation
+func (h *UserHandler) Patch(c *fiber.Ctx) error {
+	idParam := c.Params("id")
+	id, err := domain.ParseUserID(idParam)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusPreconditionFailed, err.Error())
+	}
+
+	user, err := h.userService.GetUserByID(c.Context(), id)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+	if version != 0 && version != user.Version {
+		return problem.Write(c, ports.ErrVersionConflict)
+	}
+
+	// Patches apply to the user as the caller sees them
+	presentUser(c, h.userService.AttributeSchema(), user)
+	original, err := json.Marshal(user)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	var patched []byte
+	switch mediaType(c.Get(fiber.HeaderContentType)) {
+	case mergePatchContentType:
+		patched, err = jsonpatch.MergePatch(original, c.Body())
+	case jsonPatchContentType:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(c.Body())
+		if err == nil {
+			patched, err = ops.Apply(original)
+		}
+	default:
+		c.Set("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+		return problem.WriteStatus(c, fiber.StatusUnsupportedMediaType, "Use "+mergePatchContentType+" or "+jsonPatchContentType)
+	}
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return problem.WriteStatus(c, fiber.StatusConflict, err.Error())
+		}
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid patch: "+err.Error())
+	}
+
+	patch, err := userPatchFrom(original, patched)
+	if err != nil {
+		return problem.WriteStatus(c, fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	if err := h.userService.AttributeSchema().CheckWritable(patch.Attributes, callerAudience(c, user)); err != nil {
+		return problem.Write(c, err)
+	}
+
+	patch.Version = version
+	updated, err := h.userService.PatchUser(c.Context(), id, patch)
+	if err != nil {
+		return problem.Write(c, err)
+	}
+
+	return h.writeUser(c, updated)
+}
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// patchableFields are the attributes PATCH may change. Every other
+// attribute of the user's JSON representation is read-only.
+var patchableFields = []string{"name", "email", "displayName", "locale", "timezone", "phone", "bio", "attributes"}
+
+// mediaType strips parameters such as charset from a Content-Type
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// userPatchFrom compares the user's JSON before and after a patch and
+// returns the changed fields
+func userPatchFrom(original, patched []byte) (domain.UserPatch, error) {
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		return domain.UserPatch{}, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil || after == nil {
+		return domain.UserPatch{}, errors.New("the patched user must be a JSON object")
+	}
+
+	patchable := make(map[string]bool)
+	for _, field := range patchableFields {
+		patchable[field] = true
+	}
+	for _, doc := range []map[string]interface{}{before, after} {
+		for key := range doc {
+			if !patchable[key] && !reflect.DeepEqual(before[key], after[key]) {
+				return domain.UserPatch{}, fmt.Errorf("%s is read-only", key)
+			}
+		}
+	}
+
+	var patch domain.UserPatch
+	targets := map[string]**string{
+		"name":        &patch.Name,
+		"email":       &patch.Email,
+		"displayName": &patch.DisplayName,
+		"locale":      &patch.Locale,
+		"timezone":    &patch.Timezone,
+		"phone":       &patch.Phone,
+		"bio":         &patch.Bio,
+	}
+	for _, field := range patchableFields {
+		target, ok := targets[field]
+		if !ok {
+			continue
+		}
+
+		// A removed field is cleared, which validation rejects for the
+		// name and email
+		var value string
+		if v, ok := after[field]; ok && v != nil {
+			s, ok := v.(string)
+			if !ok {
+				return domain.UserPatch{}, fmt.Errorf("%s must be a string", field)
+			}
+			value = s
+		}
+		if previous, _ := before[field].(string); value != previous {
+			*target = &value
+		}
+	}
+
+	attributes, err := attributesPatchFrom(before["attributes"], after["attributes"])
+	if err != nil {
+		return domain.UserPatch{}, err
+	}
+	patch.Attributes = attributes
+
+	return patch, nil
+}
+
+// attributesPatchFrom returns the custom attributes a patch set, with nil
+// for the ones it removed
+func attributesPatchFrom(before, after interface{}) (map[string]interface{}, error) {
+	previous, _ := before.(map[string]interface{})
+	var current map[string]interface{}
+	if after != nil {
+		var ok bool
+		if current, ok = after.(map[string]interface{}); !ok {
+			return nil, errors.New("attributes must be an object")
+		}
+	}
+
+	changes := make(map[string]interface{})
+	for name, value := range current {
+		if old, ok := previous[name]; !ok || !reflect.DeepEqual(old, value) {
+			changes[name] = value
+		}
+	}
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			changes[name] = nil
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, nil
 }
 
 func (h *UserHandler) Delete(c *fiber.Ctx) error {
 	idParam := c.Params("id")
-	id, err := primitive.ObjectIDFromHex(idParam)
+	id, err := domain.ParseUserID(idParam)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid user ID",
-		})
+		return problem.WriteStatus(c, fiber.StatusBadRequest, "Invalid user ID")
 	}
 
-	err = h.userService.DeleteUser(c.Context(), id)
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user",
-		})
+		return problem.WriteStatus(c, fiber.StatusPreconditionFailed, err.Error())
+	}
+
+	err = h.userService.DeleteUserAtVersion(c.Context(), id, version)
+	if err != nil {
+		return problem.Write(c, err)
 	}
 
 	return c.Status(fiber.StatusNoContent).Send(nil)
 }
+
+// writeUser sends a user with their ETag, or 304 Not Modified if the
+// client's If-None-Match already names the current version
+func (h *UserHandler) writeUser(c *fiber.Ctx, user *domain.User) error {
+	tag := userETag(user)
+	c.Set(fiber.HeaderETag, tag)
+	if c.Method() == fiber.MethodGet && c.Get(fiber.HeaderIfNoneMatch) == tag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	presentUser(c, h.userService.AttributeSchema(), user)
+	return c.JSON(user)
+}
+
+// Attributes handles GET /users/attributes, which lists the custom
+// attributes the caller can read
+func (h *UserHandler) Attributes(c *fiber.Ctx) error {
+	// Callers see at least the attributes of their own profile
+	audience := domain.AudienceSelf
+	if roles, _ := c.Locals("roles").([]string); slices.Contains(roles, domain.RoleAdmin) {
+		audience = domain.AudienceAdmin
+	}
+
+	definitions := make([]domain.AttributeDefinition, 0)
+	for _, d := range h.userService.AttributeSchema().Definitions() {
+		if d.VisibleTo(audience) {
+			definitions = append(definitions, d)
+		}
+	}
+	return c.JSON(fiber.Map{"attributes": definitions})
+}
+
+// callerAudience returns how the authenticated caller relates to the user
+func callerAudience(c *fiber.Ctx, user *domain.User) domain.Audience {
+	callerID, _ := c.Locals("user_id").(domain.UserID)
+	roles, _ := c.Locals("roles").([]string)
+	return domain.AudienceFor(callerID, roles, user)
+}
+
+// presentUser removes the password and the custom attributes the caller
+// may not read from a user about to be sent
+func presentUser(c *fiber.Ctx, schema *domain.AttributeSchema, user *domain.User) {
+	user.Password = ""
+	user.Attributes = schema.Visible(user.Attributes, callerAudience(c, user))
+}
+
+// userETag is the entity tag of a user's current version
+func userETag(user *domain.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+var errInvalidIfMatch = errors.New("the If-Match header must be a single ETag of this user")
+
+// ifMatchVersion returns the user version an If-Match header requires, or 0
+// if there is no header or it is "*". Only a single ETag previously returned
+// by this API is accepted.
+func ifMatchVersion(c *fiber.Ctx) (int64, error) {
+	tag := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
@@ -0,0 +1,27 @@
+// Package ids generates the IDs of stored records
+package ids
+
+import (
+	"backend-hexagonal/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ObjectIDGenerator hands out user IDs in the format of Mongo ObjectIDs, as
+// NewID does. The Mongo adapter stores them as ObjectIDs and the other
+// adapters as strings.
+type ObjectIDGenerator struct{}
+
+func NewObjectIDGenerator() ObjectIDGenerator {
+	return ObjectIDGenerator{}
+}
+
+func (ObjectIDGenerator) NewUserID() domain.UserID {
+	return domain.UserID(NewID())
+}
+
+// NewID returns 24 hex digits that start with the current time, so IDs
+// sort by age, and are unique without coordination
+func NewID() string {
+	return primitive.NewObjectID().Hex()
+}
@@ -0,0 +1,306 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// Config describes how to reach the directory and how its entries map onto
+// users. Either UserDNTemplate (bind-as-user) or UserBaseDN and UserFilter
+// (search-then-bind) must be set.
+type Config struct {
+	// URL of the directory, e.g. ldaps://dc1.corp.example:636
+	URL string
+	// StartTLS upgrades a plain ldap:// connection before binding
+	StartTLS bool
+	// InsecureSkipVerify disables certificate verification
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// UserDNTemplate binds directly as the user, e.g.
+	// "uid={username},ou=people,dc=corp,dc=example" or "{username}" for
+	// Active Directory UPN binds
+	UserDNTemplate string
+
+	// BindDN and BindPassword are the service account used to search for
+	// the user's entry before binding as them
+	BindDN       string
+	BindPassword string
+	UserBaseDN   string
+	// UserFilter locates the user's entry, e.g. "(mail={username})"
+	UserFilter string
+
+	EmailAttribute string
+	NameAttribute  string
+
+	// GroupBaseDN and GroupFilter look groups up by member, e.g.
+	// "(member={dn})". When unset the user's memberOf attribute is used.
+	GroupBaseDN string
+	GroupFilter string
+
+	// GroupRoles maps group common names or full DNs to application roles
+	GroupRoles map[string]string
+}
+
+// CredentialVerifier authenticates users against an LDAP or Active
+// Directory server
+type CredentialVerifier struct {
+	config Config
+}
+
+func NewCredentialVerifier(cfg Config) (*CredentialVerifier, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("ldap: URL is required")
+	}
+	if cfg.UserDNTemplate == "" && (cfg.UserBaseDN == "" || cfg.UserFilter == "") {
+		return nil, errors.New("ldap: either a user DN template or a user base DN and filter is required")
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = "cn"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &CredentialVerifier{
+		config: cfg,
+	}, nil
+}
+
+func (v *CredentialVerifier) VerifyCredentials(ctx context.Context, login, password string) (*domain.Identity, error) {
+	// An empty password would be an unauthenticated bind, which most
+	// directories accept as success
+	if login == "" || password == "" {
+		return nil, ports.ErrInvalidCredentials
+	}
+
+	conn, err := v.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	userDN, entry, err := v.findUser(conn, login)
+	if err != nil {
+		return nil, directoryError(err)
+	}
+
+	// Bind as the user to check their password
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ports.ErrInvalidCredentials
+		}
+		return nil, directoryError(fmt.Errorf("ldap: bind as user: %w", err))
+	}
+
+	// With bind-as-user the entry is read after binding, using the
+	// user's own permissions
+	if entry == nil {
+		entry, err = v.readEntry(conn, userDN)
+		if err != nil {
+			return nil, directoryError(err)
+		}
+	}
+
+	email := entry.GetAttributeValue(v.config.EmailAttribute)
+	if email == "" {
+		return nil, fmt.Errorf("ldap: entry %s has no %s attribute", userDN, v.config.EmailAttribute)
+	}
+
+	groups, err := v.groupsOf(conn, entry)
+	if err != nil {
+		return nil, directoryError(err)
+	}
+
+	return &domain.Identity{
+		Email: email,
+		Name:  entry.GetAttributeValue(v.config.NameAttribute),
+		Roles: v.rolesFor(groups),
+	}, nil
+}
+
+// directoryError marks errors from a directory that dropped the connection,
+// is busy or is unavailable as unavailable, leaving other errors as they are
+func directoryError(err error) error {
+	if ldap.IsErrorAnyOf(err, ldap.ErrorNetwork, ldap.LDAPResultBusy, ldap.LDAPResultUnavailable) {
+		return domain.Unavailable(err)
+	}
+	return err
+}
+
+func (v *CredentialVerifier) dial(ctx context.Context) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: v.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(v.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, domain.Unavailable(fmt.Errorf("ldap: dial %s: %w", v.config.URL, err))
+	}
+
+	timeout := v.config.Timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	conn.SetTimeout(timeout)
+
+	if v.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: start TLS: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// findUser resolves the DN to bind as. For search-then-bind it also returns
+// the entry found by the service account.
+func (v *CredentialVerifier) findUser(conn *ldap.Conn, login string) (string, *ldap.Entry, error) {
+	if v.config.UserDNTemplate != "" {
+		return strings.ReplaceAll(v.config.UserDNTemplate, "{username}", ldap.EscapeDN(login)), nil, nil
+	}
+
+	if v.config.BindDN != "" {
+		if err := conn.Bind(v.config.BindDN, v.config.BindPassword); err != nil {
+			return "", nil, fmt.Errorf("ldap: bind as service account: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(v.config.UserFilter, "{username}", ldap.EscapeFilter(login))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		v.config.UserBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false,
+		filter,
+		v.attributes(),
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return "", nil, ports.ErrInvalidCredentials
+		}
+		return "", nil, fmt.Errorf("ldap: search for user: %w", err)
+	}
+
+	// Unknown and ambiguous logins are rejected the same way as a wrong
+	// password so that they can't be told apart
+	if len(result.Entries) != 1 {
+		return "", nil, ports.ErrInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+	return entry.DN, entry, nil
+}
+
+func (v *CredentialVerifier) readEntry(conn *ldap.Conn, dn string) (*ldap.Entry, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		1, 0, false,
+		"(objectClass=*)",
+		v.attributes(),
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: read user entry: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return nil, fmt.Errorf("ldap: user entry %s not found", dn)
+	}
+	return result.Entries[0], nil
+}
+
+func (v *CredentialVerifier) attributes() []string {
+	return []string{v.config.EmailAttribute, v.config.NameAttribute, "memberOf"}
+}
+
+// groupsOf returns the DNs of the groups the user belongs to
+func (v *CredentialVerifier) groupsOf(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	if v.config.GroupFilter == "" {
+		return entry.GetAttributeValues("memberOf"), nil
+	}
+
+	filter := strings.ReplaceAll(v.config.GroupFilter, "{dn}", ldap.EscapeFilter(entry.DN))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		v.config.GroupBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false,
+		filter,
+		[]string{"cn"},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ldap: search for groups: %w", err)
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+// rolesFor maps group DNs to roles. Groups match on their full DN or on the
+// value of their first RDN, e.g. "admins" for "cn=admins,ou=groups,...".
+func (v *CredentialVerifier) rolesFor(groups []string) []string {
+	var roles []string
+	seen := make(map[string]bool)
+
+	for _, group := range groups {
+		role, ok := v.lookupRole(group)
+		if !ok {
+			if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+				role, ok = v.lookupRole(dn.RDNs[0].Attributes[0].Value)
+			}
+		}
+		if ok && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+func (v *CredentialVerifier) lookupRole(group string) (string, bool) {
+	for name, role := range v.config.GroupRoles {
+		if strings.EqualFold(name, group) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// ConfigFromEnv builds a Config from the LDAP_* environment variables
+func ConfigFromEnv() Config {
+	return Config{
+		URL:                config.LDAPURL(),
+		StartTLS:           config.LDAPStartTLS(),
+		InsecureSkipVerify: config.LDAPInsecureSkipVerify(),
+		UserDNTemplate:     config.LDAPUserDNTemplate(),
+		BindDN:             config.LDAPBindDN(),
+		BindPassword:       config.LDAPBindPassword(),
+		UserBaseDN:         config.LDAPUserBaseDN(),
+		UserFilter:         config.LDAPUserFilter(),
+		EmailAttribute:     config.LDAPEmailAttribute(),
+		NameAttribute:      config.LDAPNameAttribute(),
+		GroupBaseDN:        config.LDAPGroupBaseDN(),
+		GroupFilter:        config.LDAPGroupFilter(),
+		GroupRoles:         config.LDAPGroupRoles(),
+	}
+}
@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"sync"
+	"time"
+)
+
+type outboxEntry struct {
+	event       domain.Event
+	publishedAt *time.Time
+}
+
+// OutboxRepository keeps events in the order they were appended. Without
+// rollbacks, events appended in a transaction that fails are kept.
+type OutboxRepository struct {
+	mu      sync.Mutex
+	entries []*outboxEntry
+}
+
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{}
+}
+
+func (r *OutboxRepository) Append(ctx context.Context, events ...*domain.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		event.ID = ids.NewID()
+		r.entries = append(r.entries, &outboxEntry{event: *event})
+	}
+	return nil
+}
+
+func (r *OutboxRepository) Unpublished(ctx context.Context, limit int) ([]*domain.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []*domain.Event{}
+	for _, entry := range r.entries {
+		if len(events) == limit {
+			break
+		}
+		if entry.publishedAt == nil {
+			event := entry.event
+			events = append(events, &event)
+		}
+	}
+	return events, nil
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	published := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		published[id] = true
+	}
+	for _, entry := range r.entries {
+		if published[entry.event.ID] && entry.publishedAt == nil {
+			entry.publishedAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.entries[:0]
+	for _, entry := range r.entries {
+		if entry.publishedAt == nil || !entry.publishedAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	deleted := int64(len(r.entries) - len(kept))
+	for i := len(kept); i < len(r.entries); i++ {
+		r.entries[i] = nil
+	}
+	r.entries = kept
+	return deleted, nil
+}
+
+// Name implements ports.PersonalDataStore
+func (r *OutboxRepository) Name() string {
+	return ports.OutboxStoreName
+}
+
+// ExportUserData implements ports.PersonalDataStore with the events about
+// the user that are still kept
+func (r *OutboxRepository) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var records []interface{}
+	for _, entry := range r.entries {
+		if entry.event.UserID == userID {
+			event := entry.event
+			records = append(records, &event)
+		}
+	}
+	return records, nil
+}
+
+// EraseUserData implements ports.PersonalDataStore by removing the user
+// from the events about them
+func (r *OutboxRepository) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.entries {
+		if entry.event.UserID == userID {
+			entry.event.User = nil
+		}
+	}
+	return nil
+}
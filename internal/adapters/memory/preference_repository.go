@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type preferenceKey struct {
+	userID    domain.UserID
+	namespace string
+}
+
+type PreferenceRepository struct {
+	mu    sync.RWMutex
+	prefs map[preferenceKey]*domain.Preferences
+}
+
+func NewPreferenceRepository() *PreferenceRepository {
+	return &PreferenceRepository{
+		prefs: make(map[preferenceKey]*domain.Preferences),
+	}
+}
+
+func (r *PreferenceRepository) Get(ctx context.Context, userID domain.UserID, namespace string) (*domain.Preferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	prefs, ok := r.prefs[preferenceKey{userID, namespace}]
+	if !ok {
+		return nil, nil
+	}
+	return clonePreferences(prefs), nil
+}
+
+func (r *PreferenceRepository) Put(ctx context.Context, prefs *domain.Preferences) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := preferenceKey{prefs.UserID, prefs.Namespace}
+	var version int64
+	if stored, ok := r.prefs[key]; ok {
+		version = stored.Version
+	}
+	if version != prefs.Version {
+		return ports.ErrVersionConflict
+	}
+
+	if len(prefs.Values) == 0 {
+		delete(r.prefs, key)
+		prefs.Version = 0
+		return nil
+	}
+	prefs.UpdatedAt = time.Now()
+	prefs.Version++
+	r.prefs[key] = clonePreferences(prefs)
+	return nil
+}
+
+func (r *PreferenceRepository) ListByUser(ctx context.Context, userID domain.UserID) ([]*domain.Preferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var all []*domain.Preferences
+	for key, prefs := range r.prefs {
+		if key.userID == userID {
+			all = append(all, clonePreferences(prefs))
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Namespace < all[j].Namespace })
+	return all, nil
+}
+
+func (r *PreferenceRepository) DeleteByUser(ctx context.Context, userID domain.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.prefs {
+		if key.userID == userID {
+			delete(r.prefs, key)
+		}
+	}
+	return nil
+}
+
+func clonePreferences(prefs *domain.Preferences) *domain.Preferences {
+	clone := *prefs
+	clone.Values = cloneValue(prefs.Values).(map[string]interface{})
+	return &clone
+}
+
+// cloneValue deep copies a decoded JSON value
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneValue(item)
+		}
+		return clone
+	}
+	return value
+}
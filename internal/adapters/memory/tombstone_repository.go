@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"sync"
+)
+
+type TombstoneRepository struct {
+	mu         sync.RWMutex
+	tombstones map[domain.UserID]domain.ErasureTombstone
+}
+
+func NewTombstoneRepository() *TombstoneRepository {
+	return &TombstoneRepository{
+		tombstones: make(map[domain.UserID]domain.ErasureTombstone),
+	}
+}
+
+func (r *TombstoneRepository) Create(ctx context.Context, tombstone *domain.ErasureTombstone) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tombstone.ID = ids.NewID()
+	stored := *tombstone
+	stored.Stores = append([]string(nil), tombstone.Stores...)
+	r.tombstones[tombstone.UserID] = stored
+	return nil
+}
+
+func (r *TombstoneRepository) GetByUserID(ctx context.Context, userID domain.UserID) (*domain.ErasureTombstone, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tombstone, ok := r.tombstones[userID]
+	if !ok {
+		return nil, nil
+	}
+	tombstone.Stores = append([]string(nil), tombstone.Stores...)
+	return &tombstone, nil
+}
@@ -0,0 +1,31 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+// inTransaction marks the context of a running transaction, so nested
+// calls don't wait for the lock they already hold
+type inTransaction struct{}
+
+// Transactor runs transactions one at a time, so they don't see each
+// other's writes halfway. Writes made before fn fails are not rolled back,
+// and writes outside of transactions don't wait for them.
+type Transactor struct {
+	mu sync.Mutex
+}
+
+func NewTransactor() *Transactor {
+	return &Transactor{}
+}
+
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(inTransaction{}) != nil {
+		return fn(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fn(context.WithValue(ctx, inTransaction{}, true))
+}
@@ -0,0 +1,555 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserRepository keeps users in memory with the semantics of the Mongo
+// adapter, for running the stack without a database. It is safe for
+// concurrent use, and hands out copies so callers can't change stored
+// users behind its back.
+type UserRepository struct {
+	ids   ports.IDGenerator
+	mu    sync.RWMutex
+	users map[domain.UserID]*domain.User
+	// emails maps every stored email, including those of deleted users, to
+	// its user, like the unique index on email
+	emails map[string]domain.UserID
+}
+
+func NewUserRepository(ids ports.IDGenerator) *UserRepository {
+	return &UserRepository{
+		ids:    ids,
+		users:  make(map[domain.UserID]*domain.User),
+		emails: make(map[string]domain.UserID),
+	}
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, taken := r.emails[user.Email]; taken {
+		return ports.ErrEmailTaken
+	}
+	if user.ID.IsZero() {
+		user.ID = r.ids.NewUserID()
+	} else if _, exists := r.users[user.ID]; exists {
+		return fmt.Errorf("user %s already exists", user.ID.String())
+	}
+	user.Version = 1
+	r.users[user.ID] = cloneUser(user)
+	r.emails[user.Email] = user.ID
+	return nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user := r.active(id)
+	if user == nil {
+		return nil, ports.ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []domain.UserID) ([]*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*domain.User
+	for _, id := range ids {
+		if user := r.active(id); user != nil {
+			users = append(users, cloneUser(user))
+		}
+	}
+	return users, nil
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.emails[email]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	user := r.active(id)
+	if user == nil {
+		return nil, ports.ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
+	return r.collect(func(user *domain.User) bool { return !user.IsDeleted() }), nil
+}
+
+func (r *UserRepository) Each(ctx context.Context, fn func(*domain.User) error) error {
+	return r.each(ctx, false, fn)
+}
+
+func (r *UserRepository) EachIncludingDeleted(ctx context.Context, fn func(*domain.User) error) error {
+	return r.each(ctx, true, fn)
+}
+
+// each calls fn with a snapshot of the users in ID order, without holding
+// the lock, so fn can write to the repository
+func (r *UserRepository) each(ctx context.Context, includeDeleted bool, fn func(*domain.User) error) error {
+	users := r.collect(func(user *domain.User) bool { return includeDeleted || !user.IsDeleted() })
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) List(ctx context.Context, query ports.UserQuery) (*ports.UserPage, error) {
+	var after *domain.User
+	if query.Cursor != "" {
+		cursor, err := ports.DecodeCursor(query)
+		if err != nil {
+			return nil, err
+		}
+		after, err = cursorUser(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	users := r.collect(func(user *domain.User) bool {
+		return !user.IsDeleted() && matchesQuery(user, query)
+	})
+	total := int64(len(users))
+
+	// before reports whether a sorts before b in the listing's order
+	before := func(a, b *domain.User) bool {
+		c := compareUsers(query.SortBy, a, b)
+		if query.Descending {
+			return c > 0
+		}
+		return c < 0
+	}
+	sort.Slice(users, func(i, j int) bool { return before(users[i], users[j]) })
+
+	switch {
+	case after != nil:
+		start := sort.Search(len(users), func(i int) bool { return before(after, users[i]) })
+		users = users[start:]
+	case query.Offset > 0:
+		users = users[min(query.Offset, len(users)):]
+	}
+
+	page := &ports.UserPage{Users: users, Total: total}
+	if len(users) > query.Limit {
+		page.Users = users[:query.Limit]
+		page.NextCursor = ports.CursorAfter(query, page.Users[query.Limit-1]).Encode()
+	}
+	return page, nil
+}
+
+// cursorUser returns a user with the sort keys of a cursor, which sorts
+// where the last user of the previous page did
+func cursorUser(cursor *ports.Cursor) (*domain.User, error) {
+	id, err := domain.ParseUserID(cursor.ID)
+	if err != nil {
+		return nil, ports.ErrInvalidCursor
+	}
+	user := &domain.User{ID: id, Name: cursor.Value, Email: cursor.Value}
+	if cursor.SortBy == ports.SortByCreatedAt {
+		user.CreatedAt, _ = cursor.CreatedAt()
+	}
+	return user, nil
+}
+
+// matchesQuery applies the filters of a listing, which match emails and
+// names regardless of case
+func matchesQuery(user *domain.User, query ports.UserQuery) bool {
+	if query.EmailPrefix != "" && !strings.HasPrefix(strings.ToLower(user.Email), strings.ToLower(query.EmailPrefix)) {
+		return false
+	}
+	if query.NameContains != "" && !strings.Contains(strings.ToLower(user.Name), strings.ToLower(query.NameContains)) {
+		return false
+	}
+	if query.CreatedAfter != nil && user.CreatedAt.Before(*query.CreatedAfter) {
+		return false
+	}
+	if query.CreatedBefore != nil && !user.CreatedAt.Before(*query.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// compareUsers orders users by a sort field, breaking ties by ID
+func compareUsers(field ports.UserSortField, a, b *domain.User) int {
+	var c int
+	switch field {
+	case ports.SortByName:
+		c = strings.Compare(a.Name, b.Name)
+	case ports.SortByEmail:
+		c = strings.Compare(a.Email, b.Email)
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(string(a.ID), string(b.ID))
+}
+
+func (r *UserRepository) Update(ctx context.Context, id domain.UserID, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := r.active(id)
+	if existing == nil {
+		return ports.ErrNotFound
+	}
+	if err := r.setEmail(existing, user.Email); err != nil {
+		return err
+	}
+	existing.Name = user.Name
+	existing.Version++
+	return nil
+}
+
+func (r *UserRepository) Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := r.active(id)
+	if existing == nil {
+		return nil, ports.ErrNotFound
+	}
+	if patch.Version != 0 && patch.Version != existing.Version {
+		return nil, ports.ErrVersionConflict
+	}
+	if patch.IsEmpty() {
+		return cloneUser(existing), nil
+	}
+	if err := r.applyPatch(existing, patch); err != nil {
+		return nil, err
+	}
+	return cloneUser(existing), nil
+}
+
+func (r *UserRepository) PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed []domain.UserID
+	for id, patch := range patches {
+		existing := r.active(id)
+		if existing == nil || patch.IsEmpty() || (patch.Version != 0 && patch.Version != existing.Version) {
+			continue
+		}
+		if err := r.applyPatch(existing, patch); err != nil {
+			continue
+		}
+		changed = append(changed, id)
+	}
+	return changed, nil
+}
+
+// applyPatch sets the fields of a patch on a stored user. It changes
+// nothing if the patch's email is taken.
+func (r *UserRepository) applyPatch(user *domain.User, patch domain.UserPatch) error {
+	if patch.Email != nil {
+		if err := r.setEmail(user, *patch.Email); err != nil {
+			return err
+		}
+	}
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	if patch.Password != nil {
+		user.Password = *patch.Password
+	}
+
+	profile := []struct{ value, field *string }{
+		{patch.DisplayName, &user.DisplayName},
+		{patch.Locale, &user.Locale},
+		{patch.Timezone, &user.Timezone},
+		{patch.Phone, &user.Phone},
+		{patch.Bio, &user.Bio},
+	}
+	for _, p := range profile {
+		if p.value != nil {
+			*p.field = *p.value
+		}
+	}
+
+	for name, value := range patch.Attributes {
+		if value == nil {
+			delete(user.Attributes, name)
+			continue
+		}
+		if user.Attributes == nil {
+			user.Attributes = make(map[string]interface{})
+		}
+		user.Attributes[name] = value
+	}
+	if len(user.Attributes) == 0 {
+		user.Attributes = nil
+	}
+
+	user.Version++
+	return nil
+}
+
+// setEmail changes the email of a stored user, keeping the email index up
+// to date
+func (r *UserRepository) setEmail(user *domain.User, email string) error {
+	if email == user.Email {
+		return nil
+	}
+	if _, taken := r.emails[email]; taken {
+		return ports.ErrEmailTaken
+	}
+	delete(r.emails, user.Email)
+	r.emails[email] = user.ID
+	user.Email = email
+	return nil
+}
+
+func (r *UserRepository) UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := r.active(id)
+	if existing == nil {
+		return nil, ports.ErrNotFound
+	}
+	if user.Version != 0 && user.Version != existing.Version {
+		return nil, ports.ErrVersionConflict
+	}
+	existing.Status = user.Status
+	existing.StatusReason = user.StatusReason
+	existing.StatusChangedAt = cloneTime(user.StatusChangedAt)
+	existing.Version++
+	return cloneUser(existing), nil
+}
+
+func (r *UserRepository) SetAvatar(ctx context.Context, id domain.UserID, avatar *domain.Avatar) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := r.active(id)
+	if existing == nil {
+		return nil, ports.ErrNotFound
+	}
+	existing.Avatar = cloneAvatar(avatar)
+	existing.Version++
+	return cloneUser(existing), nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing := r.active(id)
+	if existing == nil {
+		return ports.ErrNotFound
+	}
+	if expectedVersion != 0 && expectedVersion != existing.Version {
+		return ports.ErrVersionConflict
+	}
+	now := time.Now()
+	existing.DeletedAt = &now
+	existing.Version++
+	return nil
+}
+
+func (r *UserRepository) DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var deleted []domain.UserID
+	for id, version := range expectedVersions {
+		existing := r.active(id)
+		if existing == nil || (version != 0 && version != existing.Version) {
+			continue
+		}
+		deletedAt := now
+		existing.DeletedAt = &deletedAt
+		existing.Version++
+		deleted = append(deleted, id)
+	}
+	return deleted, nil
+}
+
+func (r *UserRepository) SetEmail(ctx context.Context, id domain.UserID, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[id]
+	if !ok {
+		return nil
+	}
+	if err := r.setEmail(existing, email); err != nil {
+		return err
+	}
+	existing.Version++
+	return nil
+}
+
+func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, taken := r.emails[email]
+	return taken, nil
+}
+
+func (r *UserRepository) AttributeExists(ctx context.Context, name string, value interface{}, exceptID domain.UserID) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for id, user := range r.users {
+		current, ok := user.Attributes[name]
+		if id != exceptID && ok && sameValue(current, value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sameValue compares attribute values, which are times, strings, numbers
+// or booleans
+func sameValue(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (r *UserRepository) GetDeleted(ctx context.Context) ([]*domain.User, error) {
+	return r.collect(func(user *domain.User) bool { return user.IsDeleted() }), nil
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id domain.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[id]
+	if !ok || !existing.IsDeleted() {
+		return ports.ErrNotFound
+	}
+	existing.DeletedAt = nil
+	existing.Version++
+	return nil
+}
+
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.users {
+		if user.IsDeleted() && user.DeletedAt.Before(deletedBefore) {
+			r.remove(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *UserRepository) Erase(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ports.ErrNotFound
+	}
+	r.remove(id)
+	return user, nil
+}
+
+func (r *UserRepository) remove(id domain.UserID) {
+	delete(r.emails, r.users[id].Email)
+	delete(r.users, id)
+}
+
+// active returns the stored user with the ID unless they are deleted. The
+// caller holds the lock.
+func (r *UserRepository) active(id domain.UserID) *domain.User {
+	user, ok := r.users[id]
+	if !ok || user.IsDeleted() {
+		return nil
+	}
+	return user
+}
+
+// collect returns copies of the users keep accepts, in ID order
+func (r *UserRepository) collect(keep func(*domain.User) bool) []*domain.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*domain.User
+	for _, user := range r.users {
+		if keep(user) {
+			users = append(users, cloneUser(user))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// cloneUser copies a user along with everything it points to
+func cloneUser(user *domain.User) *domain.User {
+	clone := *user
+	if user.Roles != nil {
+		clone.Roles = append([]string(nil), user.Roles...)
+	}
+	clone.StatusChangedAt = cloneTime(user.StatusChangedAt)
+	clone.DeletedAt = cloneTime(user.DeletedAt)
+	if user.Attributes != nil {
+		clone.Attributes = make(map[string]interface{}, len(user.Attributes))
+		for name, value := range user.Attributes {
+			clone.Attributes[name] = value
+		}
+	}
+	clone.Avatar = cloneAvatar(user.Avatar)
+	return &clone
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+func cloneAvatar(avatar *domain.Avatar) *domain.Avatar {
+	if avatar == nil {
+		return nil
+	}
+	clone := *avatar
+	if avatar.Thumbnails != nil {
+		clone.Thumbnails = make(map[string]string, len(avatar.Thumbnails))
+		for size, url := range avatar.Thumbnails {
+			clone.Thumbnails[size] = url
+		}
+	}
+	clone.Keys = append([]string(nil), avatar.Keys...)
+	return &clone
+}
@@ -0,0 +1,186 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/domain"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The domain knows nothing of BSON, so the adapter maps its types to the
+// documents below and back. User IDs are stored as ObjectIDs.
+
+// objectID converts a user ID to the ObjectID it is stored as. IDs that
+// are not ObjectIDs become the nil ObjectID, which no document has, so
+// lookups by them find nothing.
+func objectID(id domain.UserID) primitive.ObjectID {
+	oid, err := primitive.ObjectIDFromHex(id.String())
+	if err != nil {
+		return primitive.NilObjectID
+	}
+	return oid
+}
+
+func objectIDs(ids []domain.UserID) []primitive.ObjectID {
+	oids := make([]primitive.ObjectID, len(ids))
+	for i, id := range ids {
+		oids[i] = objectID(id)
+	}
+	return oids
+}
+
+func userID(oid primitive.ObjectID) domain.UserID {
+	return domain.UserID(oid.Hex())
+}
+
+type userDocument struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Name            string             `bson:"name"`
+	Email           string             `bson:"email"`
+	Password        string             `bson:"password"`
+	Roles           []string           `bson:"roles,omitempty"`
+	Status          string             `bson:"status,omitempty"`
+	StatusReason    string             `bson:"statusReason,omitempty"`
+	StatusChangedAt *time.Time         `bson:"statusChangedAt,omitempty"`
+	CreatedAt       time.Time          `bson:"createdAt"`
+	DeletedAt       *time.Time         `bson:"deletedAt,omitempty"`
+
+	// Profile fields are omitted when empty, so clearing one unsets it
+	DisplayName string `bson:"displayName,omitempty"`
+	Locale      string `bson:"locale,omitempty"`
+	Timezone    string `bson:"timezone,omitempty"`
+	Phone       string `bson:"phone,omitempty"`
+	Bio         string `bson:"bio,omitempty"`
+
+	Attributes map[string]interface{} `bson:"attributes,omitempty"`
+	Avatar     *avatarDocument        `bson:"avatar,omitempty"`
+	Version    int64                  `bson:"version"`
+}
+
+func newUserDocument(user *domain.User) *userDocument {
+	return &userDocument{
+		ID:              objectID(user.ID),
+		Name:            user.Name,
+		Email:           user.Email,
+		Password:        user.Password,
+		Roles:           user.Roles,
+		Status:          string(user.Status),
+		StatusReason:    user.StatusReason,
+		StatusChangedAt: user.StatusChangedAt,
+		CreatedAt:       user.CreatedAt,
+		DeletedAt:       user.DeletedAt,
+		DisplayName:     user.DisplayName,
+		Locale:          user.Locale,
+		Timezone:        user.Timezone,
+		Phone:           user.Phone,
+		Bio:             user.Bio,
+		Attributes:      user.Attributes,
+		Avatar:          newAvatarDocument(user.Avatar),
+		Version:         user.Version,
+	}
+}
+
+func (d *userDocument) user() *domain.User {
+	return &domain.User{
+		ID:              userID(d.ID),
+		Name:            d.Name,
+		Email:           d.Email,
+		Password:        d.Password,
+		Roles:           d.Roles,
+		Status:          domain.UserStatus(d.Status),
+		StatusReason:    d.StatusReason,
+		StatusChangedAt: d.StatusChangedAt,
+		CreatedAt:       d.CreatedAt,
+		DeletedAt:       d.DeletedAt,
+		Profile: domain.Profile{
+			DisplayName: d.DisplayName,
+			Locale:      d.Locale,
+			Timezone:    d.Timezone,
+			Phone:       d.Phone,
+			Bio:         d.Bio,
+		},
+		Attributes: d.Attributes,
+		Avatar:     d.Avatar.avatar(),
+		Version:    d.Version,
+	}
+}
+
+type avatarDocument struct {
+	URL         string            `bson:"url"`
+	Thumbnails  map[string]string `bson:"thumbnails,omitempty"`
+	ContentType string            `bson:"contentType"`
+	Keys        []string          `bson:"keys"`
+	UpdatedAt   time.Time         `bson:"updatedAt"`
+}
+
+func newAvatarDocument(avatar *domain.Avatar) *avatarDocument {
+	if avatar == nil {
+		return nil
+	}
+	return &avatarDocument{
+		URL:         avatar.URL,
+		Thumbnails:  avatar.Thumbnails,
+		ContentType: avatar.ContentType,
+		Keys:        avatar.Keys,
+		UpdatedAt:   avatar.UpdatedAt,
+	}
+}
+
+func (d *avatarDocument) avatar() *domain.Avatar {
+	if d == nil {
+		return nil
+	}
+	return &domain.Avatar{
+		URL:         d.URL,
+		Thumbnails:  d.Thumbnails,
+		ContentType: d.ContentType,
+		Keys:        d.Keys,
+		UpdatedAt:   d.UpdatedAt,
+	}
+}
+
+type preferencesDocument struct {
+	UserID    primitive.ObjectID     `bson:"userId"`
+	Namespace string                 `bson:"namespace"`
+	Values    map[string]interface{} `bson:"values"`
+	UpdatedAt time.Time              `bson:"updatedAt"`
+	Version   int64                  `bson:"version"`
+}
+
+func newPreferencesDocument(prefs *domain.Preferences) *preferencesDocument {
+	return &preferencesDocument{
+		UserID:    objectID(prefs.UserID),
+		Namespace: prefs.Namespace,
+		Values:    prefs.Values,
+		UpdatedAt: prefs.UpdatedAt,
+		Version:   prefs.Version,
+	}
+}
+
+func (d *preferencesDocument) preferences() *domain.Preferences {
+	return &domain.Preferences{
+		UserID:    userID(d.UserID),
+		Namespace: d.Namespace,
+		Values:    plainObject(d.Values),
+		UpdatedAt: d.UpdatedAt,
+		Version:   d.Version,
+	}
+}
+
+type tombstoneDocument struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `bson:"userId"`
+	RequestedBy primitive.ObjectID `bson:"requestedBy"`
+	Stores      []string           `bson:"stores"`
+	ErasedAt    time.Time          `bson:"erasedAt"`
+}
+
+func (d *tombstoneDocument) tombstone() *domain.ErasureTombstone {
+	return &domain.ErasureTombstone{
+		ID:          d.ID.Hex(),
+		UserID:      userID(d.UserID),
+		RequestedBy: userID(d.RequestedBy),
+		Stores:      d.Stores,
+		ErasedAt:    d.ErasedAt,
+	}
+}
@@ -0,0 +1,101 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/migrations"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrationStore records the applied migrations in the migrations
+// collection, one document per version, and keeps the lock in a single
+// document of migration_lock
+type MigrationStore struct {
+	collection *mongo.Collection
+	lock       *mongo.Collection
+}
+
+func NewMigrationStore(db *mongo.Database) *MigrationStore {
+	return &MigrationStore{
+		collection: db.Collection("migrations"),
+		lock:       db.Collection("migration_lock"),
+	}
+}
+
+type migrationDocument struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// lockID is the _id of the lock document; there is only ever one
+const lockID = "migrations"
+
+type lockDocument struct {
+	ID        string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+func (s *MigrationStore) Applied(ctx context.Context) ([]migrations.Record, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []migrations.Record
+	for cursor.Next(ctx) {
+		var doc migrationDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		records = append(records, migrations.Record{Version: doc.Version, Name: doc.Name, AppliedAt: doc.AppliedAt})
+	}
+	return records, storeError(cursor.Err())
+}
+
+func (s *MigrationStore) Record(ctx context.Context, record migrations.Record) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": record.Version}, migrationDocument{
+		Version:   record.Version,
+		Name:      record.Name,
+		AppliedAt: record.AppliedAt,
+	}, options.Replace().SetUpsert(true))
+	return storeError(err)
+}
+
+func (s *MigrationStore) Remove(ctx context.Context, version int) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": version})
+	return storeError(err)
+}
+
+// Lock takes over the lock document when it has expired or already belongs
+// to owner. Otherwise the filter matches nothing, and the upsert fails on
+// the duplicate _id, which means someone else holds the lock.
+func (s *MigrationStore) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	now := time.Now()
+	filter := bson.M{
+		"_id": lockID,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expiresAt": bson.M{"$lte": now}},
+		},
+	}
+	_, err := s.lock.ReplaceOne(ctx, filter, lockDocument{
+		ID:        lockID,
+		Owner:     owner,
+		ExpiresAt: now.Add(ttl),
+	}, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return migrations.ErrLocked
+	}
+	return storeError(err)
+}
+
+func (s *MigrationStore) Unlock(ctx context.Context, owner string) error {
+	_, err := s.lock.DeleteOne(ctx, bson.M{"_id": lockID, "owner": owner})
+	return storeError(err)
+}
@@ -0,0 +1,119 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/migrations"
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migrations lists the changes to the database in the order they were made.
+// Append new ones with the next version; never renumber or edit one that
+// has shipped, since databases record it as applied.
+//
+// The unique indexes on custom attributes and the search text index depend
+// on the deployment's configuration rather than the release, so the servers
+// still create those on startup.
+func Migrations(db *mongo.Database) []migrations.Migration {
+	users := NewUserRepository(db)
+	preferences := NewPreferenceRepository(db)
+	outbox := NewOutboxRepository(db)
+
+	return []migrations.Migration{
+		{
+			Version: 1,
+			Name:    "users_email_unique",
+			Up: func(ctx context.Context) error {
+				err := users.EnsureEmailIndex(ctx)
+				if mongo.IsDuplicateKeyError(err) {
+					return fmt.Errorf("users share an email, run `users normalize-emails` first: %w", err)
+				}
+				return err
+			},
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, users.collection, emailIndex)
+			},
+		},
+		{
+			Version: 2,
+			Name:    "preferences_user_namespace_unique",
+			Up:      preferences.EnsureIndexes,
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, preferences.collection, preferenceIndex)
+			},
+		},
+		{
+			// Users stored before versions were introduced read as version 0,
+			// which conditional writes treat as "any version"
+			Version: 3,
+			Name:    "users_version_backfill",
+			Up: func(ctx context.Context) error {
+				_, err := users.collection.UpdateMany(ctx,
+					bson.M{"version": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"version": int64(1)}})
+				return storeError(err)
+			},
+		},
+		{
+			// The relay reads the unpublished events in order, and the
+			// cleanup the published ones by age
+			Version: 4,
+			Name:    "outbox_published_at",
+			Up: func(ctx context.Context) error {
+				_, err := outbox.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys:    bson.D{{Key: "publishedAt", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName(outboxIndex),
+				})
+				return storeError(err)
+			},
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, outbox.collection, outboxIndex)
+			},
+		},
+		{
+			// Events are found by user, to export them and to erase the
+			// user from them. The ones appended before record their user
+			// only in the event.
+			Version: 5,
+			Name:    "outbox_user_id",
+			Up: func(ctx context.Context) error {
+				events, err := outbox.find(ctx, bson.M{"userId": bson.M{"$exists": false}})
+				if err != nil {
+					return err
+				}
+				for _, event := range events {
+					if err := outbox.rewrite(ctx, event); err != nil {
+						return err
+					}
+				}
+				_, err = outbox.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys:    bson.D{{Key: "userId", Value: 1}},
+					Options: options.Index().SetName(outboxUserIndex),
+				})
+				return storeError(err)
+			},
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, outbox.collection, outboxUserIndex)
+			},
+		},
+	}
+}
+
+const (
+	outboxIndex     = "published_at"
+	outboxUserIndex = "user_id"
+)
+
+// dropIndex drops the index named name, if it exists
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "IndexNotFound" {
+		return nil
+	}
+	return storeError(err)
+}
@@ -0,0 +1,157 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxRepository stores events in the outbox collection. Their ObjectIDs
+// order them; the event itself is kept as the JSON it is published as.
+type OutboxRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOutboxRepository(db *mongo.Database) *OutboxRepository {
+	return &OutboxRepository{
+		collection: db.Collection("outbox"),
+	}
+}
+
+type outboxDocument struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Type        string             `bson:"type"`
+	UserID      string             `bson:"userId"`
+	Event       string             `bson:"event"`
+	PublishedAt *time.Time         `bson:"publishedAt"`
+}
+
+func (r *OutboxRepository) Append(ctx context.Context, events ...*domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(events))
+	for i, event := range events {
+		id := primitive.NewObjectID()
+		event.ID = id.Hex()
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		docs[i] = outboxDocument{ID: id, Type: string(event.Type), UserID: event.UserID.String(), Event: string(data)}
+	}
+	_, err := r.collection.InsertMany(ctx, docs)
+	return storeError(err)
+}
+
+func (r *OutboxRepository) Unpublished(ctx context.Context, limit int) ([]*domain.Event, error) {
+	return r.find(ctx, bson.M{"publishedAt": nil}, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(limit)))
+}
+
+// find reads the events matching the filter
+func (r *OutboxRepository) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]*domain.Event, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []*domain.Event{}
+	for cursor.Next(ctx) {
+		var doc outboxDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		var event domain.Event
+		if err := json.Unmarshal([]byte(doc.Event), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, storeError(cursor.Err())
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	oids := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			oids = append(oids, oid)
+		}
+	}
+	if len(oids) == 0 {
+		return nil
+	}
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": oids}, "publishedAt": nil},
+		bson.M{"$set": bson.M{"publishedAt": at}})
+	return storeError(err)
+}
+
+func (r *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"publishedAt": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	return result.DeletedCount, nil
+}
+
+// Name implements ports.PersonalDataStore
+func (r *OutboxRepository) Name() string {
+	return ports.OutboxStoreName
+}
+
+// ExportUserData implements ports.PersonalDataStore with the events about
+// the user that are still kept
+func (r *OutboxRepository) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	events, err := r.find(ctx, bson.M{"userId": userID.String()}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]interface{}, len(events))
+	for i, event := range events {
+		records[i] = event
+	}
+	return records, nil
+}
+
+// EraseUserData implements ports.PersonalDataStore by removing the user
+// from the events about them
+func (r *OutboxRepository) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	events, err := r.find(ctx, bson.M{"userId": userID.String()})
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if event.User == nil {
+			continue
+		}
+		event.User = nil
+		if err := r.rewrite(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite stores an event again as it is now, along with the user it is
+// about
+func (r *OutboxRepository) rewrite(ctx context.Context, event *domain.Event) error {
+	id, err := primitive.ObjectIDFromHex(event.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"event": string(data), "userId": event.UserID.String()}})
+	return storeError(err)
+}
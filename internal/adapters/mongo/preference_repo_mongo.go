@@ -0,0 +1,147 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PreferenceRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPreferenceRepository(db *mongo.Database) *PreferenceRepository {
+	return &PreferenceRepository{
+		collection: db.Collection("preferences"),
+	}
+}
+
+// preferenceIndex is the unique index that keeps one record per user and
+// namespace
+const preferenceIndex = "user_namespace_unique"
+
+// EnsureIndexes creates preferenceIndex
+func (r *PreferenceRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "namespace", Value: 1}},
+		Options: options.Index().
+			SetName(preferenceIndex).
+			SetUnique(true),
+	})
+	return storeError(err)
+}
+
+func (r *PreferenceRepository) Get(ctx context.Context, userID domain.UserID, namespace string) (*domain.Preferences, error) {
+	var doc preferencesDocument
+	err := r.collection.FindOne(ctx, bson.M{"userId": objectID(userID), "namespace": namespace}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return doc.preferences(), nil
+}
+
+func (r *PreferenceRepository) Put(ctx context.Context, prefs *domain.Preferences) error {
+	filter := bson.M{"userId": objectID(prefs.UserID), "namespace": prefs.Namespace, "version": prefs.Version}
+
+	if len(prefs.Values) == 0 {
+		if prefs.Version == 0 {
+			return nil
+		}
+		result, err := r.collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return storeError(err)
+		}
+		if result.DeletedCount == 0 {
+			return ports.ErrVersionConflict
+		}
+		prefs.Version = 0
+		return nil
+	}
+
+	prefs.UpdatedAt = time.Now()
+	if prefs.Version == 0 {
+		prefs.Version = 1
+		_, err := r.collection.InsertOne(ctx, newPreferencesDocument(prefs))
+		if mongo.IsDuplicateKeyError(err) {
+			prefs.Version = 0
+			return ports.ErrVersionConflict
+		}
+		return storeError(err)
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"values": prefs.Values, "updatedAt": prefs.UpdatedAt},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return storeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ports.ErrVersionConflict
+	}
+	prefs.Version++
+	return nil
+}
+
+func (r *PreferenceRepository) ListByUser(ctx context.Context, userID domain.UserID) ([]*domain.Preferences, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"userId": objectID(userID)},
+		options.Find().SetSort(bson.D{{Key: "namespace", Value: 1}}),
+	)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var all []*domain.Preferences
+	for cursor.Next(ctx) {
+		var doc preferencesDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		all = append(all, doc.preferences())
+	}
+	return all, storeError(cursor.Err())
+}
+
+func (r *PreferenceRepository) DeleteByUser(ctx context.Context, userID domain.UserID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"userId": objectID(userID)})
+	return err
+}
+
+// plainObject converts the nested documents and arrays the driver decodes
+// into bson types back into the plain maps and slices of decoded JSON
+func plainObject(doc map[string]interface{}) map[string]interface{} {
+	for key, value := range doc {
+		doc[key] = plainValue(value)
+	}
+	return doc
+}
+
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.M:
+		return plainObject(v)
+	case primitive.D:
+		doc := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			doc[e.Key] = plainValue(e.Value)
+		}
+		return doc
+	case primitive.A:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = plainValue(item)
+		}
+		return values
+	}
+	return value
+}
@@ -0,0 +1,47 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TombstoneRepository struct {
+	collection *mongo.Collection
+}
+
+func NewTombstoneRepository(db *mongo.Database) *TombstoneRepository {
+	return &TombstoneRepository{
+		collection: db.Collection("erasure_tombstones"),
+	}
+}
+
+func (r *TombstoneRepository) Create(ctx context.Context, tombstone *domain.ErasureTombstone) error {
+	result, err := r.collection.InsertOne(ctx, &tombstoneDocument{
+		UserID:      objectID(tombstone.UserID),
+		RequestedBy: objectID(tombstone.RequestedBy),
+		Stores:      tombstone.Stores,
+		ErasedAt:    tombstone.ErasedAt,
+	})
+	if err != nil {
+		return storeError(err)
+	}
+
+	tombstone.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (r *TombstoneRepository) GetByUserID(ctx context.Context, userID domain.UserID) (*domain.ErasureTombstone, error) {
+	var doc tombstoneDocument
+	err := r.collection.FindOne(ctx, bson.M{"userId": objectID(userID)}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return doc.tombstone(), nil
+}
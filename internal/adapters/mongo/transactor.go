@@ -0,0 +1,68 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs functions in a multi-document transaction. The driver
+// finds the session in the context fn receives, so the repositories take
+// part without knowing about it.
+//
+// Transactions need a replica set or a sharded cluster. A standalone mongod
+// is only accepted when the caller allows it; the Transactor then runs fn
+// without a transaction, so a failure part way through leaves the writes
+// made until then, and events may be lost or sent for changes that failed.
+type Transactor struct {
+	client       *mongo.Client
+	transactions bool
+}
+
+// ErrNoTransactions is returned by NewTransactor for a standalone mongod
+// unless writing without transactions is allowed
+var ErrNoTransactions = errors.New("mongod is standalone and can't run transactions; run a replica set")
+
+// NewTransactor asks the server whether it supports transactions. A
+// standalone server is an error unless allowStandalone is set.
+func NewTransactor(ctx context.Context, client *mongo.Client, allowStandalone bool) (*Transactor, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	transactions := hello.SetName != "" || hello.Msg == "isdbgrid"
+	if !transactions {
+		if !allowStandalone {
+			return nil, ErrNoTransactions
+		}
+		log.Println("mongod is standalone, writes to several documents are not atomic and user events may be lost; run a replica set for transactions")
+	}
+	return &Transactor{client: client, transactions: transactions}, nil
+}
+
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !t.transactions || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return storeError(err)
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+
+	// WithTransaction retries fn when the transaction conflicts with
+	// another, and the commit when its outcome is unknown
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return storeError(err)
+}
@@ -0,0 +1,211 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/domain"
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tokenSaveInterval is how often the resume token is saved while changes
+// arrive. A process that stops in between sees the changes since the last
+// save again when it restarts.
+const tokenSaveInterval = time.Second
+
+// Server error codes of a resume token the oplog no longer reaches
+const (
+	codeInvalidResumeToken      = 260
+	codeChangeStreamFatalError  = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// UserChangeStream follows the users collection with a change stream. Its
+// resume token is kept in the change_stream_tokens collection under its
+// name, so a restarted process carries on where it stopped; processes that
+// must each see every change need names of their own.
+//
+// Change streams need a replica set or a sharded cluster; a single-node
+// replica set will do.
+type UserChangeStream struct {
+	users  *mongo.Collection
+	tokens *mongo.Collection
+	name   string
+}
+
+func NewUserChangeStream(db *mongo.Database, name string) *UserChangeStream {
+	return &UserChangeStream{
+		users:  db.Collection("users"),
+		tokens: db.Collection("change_stream_tokens"),
+		name:   name,
+	}
+}
+
+type tokenDocument struct {
+	Name    string    `bson:"_id"`
+	Token   bson.Raw  `bson:"token"`
+	SavedAt time.Time `bson:"savedAt"`
+}
+
+type changeDocument struct {
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *userDocument `bson:"fullDocument"`
+}
+
+// change normalizes a change event, reporting false for the ones that say
+// nothing about a user
+func (d *changeDocument) change() (domain.UserChange, bool) {
+	change := domain.UserChange{
+		UserID:     userID(d.DocumentKey.ID),
+		OccurredAt: time.Unix(int64(d.ClusterTime.T), 0).UTC(),
+	}
+	switch d.OperationType {
+	case "insert":
+		change.Type = domain.ChangeCreated
+	case "update", "replace":
+		change.Type = domain.ChangeUpdated
+	case "delete":
+		change.Type = domain.ChangeDeleted
+		return change, true
+	default:
+		return change, false
+	}
+
+	// The lookup of an update finds nothing once the user is removed, and
+	// the removal has an event of its own
+	if d.FullDocument == nil {
+		return change, false
+	}
+	change.User = d.FullDocument.user()
+	if change.User.IsDeleted() {
+		change.Type = domain.ChangeDeleted
+	}
+	return change, true
+}
+
+func (s *UserChangeStream) Watch(ctx context.Context, fn func(domain.UserChange) error) error {
+	token, err := s.loadToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	stream, err := s.open(ctx, token)
+	if token != nil && historyLost(err) {
+		log.Printf("cannot resume the %s user change stream, changes since it stopped are missed: %v", s.name, err)
+		token = nil
+		stream, err = s.open(ctx, nil)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return storeError(err)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	// handled is the token after the last change fn handled, or after the
+	// last batch that had none
+	handled := token
+	lastSave := time.Now()
+	save := func(ctx context.Context) error {
+		if handled == nil || bytes.Equal(handled, token) {
+			return nil
+		}
+		if err := s.saveToken(ctx, handled); err != nil {
+			return err
+		}
+		token = handled
+		return nil
+	}
+	defer func() {
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := save(saveCtx); err != nil {
+			log.Printf("saving the %s user change stream token: %v", s.name, err)
+		}
+	}()
+
+	for {
+		// TryNext waits for changes up to the stream's MaxAwaitTime
+		if stream.TryNext(ctx) {
+			var doc changeDocument
+			if err := stream.Decode(&doc); err != nil {
+				return err
+			}
+			if change, ok := doc.change(); ok {
+				if err := fn(change); err != nil {
+					return err
+				}
+			}
+		} else if err := stream.Err(); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return storeError(err)
+		} else if stream.ID() == 0 {
+			// Dropping or renaming the collection ends the stream
+			return errors.New("the user change stream was invalidated")
+		}
+		handled = append(bson.Raw(nil), stream.ResumeToken()...)
+
+		if time.Since(lastSave) >= tokenSaveInterval {
+			if err := save(ctx); err != nil {
+				return err
+			}
+			lastSave = time.Now()
+		}
+	}
+}
+
+// open starts a change stream after token, or from now if it is nil
+func (s *UserChangeStream) open(ctx context.Context, token bson.Raw) (*mongo.ChangeStream, error) {
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(time.Second)
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType": bson.M{"$in": []string{"insert", "update", "replace", "delete"}},
+	}}}}
+	return s.users.Watch(ctx, pipeline, opts)
+}
+
+func (s *UserChangeStream) loadToken(ctx context.Context) (bson.Raw, error) {
+	var doc tokenDocument
+	err := s.tokens.FindOne(ctx, bson.M{"_id": s.name}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return doc.Token, nil
+}
+
+func (s *UserChangeStream) saveToken(ctx context.Context, token bson.Raw) error {
+	_, err := s.tokens.ReplaceOne(ctx, bson.M{"_id": s.name},
+		tokenDocument{Name: s.name, Token: token, SavedAt: time.Now()},
+		options.Replace().SetUpsert(true))
+	return storeError(err)
+}
+
+// historyLost reports whether a change stream failed to resume because the
+// oplog no longer has the changes after its token
+func historyLost(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) &&
+		(serverErr.HasErrorCode(codeChangeStreamHistoryLost) ||
+			serverErr.HasErrorCode(codeChangeStreamFatalError) ||
+			serverErr.HasErrorCode(codeInvalidResumeToken))
+}
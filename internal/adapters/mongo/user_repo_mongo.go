@@ -2,11 +2,17 @@ package mongo
 
 import (
 	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
 	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository struct {
@@ -19,66 +25,597 @@ func NewUserRepository(db *mongo.Database) *UserRepository {
 	}
 }
 
+// emailIndex is the unique index on email. Deleted users are indexed too,
+// since their email stays reserved until they are purged.
+const emailIndex = "email_unique"
+
+// duplicateKeyCode is the code of a write rejected by a unique index
+const duplicateKeyCode = 11000
+
+// EnsureEmailIndex creates the unique index on email. It fails while users
+// share an email, which the normalize-emails command of cmd/users resolves.
+func (r *UserRepository) EnsureEmailIndex(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().
+			SetName(emailIndex).
+			SetUnique(true),
+	})
+	return storeError(err)
+}
+
+// writeError translates a write rejected by the email index into
+// ports.ErrEmailTaken
+func writeError(err error) error {
+	if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), emailIndex) {
+		return ports.ErrEmailTaken
+	}
+	return storeError(err)
+}
+
+// storeError marks errors from a server that can't be reached or didn't
+// answer in time as unavailable, leaving other errors as they are
+func storeError(err error) error {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, mongo.ErrClientDisconnected) {
+		return domain.Unavailable(err)
+	}
+	return err
+}
+
+// notDeleted restricts a filter to users that have not been soft deleted
+func notDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
-	result, err := r.collection.InsertOne(ctx, user)
+	user.Version = 1
+	result, err := r.collection.InsertOne(ctx, newUserDocument(user))
 	if err != nil {
-		return err
+		return writeError(err)
 	}
 
-	user.ID = result.InsertedID.(primitive.ObjectID)
+	user.ID = userID(result.InsertedID.(primitive.ObjectID))
 	return nil
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
-	var user domain.User
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+func (r *UserRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	var doc userDocument
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"_id": objectID(id)})).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ports.ErrNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, storeError(err)
 	}
-	return &user, nil
+	return doc.user(), nil
+}
+
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []domain.UserID) ([]*domain.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return r.find(ctx, notDeleted(bson.M{"_id": bson.M{"$in": objectIDs(ids)}}))
 }
 
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	var user domain.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	var doc userDocument
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"email": email})).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ports.ErrNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, storeError(err)
 	}
-	return &user, nil
+	return doc.user(), nil
 }
 
 func (r *UserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{})
+	return r.find(ctx, notDeleted(bson.M{}))
+}
+
+func (r *UserRepository) Each(ctx context.Context, fn func(*domain.User) error) error {
+	return r.each(ctx, notDeleted(bson.M{}), fn)
+}
+
+func (r *UserRepository) EachIncludingDeleted(ctx context.Context, fn func(*domain.User) error) error {
+	return r.each(ctx, bson.M{}, fn)
+}
+
+func (r *UserRepository) each(ctx context.Context, filter bson.M, fn func(*domain.User) error) error {
+	cursor, err := r.collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return storeError(err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc userDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc.user()); err != nil {
+			return err
+		}
+	}
+	return storeError(cursor.Err())
+}
+
+func (r *UserRepository) List(ctx context.Context, query ports.UserQuery) (*ports.UserPage, error) {
+	filter := notDeleted(bson.M{})
+	if query.EmailPrefix != "" {
+		filter["email"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.EmailPrefix), Options: "i"}
+	}
+	if query.NameContains != "" {
+		filter["name"] = primitive.Regex{Pattern: regexp.QuoteMeta(query.NameContains), Options: "i"}
+	}
+	if query.CreatedAfter != nil || query.CreatedBefore != nil {
+		createdAt := bson.M{}
+		if query.CreatedAfter != nil {
+			createdAt["$gte"] = *query.CreatedAfter
+		}
+		if query.CreatedBefore != nil {
+			createdAt["$lt"] = *query.CreatedBefore
+		}
+		filter["createdAt"] = createdAt
+	}
+
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	field := string(query.SortBy)
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}).
+		// One extra user tells whether there is a next page
+		SetLimit(int64(query.Limit) + 1)
+
+	if query.Cursor != "" {
+		after, err := keysetFilter(query)
+		if err != nil {
+			return nil, err
+		}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	} else if query.Offset > 0 {
+		opts.SetSkip(int64(query.Offset))
+	}
+
+	users, err := r.find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
+
+	page := &ports.UserPage{Users: users, Total: total}
+	if len(users) > query.Limit {
+		page.Users = users[:query.Limit]
+		page.NextCursor = ports.CursorAfter(query, page.Users[query.Limit-1]).Encode()
+	}
+	return page, nil
+}
+
+// keysetFilter matches the users that sort after the query's cursor
+func keysetFilter(query ports.UserQuery) (bson.M, error) {
+	cursor, err := ports.DecodeCursor(query)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, ports.ErrInvalidCursor
+	}
+
+	var value interface{} = cursor.Value
+	if cursor.SortBy == ports.SortByCreatedAt {
+		value, _ = cursor.CreatedAt()
+	}
+
+	op := "$gt"
+	if query.Descending {
+		op = "$lt"
+	}
+
+	field := string(cursor.SortBy)
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: value}},
+		bson.M{field: value, "_id": bson.M{op: id}},
+	}}, nil
+}
+
+func (r *UserRepository) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]*domain.User, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, storeError(err)
+	}
 	defer cursor.Close(ctx)
 
 	var users []*domain.User
 	for cursor.Next(ctx) {
-		var user domain.User
-		if err := cursor.Decode(&user); err != nil {
+		var doc userDocument
+		if err := cursor.Decode(&doc); err != nil {
 			return nil, err
 		}
-		users = append(users, &user)
+		users = append(users, doc.user())
 	}
 
-	return users, cursor.Err()
+	return users, storeError(cursor.Err())
 }
 
-func (r *UserRepository) Update(ctx context.Context, id primitive.ObjectID, user *domain.User) error {
+func (r *UserRepository) Update(ctx context.Context, id domain.UserID, user *domain.User) error {
 	update := bson.M{
 		"$set": bson.M{
 			"name":  user.Name,
 			"email": user.Email,
 		},
+		"$inc": bson.M{"version": 1},
 	}
 
-	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
-	return err
+	result, err := r.collection.UpdateOne(ctx, notDeleted(bson.M{"_id": objectID(id)}), update)
+	if err != nil {
+		return writeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+func (r *UserRepository) Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	set, unset := patchFields(patch)
+	if len(set) == 0 && len(unset) == 0 {
+		user, err := r.GetByID(ctx, id)
+		if err == nil && patch.Version != 0 && user.Version != patch.Version {
+			return nil, ports.ErrVersionConflict
+		}
+		return user, err
+	}
+
+	var doc userDocument
+	err := r.collection.FindOneAndUpdate(ctx, versioned(id, patch.Version), versionedUpdate(set, unset),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, r.versionConflict(ctx, id, patch.Version)
+	}
+	if err != nil {
+		return nil, writeError(err)
+	}
+	return doc.user(), nil
+}
+
+func (r *UserRepository) PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error) {
+	batch := primitive.NewObjectID()
+	var ids []domain.UserID
+	var models []mongo.WriteModel
+	for id, patch := range patches {
+		set, unset := patchFields(patch)
+		if len(set) == 0 && len(unset) == 0 {
+			continue
+		}
+		set[batchField] = batch
+		ids = append(ids, id)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(versioned(id, patch.Version)).
+			SetUpdate(versionedUpdate(set, unset)))
+	}
+	return r.bulkWrite(ctx, batch, ids, models)
+}
+
+// patchFields returns the fields a patch sets and the ones it unsets
+func patchFields(patch domain.UserPatch) (set, unset bson.M) {
+	set, unset = bson.M{}, bson.M{}
+	if patch.Name != nil {
+		set["name"] = *patch.Name
+	}
+	if patch.Email != nil {
+		set["email"] = *patch.Email
+	}
+	if patch.Password != nil {
+		set["password"] = *patch.Password
+	}
+
+	// Profile fields are omitted when empty, so clearing one unsets it
+	profile := map[string]*string{
+		"displayName": patch.DisplayName,
+		"locale":      patch.Locale,
+		"timezone":    patch.Timezone,
+		"phone":       patch.Phone,
+		"bio":         patch.Bio,
+	}
+	for field, value := range profile {
+		switch {
+		case value == nil:
+		case *value == "":
+			unset[field] = ""
+		default:
+			set[field] = *value
+		}
+	}
+
+	for name, value := range patch.Attributes {
+		if value == nil {
+			unset["attributes."+name] = ""
+		} else {
+			set["attributes."+name] = value
+		}
+	}
+	return set, unset
+}
+
+// versionedUpdate sets and unsets fields and increments the version
+func versionedUpdate(set, unset bson.M) bson.M {
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// batchField tags the users changed by a bulk write. A bulk write only
+// counts the updates that matched, so the tag tells which ones they were.
+const batchField = "lastBatch"
+
+// bulkWrite runs the updates of the users with the given IDs as one
+// unordered bulk write tagged with batch, and returns the IDs of the users
+// it changed
+func (r *UserRepository) bulkWrite(ctx context.Context, batch primitive.ObjectID, ids []domain.UserID, models []mongo.WriteModel) ([]domain.UserID, error) {
+	if len(models) == 0 {
+		return nil, nil
+	}
+
+	result, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil && !onlyDuplicateKeys(err) {
+		return nil, storeError(err)
+	}
+	if err == nil && result.MatchedCount == int64(len(models)) {
+		return ids, nil
+	}
+
+	// Some updates matched nothing or failed, while the others applied
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": objectIDs(ids)}, batchField: batch},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var changed []domain.UserID
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		changed = append(changed, userID(doc.ID))
+	}
+	return changed, storeError(cursor.Err())
+}
+
+// onlyDuplicateKeys reports whether a bulk write failed only because some
+// of its writes would have duplicated a unique key, which skips them while
+// the others apply
+func onlyDuplicateKeys(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != duplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *UserRepository) UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          user.Status,
+			"statusReason":    user.StatusReason,
+			"statusChangedAt": user.StatusChangedAt,
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	var doc userDocument
+	err := r.collection.FindOneAndUpdate(ctx, versioned(id, user.Version), update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, r.versionConflict(ctx, id, user.Version)
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return doc.user(), nil
+}
+
+func (r *UserRepository) SetAvatar(ctx context.Context, id domain.UserID, avatar *domain.Avatar) (*domain.User, error) {
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if avatar == nil {
+		update["$unset"] = bson.M{"avatar": ""}
+	} else {
+		update["$set"] = bson.M{"avatar": newAvatarDocument(avatar)}
+	}
+
+	var doc userDocument
+	err := r.collection.FindOneAndUpdate(ctx, notDeleted(bson.M{"_id": objectID(id)}), update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return doc.user(), nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	update := bson.M{
+		"$set": bson.M{
+			"deletedAt": time.Now(),
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, versioned(id, expectedVersion), update)
+	if err != nil {
+		return storeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return r.versionConflict(ctx, id, expectedVersion)
+	}
+	return nil
+}
+
+func (r *UserRepository) DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error) {
+	batch := primitive.NewObjectID()
+	update := versionedUpdate(bson.M{"deletedAt": time.Now(), batchField: batch}, nil)
+
+	var ids []domain.UserID
+	var models []mongo.WriteModel
+	for id, version := range expectedVersions {
+		ids = append(ids, id)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(versioned(id, version)).
+			SetUpdate(update))
+	}
+	return r.bulkWrite(ctx, batch, ids, models)
+}
+
+// versioned matches the user with the given ID, and if version is not zero
+// only while they are at that version
+func versioned(id domain.UserID, version int64) bson.M {
+	filter := notDeleted(bson.M{"_id": objectID(id)})
+	if version != 0 {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// versionConflict tells why a versioned write matched nothing: it is a
+// conflict if the user exists, and ErrNotFound if they don't
+func (r *UserRepository) versionConflict(ctx context.Context, id domain.UserID, version int64) error {
+	if version == 0 {
+		return ports.ErrNotFound
+	}
+	count, err := r.collection.CountDocuments(ctx, notDeleted(bson.M{"_id": objectID(id)}))
+	if err != nil {
+		return storeError(err)
+	}
+	if count > 0 {
+		return ports.ErrVersionConflict
+	}
+	return ports.ErrNotFound
+}
+
+func (r *UserRepository) SetEmail(ctx context.Context, id domain.UserID, email string) error {
+	update := bson.M{
+		"$set": bson.M{"email": email},
+		"$inc": bson.M{"version": 1},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID(id)}, update)
+	return writeError(err)
+}
+
+func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return false, storeError(err)
+	}
+	return count > 0, nil
+}
+
+func (r *UserRepository) AttributeExists(ctx context.Context, name string, value interface{}, exceptID domain.UserID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"attributes." + name: value,
+		"_id":                bson.M{"$ne": objectID(exceptID)},
+	})
+	if err != nil {
+		return false, storeError(err)
+	}
+	return count > 0, nil
+}
+
+// EnsureAttributeIndexes creates a unique index for every unique custom
+// attribute of the schema, so concurrent writes can't duplicate a value
+// that AttributeExists has just reported as free
+func (r *UserRepository) EnsureAttributeIndexes(ctx context.Context, schema *domain.AttributeSchema) error {
+	var models []mongo.IndexModel
+	for _, d := range schema.Definitions() {
+		if !d.Unique {
+			continue
+		}
+		field := "attributes." + d.Name
+		models = append(models, mongo.IndexModel{
+			Keys: bson.D{{Key: field, Value: 1}},
+			Options: options.Index().
+				SetName("attributes_" + d.Name + "_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{field: bson.M{"$exists": true}}),
+		})
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, models)
+	return storeError(err)
+}
+
+func (r *UserRepository) GetDeleted(ctx context.Context) ([]*domain.User, error) {
+	return r.find(ctx, bson.M{"deletedAt": bson.M{"$exists": true}})
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id domain.UserID) error {
+	update := bson.M{
+		"$unset": bson.M{
+			"deletedAt": "",
+		},
+		"$inc": bson.M{"version": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID(id), "deletedAt": bson.M{"$exists": true}}, update)
+	if err != nil {
+		return storeError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ports.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *UserRepository) Erase(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	var doc userDocument
+	err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID(id)}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return doc.user(), nil
 }
@@ -0,0 +1,120 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// searchCandidates caps how many users each lookup feeds into ranking
+const searchCandidates = 200
+
+// UserSearch searches the users collection. A text index on name and email
+// finds whole words; when it finds fewer users than asked for, users sharing
+// a three letter fragment with the query are added so that misspelled
+// queries still match. Candidates are ranked with the same scoring as the
+// in-process index.
+type UserSearch struct {
+	collection *mongo.Collection
+}
+
+func NewUserSearch(db *mongo.Database) *UserSearch {
+	return &UserSearch{
+		collection: db.Collection("users"),
+	}
+}
+
+// EnsureIndexes creates the text index searches rely on
+func (s *UserSearch) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+		Options: options.Index().
+			SetName("user_search").
+			SetWeights(bson.M{"name": 10, "email": 5}),
+	})
+	return storeError(err)
+}
+
+func (s *UserSearch) Search(ctx context.Context, query string, limit int) ([]*ports.UserSearchResult, error) {
+	tokens := search.Tokenize(query)
+	if len(tokens) == 0 {
+		return []*ports.UserSearchResult{}, nil
+	}
+
+	candidates := make(map[domain.UserID]*domain.User)
+
+	err := s.collect(ctx, candidates,
+		notDeleted(bson.M{"$text": bson.M{"$search": strings.Join(tokens, " ")}}),
+		options.Find().
+			SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetLimit(searchCandidates),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) < limit {
+		pattern := primitive.Regex{Pattern: fragmentPattern(tokens), Options: "i"}
+		err := s.collect(ctx, candidates,
+			notDeleted(bson.M{"$or": bson.A{bson.M{"name": pattern}, bson.M{"email": pattern}}}),
+			options.Find().SetLimit(searchCandidates),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*ports.UserSearchResult, 0, len(candidates))
+	for _, user := range candidates {
+		if score := search.Score(tokens, user); score > 0 {
+			results = append(results, &ports.UserSearchResult{User: user, Score: score})
+		}
+	}
+
+	return search.Rank(results, limit), nil
+}
+
+func (s *UserSearch) collect(ctx context.Context, candidates map[domain.UserID]*domain.User, filter bson.M, opts *options.FindOptions) error {
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return storeError(err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc userDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		user := doc.user()
+		candidates[user.ID] = user
+	}
+
+	return storeError(cursor.Err())
+}
+
+// fragmentPattern matches any three letter fragment of the query words.
+// Shorter words are matched whole.
+func fragmentPattern(tokens []string) string {
+	var fragments []string
+	for _, token := range tokens {
+		r := []rune(token)
+		if len(r) < 3 {
+			fragments = append(fragments, regexp.QuoteMeta(token))
+			continue
+		}
+		for i := 0; i+3 <= len(r); i++ {
+			fragments = append(fragments, regexp.QuoteMeta(string(r[i:i+3])))
+		}
+	}
+	return strings.Join(fragments, "|")
+}
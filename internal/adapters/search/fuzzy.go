@@ -0,0 +1,127 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"backend-hexagonal/internal/domain"
+)
+
+// Tokenize lowercases s and splits it into words, treating the separators
+// found in emails as spaces, so "Somchai.K@gmail.com" becomes
+// [somchai k gmail com]
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// userTokens returns the searchable words of a user. Name words come first
+// so they win ties against email words.
+func userTokens(user *domain.User) []string {
+	return append(Tokenize(user.Name), Tokenize(user.Email)...)
+}
+
+// Score ranks how well a user matches the query tokens. Every query token is
+// scored against its best matching user token: 1 for an exact match, 0.9
+// for a prefix, 0.6 for a substring and less for matches within a small edit
+// distance. Users matching only some of the query tokens score below users
+// matching all of them. A score of 0 means no match.
+func Score(queryTokens []string, user *domain.User) float64 {
+	if len(queryTokens) == 0 {
+		return 0
+	}
+
+	tokens := userTokens(user)
+	var total float64
+	for _, q := range queryTokens {
+		best := 0.0
+		for _, t := range tokens {
+			if s := tokenScore(q, t); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+
+	return total / float64(len(queryTokens))
+}
+
+func tokenScore(query, token string) float64 {
+	switch {
+	case query == token:
+		return 1
+	case strings.HasPrefix(token, query):
+		return 0.9
+	case len(query) >= 3 && strings.Contains(token, query):
+		return 0.6
+	}
+
+	// Compare against the token's prefix too so that typos in a partially
+	// typed word still match, e.g. "somhc" against "somchai"
+	distance := levenshtein(query, token)
+	if len([]rune(token)) > len([]rune(query)) {
+		prefix := string([]rune(token)[:len([]rune(query))])
+		if d := levenshtein(query, prefix); d < distance {
+			distance = d
+		}
+	}
+
+	if distance > maxTypos(query) {
+		return 0
+	}
+	return 0.7 - 0.2*float64(distance-1)
+}
+
+// maxTypos is the edit distance tolerated for a query word. Short words
+// have to match exactly, or every two-letter word would match.
+func maxTypos(query string) int {
+	switch n := len([]rune(query)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein returns the edit distance between a and b, counting an
+// adjacent transposition as a single edit
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+// trigrams returns the three letter windows of a word, padded so that
+// short words still have one
+func trigrams(word string) []string {
+	r := []rune(" " + word + " ")
+	grams := make([]string, 0, len(r)-2)
+	for i := 0; i+3 <= len(r); i++ {
+		grams = append(grams, string(r[i:i+3]))
+	}
+	return grams
+}
@@ -0,0 +1,154 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// Index is an in-process UserSearch for deployments without a Mongo text
+// index. It keeps every user in memory with a trigram index of their name
+// and email words, which finds candidates for misspelled queries.
+type Index struct {
+	mu    sync.RWMutex
+	users map[domain.UserID]*domain.User
+	grams map[string]map[domain.UserID]struct{}
+}
+
+func NewIndex() *Index {
+	return &Index{
+		users: make(map[domain.UserID]*domain.User),
+		grams: make(map[string]map[domain.UserID]struct{}),
+	}
+}
+
+// Rebuild replaces the indexed users, e.g. with the repository's contents
+// on startup
+func (i *Index) Rebuild(users []*domain.User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.users = make(map[domain.UserID]*domain.User, len(users))
+	i.grams = make(map[string]map[domain.UserID]struct{})
+	for _, user := range users {
+		i.add(user)
+	}
+}
+
+// Add indexes a user, replacing any previous version of them. Deleted users
+// are removed instead.
+func (i *Index) Add(user *domain.User) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(user.ID)
+	i.add(user)
+}
+
+func (i *Index) Remove(id domain.UserID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.remove(id)
+}
+
+// Apply catches the index up with a change made without going through an
+// IndexedRepository, such as by another server
+func (i *Index) Apply(change domain.UserChange) {
+	if change.User == nil {
+		i.Remove(change.UserID)
+		return
+	}
+	i.Add(change.User)
+}
+
+func (i *Index) add(user *domain.User) {
+	if user.IsDeleted() {
+		return
+	}
+
+	// Keep a copy without the password hash
+	stored := *user
+	stored.Password = ""
+	i.users[user.ID] = &stored
+
+	for _, token := range userTokens(&stored) {
+		for _, gram := range trigrams(token) {
+			ids, ok := i.grams[gram]
+			if !ok {
+				ids = make(map[domain.UserID]struct{})
+				i.grams[gram] = ids
+			}
+			ids[user.ID] = struct{}{}
+		}
+	}
+}
+
+func (i *Index) remove(id domain.UserID) {
+	user, ok := i.users[id]
+	if !ok {
+		return
+	}
+
+	for _, token := range userTokens(user) {
+		for _, gram := range trigrams(token) {
+			delete(i.grams[gram], id)
+			if len(i.grams[gram]) == 0 {
+				delete(i.grams, gram)
+			}
+		}
+	}
+	delete(i.users, id)
+}
+
+func (i *Index) Search(ctx context.Context, query string, limit int) ([]*ports.UserSearchResult, error) {
+	queryTokens := Tokenize(query)
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	// Any user sharing a trigram with the query is a candidate
+	candidates := make(map[domain.UserID]struct{})
+	for _, token := range queryTokens {
+		for _, gram := range trigrams(token) {
+			for id := range i.grams[gram] {
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+
+	results := make([]*ports.UserSearchResult, 0, len(candidates))
+	for id := range candidates {
+		user := i.users[id]
+		if score := Score(queryTokens, user); score > 0 {
+			// Callers may modify the users they get back
+			found := *user
+			results = append(results, &ports.UserSearchResult{User: &found, Score: score})
+		}
+	}
+
+	return Rank(results, limit), nil
+}
+
+// Rank orders results by score, best first, and keeps the top limit. Ties
+// are broken by name and then ID so that the order is stable.
+func Rank(results []*ports.UserSearchResult, limit int) []*ports.UserSearchResult {
+	sort.Slice(results, func(a, b int) bool {
+		ra, rb := results[a], results[b]
+		if ra.Score != rb.Score {
+			return ra.Score > rb.Score
+		}
+		if ra.User.Name != rb.User.Name {
+			return ra.User.Name < rb.User.Name
+		}
+		return ra.User.ID < rb.User.ID
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
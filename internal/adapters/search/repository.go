@@ -0,0 +1,139 @@
+package search
+
+import (
+	"context"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// IndexedRepository keeps an Index up to date with the writes made through
+// the UserRepository it wraps. Reads go straight to the wrapped repository.
+// The writes of a transaction reach the index when it ends, see Transactor.
+type IndexedRepository struct {
+	ports.UserRepository
+	index *Index
+}
+
+func NewIndexedRepository(repo ports.UserRepository, index *Index) *IndexedRepository {
+	return &IndexedRepository{
+		UserRepository: repo,
+		index:          index,
+	}
+}
+
+func (r *IndexedRepository) Create(ctx context.Context, user *domain.User) error {
+	if err := r.UserRepository.Create(ctx, user); err != nil {
+		return err
+	}
+	if !deferred(ctx, user.ID) {
+		r.index.Add(user)
+	}
+	return nil
+}
+
+func (r *IndexedRepository) Update(ctx context.Context, id domain.UserID, user *domain.User) error {
+	if err := r.UserRepository.Update(ctx, id, user); err != nil {
+		return err
+	}
+	if !deferred(ctx, id) {
+		r.reindex(ctx, id)
+	}
+	return nil
+}
+
+func (r *IndexedRepository) Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	user, err := r.UserRepository.Patch(ctx, id, patch)
+	if err != nil {
+		return nil, err
+	}
+	if !deferred(ctx, id) {
+		r.index.Add(user)
+	}
+	return user, nil
+}
+
+func (r *IndexedRepository) PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error) {
+	changed, err := r.UserRepository.PatchMany(ctx, patches)
+	if err != nil {
+		return nil, err
+	}
+	if deferred(ctx, changed...) {
+		return changed, nil
+	}
+	users, err := r.UserRepository.GetByIDs(ctx, changed)
+	if err != nil {
+		// The index catches up with the users on their next write
+		return changed, nil
+	}
+	for _, user := range users {
+		r.index.Add(user)
+	}
+	return changed, nil
+}
+
+func (r *IndexedRepository) UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error) {
+	updated, err := r.UserRepository.UpdateStatus(ctx, id, user)
+	if err != nil {
+		return nil, err
+	}
+	if !deferred(ctx, id) {
+		r.index.Add(updated)
+	}
+	return updated, nil
+}
+
+func (r *IndexedRepository) Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	if err := r.UserRepository.Delete(ctx, id, expectedVersion); err != nil {
+		return err
+	}
+	if !deferred(ctx, id) {
+		r.index.Remove(id)
+	}
+	return nil
+}
+
+func (r *IndexedRepository) DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error) {
+	deleted, err := r.UserRepository.DeleteMany(ctx, expectedVersions)
+	if err != nil {
+		return nil, err
+	}
+	if deferred(ctx, deleted...) {
+		return deleted, nil
+	}
+	for _, id := range deleted {
+		r.index.Remove(id)
+	}
+	return deleted, nil
+}
+
+func (r *IndexedRepository) Restore(ctx context.Context, id domain.UserID) error {
+	if err := r.UserRepository.Restore(ctx, id); err != nil {
+		return err
+	}
+	if !deferred(ctx, id) {
+		r.reindex(ctx, id)
+	}
+	return nil
+}
+
+func (r *IndexedRepository) Erase(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := r.UserRepository.Erase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !deferred(ctx, id) {
+		r.index.Remove(id)
+	}
+	return user, nil
+}
+
+// reindex reloads a user after a partial update, or a transaction
+func (r *IndexedRepository) reindex(ctx context.Context, id domain.UserID) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil || user == nil {
+		r.index.Remove(id)
+		return
+	}
+	r.index.Add(user)
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"context"
+	"sync"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// transactionKey is the context key of the transaction a context belongs to
+type transactionKey struct{}
+
+// transaction collects the users the writes of a transaction changed
+type transaction struct {
+	mu  sync.Mutex
+	ids []domain.UserID
+}
+
+func (t *transaction) add(ids []domain.UserID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids = append(t.ids, ids...)
+}
+
+func transactionOf(ctx context.Context) *transaction {
+	tx, _ := ctx.Value(transactionKey{}).(*transaction)
+	return tx
+}
+
+// Transactor wraps the Transactor of the storage behind an
+// IndexedRepository, so that the index only sees the writes of a
+// transaction once it has ended
+type Transactor struct {
+	ports.Transactor
+	repo *IndexedRepository
+}
+
+// Transactor wraps the Transactor of the storage behind the
+// IndexedRepository. Services must use it rather than the storage's, or the
+// index keeps writes that are rolled back.
+func (r *IndexedRepository) Transactor(transactor ports.Transactor) *Transactor {
+	return &Transactor{Transactor: transactor, repo: r}
+}
+
+// WithinTransaction runs fn in a transaction of the wrapped Transactor and,
+// once it has committed or rolled back, reindexes the users its writes
+// changed as they are stored
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if transactionOf(ctx) != nil {
+		return t.Transactor.WithinTransaction(ctx, fn)
+	}
+
+	tx := &transaction{}
+	err := t.Transactor.WithinTransaction(context.WithValue(ctx, transactionKey{}, tx), fn)
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for _, id := range tx.ids {
+		t.repo.reindex(ctx, id)
+	}
+	return err
+}
+
+// deferred records the users a write changed within a transaction, to
+// reindex once it ends, and reports whether the write was in one
+func deferred(ctx context.Context, ids ...domain.UserID) bool {
+	tx := transactionOf(ctx)
+	if tx == nil {
+		return false
+	}
+	tx.add(ids)
+	return true
+}
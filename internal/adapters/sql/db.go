@@ -0,0 +1,166 @@
+// Package sql stores users, preferences and erasure tombstones in a
+// relational database through database/sql. SQLite and PostgreSQL are
+// supported; the schema is created by the embedded migrations.
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-hexagonal/internal/domain"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// DB is a connection pool to a SQLite or PostgreSQL database
+type DB struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Open connects to a database. dialectName is "sqlite", with a file path
+// or file: URI as the DSN, or "postgres", with a connection URL.
+func Open(dialectName, dsn string) (*DB, error) {
+	d, err := dialectByName(dialectName)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(d.driverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	if d.name() == "sqlite" {
+		// SQLite serializes writes anyway, and one connection keeps it
+		// from failing them with SQLITE_BUSY instead
+		db.SetMaxOpenConns(1)
+	}
+	return &DB{db: db, dialect: d}, nil
+}
+
+// storeError marks errors from a database that can't be reached, is busy or
+// didn't answer in time as unavailable, leaving other errors as they are
+func storeError(d dialect, err error) error {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) || d.isUnavailable(err) {
+		return domain.Unavailable(err)
+	}
+	return err
+}
+
+func (db *DB) Close() error {
+	return db.db.Close()
+}
+
+// Ping checks that the database can be reached
+func (db *DB) Ping(ctx context.Context) error {
+	return db.db.PingContext(ctx)
+}
+
+// Migrate applies the migrations of the dialect that have not been applied
+// yet, each in its own transaction, and records them in schema_migrations
+func (db *DB) Migrate(ctx context.Context) error {
+	_, err := db.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	pending, err := db.migrationFiles()
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if applied[m.version] {
+			continue
+		}
+		if err := db.apply(ctx, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+type migration struct {
+	version int
+	name    string
+}
+
+// migrationFiles lists the migrations of the dialect in version order.
+// Their names start with the version, e.g. 0001_init.sql.
+func (db *DB) migrationFiles() ([]migration, error) {
+	entries, err := fs.ReadDir(migrations, "migrations/"+db.dialect.name())
+	if err != nil {
+		return nil, err
+	}
+
+	var files []migration
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".sql") {
+			return nil, fmt.Errorf("invalid migration name %s", entry.Name())
+		}
+		files = append(files, migration{version: version, name: entry.Name()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+	return files, nil
+}
+
+func (db *DB) apply(ctx context.Context, m migration) error {
+	script, err := migrations.ReadFile("migrations/" + db.dialect.name() + "/" + m.name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, db.dialect.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`),
+		m.version, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
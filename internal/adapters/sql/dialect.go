@@ -0,0 +1,142 @@
+package sql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect holds what differs between the supported databases. Queries are
+// written with ? placeholders and rebound for databases that number them.
+type dialect interface {
+	name() string
+	driverName() string
+	rebind(query string) string
+	// isUniqueViolation reports whether a write was rejected by a unique
+	// constraint or index
+	isUniqueViolation(err error) bool
+	// isEmailTaken reports whether a write was rejected by the unique
+	// constraint on users.email
+	isEmailTaken(err error) bool
+	// isUnavailable reports whether the database was unreachable, busy or
+	// shutting down, beyond the errors every driver reports the same way
+	isUnavailable(err error) bool
+	// attributeEquals returns a condition matching users whose custom
+	// attribute has the value, with its arguments
+	attributeEquals(name string, value interface{}) (string, []interface{}, error)
+	// attributeExpr returns the expression indexing a custom attribute,
+	// whose name has been validated by the attribute schema
+	attributeExpr(name string) string
+}
+
+func dialectByName(name string) (dialect, error) {
+	switch name {
+	case "sqlite":
+		return sqliteDialect{}, nil
+	case "postgres":
+		return postgresDialect{}, nil
+	}
+	return nil, fmt.Errorf("unsupported SQL dialect %q", name)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string       { return "sqlite" }
+func (sqliteDialect) driverName() string { return "sqlite" }
+
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func (d sqliteDialect) isEmailTaken(err error) bool {
+	// SQLite names the columns of the violated constraint, not the constraint
+	return d.isUniqueViolation(err) && strings.Contains(err.Error(), "failed: users.email")
+}
+
+func (sqliteDialect) isUnavailable(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// Extended codes keep the primary code in their low byte
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+func (sqliteDialect) attributeEquals(name string, value interface{}) (string, []interface{}, error) {
+	return `json_extract(attributes, ?) = ?`, []interface{}{`$."` + name + `"`, value}, nil
+}
+
+func (sqliteDialect) attributeExpr(name string) string {
+	return `json_extract(attributes, '$.` + name + `')`
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) name() string       { return "postgres" }
+func (postgresDialect) driverName() string { return "pgx" }
+
+// rebind numbers the placeholders of a query, which contains no literal ?
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (postgresDialect) isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (postgresDialect) isEmailTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_email_unique"
+}
+
+func (postgresDialect) isUnavailable(err error) bool {
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) {
+		return true
+	}
+	// Class 08 is connection exceptions, class 53 insufficient resources and
+	// 57P01 to 57P03 the server shutting down or not accepting connections
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") ||
+		pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+}
+
+func (postgresDialect) attributeEquals(name string, value interface{}) (string, []interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return `attributes -> ? = CAST(? AS JSONB)`, []interface{}{name, string(encoded)}, nil
+}
+
+func (postgresDialect) attributeExpr(name string) string {
+	return `(attributes ->> '` + name + `')`
+}
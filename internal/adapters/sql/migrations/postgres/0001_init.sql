@@ -0,0 +1,46 @@
+-- IDs, names and emails sort bytewise like they do in Mongo, which keeps
+-- keyset pagination independent of the database locale
+CREATE TABLE users (
+    id                TEXT COLLATE "C" PRIMARY KEY,
+    name              TEXT COLLATE "C" NOT NULL,
+    email             TEXT COLLATE "C" NOT NULL,
+    password          TEXT NOT NULL DEFAULT '',
+    roles             JSONB,
+    status            TEXT NOT NULL DEFAULT '',
+    status_reason     TEXT NOT NULL DEFAULT '',
+    status_changed_at TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL,
+    deleted_at        TIMESTAMPTZ,
+    display_name      TEXT NOT NULL DEFAULT '',
+    locale            TEXT NOT NULL DEFAULT '',
+    timezone          TEXT NOT NULL DEFAULT '',
+    phone             TEXT NOT NULL DEFAULT '',
+    bio               TEXT NOT NULL DEFAULT '',
+    attributes        JSONB,
+    avatar            JSONB,
+    version           BIGINT NOT NULL DEFAULT 1,
+    CONSTRAINT users_email_unique UNIQUE (email)
+);
+
+CREATE INDEX users_created_at ON users (created_at, id);
+CREATE INDEX users_name ON users (name, id);
+CREATE INDEX users_deleted_at ON users (deleted_at);
+
+CREATE TABLE preferences (
+    user_id    TEXT NOT NULL,
+    namespace  TEXT NOT NULL,
+    data       JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    version    BIGINT NOT NULL,
+    PRIMARY KEY (user_id, namespace)
+);
+
+CREATE TABLE erasure_tombstones (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL,
+    requested_by TEXT NOT NULL,
+    stores       JSONB NOT NULL,
+    erased_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX erasure_tombstones_user_id ON erasure_tombstones (user_id);
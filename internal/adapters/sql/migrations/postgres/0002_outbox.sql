@@ -0,0 +1,9 @@
+-- Events are relayed in sequence order, the order they were appended
+CREATE TABLE outbox (
+    sequence     BIGSERIAL PRIMARY KEY,
+    id           TEXT NOT NULL UNIQUE,
+    event        JSONB NOT NULL,
+    published_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_published_at ON outbox (published_at, sequence);
@@ -0,0 +1,44 @@
+CREATE TABLE users (
+    id                TEXT PRIMARY KEY,
+    name              TEXT NOT NULL,
+    email             TEXT NOT NULL,
+    password          TEXT NOT NULL DEFAULT '',
+    roles             TEXT,
+    status            TEXT NOT NULL DEFAULT '',
+    status_reason     TEXT NOT NULL DEFAULT '',
+    status_changed_at TIMESTAMP,
+    created_at        TIMESTAMP NOT NULL,
+    deleted_at        TIMESTAMP,
+    display_name      TEXT NOT NULL DEFAULT '',
+    locale            TEXT NOT NULL DEFAULT '',
+    timezone          TEXT NOT NULL DEFAULT '',
+    phone             TEXT NOT NULL DEFAULT '',
+    bio               TEXT NOT NULL DEFAULT '',
+    attributes        TEXT,
+    avatar            TEXT,
+    version           INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT users_email_unique UNIQUE (email)
+);
+
+CREATE INDEX users_created_at ON users (created_at, id);
+CREATE INDEX users_name ON users (name, id);
+CREATE INDEX users_deleted_at ON users (deleted_at);
+
+CREATE TABLE preferences (
+    user_id    TEXT NOT NULL,
+    namespace  TEXT NOT NULL,
+    data       TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    version    INTEGER NOT NULL,
+    PRIMARY KEY (user_id, namespace)
+);
+
+CREATE TABLE erasure_tombstones (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL,
+    requested_by TEXT NOT NULL,
+    stores       TEXT NOT NULL,
+    erased_at    TIMESTAMP NOT NULL
+);
+
+CREATE INDEX erasure_tombstones_user_id ON erasure_tombstones (user_id);
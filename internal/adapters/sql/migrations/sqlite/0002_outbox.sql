@@ -0,0 +1,9 @@
+-- Events are relayed in sequence order, the order they were appended
+CREATE TABLE outbox (
+    sequence     INTEGER PRIMARY KEY AUTOINCREMENT,
+    id           TEXT NOT NULL UNIQUE,
+    event        TEXT NOT NULL,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX outbox_published_at ON outbox (published_at, sequence);
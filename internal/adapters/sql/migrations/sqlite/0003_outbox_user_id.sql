@@ -0,0 +1,6 @@
+-- Events are found by user, to export them and to erase the user from them
+ALTER TABLE outbox ADD COLUMN user_id TEXT;
+
+UPDATE outbox SET user_id = json_extract(event, '$.userId');
+
+CREATE INDEX outbox_user_id ON outbox (user_id);
@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// OutboxRepository stores events as JSON in the outbox table
+type OutboxRepository struct {
+	db      conn
+	dialect dialect
+}
+
+func NewOutboxRepository(db *DB) *OutboxRepository {
+	return &OutboxRepository{db: conn{pool: db.db}, dialect: db.dialect}
+}
+
+func (r *OutboxRepository) Append(ctx context.Context, events ...*domain.Event) error {
+	for _, event := range events {
+		event.ID = ids.NewID()
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = r.db.ExecContext(ctx, r.dialect.rebind(`INSERT INTO outbox (id, user_id, event) VALUES (?, ?, ?)`),
+			event.ID, event.UserID.String(), string(data))
+		if err != nil {
+			return storeError(r.dialect, err)
+		}
+	}
+	return nil
+}
+
+func (r *OutboxRepository) Unpublished(ctx context.Context, limit int) ([]*domain.Event, error) {
+	return r.query(ctx, `WHERE published_at IS NULL ORDER BY sequence LIMIT ?`, limit)
+}
+
+// query reads the events matching the conditions that follow the FROM
+func (r *OutboxRepository) query(ctx context.Context, conditions string, args ...interface{}) ([]*domain.Event, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(`SELECT event FROM outbox `+conditions), args...)
+	if err != nil {
+		return nil, storeError(r.dialect, err)
+	}
+	defer rows.Close()
+
+	events := []*domain.Event{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, storeError(r.dialect, err)
+		}
+		var event domain.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, storeError(r.dialect, rows.Err())
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []interface{}{at.UTC()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`UPDATE outbox SET published_at = ? WHERE published_at IS NULL AND id IN (`+placeholders+`)`), args...)
+	return storeError(r.dialect, err)
+}
+
+func (r *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`DELETE FROM outbox WHERE published_at < ?`), before.UTC())
+	if err != nil {
+		return 0, storeError(r.dialect, err)
+	}
+	return result.RowsAffected()
+}
+
+// Name implements ports.PersonalDataStore
+func (r *OutboxRepository) Name() string {
+	return ports.OutboxStoreName
+}
+
+// ExportUserData implements ports.PersonalDataStore with the events about
+// the user that are still kept
+func (r *OutboxRepository) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	events, err := r.query(ctx, `WHERE user_id = ? ORDER BY sequence`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	records := make([]interface{}, len(events))
+	for i, event := range events {
+		records[i] = event
+	}
+	return records, nil
+}
+
+// EraseUserData implements ports.PersonalDataStore by removing the user
+// from the events about them
+func (r *OutboxRepository) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	events, err := r.query(ctx, `WHERE user_id = ?`, userID.String())
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if event.User == nil {
+			continue
+		}
+		event.User = nil
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = r.db.ExecContext(ctx, r.dialect.rebind(`UPDATE outbox SET event = ? WHERE id = ?`), string(data), event.ID)
+		if err != nil {
+			return storeError(r.dialect, err)
+		}
+	}
+	return nil
+}
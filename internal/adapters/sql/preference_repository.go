@@ -0,0 +1,133 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type PreferenceRepository struct {
+	db      conn
+	dialect dialect
+}
+
+func NewPreferenceRepository(db *DB) *PreferenceRepository {
+	return &PreferenceRepository{db: conn{pool: db.db}, dialect: db.dialect}
+}
+
+const selectPreferences = `SELECT user_id, namespace, data, updated_at, version FROM preferences `
+
+func (r *PreferenceRepository) Get(ctx context.Context, userID domain.UserID, namespace string) (*domain.Preferences, error) {
+	prefs, err := scanPreferences(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		selectPreferences+`WHERE user_id = ? AND namespace = ?`), userID.String(), namespace))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return prefs, storeError(r.dialect, err)
+}
+
+func (r *PreferenceRepository) Put(ctx context.Context, prefs *domain.Preferences) error {
+	if len(prefs.Values) == 0 {
+		if prefs.Version == 0 {
+			return nil
+		}
+		result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+			`DELETE FROM preferences WHERE user_id = ? AND namespace = ? AND version = ?`),
+			prefs.UserID.String(), prefs.Namespace, prefs.Version)
+		if err := versionedWrite(result, err); err != nil {
+			return err
+		}
+		prefs.Version = 0
+		return nil
+	}
+
+	data, err := json.Marshal(prefs.Values)
+	if err != nil {
+		return err
+	}
+	updatedAt := time.Now()
+
+	if prefs.Version == 0 {
+		_, err := r.db.ExecContext(ctx, r.dialect.rebind(
+			`INSERT INTO preferences (user_id, namespace, data, updated_at, version) VALUES (?, ?, ?, ?, 1)`),
+			prefs.UserID.String(), prefs.Namespace, string(data), updatedAt.UTC())
+		if r.dialect.isUniqueViolation(err) {
+			return ports.ErrVersionConflict
+		}
+		if err != nil {
+			return storeError(r.dialect, err)
+		}
+	} else {
+		result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+			`UPDATE preferences SET data = ?, updated_at = ?, version = version + 1
+			WHERE user_id = ? AND namespace = ? AND version = ?`),
+			string(data), updatedAt.UTC(), prefs.UserID.String(), prefs.Namespace, prefs.Version)
+		if err := versionedWrite(result, err); err != nil {
+			return err
+		}
+	}
+
+	prefs.UpdatedAt = updatedAt
+	prefs.Version++
+	return nil
+}
+
+// versionedWrite returns ports.ErrVersionConflict for a write that matched
+// no row at the expected version
+func versionedWrite(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ports.ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *PreferenceRepository) ListByUser(ctx context.Context, userID domain.UserID) ([]*domain.Preferences, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(
+		selectPreferences+`WHERE user_id = ? ORDER BY namespace`), userID.String())
+	if err != nil {
+		return nil, storeError(r.dialect, err)
+	}
+	defer rows.Close()
+
+	var all []*domain.Preferences
+	for rows.Next() {
+		prefs, err := scanPreferences(rows)
+		if err != nil {
+			return nil, storeError(r.dialect, err)
+		}
+		all = append(all, prefs)
+	}
+	return all, storeError(r.dialect, rows.Err())
+}
+
+func (r *PreferenceRepository) DeleteByUser(ctx context.Context, userID domain.UserID) error {
+	_, err := r.db.ExecContext(ctx, r.dialect.rebind(`DELETE FROM preferences WHERE user_id = ?`), userID.String())
+	return storeError(r.dialect, err)
+}
+
+func scanPreferences(row scanner) (*domain.Preferences, error) {
+	var (
+		prefs domain.Preferences
+		data  string
+	)
+	if err := row.Scan(&prefs.UserID, &prefs.Namespace, &data, &prefs.UpdatedAt, &prefs.Version); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &prefs.Values); err != nil {
+		return nil, err
+	}
+	prefs.UpdatedAt = prefs.UpdatedAt.UTC()
+	return &prefs, nil
+}
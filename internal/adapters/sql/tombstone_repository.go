@@ -0,0 +1,61 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+type TombstoneRepository struct {
+	db      conn
+	dialect dialect
+}
+
+func NewTombstoneRepository(db *DB) *TombstoneRepository {
+	return &TombstoneRepository{db: conn{pool: db.db}, dialect: db.dialect}
+}
+
+func (r *TombstoneRepository) Create(ctx context.Context, tombstone *domain.ErasureTombstone) error {
+	stores, err := json.Marshal(tombstone.Stores)
+	if err != nil {
+		return err
+	}
+
+	id := ids.NewID()
+	_, err = r.db.ExecContext(ctx, r.dialect.rebind(
+		`INSERT INTO erasure_tombstones (id, user_id, requested_by, stores, erased_at) VALUES (?, ?, ?, ?, ?)`),
+		id, tombstone.UserID.String(), tombstone.RequestedBy.String(), string(stores), tombstone.ErasedAt.UTC())
+	if err != nil {
+		return storeError(r.dialect, err)
+	}
+
+	tombstone.ID = id
+	return nil
+}
+
+func (r *TombstoneRepository) GetByUserID(ctx context.Context, userID domain.UserID) (*domain.ErasureTombstone, error) {
+	var (
+		tombstone domain.ErasureTombstone
+		storeList string
+	)
+	err := r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`SELECT id, requested_by, stores, erased_at FROM erasure_tombstones
+		WHERE user_id = ? ORDER BY erased_at DESC LIMIT 1`), userID.String(),
+	).Scan(&tombstone.ID, &tombstone.RequestedBy, &storeList, &tombstone.ErasedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(r.dialect, err)
+	}
+
+	tombstone.UserID = userID
+	if err := json.Unmarshal([]byte(storeList), &tombstone.Stores); err != nil {
+		return nil, err
+	}
+	tombstone.ErasedAt = tombstone.ErasedAt.UTC()
+	return &tombstone, nil
+}
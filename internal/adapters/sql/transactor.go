@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// txKey is the context key of the transaction repositories run in
+type txKey struct{}
+
+// Transactor runs functions in a database transaction that the
+// repositories opened on the same DB pick up from the context
+type Transactor struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func NewTransactor(db *DB) *Transactor {
+	return &Transactor{db: db.db, dialect: db.dialect}
+}
+
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storeError(t.dialect, err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return storeError(t.dialect, tx.Commit())
+}
+
+// conn runs statements in the transaction of the context if there is one,
+// and on the pool otherwise. *sql.DB and *sql.Tx have the same methods, so
+// the repositories use it as if it were the pool.
+type conn struct {
+	pool *sql.DB
+}
+
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (c conn) executor(ctx context.Context) executor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return c.pool
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.executor(ctx).ExecContext(ctx, query, args...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.executor(ctx).QueryContext(ctx, query, args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.executor(ctx).QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,661 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UserRepository stores users in the users table with the semantics of the
+// Mongo adapter. Writes other than Create read the user, change it and
+// write it back only if its version is unchanged, retrying when another
+// write got there first.
+type UserRepository struct {
+	db      conn
+	dialect dialect
+	ids     ports.IDGenerator
+}
+
+func NewUserRepository(db *DB, ids ports.IDGenerator) *UserRepository {
+	return &UserRepository{db: conn{pool: db.db}, dialect: db.dialect, ids: ids}
+}
+
+// userColumns are the columns of the users table, in the order userArgs
+// and scanUser use
+var userColumns = []string{
+	"id", "name", "email", "password", "roles", "status", "status_reason", "status_changed_at",
+	"created_at", "deleted_at", "display_name", "locale", "timezone", "phone", "bio",
+	"attributes", "avatar", "version",
+}
+
+var selectUsers = `SELECT ` + strings.Join(userColumns, ", ") + ` FROM users `
+
+// eachBatchSize is how many users Each reads per query
+const eachBatchSize = 500
+
+// avatarRecord is how avatars are stored. Unlike domain.Avatar's JSON form
+// it includes the blob keys.
+type avatarRecord struct {
+	URL         string            `json:"url"`
+	Thumbnails  map[string]string `json:"thumbnails,omitempty"`
+	ContentType string            `json:"contentType"`
+	Keys        []string          `json:"keys"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// writeError translates a write rejected by the unique constraint on
+// email into ports.ErrEmailTaken
+func (r *UserRepository) writeError(err error) error {
+	if r.dialect.isEmailTaken(err) {
+		return ports.ErrEmailTaken
+	}
+	return storeError(r.dialect, err)
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	id := user.ID
+	if id.IsZero() {
+		id = r.ids.NewUserID()
+	}
+	user.Version = 1
+
+	stored := *user
+	stored.ID = id
+	args, err := userArgs(&stored)
+	if err != nil {
+		return err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userColumns)), ", ")
+	_, err = r.db.ExecContext(ctx, r.dialect.rebind(
+		`INSERT INTO users (`+strings.Join(userColumns, ", ")+`) VALUES (`+placeholders+`)`), args...)
+	if err != nil {
+		return r.writeError(err)
+	}
+
+	user.ID = id
+	return nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := r.load(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ports.ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []domain.UserID) ([]*domain.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id.String()
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	return r.query(ctx, `WHERE id IN (`+placeholders+`) AND deleted_at IS NULL`, args...)
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		selectUsers+`WHERE email = ? AND deleted_at IS NULL`), email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ports.ErrNotFound
+	}
+	return user, storeError(r.dialect, err)
+}
+
+func (r *UserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
+	return r.query(ctx, `WHERE deleted_at IS NULL ORDER BY id`)
+}
+
+func (r *UserRepository) Each(ctx context.Context, fn func(*domain.User) error) error {
+	return r.each(ctx, false, fn)
+}
+
+func (r *UserRepository) EachIncludingDeleted(ctx context.Context, fn func(*domain.User) error) error {
+	return r.each(ctx, true, fn)
+}
+
+// each reads users in batches by ID, calling fn only between queries so
+// that fn can write to the repository
+func (r *UserRepository) each(ctx context.Context, includeDeleted bool, fn func(*domain.User) error) error {
+	where := `WHERE id > ?`
+	if !includeDeleted {
+		where += ` AND deleted_at IS NULL`
+	}
+	where += ` ORDER BY id LIMIT ?`
+
+	after := ""
+	for {
+		users, err := r.query(ctx, where, after, eachBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if err := fn(user); err != nil {
+				return err
+			}
+		}
+		if len(users) < eachBatchSize {
+			return nil
+		}
+		after = users[len(users)-1].ID.String()
+	}
+}
+
+func (r *UserRepository) List(ctx context.Context, query ports.UserQuery) (*ports.UserPage, error) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	if query.EmailPrefix != "" {
+		conditions = append(conditions, `lower(email) LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(strings.ToLower(query.EmailPrefix))+"%")
+	}
+	if query.NameContains != "" {
+		conditions = append(conditions, `lower(name) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(query.NameContains))+"%")
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, query.CreatedAfter.UTC())
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, `created_at < ?`)
+		args = append(args, query.CreatedBefore.UTC())
+	}
+
+	var total int64
+	err := r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`SELECT COUNT(*) FROM users WHERE `+strings.Join(conditions, " AND ")), args...).Scan(&total)
+	if err != nil {
+		return nil, storeError(r.dialect, err)
+	}
+
+	column := sortColumn(query.SortBy)
+	direction, op := "ASC", ">"
+	if query.Descending {
+		direction, op = "DESC", "<"
+	}
+
+	// Continue after the cursor's sort key, using the ID to break ties
+	if query.Cursor != "" {
+		cursor, err := ports.DecodeCursor(query)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := domain.ParseUserID(cursor.ID); err != nil {
+			return nil, ports.ErrInvalidCursor
+		}
+		var value interface{} = cursor.Value
+		if cursor.SortBy == ports.SortByCreatedAt {
+			createdAt, _ := cursor.CreatedAt()
+			value = createdAt.UTC()
+		}
+		conditions = append(conditions, fmt.Sprintf(`(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))`, column, op))
+		args = append(args, value, value, cursor.ID)
+	}
+
+	// Read one user more than the page holds to tell whether another
+	// page follows
+	where := `WHERE ` + strings.Join(conditions, " AND ") +
+		fmt.Sprintf(` ORDER BY %[1]s %[2]s, id %[2]s LIMIT ?`, column, direction)
+	args = append(args, query.Limit+1)
+	if query.Cursor == "" && query.Offset > 0 {
+		where += ` OFFSET ?`
+		args = append(args, query.Offset)
+	}
+
+	users, err := r.query(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ports.UserPage{Users: users, Total: total}
+	if len(users) > query.Limit {
+		page.Users = users[:query.Limit]
+		page.NextCursor = ports.CursorAfter(query, page.Users[query.Limit-1]).Encode()
+	}
+	return page, nil
+}
+
+func sortColumn(field ports.UserSortField) string {
+	switch field {
+	case ports.SortByName:
+		return "name"
+	case ports.SortByEmail:
+		return "email"
+	}
+	return "created_at"
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, for use with
+// ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (r *UserRepository) Update(ctx context.Context, id domain.UserID, user *domain.User) error {
+	updated, err := r.modify(ctx, id, false, 0, func(existing *domain.User) error {
+		existing.Name = user.Name
+		existing.Email = user.Email
+		return nil
+	})
+	return found(updated, err)
+}
+
+func (r *UserRepository) Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	if patch.IsEmpty() {
+		user, err := r.load(ctx, id, false)
+		if err == nil && user != nil && patch.Version != 0 && user.Version != patch.Version {
+			return nil, ports.ErrVersionConflict
+		}
+		return user, found(user, err)
+	}
+
+	user, err := r.modify(ctx, id, false, patch.Version, func(user *domain.User) error {
+		applyPatch(user, patch)
+		return nil
+	})
+	return user, found(user, err)
+}
+
+func (r *UserRepository) PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error) {
+	var changed []domain.UserID
+	for id, patch := range patches {
+		if patch.IsEmpty() {
+			continue
+		}
+		_, err := r.Patch(ctx, id, patch)
+		if errors.Is(err, ports.ErrNotFound) || errors.Is(err, ports.ErrVersionConflict) || errors.Is(err, ports.ErrEmailTaken) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, id)
+	}
+	return changed, nil
+}
+
+// applyPatch sets the fields of a patch on a user
+func applyPatch(user *domain.User, patch domain.UserPatch) {
+	fields := []struct{ value, field *string }{
+		{patch.Name, &user.Name},
+		{patch.Email, &user.Email},
+		{patch.Password, &user.Password},
+		{patch.DisplayName, &user.DisplayName},
+		{patch.Locale, &user.Locale},
+		{patch.Timezone, &user.Timezone},
+		{patch.Phone, &user.Phone},
+		{patch.Bio, &user.Bio},
+	}
+	for _, f := range fields {
+		if f.value != nil {
+			*f.field = *f.value
+		}
+	}
+
+	for name, value := range patch.Attributes {
+		if value == nil {
+			delete(user.Attributes, name)
+			continue
+		}
+		if user.Attributes == nil {
+			user.Attributes = make(map[string]interface{})
+		}
+		user.Attributes[name] = value
+	}
+}
+
+func (r *UserRepository) UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error) {
+	updated, err := r.modify(ctx, id, false, user.Version, func(existing *domain.User) error {
+		existing.Status = user.Status
+		existing.StatusReason = user.StatusReason
+		existing.StatusChangedAt = user.StatusChangedAt
+		return nil
+	})
+	if err := found(updated, err); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// found returns ports.ErrNotFound for a write that found no user to change
+func found(user *domain.User, err error) error {
+	if err == nil && user == nil {
+		return ports.ErrNotFound
+	}
+	return err
+}
+
+func (r *UserRepository) SetAvatar(ctx context.Context, id domain.UserID, avatar *domain.Avatar) (*domain.User, error) {
+	user, err := r.modify(ctx, id, false, 0, func(user *domain.User) error {
+		user.Avatar = avatar
+		return nil
+	})
+	return user, found(user, err)
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	user, err := r.modify(ctx, id, false, expectedVersion, func(user *domain.User) error {
+		now := time.Now()
+		user.DeletedAt = &now
+		return nil
+	})
+	return found(user, err)
+}
+
+func (r *UserRepository) DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error) {
+	var deleted []domain.UserID
+	for id, version := range expectedVersions {
+		user, err := r.modify(ctx, id, false, version, func(user *domain.User) error {
+			now := time.Now()
+			user.DeletedAt = &now
+			return nil
+		})
+		if errors.Is(err, ports.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, nil
+}
+
+func (r *UserRepository) SetEmail(ctx context.Context, id domain.UserID, email string) error {
+	_, err := r.modify(ctx, id, true, 0, func(user *domain.User) error {
+		user.Email = email
+		return nil
+	})
+	return err
+}
+
+func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	return r.exists(ctx, `email = ?`, email)
+}
+
+func (r *UserRepository) AttributeExists(ctx context.Context, name string, value interface{}, exceptID domain.UserID) (bool, error) {
+	condition, args, err := r.dialect.attributeEquals(name, value)
+	if err != nil {
+		return false, err
+	}
+	return r.exists(ctx, condition+` AND id <> ?`, append(args, exceptID.String())...)
+}
+
+func (r *UserRepository) exists(ctx context.Context, condition string, args ...interface{}) (bool, error) {
+	var one int
+	err := r.db.QueryRowContext(ctx, r.dialect.rebind(`SELECT 1 FROM users WHERE `+condition+` LIMIT 1`), args...).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// EnsureAttributeIndexes creates a unique index for every unique custom
+// attribute of the schema, so concurrent writes can't duplicate a value
+// that AttributeExists has just reported as free
+func (r *UserRepository) EnsureAttributeIndexes(ctx context.Context, schema *domain.AttributeSchema) error {
+	for _, d := range schema.Definitions() {
+		if !d.Unique {
+			continue
+		}
+		expr := r.dialect.attributeExpr(d.Name)
+		_, err := r.db.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS users_attributes_`+d.Name+`_unique
+			ON users (`+expr+`) WHERE `+expr+` IS NOT NULL`)
+		if err != nil {
+			return storeError(r.dialect, err)
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) GetDeleted(ctx context.Context) ([]*domain.User, error) {
+	return r.query(ctx, `WHERE deleted_at IS NOT NULL ORDER BY id`)
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id domain.UserID) error {
+	user, err := r.modify(ctx, id, true, 0, func(user *domain.User) error {
+		if !user.IsDeleted() {
+			return ports.ErrNotFound
+		}
+		user.DeletedAt = nil
+		return nil
+	})
+	if err == nil && user == nil {
+		return ports.ErrNotFound
+	}
+	return err
+}
+
+func (r *UserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < ?`), deletedBefore.UTC())
+	if err != nil {
+		return 0, storeError(r.dialect, err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *UserRepository) Erase(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx, r.dialect.rebind(
+		`DELETE FROM users WHERE id = ? RETURNING `+strings.Join(userColumns, ", ")), id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ports.ErrNotFound
+	}
+	return user, storeError(r.dialect, err)
+}
+
+// load reads a user, or returns nil if there is none
+func (r *UserRepository) load(ctx context.Context, id domain.UserID, includeDeleted bool) (*domain.User, error) {
+	where := `WHERE id = ?`
+	if !includeDeleted {
+		where += ` AND deleted_at IS NULL`
+	}
+	user, err := scanUser(r.db.QueryRowContext(ctx, r.dialect.rebind(selectUsers+where), id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, storeError(r.dialect, err)
+}
+
+// modify reads a user, applies change and writes the user back, and
+// returns the updated user or nil if there is none. If another write
+// replaced the user in the meantime it starts over, unless expectedVersion
+// is set, in which case the user must still be at that version.
+func (r *UserRepository) modify(ctx context.Context, id domain.UserID, includeDeleted bool, expectedVersion int64, change func(*domain.User) error) (*domain.User, error) {
+	for {
+		user, err := r.load(ctx, id, includeDeleted)
+		if err != nil || user == nil {
+			return nil, err
+		}
+		if expectedVersion != 0 && user.Version != expectedVersion {
+			return nil, ports.ErrVersionConflict
+		}
+		if err := change(user); err != nil {
+			return nil, err
+		}
+
+		written, err := r.replace(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			return user, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, storeError(r.dialect, err)
+		}
+	}
+}
+
+// replace writes a user over the stored row if it is still at the user's
+// Version, and increments the Version. It reports whether it wrote.
+func (r *UserRepository) replace(ctx context.Context, user *domain.User) (bool, error) {
+	args, err := userArgs(user)
+	if err != nil {
+		return false, err
+	}
+
+	// Every column but the ID is set, the version last
+	set := make([]string, 0, len(userColumns)-1)
+	for _, column := range userColumns[1:] {
+		set = append(set, column+" = ?")
+	}
+	args = append(args[1:len(args)-1], user.Version+1, user.ID.String(), user.Version)
+
+	result, err := r.db.ExecContext(ctx, r.dialect.rebind(
+		`UPDATE users SET `+strings.Join(set, ", ")+` WHERE id = ? AND version = ?`), args...)
+	if err != nil {
+		return false, r.writeError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	user.Version++
+	return true, nil
+}
+
+func (r *UserRepository) query(ctx context.Context, where string, args ...interface{}) ([]*domain.User, error) {
+	rows, err := r.db.QueryContext(ctx, r.dialect.rebind(selectUsers+where), args...)
+	if err != nil {
+		return nil, storeError(r.dialect, err)
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, storeError(r.dialect, err)
+		}
+		users = append(users, user)
+	}
+	return users, storeError(r.dialect, rows.Err())
+}
+
+// userArgs returns the values of a user's columns, in the order of
+// userColumns
+func userArgs(user *domain.User) ([]interface{}, error) {
+	var roles, attributes, avatar interface{}
+	if len(user.Roles) > 0 {
+		data, err := json.Marshal(user.Roles)
+		if err != nil {
+			return nil, err
+		}
+		roles = string(data)
+	}
+	if len(user.Attributes) > 0 {
+		data, err := json.Marshal(user.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		attributes = string(data)
+	}
+	if user.Avatar != nil {
+		data, err := json.Marshal(avatarRecord{
+			URL:         user.Avatar.URL,
+			Thumbnails:  user.Avatar.Thumbnails,
+			ContentType: user.Avatar.ContentType,
+			Keys:        user.Avatar.Keys,
+			UpdatedAt:   user.Avatar.UpdatedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		avatar = string(data)
+	}
+
+	return []interface{}{
+		user.ID.String(), user.Name, user.Email, user.Password, roles, string(user.Status), user.StatusReason,
+		timeArg(user.StatusChangedAt), user.CreatedAt.UTC(), timeArg(user.DeletedAt),
+		user.DisplayName, user.Locale, user.Timezone, user.Phone, user.Bio,
+		attributes, avatar, user.Version,
+	}, nil
+}
+
+// timeArg stores optional times as NULL and the others in UTC, which keeps
+// them comparable in SQLite, where they are text
+func timeArg(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*domain.User, error) {
+	var (
+		user                       domain.User
+		status                     string
+		roles, attributes, avatar  sql.NullString
+		statusChangedAt, deletedAt sql.NullTime
+	)
+	err := row.Scan(
+		&user.ID, &user.Name, &user.Email, &user.Password, &roles, &status, &user.StatusReason,
+		&statusChangedAt, &user.CreatedAt, &deletedAt,
+		&user.DisplayName, &user.Locale, &user.Timezone, &user.Phone, &user.Bio,
+		&attributes, &avatar, &user.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = domain.UserStatus(status)
+	user.CreatedAt = user.CreatedAt.UTC()
+	user.StatusChangedAt = nullTime(statusChangedAt)
+	user.DeletedAt = nullTime(deletedAt)
+
+	if roles.Valid {
+		if err := json.Unmarshal([]byte(roles.String), &user.Roles); err != nil {
+			return nil, err
+		}
+	}
+	if attributes.Valid {
+		if err := json.Unmarshal([]byte(attributes.String), &user.Attributes); err != nil {
+			return nil, err
+		}
+		if len(user.Attributes) == 0 {
+			user.Attributes = nil
+		}
+	}
+	if avatar.Valid {
+		var record avatarRecord
+		if err := json.Unmarshal([]byte(avatar.String), &record); err != nil {
+			return nil, err
+		}
+		user.Avatar = &domain.Avatar{
+			URL:         record.URL,
+			Thumbnails:  record.Thumbnails,
+			ContentType: record.ContentType,
+			Keys:        record.Keys,
+			UpdatedAt:   record.UpdatedAt,
+		}
+	}
+	return &user, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
@@ -0,0 +1,306 @@
+// Package app assembles the storage and services the servers run on from
+// the configuration, leaving each server to start its own transport.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"backend-hexagonal/internal/adapters/cache"
+	"backend-hexagonal/internal/adapters/events"
+	"backend-hexagonal/internal/adapters/ids"
+	ldapadapter "backend-hexagonal/internal/adapters/ldap"
+	"backend-hexagonal/internal/adapters/memory"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/adapters/search"
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/migrations"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+)
+
+// App holds the repositories and services of a server
+type App struct {
+	// Schema declares the custom user attributes, nil when there are none
+	Schema *domain.AttributeSchema
+
+	UserRepo   ports.UserRepository
+	Transactor ports.Transactor
+	Outbox     ports.OutboxRepository
+	Tombstones ports.TombstoneRepository
+
+	Users       *service.UserService
+	Auth        *service.AuthService
+	Search      *service.SearchService
+	Preferences *service.PreferenceService
+	// UserChanges follows the writes of every server, nil unless
+	// USER_CHANGE_STREAM is on
+	UserChanges *service.UserChangeBus
+
+	userCache    *cache.Repository
+	changeStream ports.UserChangeStream
+	publisher    ports.EventPublisher
+	closers      []func()
+}
+
+// New connects to the configured storage, migrating it, and assembles the
+// services on top of it. ctx bounds the startup.
+func New(ctx context.Context) (*App, error) {
+	a := &App{}
+	if err := a.assemble(ctx); err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *App) assemble(ctx context.Context) error {
+	// Custom user attributes are declared by the deployment
+	schema, err := loadAttributeSchema(config.UserSchemaFile())
+	if err != nil {
+		return err
+	}
+	a.Schema = schema
+
+	var (
+		preferenceRepo ports.PreferenceRepository
+		db             *mongo.Database
+	)
+	switch config.Storage() {
+	case "memory":
+		log.Println("storing data in memory, it is lost on restart")
+		a.UserRepo = memory.NewUserRepository(ids.NewObjectIDGenerator())
+		preferenceRepo = memory.NewPreferenceRepository()
+		a.Transactor = memory.NewTransactor()
+		a.Outbox = memory.NewOutboxRepository()
+		a.Tombstones = memory.NewTombstoneRepository()
+	case "sqlite", "postgres":
+		sqlDB, err := sqladapter.Open(config.Storage(), config.SQLDSN())
+		if err != nil {
+			return err
+		}
+		a.closers = append(a.closers, func() { sqlDB.Close() })
+		if err := sqlDB.Migrate(ctx); err != nil {
+			return err
+		}
+
+		sqlRepo := sqladapter.NewUserRepository(sqlDB, ids.NewObjectIDGenerator())
+		if err := sqlRepo.EnsureAttributeIndexes(ctx, schema); err != nil {
+			return err
+		}
+		a.UserRepo = sqlRepo
+		preferenceRepo = sqladapter.NewPreferenceRepository(sqlDB)
+		a.Transactor = sqladapter.NewTransactor(sqlDB)
+		a.Outbox = sqladapter.NewOutboxRepository(sqlDB)
+		a.Tombstones = sqladapter.NewTombstoneRepository(sqlDB)
+	default:
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI()))
+		if err != nil {
+			return err
+		}
+		a.closers = append(a.closers, func() { client.Disconnect(context.Background()) })
+		db = client.Database(config.DBName())
+
+		if err := migrateOnStart(db); err != nil {
+			return err
+		}
+
+		mongoRepo := mongoadapter.NewUserRepository(db)
+		if err := mongoRepo.EnsureAttributeIndexes(ctx, schema); err != nil {
+			return err
+		}
+		a.UserRepo = mongoRepo
+		preferenceRepo = mongoadapter.NewPreferenceRepository(db)
+		a.Transactor, err = mongoadapter.NewTransactor(ctx, client, config.MongoAllowNoTransactions())
+		if err != nil {
+			return err
+		}
+		a.Outbox = mongoadapter.NewOutboxRepository(db)
+		a.Tombstones = mongoadapter.NewTombstoneRepository(db)
+	}
+
+	// Search with the Mongo text index, or an in-process index kept up to
+	// date by wrapping the repository when the users are not in Mongo
+	var userSearch ports.UserSearch
+	var index *search.Index
+	if config.SearchBackend() == "memory" || db == nil {
+		users, err := a.UserRepo.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		index = search.NewIndex()
+		index.Rebuild(users)
+		userSearch = index
+		indexed := search.NewIndexedRepository(a.UserRepo, index)
+		a.UserRepo = indexed
+		a.Transactor = indexed.Transactor(a.Transactor)
+	} else {
+		mongoSearch := mongoadapter.NewUserSearch(db)
+		if err := mongoSearch.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		userSearch = mongoSearch
+	}
+
+	// Serve repeated reads of a user by ID or email from memory
+	if config.UserCache() {
+		a.userCache = cache.NewRepository(a.UserRepo, cache.Config{
+			Size:        config.UserCacheSize(),
+			TTL:         config.UserCacheTTL(),
+			NegativeTTL: config.UserCacheNegativeTTL(),
+		})
+		a.UserRepo = a.userCache
+		a.Transactor = a.userCache.Transactor(a.Transactor)
+	}
+
+	// Follow the writes of every server, so the cache and index don't miss
+	// the ones made elsewhere
+	if config.UserChangeStream() {
+		if db == nil {
+			return errors.New("USER_CHANGE_STREAM needs STORAGE=mongo")
+		}
+		a.UserChanges = service.NewUserChangeBus()
+		if a.userCache != nil {
+			a.UserChanges.Handle(a.userCache.Invalidate)
+		}
+		if index != nil {
+			a.UserChanges.Handle(index.Apply)
+		}
+		a.changeStream = mongoadapter.NewUserChangeStream(db, config.UserChangeStreamName())
+	}
+
+	// Preference namespaces are declared by the deployment too
+	preferenceSchema, err := loadPreferenceSchema(config.PreferenceSchemaFile())
+	if err != nil {
+		return err
+	}
+
+	a.Users = service.NewUserService(a.UserRepo).WithAttributeSchema(schema).WithTransactor(a.Transactor).WithOutbox(a.Outbox)
+	a.Search = service.NewSearchService(userSearch)
+	a.Preferences = service.NewPreferenceService(preferenceRepo, preferenceSchema)
+	a.Auth = service.NewAuthService(a.UserRepo).WithAttributeSchema(schema).WithTransactor(a.Transactor).WithOutbox(a.Outbox)
+
+	// Authenticate against a directory instead of local password hashes
+	if config.CredentialBackend() == "ldap" {
+		verifier, err := ldapadapter.NewCredentialVerifier(ldapadapter.ConfigFromEnv())
+		if err != nil {
+			return err
+		}
+		a.Auth = service.NewAuthServiceWithVerifier(a.UserRepo, verifier).WithAttributeSchema(schema).WithTransactor(a.Transactor).WithOutbox(a.Outbox)
+	}
+
+	a.publisher, err = newEventPublisher()
+	return err
+}
+
+// Start runs the background work every server does until the process
+// exits: following the change stream, delivering the events of the outbox
+// and logging the cache's statistics
+func (a *App) Start() {
+	if a.changeStream != nil {
+		go a.UserChanges.Run(context.Background(), a.changeStream, 5*time.Second)
+	}
+
+	// With a shared database, configure a publisher on one instance only,
+	// so events keep their order
+	if a.publisher != nil {
+		relay := service.NewOutboxRelay(a.Outbox, a.publisher).WithRetention(config.OutboxRetention())
+		go relay.Run(context.Background(), config.OutboxPollInterval())
+	}
+
+	if a.userCache != nil {
+		go logCacheStats(a.userCache)
+	}
+}
+
+// Close disconnects from the storage
+func (a *App) Close() {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		a.closers[i]()
+	}
+	a.closers = nil
+}
+
+// migrateOnStart applies the pending Mongo migrations, or with
+// MIGRATE_ON_START=false checks there are none. Migrations get a context of
+// their own, since index builds can outlast the startup timeout.
+func migrateOnStart(db *mongo.Database) error {
+	migrator := migrations.New(mongoadapter.NewMigrationStore(db), mongoadapter.Migrations(db))
+	if !config.MigrateOnStart() {
+		pending, err := migrator.Pending(context.Background())
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations are pending, run `migrate up` first", len(pending))
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up(context.Background())
+	for _, m := range applied {
+		log.Printf("applied migration %d %s", m.Version, m.Name)
+	}
+	return err
+}
+
+// loadAttributeSchema reads the custom user attribute schema, if a file is
+// configured
+func loadAttributeSchema(path string) (*domain.AttributeSchema, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return domain.ParseAttributeSchema(data)
+}
+
+// loadPreferenceSchema reads the preference namespaces, if a file is
+// configured
+func loadPreferenceSchema(path string) (*domain.PreferenceSchema, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return domain.ParsePreferenceSchema(data)
+}
+
+// newEventPublisher opens the configured publisher of user events, or
+// returns nil when none is configured
+func newEventPublisher() (ports.EventPublisher, error) {
+	switch config.EventPublisher() {
+	case "":
+		return nil, nil
+	case "log":
+		return events.NewLogPublisher(), nil
+	case "webhook":
+		return events.NewWebhookPublisher(config.EventWebhookURL())
+	default:
+		return nil, fmt.Errorf("unknown EVENT_PUBLISHER %q", config.EventPublisher())
+	}
+}
+
+// logCacheStats logs how often the user cache answered lookups, every
+// minute
+func logCacheStats(userCache *cache.Repository) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		stats := userCache.Stats()
+		log.Printf("user cache: %d hits, %d misses, %d entries\n", stats.Hits, stats.Misses, stats.Entries)
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -57,6 +60,333 @@ func GRPCPort() string {
 	return ":9000"
 }
 
+// SCIMToken returns the bearer token expected from SCIM provisioning clients.
+// SCIM endpoints are disabled when it is empty.
+func SCIMToken() string {
+	return os.Getenv("SCIM_TOKEN")
+}
+
+// CredentialBackend selects how passwords are verified: "local" (bcrypt
+// hashes in the user repository) or "ldap"
+func CredentialBackend() string {
+	if v := os.Getenv("CREDENTIAL_BACKEND"); v != "" {
+		return v
+	}
+	return "local"
+}
+
+func LDAPURL() string {
+	return os.Getenv("LDAP_URL")
+}
+
+func LDAPStartTLS() bool {
+	return os.Getenv("LDAP_START_TLS") == "true"
+}
+
+func LDAPInsecureSkipVerify() bool {
+	return os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true"
+}
+
+// LDAPUserDNTemplate enables bind-as-user, e.g. "uid={username},ou=people,dc=example,dc=org"
+func LDAPUserDNTemplate() string {
+	return os.Getenv("LDAP_USER_DN_TEMPLATE")
+}
+
+func LDAPBindDN() string {
+	return os.Getenv("LDAP_BIND_DN")
+}
+
+func LDAPBindPassword() string {
+	return os.Getenv("LDAP_BIND_PASSWORD")
+}
+
+func LDAPUserBaseDN() string {
+	return os.Getenv("LDAP_USER_BASE_DN")
+}
+
+func LDAPUserFilter() string {
+	if v := os.Getenv("LDAP_USER_FILTER"); v != "" {
+		return v
+	}
+	return "(mail={username})"
+}
+
+func LDAPEmailAttribute() string {
+	if v := os.Getenv("LDAP_EMAIL_ATTRIBUTE"); v != "" {
+		return v
+	}
+	return "mail"
+}
+
+func LDAPNameAttribute() string {
+	if v := os.Getenv("LDAP_NAME_ATTRIBUTE"); v != "" {
+		return v
+	}
+	return "cn"
+}
+
+func LDAPGroupBaseDN() string {
+	return os.Getenv("LDAP_GROUP_BASE_DN")
+}
+
+// LDAPGroupFilter looks groups up by member DN, e.g. "(member={dn})".
+// When empty the user's memberOf attribute is used instead.
+func LDAPGroupFilter() string {
+	return os.Getenv("LDAP_GROUP_FILTER")
+}
+
+// LDAPGroupRoles parses LDAP_GROUP_ROLES, a semicolon separated list of
+// group=role pairs such as "domain admins=admin;cn=devs,ou=groups,dc=example,dc=org=developer".
+// Groups may be common names or full DNs; the role follows the last "=".
+func LDAPGroupRoles() map[string]string {
+	roles := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("LDAP_GROUP_ROLES"), ";") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			continue
+		}
+		roles[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return roles
+}
+
+// Storage selects where data is kept: "mongo", "sqlite", "postgres" or
+// "memory". Memory storage needs no database and loses everything on
+// restart, so it is only for development.
+func Storage() string {
+	if v := os.Getenv("STORAGE"); v != "" {
+		return v
+	}
+	return "mongo"
+}
+
+// SQLDSN locates the database of the sqlite and postgres storages: a file
+// path for SQLite, a connection URL for PostgreSQL
+func SQLDSN() string {
+	if v := os.Getenv("SQL_DSN"); v != "" {
+		return v
+	}
+	return "users.db"
+}
+
+// SearchBackend selects how users are searched: "mongo" (a text index on
+// the users collection) or "memory" (an in-process index built on startup).
+// Memory storage always searches in memory.
+func SearchBackend() string {
+	if v := os.Getenv("SEARCH_BACKEND"); v != "" {
+		return v
+	}
+	return "mongo"
+}
+
+// UserSchemaFile is the path of the JSON file declaring custom user
+// attributes. Users have no custom attributes when it is empty.
+func UserSchemaFile() string {
+	return os.Getenv("USER_SCHEMA_FILE")
+}
+
+// PreferenceSchemaFile is the path of the JSON file declaring the
+// namespaces of user preferences, their JSON Schemas and defaults. Users
+// can't store preferences when it is empty.
+func PreferenceSchemaFile() string {
+	return os.Getenv("PREFERENCE_SCHEMA_FILE")
+}
+
+// BlobBackend selects where uploaded files such as avatars are stored:
+// "filesystem" (below BlobDir) or "s3"
+func BlobBackend() string {
+	if v := os.Getenv("BLOB_BACKEND"); v != "" {
+		return v
+	}
+	return "filesystem"
+}
+
+func BlobDir() string {
+	if v := os.Getenv("BLOB_DIR"); v != "" {
+		return v
+	}
+	return "./data/blobs"
+}
+
+// BlobPublicURL is the base URL clients fetch stored files from. The
+// default is the server's own /media route, which works with every backend.
+func BlobPublicURL() string {
+	if v := os.Getenv("BLOB_PUBLIC_URL"); v != "" {
+		return v
+	}
+	return "/media"
+}
+
+// S3Endpoint is the URL of an S3-compatible service. Empty means AWS.
+func S3Endpoint() string {
+	return os.Getenv("S3_ENDPOINT")
+}
+
+func S3Region() string {
+	if v := os.Getenv("S3_REGION"); v != "" {
+		return v
+	}
+	return "us-east-1"
+}
+
+func S3Bucket() string {
+	return os.Getenv("S3_BUCKET")
+}
+
+func S3AccessKeyID() string {
+	return os.Getenv("S3_ACCESS_KEY_ID")
+}
+
+func S3SecretAccessKey() string {
+	return os.Getenv("S3_SECRET_ACCESS_KEY")
+}
+
+func S3UsePathStyle() bool {
+	return os.Getenv("S3_USE_PATH_STYLE") == "true"
+}
+
+// AvatarMaxBytes is the largest avatar upload accepted
+func AvatarMaxBytes() int64 {
+	return bytesEnv("AVATAR_MAX_BYTES", 2<<20)
+}
+
+// ImportMaxBytes is the largest bulk import accepted over HTTP. Larger
+// imports go through the users CLI, which streams files of any size.
+func ImportMaxBytes() int64 {
+	return bytesEnv("IMPORT_MAX_BYTES", 32<<20)
+}
+
+// DeletedUserRetention is how long soft deleted users are kept before they
+// are purged
+func DeletedUserRetention() time.Duration {
+	return durationEnv("DELETED_USER_RETENTION", 30*24*time.Hour)
+}
+
+// PurgeInterval is how often the purge of soft deleted users runs
+func PurgeInterval() time.Duration {
+	return durationEnv("PURGE_INTERVAL", time.Hour)
+}
+
+// MigrateOnStart makes the servers apply pending Mongo migrations before
+// serving. When it is "false" they refuse to start until `migrate up` has
+// run, so deployments can migrate once, before rolling out instances.
+func MigrateOnStart() bool {
+	return os.Getenv("MIGRATE_ON_START") != "false"
+}
+
+// MongoAllowNoTransactions lets the servers write to a standalone mongod,
+// which can't run transactions, when it is "true". Writes to several
+// documents are then not atomic and the outbox no longer guarantees that
+// every change has its event.
+func MongoAllowNoTransactions() bool {
+	return os.Getenv("MONGO_ALLOW_NO_TRANSACTIONS") == "true"
+}
+
+// EventPublisher selects where the outbox relay delivers user events: "log"
+// (the server log) or "webhook" (POSTed to EventWebhookURL). Events stay in
+// the outbox, undelivered, when it is empty.
+func EventPublisher() string {
+	return os.Getenv("EVENT_PUBLISHER")
+}
+
+// EventWebhookURL is the URL user events are POSTed to, one JSON event per
+// request
+func EventWebhookURL() string {
+	return os.Getenv("EVENT_WEBHOOK_URL")
+}
+
+// OutboxPollInterval is how often the relay looks for events to deliver
+func OutboxPollInterval() time.Duration {
+	return durationEnv("OUTBOX_POLL_INTERVAL", time.Second)
+}
+
+// OutboxRetention is how long delivered events are kept in the outbox
+func OutboxRetention() time.Duration {
+	return durationEnv("OUTBOX_RETENTION", 7*24*time.Hour)
+}
+
+// UserCache puts a cache in front of the user repository when it is
+// "true", so reads of a user by ID or email mostly skip the database
+func UserCache() bool {
+	return os.Getenv("USER_CACHE") == "true"
+}
+
+// UserCacheSize is how many lookups of users the cache keeps
+func UserCacheSize() int {
+	return intEnv("USER_CACHE_SIZE", 10000)
+}
+
+// UserCacheTTL is how long the cache keeps a user. Changes made by other
+// servers are seen once it passes.
+func UserCacheTTL() time.Duration {
+	return durationEnv("USER_CACHE_TTL", time.Minute)
+}
+
+// UserCacheNegativeTTL is how long the cache remembers that there is no
+// user with an ID or email
+func UserCacheNegativeTTL() time.Duration {
+	return durationEnv("USER_CACHE_NEGATIVE_TTL", 5*time.Second)
+}
+
+// UserChangeStream makes the servers follow the writes to users through a
+// MongoDB change stream when it is "true", so their caches see the writes
+// of other servers and gRPC clients can watch them. It needs a replica set.
+func UserChangeStream() bool {
+	return os.Getenv("USER_CHANGE_STREAM") == "true"
+}
+
+// UserChangeStreamName names the position in the change stream a server
+// resumes from after a restart. Every server needs a name of its own; the
+// default is the host name.
+func UserChangeStreamName() string {
+	if v := os.Getenv("USER_CHANGE_STREAM_NAME"); v != "" {
+		return v
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "default"
+}
+
+func bytesEnv(key string, fallback int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("invalid %s %q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+func intEnv(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("invalid %s %q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("invalid %s %q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
 // LoadEnv loads environment variables from .env file
 func LoadEnv() {
 	if err := godotenv.Load(); err != nil {
@@ -0,0 +1,265 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ErrAttributeNotWritable is returned when a caller sets a custom attribute
+// they are not allowed to change
+var ErrAttributeNotWritable = NewError(KindPermissionDenied, "attribute_not_writable", "attribute is not writable")
+
+// AttributeType is the type of a custom attribute's values
+type AttributeType string
+
+const (
+	AttributeTypeString  AttributeType = "string"
+	AttributeTypeNumber  AttributeType = "number"
+	AttributeTypeBoolean AttributeType = "boolean"
+	// AttributeTypeDateTime values are RFC 3339 timestamps
+	AttributeTypeDateTime AttributeType = "datetime"
+)
+
+// AttributeVisibility controls who can read a custom attribute
+type AttributeVisibility string
+
+const (
+	// VisibilityPublic attributes can be read by every authenticated user
+	VisibilityPublic AttributeVisibility = "public"
+	// VisibilityPrivate attributes can be read by the user and admins
+	VisibilityPrivate AttributeVisibility = "private"
+	// VisibilityAdmin attributes can only be read and written by admins
+	VisibilityAdmin AttributeVisibility = "admin"
+)
+
+// Audience is the relationship between a caller and the user they read or
+// write
+type Audience int
+
+const (
+	// AudiencePublic callers are other users, or unauthenticated
+	AudiencePublic Audience = iota
+	// AudienceSelf callers are the user themselves
+	AudienceSelf
+	// AudienceAdmin callers have the admin role
+	AudienceAdmin
+)
+
+// AudienceFor returns the audience of a caller, given their ID and roles,
+// for the user
+func AudienceFor(callerID UserID, callerRoles []string, user *User) Audience {
+	for _, role := range callerRoles {
+		if role == RoleAdmin {
+			return AudienceAdmin
+		}
+	}
+	if !callerID.IsZero() && callerID == user.ID {
+		return AudienceSelf
+	}
+	return AudiencePublic
+}
+
+// AttributeDefinition declares a custom attribute
+type AttributeDefinition struct {
+	Name string        `json:"name"`
+	Type AttributeType `json:"type"`
+	// Required attributes must be given on registration and can't be removed
+	Required bool `json:"required,omitempty"`
+	// Unique attributes can't have the same value on two users
+	Unique     bool                `json:"unique,omitempty"`
+	Visibility AttributeVisibility `json:"visibility,omitempty"`
+}
+
+// VisibleTo reports whether the audience may read the attribute
+func (d AttributeDefinition) VisibleTo(audience Audience) bool {
+	switch d.Visibility {
+	case VisibilityPublic:
+		return true
+	case VisibilityPrivate:
+		return audience >= AudienceSelf
+	default:
+		return audience == AudienceAdmin
+	}
+}
+
+// WritableBy reports whether the audience may set the attribute. Users can
+// change their own public and private attributes.
+func (d AttributeDefinition) WritableBy(audience Audience) bool {
+	if d.Visibility == VisibilityAdmin {
+		return audience == AudienceAdmin
+	}
+	return audience >= AudienceSelf
+}
+
+// attributeName matches the names attributes can be declared with, which
+// are also their keys in JSON and storage
+var attributeName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// AttributeSchema is the set of custom attributes a deployment declares.
+// A nil schema declares none.
+type AttributeSchema struct {
+	definitions map[string]AttributeDefinition
+}
+
+// ParseAttributeSchema reads a schema file of the form
+// {"attributes": [{"name": "employeeId", "type": "string", "unique": true}]}
+func ParseAttributeSchema(data []byte) (*AttributeSchema, error) {
+	var file struct {
+		Attributes []AttributeDefinition `json:"attributes"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid attribute schema: %w", err)
+	}
+	return NewAttributeSchema(file.Attributes)
+}
+
+// NewAttributeSchema checks the definitions and returns their schema.
+// Visibility defaults to private.
+func NewAttributeSchema(definitions []AttributeDefinition) (*AttributeSchema, error) {
+	schema := &AttributeSchema{definitions: make(map[string]AttributeDefinition)}
+	for _, d := range definitions {
+		if !attributeName.MatchString(d.Name) {
+			return nil, fmt.Errorf("invalid attribute schema: %q is not a valid attribute name", d.Name)
+		}
+		if _, ok := schema.definitions[d.Name]; ok {
+			return nil, fmt.Errorf("invalid attribute schema: %s is declared twice", d.Name)
+		}
+		switch d.Type {
+		case AttributeTypeString, AttributeTypeNumber, AttributeTypeBoolean, AttributeTypeDateTime:
+		default:
+			return nil, fmt.Errorf("invalid attribute schema: %s has unknown type %q", d.Name, d.Type)
+		}
+		switch d.Visibility {
+		case "":
+			d.Visibility = VisibilityPrivate
+		case VisibilityPublic, VisibilityPrivate, VisibilityAdmin:
+		default:
+			return nil, fmt.Errorf("invalid attribute schema: %s has unknown visibility %q", d.Name, d.Visibility)
+		}
+		schema.definitions[d.Name] = d
+	}
+	return schema, nil
+}
+
+// Definitions returns the declared attributes sorted by name
+func (s *AttributeSchema) Definitions() []AttributeDefinition {
+	if s == nil {
+		return nil
+	}
+	definitions := make([]AttributeDefinition, 0, len(s.definitions))
+	for _, d := range s.definitions {
+		definitions = append(definitions, d)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
+	return definitions
+}
+
+// Definition looks up a declared attribute
+func (s *AttributeSchema) Definition(name string) (AttributeDefinition, bool) {
+	if s == nil {
+		return AttributeDefinition{}, false
+	}
+	d, ok := s.definitions[name]
+	return d, ok
+}
+
+// Normalize checks attribute values against their declared types and
+// returns them in their stored form: numbers as float64 and datetimes as
+// UTC RFC 3339 strings. Nil values, which remove an attribute, are kept.
+func (s *AttributeSchema) Normalize(attributes map[string]interface{}) (map[string]interface{}, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+
+	normalized := make(map[string]interface{}, len(attributes))
+	for name, value := range attributes {
+		d, ok := s.Definition(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown attribute %s", ErrInvalidUser, name)
+		}
+		if value == nil {
+			normalized[name] = nil
+			continue
+		}
+		v, ok := d.normalize(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be a %s", ErrInvalidUser, name, d.Type)
+		}
+		normalized[name] = v
+	}
+	return normalized, nil
+}
+
+func (d AttributeDefinition) normalize(value interface{}) (interface{}, bool) {
+	switch d.Type {
+	case AttributeTypeString:
+		s, ok := value.(string)
+		return s, ok
+	case AttributeTypeBoolean:
+		b, ok := value.(bool)
+		return b, ok
+	case AttributeTypeNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, true
+		case float32:
+			return float64(n), true
+		case int:
+			return float64(n), true
+		case int32:
+			return float64(n), true
+		case int64:
+			return float64(n), true
+		}
+	case AttributeTypeDateTime:
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, false
+		}
+		return t.UTC().Format(time.RFC3339Nano), true
+	}
+	return nil, false
+}
+
+// CheckRequired checks that the attributes include every required one
+func (s *AttributeSchema) CheckRequired(attributes map[string]interface{}) error {
+	for _, d := range s.Definitions() {
+		if d.Required && attributes[d.Name] == nil {
+			return fmt.Errorf("%w: %s is required", ErrInvalidUser, d.Name)
+		}
+	}
+	return nil
+}
+
+// CheckWritable checks that the audience may set or remove every given
+// attribute. Unknown attributes are left to Normalize.
+func (s *AttributeSchema) CheckWritable(attributes map[string]interface{}, audience Audience) error {
+	for name := range attributes {
+		if d, ok := s.Definition(name); ok && !d.WritableBy(audience) {
+			return fmt.Errorf("%w: %s", ErrAttributeNotWritable, name)
+		}
+	}
+	return nil
+}
+
+// Visible returns the attributes the audience may read. Stored attributes
+// that are no longer declared are left out.
+func (s *AttributeSchema) Visible(attributes map[string]interface{}, audience Audience) map[string]interface{} {
+	var visible map[string]interface{}
+	for name, value := range attributes {
+		if d, ok := s.Definition(name); ok && d.VisibleTo(audience) {
+			if visible == nil {
+				visible = make(map[string]interface{})
+			}
+			visible[name] = value
+		}
+	}
+	return visible
+}
@@ -1,9 +1,5 @@
 package domain
 
-import (
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
-
 type AuthRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
@@ -13,6 +9,8 @@ type RegisterRequest struct {
 	Name     string `json:"name" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	Profile
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 type AuthResponse struct {
@@ -21,7 +19,16 @@ type AuthResponse struct {
 }
 
 type JWTClaims struct {
-	UserID primitive.ObjectID `json:"user_id"`
-	Email  string             `json:"email"`
-	Exp    int64              `json:"exp"`
+	UserID UserID   `json:"user_id"`
+	Email  string   `json:"email"`
+	Roles  []string `json:"roles,omitempty"`
+	Exp    int64    `json:"exp"`
+}
+
+// Identity is a user whose credentials were verified by a credential
+// backend, such as the local password store or a directory server
+type Identity struct {
+	Email string
+	Name  string
+	Roles []string
 }
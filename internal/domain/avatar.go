@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// Avatar is a user's profile picture. The image and its square thumbnails
+// are kept in a blob store.
+type Avatar struct {
+	URL string `json:"url"`
+	// Thumbnails maps edge lengths in pixels, e.g. "64", to thumbnail URLs
+	Thumbnails  map[string]string `json:"thumbnails,omitempty"`
+	ContentType string            `json:"contentType"`
+	// Keys are the blob keys of the image and its thumbnails
+	Keys      []string  `json:"-"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
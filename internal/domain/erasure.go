@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"time"
+)
+
+// ErasureTombstone is the proof that a user's personal data was erased. It
+// holds no personal data itself, only who was erased, when and from where.
+type ErasureTombstone struct {
+	ID          string    `json:"id"`
+	UserID      UserID    `json:"userId"`
+	RequestedBy UserID    `json:"requestedBy"`
+	Stores      []string  `json:"stores"`
+	ErasedAt    time.Time `json:"erasedAt"`
+}
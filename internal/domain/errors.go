@@ -0,0 +1,97 @@
+package domain
+
+import "errors"
+
+// ErrorKind says what kind of failure an error is, so adapters can report
+// errors from any layer the same way without knowing each one. Errors
+// without a kind are internal errors.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	// KindNotFound means the thing asked for doesn't exist
+	KindNotFound
+	// KindConflict means the request clashes with the current state, such
+	// as a taken email or a stale version
+	KindConflict
+	// KindInvalidArgument means the request itself is malformed or invalid
+	KindInvalidArgument
+	// KindUnauthenticated means the caller's credentials or token are
+	// missing or invalid
+	KindUnauthenticated
+	// KindPermissionDenied means the caller is known but not allowed
+	KindPermissionDenied
+	// KindUnavailable means a store or service the request depends on is
+	// down or timing out, so the request may succeed if retried
+	KindUnavailable
+)
+
+var errorKindNames = map[ErrorKind]string{
+	KindInternal:         "internal",
+	KindNotFound:         "not_found",
+	KindConflict:         "conflict",
+	KindInvalidArgument:  "invalid_argument",
+	KindUnauthenticated:  "unauthenticated",
+	KindPermissionDenied: "permission_denied",
+	KindUnavailable:      "unavailable",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return errorKindNames[KindInternal]
+}
+
+// Error is an error of a known kind. Code names the specific error, such as
+// "email_taken", for clients that handle errors of the same kind differently.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	// Err is the underlying error, if any
+	Err error
+}
+
+// NewError returns an error of the kind, for use as a sentinel that callers
+// match with errors.Is and wrap with fmt.Errorf("%w: ...")
+func NewError(kind ErrorKind, code, message string) error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Unavailable wraps an error from a store or service that is down or timing
+// out, keeping it in the chain for logs
+func Unavailable(err error) error {
+	return &Error{Kind: KindUnavailable, Code: "unavailable", Message: "service unavailable", Err: err}
+}
+
+// KindOf returns the kind of the first Error in err's chain, or KindInternal
+// if there is none
+func KindOf(err error) ErrorKind {
+	var kindErr *Error
+	if errors.As(err, &kindErr) {
+		return kindErr.Kind
+	}
+	return KindInternal
+}
+
+// CodeOf returns the code of the first Error in err's chain, or the code of
+// its kind if there is none
+func CodeOf(err error) string {
+	var kindErr *Error
+	if errors.As(err, &kindErr) && kindErr.Code != "" {
+		return kindErr.Code
+	}
+	return KindOf(err).String()
+}
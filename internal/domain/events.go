@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"time"
+)
+
+// EventType names what happened to a user
+type EventType string
+
+const (
+	EventUserRegistered  EventType = "user.registered"
+	EventUserUpdated     EventType = "user.updated"
+	EventUserDeleted     EventType = "user.deleted"
+	EventUserErased      EventType = "user.erased"
+	EventPasswordChanged EventType = "user.password_changed"
+)
+
+// Event tells downstream systems about a change to a user. ID is assigned
+// when the event is stored, and consumers use it to ignore the events they
+// are delivered twice.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	UserID     UserID    `json:"userId"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// User is the user after the change, for registered and updated events.
+	// It is removed from the stored events of a user who is erased.
+	User *EventUser `json:"user,omitempty"`
+}
+
+// EventUser is what events tell about a user: enough for consumers to keep
+// their accounts in sync, leaving out the profile, custom attributes and
+// avatar, which they read from the API if they need them
+type EventUser struct {
+	ID      UserID     `json:"id"`
+	Name    string     `json:"name"`
+	Email   string     `json:"email"`
+	Roles   []string   `json:"roles,omitempty"`
+	Status  UserStatus `json:"status"`
+	Version int64      `json:"version"`
+}
+
+// UserRegistered is the event of a new user
+func UserRegistered(user *User) *Event {
+	return userEvent(EventUserRegistered, user)
+}
+
+// UserUpdated is the event of a change to a user, with the user as it is
+// after the change
+func UserUpdated(user *User) *Event {
+	return userEvent(EventUserUpdated, user)
+}
+
+// UserDeleted is the event of a user being soft deleted
+func UserDeleted(id UserID) *Event {
+	return &Event{Type: EventUserDeleted, UserID: id, OccurredAt: time.Now().UTC()}
+}
+
+// UserErased is the event of a user being erased for good, along with
+// everything held about them. Consumers should erase their copy too.
+func UserErased(id UserID) *Event {
+	return &Event{Type: EventUserErased, UserID: id, OccurredAt: time.Now().UTC()}
+}
+
+// PasswordChanged is the event of a user's password being replaced. It
+// carries nothing about the password.
+func PasswordChanged(id UserID) *Event {
+	return &Event{Type: EventPasswordChanged, UserID: id, OccurredAt: time.Now().UTC()}
+}
+
+// userEvent copies what events tell about the user, so later changes to it
+// don't alter the event
+func userEvent(eventType EventType, user *User) *Event {
+	snapshot := &EventUser{
+		ID:      user.ID,
+		Name:    user.Name,
+		Email:   user.Email,
+		Roles:   append([]string(nil), user.Roles...),
+		Status:  user.CurrentStatus(),
+		Version: user.Version,
+	}
+	return &Event{Type: eventType, UserID: user.ID, OccurredAt: time.Now().UTC(), User: snapshot}
+}
@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// ErrInvalidPreferences is returned when preferences don't match the schema
+// of their namespace
+var ErrInvalidPreferences = NewError(KindInvalidArgument, "invalid_preferences", "invalid preferences")
+
+// MaxPreferencesBytes bounds the JSON size of the preferences a user sets in
+// one namespace
+const MaxPreferencesBytes = 16 << 10
+
+// Preferences are the settings a user has set in one namespace. Settings
+// they haven't set fall back to the namespace's defaults, which are not
+// stored.
+type Preferences struct {
+	UserID    UserID                 `json:"-"`
+	Namespace string                 `json:"namespace"`
+	Values    map[string]interface{} `json:"values"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+	// Version counts the writes to the preferences, starting from 1. Zero
+	// means they have not been stored yet.
+	Version int64 `json:"-"`
+}
+
+// preferenceNamespaceName matches the names namespaces can be declared with
+var preferenceNamespaceName = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// PreferenceNamespace declares a namespace of preferences, such as the
+// settings of one client app
+type PreferenceNamespace struct {
+	Name     string
+	Defaults map[string]interface{}
+	schema   *jsonschema.Schema
+}
+
+// PreferenceSchema is the set of preference namespaces a deployment
+// declares. A nil schema declares none.
+type PreferenceSchema struct {
+	namespaces map[string]*PreferenceNamespace
+}
+
+// ParsePreferenceSchema reads a file of the form
+// {"namespaces": {"ui": {"schema": {...}, "defaults": {"theme": "light"}}}}
+// where each schema is a JSON Schema that the preferences, merged over the
+// defaults, must match
+func ParsePreferenceSchema(data []byte) (*PreferenceSchema, error) {
+	var file struct {
+		Namespaces map[string]struct {
+			Schema   json.RawMessage        `json:"schema"`
+			Defaults map[string]interface{} `json:"defaults"`
+		} `json:"namespaces"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid preference schema: %w", err)
+	}
+
+	s := &PreferenceSchema{namespaces: make(map[string]*PreferenceNamespace)}
+	for name, ns := range file.Namespaces {
+		if !preferenceNamespaceName.MatchString(name) {
+			return nil, fmt.Errorf("invalid preference schema: %q is not a valid namespace name", name)
+		}
+		if len(ns.Schema) == 0 {
+			return nil, fmt.Errorf("invalid preference schema: %s has no schema", name)
+		}
+
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(ns.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("invalid preference schema: %s: %w", name, err)
+		}
+		url := "preferences/" + name + ".json"
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(url, doc); err != nil {
+			return nil, fmt.Errorf("invalid preference schema: %s: %w", name, err)
+		}
+		compiled, err := compiler.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preference schema: %s: %w", name, err)
+		}
+
+		namespace := &PreferenceNamespace{Name: name, Defaults: ns.Defaults, schema: compiled}
+		if err := namespace.Validate(nil); err != nil {
+			return nil, fmt.Errorf("invalid preference schema: the defaults of %s: %w", name, err)
+		}
+		s.namespaces[name] = namespace
+	}
+	return s, nil
+}
+
+// Namespace looks up a declared namespace
+func (s *PreferenceSchema) Namespace(name string) (*PreferenceNamespace, bool) {
+	if s == nil {
+		return nil, false
+	}
+	ns, ok := s.namespaces[name]
+	return ns, ok
+}
+
+// Names returns the declared namespaces sorted by name
+func (s *PreferenceSchema) Names() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.namespaces))
+	for name := range s.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the defaults with the user's values merged over them
+func (n *PreferenceNamespace) Resolve(values map[string]interface{}) map[string]interface{} {
+	resolved := MergePreferences(nil, n.Defaults)
+	return MergePreferences(resolved, values)
+}
+
+// Validate checks the user's values, merged over the defaults, against the
+// namespace's schema
+func (n *PreferenceNamespace) Validate(values map[string]interface{}) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	if len(data) > MaxPreferencesBytes {
+		return fmt.Errorf("%w: preferences must be at most %d bytes", ErrInvalidPreferences, MaxPreferencesBytes)
+	}
+
+	// Validate the JSON form, so numbers of any Go type are checked alike
+	resolved, err := json.Marshal(n.Resolve(values))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(resolved))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	if err := n.schema.Validate(instance); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if errors.As(err, &validationErr) {
+			return fmt.Errorf("%w: %s", ErrInvalidPreferences, validationMessage(validationErr))
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	return nil
+}
+
+// validationMessage describes the first leaf error of a validation, which
+// names the setting at fault
+func validationMessage(err *jsonschema.ValidationError) string {
+	for len(err.Causes) > 0 {
+		err = err.Causes[0]
+	}
+	location := "/"
+	if len(err.InstanceLocation) > 0 {
+		location = ""
+		for _, token := range err.InstanceLocation {
+			location += "/" + token
+		}
+	}
+	return fmt.Sprintf("%s: %s", location, err.ErrorKind.LocalizedString(message.NewPrinter(language.English)))
+}
+
+// MergePreferences applies patch to a copy of target with the rules of JSON
+// Merge Patch (RFC 7396): objects merge recursively and nil removes a
+// setting
+func MergePreferences(target, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(target)+len(patch))
+	for key, value := range target {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		patchObject, ok := value.(map[string]interface{})
+		if !ok {
+			merged[key] = value
+			continue
+		}
+		targetObject, _ := merged[key].(map[string]interface{})
+		merged[key] = MergePreferences(targetObject, patchObject)
+	}
+	return merged
+}
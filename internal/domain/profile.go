@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+	// Timezones are validated against the embedded database so that
+	// validation doesn't depend on the host's zoneinfo files
+	_ "time/tzdata"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Limits of the free-text profile fields, in characters
+const (
+	MaxDisplayNameLength = 100
+	MaxBioLength         = 500
+)
+
+// e164 matches phone numbers in E.164 format, e.g. "+66812345678"
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// Profile holds the optional, self-described attributes of a user. Empty
+// fields are unset.
+type Profile struct {
+	DisplayName string `json:"displayName,omitempty"`
+	// Locale is a BCP 47 language tag such as "th-TH"
+	Locale string `json:"locale,omitempty"`
+	// Timezone is an IANA time zone name such as "Asia/Bangkok"
+	Timezone string `json:"timezone,omitempty"`
+	// Phone is in E.164 format
+	Phone string `json:"phone,omitempty"`
+	Bio   string `json:"bio,omitempty"`
+}
+
+// Validate checks the fields that are set
+func (p Profile) Validate() error {
+	if err := ValidateDisplayName(p.DisplayName); err != nil {
+		return err
+	}
+	if err := ValidateLocale(p.Locale); err != nil {
+		return err
+	}
+	if err := ValidateTimezone(p.Timezone); err != nil {
+		return err
+	}
+	if err := ValidatePhone(p.Phone); err != nil {
+		return err
+	}
+	return ValidateBio(p.Bio)
+}
+
+// ValidateDisplayName checks the length of a display name
+func ValidateDisplayName(displayName string) error {
+	if utf8.RuneCountInString(displayName) > MaxDisplayNameLength {
+		return fmt.Errorf("%w: displayName must be at most %d characters", ErrInvalidUser, MaxDisplayNameLength)
+	}
+	return nil
+}
+
+// ValidateLocale checks that a locale is a well-formed BCP 47 tag
+func ValidateLocale(locale string) error {
+	if locale == "" {
+		return nil
+	}
+	if _, err := language.Parse(locale); err != nil {
+		return fmt.Errorf("%w: %q is not a valid locale", ErrInvalidUser, locale)
+	}
+	return nil
+}
+
+// ValidateTimezone checks that a timezone is a known IANA zone name
+func ValidateTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	// LoadLocation also accepts "Local", which means nothing to clients
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+		return fmt.Errorf("%w: %q is not a valid timezone", ErrInvalidUser, timezone)
+	}
+	return nil
+}
+
+// ValidatePhone checks that a phone number is in E.164 format
+func ValidatePhone(phone string) error {
+	if phone != "" && !e164.MatchString(phone) {
+		return fmt.Errorf("%w: phone must be in E.164 format, e.g. +66812345678", ErrInvalidUser)
+	}
+	return nil
+}
+
+// ValidateBio checks the length of a bio
+func ValidateBio(bio string) error {
+	if utf8.RuneCountInString(bio) > MaxBioLength {
+		return fmt.Errorf("%w: bio must be at most %d characters", ErrInvalidUser, MaxBioLength)
+	}
+	return nil
+}
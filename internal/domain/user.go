@@ -1,14 +1,195 @@
 package domain
 
 import (
-    "time"
-    "go.mongodb.org/mongo-driver/bson/primitive"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
 )
 
+// ErrInvalidUser is returned when user attributes break the domain rules
+var ErrInvalidUser = NewError(KindInvalidArgument, "invalid_user", "invalid user")
+
+// RoleAdmin grants access to the administrative endpoints
+const RoleAdmin = "admin"
+
+// UserStatus is the lifecycle state of an account
+type UserStatus string
+
+const (
+	// UserStatusPending accounts exist but have not been activated yet
+	UserStatusPending UserStatus = "pending"
+	// UserStatusActive accounts can log in and use the API
+	UserStatusActive UserStatus = "active"
+	// UserStatusSuspended accounts were blocked by an admin and can be reactivated
+	UserStatusSuspended UserStatus = "suspended"
+	// UserStatusDeactivated accounts were closed but their data is kept
+	UserStatusDeactivated UserStatus = "deactivated"
+)
+
+// userStatusTransitions lists the statuses each status may move to
+var userStatusTransitions = map[UserStatus][]UserStatus{
+	UserStatusPending:     {UserStatusActive, UserStatusDeactivated},
+	UserStatusActive:      {UserStatusSuspended, UserStatusDeactivated},
+	UserStatusSuspended:   {UserStatusActive, UserStatusDeactivated},
+	UserStatusDeactivated: {UserStatusActive},
+}
+
+// IsValid reports whether s is a known status
+func (s UserStatus) IsValid() bool {
+	_, ok := userStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an account may move from s to next
+func (s UserStatus) CanTransitionTo(next UserStatus) bool {
+	for _, allowed := range userStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
-    ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-    Name      string             `json:"name" bson:"name"`
-    Email     string             `json:"email" bson:"email"`
-    Password  string             `json:"-" bson:"password"` // ไม่ส่งออก password เวลา JSON
-    CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ID              UserID     `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"` // ไม่ส่งออก password เวลา JSON
+	Roles           []string   `json:"roles,omitempty"`
+	Status          UserStatus `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt *time.Time `json:"statusChangedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	DeletedAt       *time.Time `json:"deletedAt,omitempty"`
+	Profile
+	// Attributes holds the custom attributes declared by the deployment's
+	// AttributeSchema
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Avatar     *Avatar                `json:"avatar,omitempty"`
+	// Version counts the writes to the user and guards against lost updates.
+	// Users stored before versioning have none until their next write.
+	Version int64 `json:"version"`
+}
+
+// CurrentStatus returns the account status. Accounts created before
+// statuses were introduced have none stored and are active.
+func (u *User) CurrentStatus() UserStatus {
+	if u.Status == "" {
+		return UserStatusActive
+	}
+	return u.Status
+}
+
+// IsActive reports whether the account may authenticate
+func (u *User) IsActive() bool {
+	return u.CurrentStatus() == UserStatusActive
+}
+
+// IsDeleted reports whether the user has been soft deleted and is waiting
+// to be purged
+func (u *User) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// HasRole reports whether the user has been granted role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// UserPatch is a partial update of a user's attributes. Nil fields are left
+// unchanged.
+type UserPatch struct {
+	Name  *string
+	Email *string
+
+	// Profile fields are cleared by setting them to ""
+	DisplayName *string
+	Locale      *string
+	Timezone    *string
+	Phone       *string
+	Bio         *string
+
+	// Attributes sets custom attributes, removing those set to nil
+	Attributes map[string]interface{}
+
+	// Password replaces the bcrypt hash of the user's password
+	Password *string
+
+	// Version, unless zero, is the version the user must be at for the
+	// patch to apply
+	Version int64
+}
+
+// IsEmpty reports whether the patch changes nothing
+func (p UserPatch) IsEmpty() bool {
+	return p.Name == nil && p.Email == nil && p.DisplayName == nil && p.Locale == nil &&
+		p.Timezone == nil && p.Phone == nil && p.Bio == nil && len(p.Attributes) == 0 &&
+		p.Password == nil
+}
+
+// Validate checks the fields the patch sets
+func (p UserPatch) Validate() error {
+	if p.Name != nil {
+		if err := ValidateName(*p.Name); err != nil {
+			return err
+		}
+	}
+	if p.Email != nil {
+		if err := ValidateEmail(*p.Email); err != nil {
+			return err
+		}
+	}
+
+	validators := []struct {
+		value    *string
+		validate func(string) error
+	}{
+		{p.DisplayName, ValidateDisplayName},
+		{p.Locale, ValidateLocale},
+		{p.Timezone, ValidateTimezone},
+		{p.Phone, ValidatePhone},
+		{p.Bio, ValidateBio},
+	}
+	for _, v := range validators {
+		if v.value != nil {
+			if err := v.validate(*v.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateName checks that a name is not blank
+func ValidateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidUser)
+	}
+	return nil
+}
+
+// NormalizeEmail returns the form emails are stored and looked up in:
+// trimmed and in lower case, so addresses that differ only in case belong
+// to the same user
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail checks that an email is a bare address such as
+// "jane@example.com"
+func ValidateEmail(email string) error {
+	if email == "" {
+		return fmt.Errorf("%w: email is required", ErrInvalidUser)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("%w: %q is not a valid email address", ErrInvalidUser, email)
+	}
+	return nil
 }
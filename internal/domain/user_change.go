@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+)
+
+// ChangeType is what a write did to a user
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// UserChange is a write to a user as the database saw it, whichever server
+// made it. Unlike an Event it is not kept once delivered, so it serves
+// keeping in-process state such as caches up to date rather than telling
+// downstream systems.
+type UserChange struct {
+	Type   ChangeType
+	UserID UserID
+	// User is the user after the change. It is nil once they are erased or
+	// purged, and has DeletedAt set when they are soft deleted.
+	User       *User
+	OccurredAt time.Time
+}
@@ -0,0 +1,33 @@
+package domain
+
+import "regexp"
+
+// ErrInvalidUserID is returned for strings that cannot be user IDs
+var ErrInvalidUserID = NewError(KindInvalidArgument, "invalid_user_id", "invalid user ID")
+
+// UserID identifies a user. It is opaque: storage adapters choose what IDs
+// look like and hand out new ones through ports.IDGenerator, so code
+// outside them only parses, compares and formats IDs.
+type UserID string
+
+// userIDPattern matches every ID an adapter may hand out, which keeps IDs
+// safe to embed in URLs, blob keys and file names
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ParseUserID parses the string form of a user ID, e.g. from a URL
+func ParseUserID(s string) (UserID, error) {
+	if !userIDPattern.MatchString(s) {
+		return "", ErrInvalidUserID
+	}
+	return UserID(s), nil
+}
+
+// String returns the form ParseUserID accepts
+func (id UserID) String() string {
+	return string(id)
+}
+
+// IsZero reports whether id is unset
+func (id UserID) IsZero() bool {
+	return id == ""
+}
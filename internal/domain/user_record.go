@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// UserRecord is a user in bulk imports and exports. Imports match users by
+// email; ID, Status, Roles and CreatedAt are only exported and are ignored
+// on import.
+type UserRecord struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// Password is a plain text password to hash on import
+	Password string `json:"password,omitempty"`
+	// PasswordHash is an existing bcrypt hash, imported as is
+	PasswordHash string     `json:"passwordHash,omitempty"`
+	Status       UserStatus `json:"status,omitempty"`
+	Roles        []string   `json:"roles,omitempty"`
+	CreatedAt    *time.Time `json:"createdAt,omitempty"`
+	Profile
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
@@ -0,0 +1,334 @@
+// Package migrations applies and reverts versioned changes to a database,
+// such as index builds, field backfills and renames, written as Go
+// functions. The versions applied are recorded by a Store, which also
+// provides the lock that keeps concurrent instances from migrating at the
+// same time.
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrLocked is returned by Store.Lock while another owner holds the lock
+	ErrLocked = errors.New("migrations are locked by another instance")
+	// ErrUnknownVersion is returned for a version no migration has, either
+	// requested or recorded by a newer release
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Migration is one versioned change. Down undoes Up; it is nil when there
+// is nothing to undo, such as for a backfill the previous release ignores.
+// Both should be safe to run again after failing halfway, since a failed
+// step is not recorded.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context) error
+	Down    func(ctx context.Context) error
+}
+
+// Record is an applied migration as the Store keeps it
+type Record struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// Store records the applied migrations and holds the migration lock
+type Store interface {
+	// Applied returns the applied migrations in version order
+	Applied(ctx context.Context) ([]Record, error)
+	Record(ctx context.Context, record Record) error
+	Remove(ctx context.Context, version int) error
+
+	// Lock acquires the lock for owner until ttl has passed, or extends it
+	// if owner already holds it. It returns ErrLocked if someone else does.
+	Lock(ctx context.Context, owner string, ttl time.Duration) error
+	// Unlock releases the lock if owner holds it
+	Unlock(ctx context.Context, owner string) error
+}
+
+// Status is the state of one migration. Migrations recorded by the store
+// but unknown to this release are listed with a nil Up.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const (
+	defaultLockTTL = 10 * time.Minute
+	lockRetry      = time.Second
+)
+
+// Migrator runs a list of migrations against a Store
+type Migrator struct {
+	store      Store
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+}
+
+// New returns a Migrator of migrations, which it sorts by version. It
+// panics if two migrations share a version or a version is not positive,
+// since the list is fixed when the program is built.
+func New(store Store, migrations []Migration) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || m.Up == nil {
+			panic(fmt.Sprintf("migrations: invalid migration %d %s", m.Version, m.Name))
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			panic(fmt.Sprintf("migrations: version %d is used twice", m.Version))
+		}
+	}
+	return &Migrator{store: store, migrations: sorted, owner: newOwner(), lockTTL: defaultLockTTL}
+}
+
+// WithLockTTL sets how long the lock outlives an instance that dies while
+// migrating. It is extended before every step, so it only has to be longer
+// than the slowest one.
+func (m *Migrator) WithLockTTL(ttl time.Duration) *Migrator {
+	m.lockTTL = ttl
+	return m
+}
+
+// newOwner names this process in the lock, so an operator can tell who
+// holds it
+func newOwner() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Status lists every known migration in version order, followed by the
+// applied ones this release doesn't know
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.appliedByVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied, status.AppliedAt = true, record.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	unknown := make([]Status, 0, len(applied))
+	for _, record := range applied {
+		unknown = append(unknown, Status{
+			Migration: Migration{Version: record.Version, Name: record.Name},
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return append(statuses, unknown...), nil
+}
+
+// Pending returns the migrations that have not been applied, in version
+// order
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.appliedByVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order and returns the
+// ones it applied. It stops at the first that fails, and leaves alone the
+// applied migrations this release doesn't know.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		// Read the records under the lock, since another instance may have
+		// migrated while this one waited for it
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range pending {
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the most recently applied migration and returns it, or nil
+// if none is applied
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.locked(ctx, func() error {
+		records, err := m.store.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		migration, err := m.find(records[len(records)-1].Version)
+		if err != nil {
+			return err
+		}
+		if err := m.revert(ctx, migration); err != nil {
+			return err
+		}
+		reverted = &migration
+		return nil
+	})
+	return reverted, err
+}
+
+// To applies or reverts migrations until exactly those up to version are
+// applied, and returns the ones it applied or reverted in that order.
+// Version 0 reverts them all.
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 {
+		if _, err := m.find(version); err != nil {
+			return nil, err
+		}
+	}
+
+	var done []Migration
+	err := m.locked(ctx, func() error {
+		applied, err := m.appliedByVersion(ctx)
+		if err != nil {
+			return err
+		}
+
+		var revert []int
+		for v := range applied {
+			if v > version {
+				revert = append(revert, v)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(revert)))
+		for _, v := range revert {
+			migration, err := m.find(v)
+			if err != nil {
+				return err
+			}
+			if err := m.revert(ctx, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	if err := m.store.Lock(ctx, m.owner, m.lockTTL); err != nil {
+		return err
+	}
+	if err := migration.Up(ctx); err != nil {
+		return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+	}
+	return m.store.Record(ctx, Record{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()})
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if err := m.store.Lock(ctx, m.owner, m.lockTTL); err != nil {
+		return err
+	}
+	if migration.Down != nil {
+		if err := migration.Down(ctx); err != nil {
+			return fmt.Errorf("reverting migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return m.store.Remove(ctx, migration.Version)
+}
+
+// locked runs fn holding the lock, waiting for it as long as ctx allows
+func (m *Migrator) locked(ctx context.Context, fn func() error) error {
+	waiting := false
+	for {
+		err := m.store.Lock(ctx, m.owner, m.lockTTL)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) {
+			return err
+		}
+		if !waiting {
+			log.Println("waiting for another instance to finish migrating")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrLocked, ctx.Err())
+		case <-time.After(lockRetry):
+		}
+	}
+
+	defer func() {
+		// Release the lock even if ctx was canceled halfway
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := m.store.Unlock(unlockCtx, m.owner); err != nil {
+			log.Printf("releasing the migration lock: %v", err)
+		}
+	}()
+	return fn()
+}
+
+func (m *Migrator) appliedByVersion(ctx context.Context) (map[int]Record, error) {
+	records, err := m.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (m *Migrator) find(version int) (Migration, error) {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i == len(m.migrations) || m.migrations[i].Version != version {
+		return Migration{}, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.migrations[i], nil
+}
@@ -0,0 +1,24 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+	"io"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under a key
+var ErrBlobNotFound = domain.NewError(domain.KindNotFound, "blob_not_found", "blob not found")
+
+// BlobStore stores binary objects such as images under slash separated keys
+// like "avatars/<user>/64.jpg"
+type BlobStore interface {
+	// Put stores the data under key, replacing any blob already there
+	Put(ctx context.Context, key string, data io.Reader, contentType string) error
+	// Get opens the blob stored under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob under key. Deleting a missing blob is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the address clients fetch the blob from
+	URL(key string) string
+}
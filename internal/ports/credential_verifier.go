@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+)
+
+// ErrInvalidCredentials is returned by a CredentialVerifier when the login
+// or password is wrong. Any other error means the backend could not be
+// consulted.
+var ErrInvalidCredentials = domain.NewError(domain.KindUnauthenticated, "invalid_credentials", "invalid credentials")
+
+type CredentialVerifier interface {
+	VerifyCredentials(ctx context.Context, login, password string) (*domain.Identity, error)
+}
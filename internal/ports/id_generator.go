@@ -0,0 +1,10 @@
+package ports
+
+import "backend-hexagonal/internal/domain"
+
+// IDGenerator hands out IDs for new users. IDs must be unique without
+// coordination and should sort roughly by creation time, which keeps
+// listings in ID order stable.
+type IDGenerator interface {
+	NewUserID() domain.UserID
+}
@@ -0,0 +1,40 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+	"time"
+)
+
+// OutboxRepository keeps the events to publish next to the data they are
+// about. Appended with the context of a transaction, events are stored only
+// if the change they describe is.
+type OutboxRepository interface {
+	// Append stores events, assigning their IDs
+	Append(ctx context.Context, events ...*domain.Event) error
+
+	// Unpublished returns up to limit events that are not marked published,
+	// in the order they were appended
+	Unpublished(ctx context.Context, limit int) ([]*domain.Event, error)
+
+	MarkPublished(ctx context.Context, ids []string, at time.Time) error
+
+	// DeletePublished removes the events published before the given time
+	// and returns how many there were
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+
+	// Events carry the name and email of their user, so the outbox is a
+	// PersonalDataStore too: exports include the user's events, and erasing
+	// the user removes them from their events, which are still delivered
+	PersonalDataStore
+}
+
+// OutboxStoreName identifies the outbox in data exports and erasures
+const OutboxStoreName = "events"
+
+// EventPublisher delivers events to downstream systems. An event can be
+// delivered more than once, such as after a crash between its delivery and
+// its outbox entry being marked published.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *domain.Event) error
+}
@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+)
+
+// PersonalDataStore is a store that holds data about users besides their
+// profile. Every store is included in data exports and erasures.
+type PersonalDataStore interface {
+	// Name identifies the store in exports and erasure tombstones
+	Name() string
+	// ExportUserData returns the user's records, each encoded as one JSON
+	// value
+	ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error)
+	// EraseUserData removes or anonymizes the user's records. Erasing a user
+	// with no records is not an error.
+	EraseUserData(ctx context.Context, userID domain.UserID) error
+}
+
+type TombstoneRepository interface {
+	Create(ctx context.Context, tombstone *domain.ErasureTombstone) error
+	// GetByUserID returns nil if the user has not been erased
+	GetByUserID(ctx context.Context, userID domain.UserID) (*domain.ErasureTombstone, error)
+}
@@ -0,0 +1,23 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+)
+
+// PreferenceRepository stores the preferences users set, one record per
+// user and namespace. Defaults are not stored.
+type PreferenceRepository interface {
+	// Get returns the user's preferences in the namespace, or nil if they
+	// have set none
+	Get(ctx context.Context, userID domain.UserID, namespace string) (*domain.Preferences, error)
+	// Put stores the preferences if they are still at their Version, or
+	// not stored yet if it is zero, and increments the Version. Preferences
+	// without values are removed. It returns ErrVersionConflict if another
+	// write got there first.
+	Put(ctx context.Context, prefs *domain.Preferences) error
+	// ListByUser returns the user's preferences in every namespace
+	ListByUser(ctx context.Context, userID domain.UserID) ([]*domain.Preferences, error)
+	// DeleteByUser removes the user's preferences in every namespace
+	DeleteByUser(ctx context.Context, userID domain.UserID) error
+}
@@ -0,0 +1,15 @@
+package ports
+
+import "context"
+
+// Transactor groups repository writes so that they all happen or none do.
+// Repositories of the same storage take part in the transaction when they
+// are called with the context fn receives; nothing has to be passed to them.
+type Transactor interface {
+	// WithinTransaction runs fn in a transaction, committing it if fn returns
+	// nil and rolling it back otherwise. Called within a transaction, it
+	// joins that one. fn may run more than once when the storage retries
+	// a transaction that conflicted with another, and side effects outside
+	// the storage, such as in-process indexes, are not rolled back.
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
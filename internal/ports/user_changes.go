@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+)
+
+// UserChangeStream follows the writes to users made by every server
+type UserChangeStream interface {
+	// Watch calls fn with every change after the last one it was called
+	// with, even by a previous process, until ctx is done or fn or the
+	// stream fails. It returns nil once ctx is done.
+	Watch(ctx context.Context, fn func(domain.UserChange) error) error
+}
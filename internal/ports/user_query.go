@@ -0,0 +1,125 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// ErrInvalidCursor is returned for page tokens that are malformed or were
+// issued for a different sort order
+var ErrInvalidCursor = domain.NewError(domain.KindInvalidArgument, "invalid_cursor", "invalid cursor")
+
+// UserSortField is a field users can be listed by
+type UserSortField string
+
+const (
+	SortByCreatedAt UserSortField = "createdAt"
+	SortByName      UserSortField = "name"
+	SortByEmail     UserSortField = "email"
+)
+
+// IsValid reports whether users can be sorted by f
+func (f UserSortField) IsValid() bool {
+	switch f {
+	case SortByCreatedAt, SortByName, SortByEmail:
+		return true
+	}
+	return false
+}
+
+// UserQuery selects a page of users. Zero values mean no filter.
+type UserQuery struct {
+	Limit int
+	// Cursor is the NextCursor of the previous page. It takes precedence
+	// over Offset.
+	Cursor string
+	// Offset skips users when no cursor is given, for page-numbered clients
+	Offset int
+
+	SortBy     UserSortField
+	Descending bool
+
+	EmailPrefix   string
+	NameContains  string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// UserPage is one page of a user listing
+type UserPage struct {
+	Users []*domain.User
+	// Total counts every user matching the filters, across all pages
+	Total int64
+	// NextCursor fetches the following page and is empty on the last one
+	NextCursor string
+}
+
+// Cursor is the decoded form of a page token. It holds the sort key of the
+// last user on a page, with the ID breaking ties between equal keys.
+type Cursor struct {
+	SortBy     UserSortField `json:"s"`
+	Descending bool          `json:"d,omitempty"`
+	Value      string        `json:"v"`
+	ID         string        `json:"id"`
+}
+
+// CursorAfter returns the cursor that continues a listing after user
+func CursorAfter(query UserQuery, user *domain.User) *Cursor {
+	var value string
+	switch query.SortBy {
+	case SortByName:
+		value = user.Name
+	case SortByEmail:
+		value = user.Email
+	default:
+		value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	return &Cursor{
+		SortBy:     query.SortBy,
+		Descending: query.Descending,
+		Value:      value,
+		ID:         user.ID.String(),
+	}
+}
+
+// Encode returns the opaque page token for c
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// CreatedAt returns the cursor value of a createdAt sorted listing
+func (c *Cursor) CreatedAt() (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return time.Time{}, ErrInvalidCursor
+	}
+	return t, nil
+}
+
+// DecodeCursor parses the page token of query, checking that it was issued
+// for the same sort order
+func DecodeCursor(query UserQuery) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.SortBy != query.SortBy || c.Descending != query.Descending || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if c.SortBy == SortByCreatedAt {
+		if _, err := c.CreatedAt(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
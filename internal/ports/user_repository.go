@@ -3,15 +3,100 @@ package ports
 import (
 	"backend-hexagonal/internal/domain"
 	"context"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
+// ErrVersionConflict is returned when a write expects a user version that
+// another write has already replaced
+var ErrVersionConflict = domain.NewError(domain.KindConflict, "version_conflict", "user was modified concurrently")
+
+// ErrNotFound is returned by the methods that read, change or remove a single
+// user when there is no such user
+var ErrNotFound = domain.NewError(domain.KindNotFound, "user_not_found", "user not found")
+
+// ErrEmailTaken is returned by writes that would give a user an email
+// another user, deleted or not, already has
+var ErrEmailTaken = domain.NewError(domain.KindConflict, "email_taken", "email is already taken")
+
+// UserRepository stores users. Every write increments the user's Version.
+// Delete is a soft delete: deleted users are hidden from every read except
+// GetDeleted until they are restored or purged.
+//
+// Emails are stored and matched exactly as given, so callers pass them
+// through domain.NormalizeEmail first. No two users can share an email:
+// Create, Update, Patch and PatchMany enforce it atomically, returning
+// ErrEmailTaken (PatchMany skips the patch instead).
 type UserRepository interface {
+	// Create stores a new user at version 1, giving them an ID unless they
+	// have one
 	Create(ctx context.Context, user *domain.User) error
-	GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error)
+	// GetByID returns ErrNotFound if the user doesn't exist or is deleted
+	GetByID(ctx context.Context, id domain.UserID) (*domain.User, error)
+	// GetByIDs returns the users with the given IDs that exist and are not
+	// deleted, in no particular order, reading them in one query
+	GetByIDs(ctx context.Context, ids []domain.UserID) ([]*domain.User, error)
+	// GetByEmail returns the user with the email who is not deleted, or
+	// ErrNotFound if there is none
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	GetAll(ctx context.Context) ([]*domain.User, error)
-	Update(ctx context.Context, id primitive.ObjectID, user *domain.User) error
-	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Each calls fn with every user in ID order, reading them in batches
+	// rather than all at once. It stops at the first error fn returns.
+	Each(ctx context.Context, fn func(*domain.User) error) error
+	// List returns a page of users. The query's SortBy and Limit must be set.
+	List(ctx context.Context, query UserQuery) (*UserPage, error)
+	// Update replaces the user's name and email, returning ErrNotFound if
+	// the user doesn't exist or is deleted
+	Update(ctx context.Context, id domain.UserID, user *domain.User) error
+	// Patch atomically sets the fields of the patch, clearing empty profile
+	// fields and nil attributes, and returns the updated user. It returns
+	// ErrNotFound like Update, and ErrVersionConflict if the patch has a
+	// Version the user is no longer at.
+	Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error)
+	// PatchMany applies the patches in one bulk write and returns the IDs
+	// of the users it changed. Like Patch, a patch with a Version only
+	// applies while the user is at that version; patches that don't apply
+	// and empty patches are skipped.
+	PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error)
+	// UpdateStatus replaces the user's status, its reason and when it
+	// changed, and returns the updated user. If user.Version is not zero it
+	// only applies while the user is at that version, returning
+	// ErrVersionConflict otherwise. It returns ErrNotFound like Update.
+	UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error)
+	// SetAvatar replaces the user's avatar, or removes it if avatar is nil,
+	// and returns the updated user. It returns ErrNotFound like Update.
+	SetAvatar(ctx context.Context, id domain.UserID, avatar *domain.Avatar) (*domain.User, error)
+	// Delete returns ErrVersionConflict if expectedVersion is not zero and
+	// the user is at a different version, and ErrNotFound like Update if
+	// there is no user to delete, including when they are already deleted
+	Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error
+	// DeleteMany soft deletes users in one bulk write, mapping each ID to
+	// its expected version or zero, and returns the IDs of the users it
+	// deleted
+	DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error)
+	// EmailExists also counts deleted users, whose email stays reserved
+	// until they are purged
+	EmailExists(ctx context.Context, email string) (bool, error)
+	// AttributeExists reports whether a user other than exceptID has the
+	// custom attribute set to value. Like EmailExists it counts deleted users.
+	AttributeExists(ctx context.Context, name string, value interface{}, exceptID domain.UserID) (bool, error)
+	GetDeleted(ctx context.Context) ([]*domain.User, error)
+	// Restore undoes a soft delete, returning ErrNotFound if there is no
+	// deleted user with the ID
+	Restore(ctx context.Context, id domain.UserID) error
+	// Purge permanently removes users deleted before the cutoff
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// Erase permanently removes a user, whether or not they are deleted,
+	// and returns the removed user, or ErrNotFound if there was none
+	Erase(ctx context.Context, id domain.UserID) (*domain.User, error)
+}
+
+// UserEmailStore gives the email migration access to the stored emails of
+// every user, including deleted ones
+type UserEmailStore interface {
+	// EachIncludingDeleted calls fn with every user in ID order, deleted or
+	// not. It stops at the first error fn returns.
+	EachIncludingDeleted(ctx context.Context, fn func(*domain.User) error) error
+	// SetEmail replaces a user's stored email as given, whether or not they
+	// are deleted
+	SetEmail(ctx context.Context, id domain.UserID, email string) error
 }
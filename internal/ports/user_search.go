@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+)
+
+// UserSearchResult is a user matching a search, with a relevance score
+// between 0 and 1
+type UserSearchResult struct {
+	User  *domain.User
+	Score float64
+}
+
+// UserSearch finds users by name and email, tolerating typos. Results are
+// ordered by relevance, best first, and never include deleted users.
+type UserSearch interface {
+	Search(ctx context.Context, query string, limit int) ([]*UserSearchResult, error)
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"fmt"
+)
+
+// ErrAttributeTaken is returned when a unique custom attribute is set to a
+// value another user already has
+var ErrAttributeTaken = domain.NewError(domain.KindConflict, "attribute_taken", "attribute value is already taken")
+
+// normalizeAttributes validates custom attributes being written against the
+// schema and checks the uniqueness of the values being set. exceptID is the
+// user being written, or a zero ID for a new one.
+func normalizeAttributes(ctx context.Context, userRepo ports.UserRepository, schema *domain.AttributeSchema, attributes map[string]interface{}, exceptID domain.UserID) (map[string]interface{}, error) {
+	normalized, err := schema.Normalize(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range normalized {
+		d, _ := schema.Definition(name)
+		if value == nil {
+			if d.Required {
+				return nil, fmt.Errorf("%w: %s is required", domain.ErrInvalidUser, name)
+			}
+			continue
+		}
+		if !d.Unique {
+			continue
+		}
+		exists, err := userRepo.AttributeExists(ctx, name, value, exceptID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("%w: %s", ErrAttributeTaken, name)
+		}
+	}
+
+	return normalized, nil
+}
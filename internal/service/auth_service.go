@@ -3,10 +3,10 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 
 	"backend-hexagonal/internal/config"
@@ -14,21 +14,63 @@ import (
 	"backend-hexagonal/internal/ports"
 )
 
+// ErrAccountInactive is returned when a pending, suspended or deactivated
+// account tries to authenticate
+var ErrAccountInactive = domain.NewError(domain.KindPermissionDenied, "account_inactive", "account is not active")
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, signed
+// with another key or whose user no longer exists
+var ErrInvalidToken = domain.NewError(domain.KindUnauthenticated, "invalid_token", "invalid token")
+
 type AuthService struct {
-	userRepo ports.UserRepository
+	userRepo   ports.UserRepository
+	verifier   ports.CredentialVerifier
+	schema     *domain.AttributeSchema
+	transactor ports.Transactor
+	outbox     ports.OutboxRepository
 }
 
+// NewAuthService creates an AuthService that verifies passwords against the
+// hashes stored in the user repository
 func NewAuthService(userRepo ports.UserRepository) *AuthService {
+	return NewAuthServiceWithVerifier(userRepo, NewPasswordVerifier(userRepo))
+}
+
+// NewAuthServiceWithVerifier creates an AuthService that delegates credential
+// checks to an external backend such as LDAP
+func NewAuthServiceWithVerifier(userRepo ports.UserRepository, verifier ports.CredentialVerifier) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:   userRepo,
+		verifier:   verifier,
+		transactor: noTransactor{},
+		outbox:     noOutbox{},
 	}
 }
 
+// WithAttributeSchema declares the custom attributes users can register
+// with. Required ones must be given.
+func (s *AuthService) WithAttributeSchema(schema *domain.AttributeSchema) *AuthService {
+	s.schema = schema
+	return s
+}
+
+// WithTransactor makes registration check and write the user in one
+// transaction of the user repository's storage
+func (s *AuthService) WithTransactor(transactor ports.Transactor) *AuthService {
+	s.transactor = transactor
+	return s
+}
+
+// WithOutbox makes registrations, including those of users logging in
+// from a directory for the first time, append a UserRegistered event
+func (s *AuthService) WithOutbox(outbox ports.OutboxRepository) *AuthService {
+	s.outbox = outbox
+	return s
+}
+
 func (s *AuthService) Register(ctx context.Context, req *domain.RegisterRequest) (*domain.AuthResponse, error) {
-	// Check if user already exists
-	existingUser, _ := s.userRepo.GetByEmail(ctx, req.Email)
-	if existingUser != nil {
-		return nil, errors.New("user already exists")
+	if err := req.Profile.Validate(); err != nil {
+		return nil, err
 	}
 
 	// Hash password
@@ -37,21 +79,55 @@ func (s *AuthService) Register(ctx context.Context, req *domain.RegisterRequest)
 		return nil, err
 	}
 
-	// Create user
-	user := &domain.User{
-		Name:      req.Name,
-		Email:     req.Email,
-		Password:  string(hashedPassword),
-		CreatedAt: time.Now(),
-	}
+	var user *domain.User
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		// Check if user already exists. Deleted users keep their email until
+		// they are purged. The unique index on email still catches concurrent
+		// registrations that both pass this check.
+		email := domain.NormalizeEmail(req.Email)
+		exists, err := s.userRepo.EmailExists(ctx, email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrUserExists
+		}
+
+		attributes, err := normalizeAttributes(ctx, s.userRepo, s.schema, req.Attributes, "")
+		if err != nil {
+			return err
+		}
+		if err := s.schema.CheckRequired(attributes); err != nil {
+			return err
+		}
+		for name, value := range attributes {
+			// There is nothing to remove on a new user
+			if value == nil {
+				delete(attributes, name)
+			}
+		}
 
-	err = s.userRepo.Create(ctx, user)
+		// Create user
+		user = &domain.User{
+			Name:       req.Name,
+			Email:      email,
+			Password:   string(hashedPassword),
+			Status:     domain.UserStatusActive,
+			CreatedAt:  time.Now(),
+			Profile:    req.Profile,
+			Attributes: attributes,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserRegistered(user))
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate JWT token
-	token, err := s.generateJWT(user.ID, user.Email)
+	token, err := s.generateJWT(user.ID, user.Email, user.Roles)
 	if err != nil {
 		return nil, err
 	}
@@ -66,23 +142,24 @@ func (s *AuthService) Register(ctx context.Context, req *domain.RegisterRequest)
 }
 
 func (s *AuthService) Login(ctx context.Context, req *domain.AuthRequest) (*domain.AuthResponse, error) {
-	// Find user by email
-	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	// Verify credentials with the configured backend
+	identity, err := s.verifier.VerifyCredentials(ctx, req.Email, req.Password)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
-	}
-	if user == nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
 	}
 
-	// Check password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	// Find the matching local user, creating it on first login
+	user, err := s.syncUser(ctx, identity)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
+	}
+
+	if !user.IsActive() {
+		return nil, fmt.Errorf("%w (%s)", ErrAccountInactive, user.CurrentStatus())
 	}
 
 	// Generate JWT token
-	token, err := s.generateJWT(user.ID, user.Email)
+	token, err := s.generateJWT(user.ID, user.Email, identity.Roles)
 	if err != nil {
 		return nil, err
 	}
@@ -96,60 +173,142 @@ func (s *AuthService) Login(ctx context.Context, req *domain.AuthRequest) (*doma
 	}, nil
 }
 
+// syncUser returns the local user for a verified identity. Identities from
+// an external backend have no local record on first login, so one is
+// created from the directory attributes.
+func (s *AuthService) syncUser(ctx context.Context, identity *domain.Identity) (*domain.User, error) {
+	email := domain.NormalizeEmail(identity.Email)
+	existingUser, err := s.userRepo.GetByEmail(ctx, email)
+	if err == nil {
+		return existingUser, nil
+	}
+	if !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+
+	// A deleted user must be restored rather than recreated
+	exists, err := s.userRepo.EmailExists(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("%w (deleted)", ErrAccountInactive)
+	}
+
+	user := &domain.User{
+		Name:      identity.Name,
+		Email:     email,
+		Roles:     identity.Roles,
+		Status:    domain.UserStatusActive,
+		CreatedAt: time.Now(),
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserRegistered(user))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Authenticate validates a token and checks that its user still exists and
+// is active, so suspended accounts are locked out before their tokens expire
+func (s *AuthService) Authenticate(ctx context.Context, tokenString string) (*domain.JWTClaims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if errors.Is(err, ports.ErrNotFound) {
+		return nil, fmt.Errorf("%w: user no longer exists", ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive() {
+		return nil, fmt.Errorf("%w (%s)", ErrAccountInactive, user.CurrentStatus())
+	}
+
+	return claims, nil
+}
+
 func (s *AuthService) ValidateToken(tokenString string) (*domain.JWTClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
+			return nil, errors.New("unexpected signing method")
 		}
 		return []byte(config.JWTSecret()), nil
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
 
 	if !token.Valid {
-		return nil, errors.New("invalid token")
+		return nil, ErrInvalidToken
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, errors.New("invalid token claims")
+		return nil, fmt.Errorf("%w: invalid claims", ErrInvalidToken)
 	}
 
 	userIDStr, ok := claims["user_id"].(string)
 	if !ok {
-		return nil, errors.New("invalid user_id in token")
+		return nil, fmt.Errorf("%w: invalid user_id", ErrInvalidToken)
 	}
 
-	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	userID, err := domain.ParseUserID(userIDStr)
 	if err != nil {
-		return nil, errors.New("invalid user_id format")
+		return nil, fmt.Errorf("%w: invalid user_id format", ErrInvalidToken)
 	}
 
 	email, ok := claims["email"].(string)
 	if !ok {
-		return nil, errors.New("invalid email in token")
+		return nil, fmt.Errorf("%w: invalid email", ErrInvalidToken)
 	}
 
 	exp, ok := claims["exp"].(float64)
 	if !ok {
-		return nil, errors.New("invalid exp in token")
+		return nil, fmt.Errorf("%w: invalid exp", ErrInvalidToken)
+	}
+
+	// Roles are optional for tokens issued to users without any
+	var roles []string
+	if rawRoles, ok := claims["roles"].([]interface{}); ok {
+		for _, rawRole := range rawRoles {
+			role, ok := rawRole.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: invalid roles", ErrInvalidToken)
+			}
+			roles = append(roles, role)
+		}
 	}
 
 	return &domain.JWTClaims{
 		UserID: userID,
 		Email:  email,
+		Roles:  roles,
 		Exp:    int64(exp),
 	}, nil
 }
 
-func (s *AuthService) generateJWT(userID primitive.ObjectID, email string) (string, error) {
+func (s *AuthService) generateJWT(userID domain.UserID, email string, roles []string) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID.Hex(),
+		"user_id": userID.String(),
 		"email":   email,
 		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
 	}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(config.JWTSecret()))
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrAvatarTooLarge is returned for avatar uploads over the size limit
+var ErrAvatarTooLarge = domain.NewError(domain.KindInvalidArgument, "avatar_too_large", "avatar is too large")
+
+// ErrUnsupportedImage is returned for avatar uploads that are not JPEG,
+// PNG, GIF or WebP images
+var ErrUnsupportedImage = domain.NewError(domain.KindInvalidArgument, "unsupported_image", "unsupported image type")
+
+// ErrInvalidImage is returned for avatar uploads that can't be decoded or
+// whose dimensions are too large
+var ErrInvalidImage = domain.NewError(domain.KindInvalidArgument, "invalid_image", "invalid image")
+
+// Avatar image sizes, in pixels
+const (
+	// MaxAvatarDimension bounds the sides of the stored image
+	MaxAvatarDimension = 1024
+	// maxAvatarPixels bounds the decoded size of uploads, so small files
+	// with huge dimensions can't exhaust memory
+	maxAvatarPixels = 25_000_000
+)
+
+// AvatarThumbnailSizes are the edge lengths of the square thumbnails
+// generated for every avatar
+var AvatarThumbnailSizes = []int{64, 256}
+
+// avatarsStoreName identifies avatars in data exports and erasures
+const avatarsStoreName = "avatars"
+
+// AvatarService processes and stores user avatars. Uploads are re-encoded,
+// which drops EXIF and other metadata, after applying their orientation.
+type AvatarService struct {
+	userRepo   ports.UserRepository
+	blobs      ports.BlobStore
+	maxBytes   int64
+	transactor ports.Transactor
+	outbox     ports.OutboxRepository
+}
+
+func NewAvatarService(userRepo ports.UserRepository, blobs ports.BlobStore, maxBytes int64) *AvatarService {
+	return &AvatarService{
+		userRepo:   userRepo,
+		blobs:      blobs,
+		maxBytes:   maxBytes,
+		transactor: noTransactor{},
+		outbox:     noOutbox{},
+	}
+}
+
+// WithTransactor makes every avatar change write the user and its event in
+// one transaction. The repositories must share the transactor's storage.
+func (s *AvatarService) WithTransactor(transactor ports.Transactor) *AvatarService {
+	s.transactor = transactor
+	return s
+}
+
+// WithOutbox makes avatar changes append a UserUpdated event
+func (s *AvatarService) WithOutbox(outbox ports.OutboxRepository) *AvatarService {
+	s.outbox = outbox
+	return s
+}
+
+// avatarVariant is an encoded image to store
+type avatarVariant struct {
+	name string
+	data []byte
+}
+
+// UploadAvatar replaces the user's avatar with the image read from r and
+// returns the updated user
+func (s *AvatarService) UploadAvatar(ctx context.Context, userID domain.UserID, r io.Reader) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, ports.ErrNotFound) || (err == nil && user == nil) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", ErrAvatarTooLarge, s.maxBytes)
+	}
+
+	// The declared content type isn't trusted
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedImage, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxAvatarPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	img = fit(img, MaxAvatarDimension)
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+
+	// Photos stay JPEG, everything else becomes PNG to keep transparency
+	ext, storedType := ".png", "image/png"
+	if contentType == "image/jpeg" {
+		ext, storedType = ".jpg", "image/jpeg"
+	}
+	encode := func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		var err error
+		if storedType == "image/jpeg" {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, img)
+		}
+		return buf.Bytes(), err
+	}
+
+	variants := make([]avatarVariant, 0, len(AvatarThumbnailSizes)+1)
+	encoded, err := encode(img)
+	if err != nil {
+		return nil, err
+	}
+	variants = append(variants, avatarVariant{name: "original", data: encoded})
+	for _, size := range AvatarThumbnailSizes {
+		encoded, err := encode(square(img, size))
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, avatarVariant{name: strconv.Itoa(size), data: encoded})
+	}
+
+	// Keys include a hash of the upload so that every avatar has new URLs,
+	// which can be cached indefinitely
+	sum := sha256.Sum256(data)
+	prefix := "avatars/" + userID.String() + "/" + hex.EncodeToString(sum[:8]) + "/"
+
+	avatar := &domain.Avatar{
+		Thumbnails:  make(map[string]string, len(AvatarThumbnailSizes)),
+		ContentType: storedType,
+		UpdatedAt:   time.Now(),
+	}
+	for _, v := range variants {
+		key := prefix + v.name + ext
+		if err := s.blobs.Put(ctx, key, bytes.NewReader(v.data), storedType); err != nil {
+			s.deleteBlobs(ctx, avatar.Keys, nil)
+			return nil, err
+		}
+		avatar.Keys = append(avatar.Keys, key)
+		if v.name == "original" {
+			avatar.URL = s.blobs.URL(key)
+		} else {
+			avatar.Thumbnails[v.name] = s.blobs.URL(key)
+		}
+	}
+
+	updated, err := s.setAvatar(ctx, userID, avatar)
+	if err != nil {
+		s.deleteBlobs(ctx, avatar.Keys, nil)
+		return nil, err
+	}
+
+	// Uploading the same image again reuses its keys, which must be kept
+	if user.Avatar != nil {
+		s.deleteBlobs(ctx, user.Avatar.Keys, avatar.Keys)
+	}
+	return updated, nil
+}
+
+// DeleteAvatar removes the user's avatar and returns the updated user
+func (s *AvatarService) DeleteAvatar(ctx context.Context, userID domain.UserID) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, ports.ErrNotFound) || (err == nil && user == nil) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Avatar == nil {
+		return user, nil
+	}
+
+	updated, err := s.setAvatar(ctx, userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteBlobs(ctx, user.Avatar.Keys, nil)
+	return updated, nil
+}
+
+// setAvatar replaces the user's avatar and appends the update to the
+// outbox, returning the updated user
+func (s *AvatarService) setAvatar(ctx context.Context, userID domain.UserID, avatar *domain.Avatar) (*domain.User, error) {
+	var updated *domain.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = s.userRepo.SetAvatar(ctx, userID, avatar)
+		if err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserUpdated(updated))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// GetBlob opens a stored avatar image
+func (s *AvatarService) GetBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.blobs.Get(ctx, key)
+}
+
+// deleteBlobs removes the keys that aren't kept. It is best effort: a blob
+// left behind is unreferenced and harmless.
+func (s *AvatarService) deleteBlobs(ctx context.Context, keys, keep []string) {
+	kept := make(map[string]bool, len(keep))
+	for _, key := range keep {
+		kept[key] = true
+	}
+	for _, key := range keys {
+		if !kept[key] {
+			_ = s.blobs.Delete(ctx, key)
+		}
+	}
+}
+
+// Name implements ports.PersonalDataStore
+func (s *AvatarService) Name() string {
+	return avatarsStoreName
+}
+
+// ExportUserData implements ports.PersonalDataStore. The avatar's metadata
+// is exported; the images are available at its URLs.
+func (s *AvatarService) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil && !errors.Is(err, ports.ErrNotFound) {
+		return nil, err
+	}
+	if user == nil || user.Avatar == nil {
+		return nil, nil
+	}
+	return []interface{}{user.Avatar}, nil
+}
+
+// EraseUserData implements ports.PersonalDataStore by deleting the images.
+// The avatar's metadata is erased with the user.
+func (s *AvatarService) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil && !errors.Is(err, ports.ErrNotFound) {
+		return err
+	}
+	if user == nil {
+		// Soft deleted users are erased too
+		deleted, err := s.userRepo.GetDeleted(ctx)
+		if err != nil {
+			return err
+		}
+		for _, d := range deleted {
+			if d.ID == userID {
+				user = d
+				break
+			}
+		}
+	}
+	if user == nil || user.Avatar == nil {
+		return nil
+	}
+	for _, key := range user.Avatar.Keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
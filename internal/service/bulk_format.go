@@ -0,0 +1,327 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-hexagonal/internal/domain"
+)
+
+// BulkFormat is the encoding of bulk imports and exports
+type BulkFormat string
+
+const (
+	// BulkFormatCSV has a header row naming the columns, see csvColumns
+	BulkFormatCSV BulkFormat = "csv"
+	// BulkFormatNDJSON has one domain.UserRecord JSON object per line
+	BulkFormatNDJSON BulkFormat = "ndjson"
+)
+
+// ParseBulkFormat checks a format name
+func ParseBulkFormat(format string) (BulkFormat, error) {
+	switch f := BulkFormat(strings.ToLower(format)); f {
+	case BulkFormatCSV, BulkFormatNDJSON:
+		return f, nil
+	}
+	return "", fmt.Errorf("%w: unknown format %q, use csv or ndjson", ErrInvalidImport, format)
+}
+
+// CSV columns in export order. Custom attributes follow as
+// "attributes.<name>" columns.
+var csvColumns = []string{
+	"id", "name", "email", "password", "passwordHash", "status", "roles", "createdAt",
+	"displayName", "locale", "timezone", "phone", "bio",
+}
+
+const csvAttributePrefix = "attributes."
+
+// csvRolesSeparator joins roles within their CSV cell
+const csvRolesSeparator = ";"
+
+// maxNDJSONLine bounds the length of one NDJSON record
+const maxNDJSONLine = 1 << 20
+
+// errMalformedRecord marks records that can't be parsed. The import skips
+// them and goes on with the next one.
+var errMalformedRecord = errors.New("malformed record")
+
+// recordReader reads user records one at a time. Next returns io.EOF after
+// the last record, and errors wrapping errMalformedRecord for records that
+// are skipped.
+type recordReader interface {
+	Next() (line int, record *domain.UserRecord, err error)
+}
+
+func newRecordReader(format BulkFormat, r io.Reader, schema *domain.AttributeSchema) (recordReader, error) {
+	if format == BulkFormatCSV {
+		return newCSVRecordReader(r, schema)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxNDJSONLine)
+	return &ndjsonRecordReader{scanner: scanner}, nil
+}
+
+type ndjsonRecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *ndjsonRecordReader) Next() (int, *domain.UserRecord, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := strings.TrimSpace(r.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var record domain.UserRecord
+		decoder := json.NewDecoder(strings.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&record); err != nil {
+			return r.line, nil, fmt.Errorf("%w: %v", errMalformedRecord, err)
+		}
+		return r.line, &record, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return r.line + 1, nil, fmt.Errorf("%w: lines must be at most %d bytes", ErrInvalidImport, maxNDJSONLine)
+		}
+		return 0, nil, err
+	}
+	return 0, nil, io.EOF
+}
+
+type csvRecordReader struct {
+	reader *csv.Reader
+	schema *domain.AttributeSchema
+	header []string
+}
+
+func newCSVRecordReader(r io.Reader, schema *domain.AttributeSchema) (*csvRecordReader, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the CSV has no header row", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	header = append([]string(nil), header...)
+
+	seen := make(map[string]bool, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if i == 0 {
+			// Spreadsheets often save a byte order mark
+			column = strings.TrimPrefix(column, "\uFEFF")
+		}
+		header[i] = column
+
+		if !isCSVColumn(column) {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidImport, column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidImport, column)
+		}
+		seen[column] = true
+	}
+	if !seen["name"] || !seen["email"] {
+		return nil, fmt.Errorf("%w: the name and email columns are required", ErrInvalidImport)
+	}
+
+	return &csvRecordReader{reader: reader, schema: schema, header: header}, nil
+}
+
+func isCSVColumn(column string) bool {
+	if strings.HasPrefix(column, csvAttributePrefix) {
+		return len(column) > len(csvAttributePrefix)
+	}
+	for _, c := range csvColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *csvRecordReader) Next() (int, *domain.UserRecord, error) {
+	row, err := r.reader.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, fmt.Errorf("%w: %v", errMalformedRecord, parseErr.Err)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	record := &domain.UserRecord{}
+	for i, value := range row {
+		value = strings.TrimSpace(value)
+		column := r.header[i]
+		switch column {
+		case "name":
+			record.Name = value
+		case "email":
+			record.Email = value
+		case "password":
+			record.Password = value
+		case "passwordHash":
+			record.PasswordHash = value
+		case "displayName":
+			record.DisplayName = value
+		case "locale":
+			record.Locale = value
+		case "timezone":
+			record.Timezone = value
+		case "phone":
+			record.Phone = value
+		case "bio":
+			record.Bio = value
+		default:
+			// Empty cells leave attributes unchanged
+			if name, ok := strings.CutPrefix(column, csvAttributePrefix); ok && value != "" {
+				if record.Attributes == nil {
+					record.Attributes = make(map[string]interface{})
+				}
+				record.Attributes[name] = r.attributeValue(name, value)
+			}
+		}
+	}
+	return line, record, nil
+}
+
+// attributeValue converts a CSV cell to the type of the attribute. Cells
+// that don't convert are kept as strings for Normalize to reject.
+func (r *csvRecordReader) attributeValue(name, value string) interface{} {
+	d, _ := r.schema.Definition(name)
+	switch d.Type {
+	case domain.AttributeTypeNumber:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case domain.AttributeTypeBoolean:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// recordWriter writes user records in an export format
+type recordWriter interface {
+	Write(record *domain.UserRecord) error
+	Flush() error
+}
+
+func newRecordWriter(format BulkFormat, w io.Writer, schema *domain.AttributeSchema, includePasswordHashes bool) (recordWriter, error) {
+	if format == BulkFormatNDJSON {
+		return &ndjsonRecordWriter{encoder: json.NewEncoder(w)}, nil
+	}
+
+	var header []string
+	for _, column := range csvColumns {
+		if column == "password" || (column == "passwordHash" && !includePasswordHashes) {
+			continue
+		}
+		header = append(header, column)
+	}
+	for _, d := range schema.Definitions() {
+		header = append(header, csvAttributePrefix+d.Name)
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvRecordWriter{writer: writer, header: header}, nil
+}
+
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonRecordWriter) Write(record *domain.UserRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *ndjsonRecordWriter) Flush() error {
+	return nil
+}
+
+type csvRecordWriter struct {
+	writer *csv.Writer
+	header []string
+	row    []string
+}
+
+func (w *csvRecordWriter) Write(record *domain.UserRecord) error {
+	w.row = w.row[:0]
+	for _, column := range w.header {
+		var value string
+		switch column {
+		case "id":
+			value = record.ID
+		case "name":
+			value = record.Name
+		case "email":
+			value = record.Email
+		case "passwordHash":
+			value = record.PasswordHash
+		case "status":
+			value = string(record.Status)
+		case "roles":
+			value = strings.Join(record.Roles, csvRolesSeparator)
+		case "createdAt":
+			if record.CreatedAt != nil {
+				value = record.CreatedAt.UTC().Format(time.RFC3339Nano)
+			}
+		case "displayName":
+			value = record.DisplayName
+		case "locale":
+			value = record.Locale
+		case "timezone":
+			value = record.Timezone
+		case "phone":
+			value = record.Phone
+		case "bio":
+			value = record.Bio
+		default:
+			value = formatAttribute(record.Attributes[strings.TrimPrefix(column, csvAttributePrefix)])
+		}
+		w.row = append(w.row, value)
+	}
+	return w.writer.Write(w.row)
+}
+
+func (w *csvRecordWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func formatAttribute(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidImport is returned for imports that can't be read at all, such
+// as a CSV with an unknown column. Problems with single records are
+// reported per record instead.
+var ErrInvalidImport = domain.NewError(domain.KindInvalidArgument, "invalid_import", "invalid import")
+
+// MinPasswordLength is the shortest password users can be given
+const MinPasswordLength = 6
+
+// ImportOptions configures a bulk import
+type ImportOptions struct {
+	Format BulkFormat
+	// DryRun validates every record without writing anything
+	DryRun bool
+}
+
+// ImportRecordError is a record that was not imported
+type ImportRecordError struct {
+	// Line is where the record starts in the input, counting from 1
+	Line  int    `json:"line"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportReport summarizes a bulk import. In a dry run the counts are what
+// the import would have done.
+type ImportReport struct {
+	DryRun    bool                `json:"dryRun"`
+	Records   int                 `json:"records"`
+	Created   int                 `json:"created"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Failed    int                 `json:"failed"`
+	Errors    []ImportRecordError `json:"errors"`
+}
+
+// WriteCSV writes the failed records as CSV with line, email and error
+// columns
+func (r *ImportReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"line", "email", "error"})
+	for _, e := range r.Errors {
+		writer.Write([]string{strconv.Itoa(e.Line), e.Email, e.Error})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ExportOptions configures a bulk export
+type ExportOptions struct {
+	Format BulkFormat
+	// IncludePasswordHashes exports bcrypt hashes so that users can be
+	// imported elsewhere with their passwords
+	IncludePasswordHashes bool
+}
+
+// BulkService imports and exports users in bulk, streaming records rather
+// than holding them all in memory
+type BulkService struct {
+	userRepo   ports.UserRepository
+	schema     *domain.AttributeSchema
+	transactor ports.Transactor
+	outbox     ports.OutboxRepository
+}
+
+func NewBulkService(userRepo ports.UserRepository) *BulkService {
+	return &BulkService{
+		userRepo:   userRepo,
+		transactor: noTransactor{},
+		outbox:     noOutbox{},
+	}
+}
+
+// WithAttributeSchema declares the custom attributes records can set
+func (s *BulkService) WithAttributeSchema(schema *domain.AttributeSchema) *BulkService {
+	s.schema = schema
+	return s
+}
+
+// WithTransactor makes every imported record, with its events, written in
+// a transaction of its own
+func (s *BulkService) WithTransactor(transactor ports.Transactor) *BulkService {
+	s.transactor = transactor
+	return s
+}
+
+// WithOutbox makes every user the import creates or updates append its
+// events to the outbox
+func (s *BulkService) WithOutbox(outbox ports.OutboxRepository) *BulkService {
+	s.outbox = outbox
+	return s
+}
+
+// ImportUsers creates or updates a user for every record read from r,
+// matching existing users by email. Invalid records are skipped and listed
+// in the report; the others are imported. If reading fails part way, the
+// report of the records imported so far is returned with the error.
+func (s *BulkService) ImportUsers(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	reader, err := newRecordReader(opts.Format, r, s.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Errors: []ImportRecordError{}}
+	// Emails seen so far, so a user listed twice is reported rather than
+	// updated by the second record
+	seen := make(map[string]int)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		line, record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, errMalformedRecord) {
+			return report, err
+		}
+		report.Records++
+
+		if err == nil {
+			record.Email = domain.NormalizeEmail(record.Email)
+			if first, ok := seen[record.Email]; ok {
+				err = fmt.Errorf("%w: %s is already imported on line %d", domain.ErrInvalidUser, record.Email, first)
+			} else {
+				seen[record.Email] = line
+				err = s.importRecord(ctx, record, opts.DryRun, report)
+			}
+		}
+		if err != nil {
+			email := ""
+			if record != nil {
+				email = record.Email
+			}
+			report.Failed++
+			report.Errors = append(report.Errors, ImportRecordError{Line: line, Email: email, Error: err.Error()})
+		}
+	}
+
+	return report, nil
+}
+
+func (s *BulkService) importRecord(ctx context.Context, record *domain.UserRecord, dryRun bool, report *ImportReport) error {
+	if err := domain.ValidateName(record.Name); err != nil {
+		return err
+	}
+	if err := domain.ValidateEmail(record.Email); err != nil {
+		return err
+	}
+	if err := record.Profile.Validate(); err != nil {
+		return err
+	}
+	if err := validateImportedPassword(record); err != nil {
+		return err
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, record.Email)
+	if errors.Is(err, ports.ErrNotFound) {
+		// Deleted users keep their email until they are purged
+		exists, err := s.userRepo.EmailExists(ctx, record.Email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: %s belongs to a deleted user", ErrUserExists, record.Email)
+		}
+		return s.createUser(ctx, record, dryRun, report)
+	}
+	if err != nil {
+		return err
+	}
+	return s.updateUser(ctx, existing, record, dryRun, report)
+}
+
+func validateImportedPassword(record *domain.UserRecord) error {
+	if record.Password != "" && record.PasswordHash != "" {
+		return fmt.Errorf("%w: give either password or passwordHash, not both", domain.ErrInvalidUser)
+	}
+	if record.Password != "" && len(record.Password) < MinPasswordLength {
+		return fmt.Errorf("%w: password must be at least %d characters", domain.ErrInvalidUser, MinPasswordLength)
+	}
+	if record.PasswordHash != "" {
+		if _, err := bcrypt.Cost([]byte(record.PasswordHash)); err != nil {
+			return fmt.Errorf("%w: passwordHash is not a bcrypt hash", domain.ErrInvalidUser)
+		}
+	}
+	return nil
+}
+
+func (s *BulkService) createUser(ctx context.Context, record *domain.UserRecord, dryRun bool, report *ImportReport) error {
+	if record.Password == "" && record.PasswordHash == "" {
+		return fmt.Errorf("%w: new users need a password or passwordHash", domain.ErrInvalidUser)
+	}
+
+	attributes, err := normalizeAttributes(ctx, s.userRepo, s.schema, record.Attributes, "")
+	if err != nil {
+		return err
+	}
+	if err := s.schema.CheckRequired(attributes); err != nil {
+		return err
+	}
+	for name, value := range attributes {
+		// There is nothing to remove on a new user
+		if value == nil {
+			delete(attributes, name)
+		}
+	}
+
+	if dryRun {
+		report.Created++
+		return nil
+	}
+
+	hash, err := importedPasswordHash(record)
+	if err != nil {
+		return err
+	}
+	user := &domain.User{
+		Name:       record.Name,
+		Email:      record.Email,
+		Password:   hash,
+		Status:     domain.UserStatusActive,
+		CreatedAt:  time.Now(),
+		Profile:    record.Profile,
+		Attributes: attributes,
+	}
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserRegistered(user))
+	})
+	if err != nil {
+		return err
+	}
+	report.Created++
+	return nil
+}
+
+// updateUser patches the fields of the user that the record changes. Empty
+// record fields are left unchanged.
+func (s *BulkService) updateUser(ctx context.Context, existing *domain.User, record *domain.UserRecord, dryRun bool, report *ImportReport) error {
+	var patch domain.UserPatch
+	if record.Name != existing.Name {
+		patch.Name = &record.Name
+	}
+
+	profile := []struct {
+		value   string
+		current string
+		field   **string
+	}{
+		{record.DisplayName, existing.DisplayName, &patch.DisplayName},
+		{record.Locale, existing.Locale, &patch.Locale},
+		{record.Timezone, existing.Timezone, &patch.Timezone},
+		{record.Phone, existing.Phone, &patch.Phone},
+		{record.Bio, existing.Bio, &patch.Bio},
+	}
+	for _, p := range profile {
+		if p.value != "" && p.value != p.current {
+			value := p.value
+			*p.field = &value
+		}
+	}
+
+	attributes, err := normalizeAttributes(ctx, s.userRepo, s.schema, record.Attributes, existing.ID)
+	if err != nil {
+		return err
+	}
+	for name, value := range attributes {
+		current, ok := existing.Attributes[name]
+		if (value == nil && !ok) || (ok && reflect.DeepEqual(value, current)) {
+			continue
+		}
+		if patch.Attributes == nil {
+			patch.Attributes = make(map[string]interface{})
+		}
+		patch.Attributes[name] = value
+	}
+
+	passwordChanged := (record.PasswordHash != "" && record.PasswordHash != existing.Password) ||
+		(record.Password != "" && bcrypt.CompareHashAndPassword([]byte(existing.Password), []byte(record.Password)) != nil)
+
+	if patch.IsEmpty() && !passwordChanged {
+		report.Unchanged++
+		return nil
+	}
+	if dryRun {
+		report.Updated++
+		return nil
+	}
+
+	if passwordChanged {
+		hash, err := importedPasswordHash(record)
+		if err != nil {
+			return err
+		}
+		patch.Password = &hash
+	}
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		updated, err := s.userRepo.Patch(ctx, existing.ID, patch)
+		if err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, patchEvents(updated, patch)...)
+	})
+	if err != nil {
+		return err
+	}
+	report.Updated++
+	return nil
+}
+
+// importedPasswordHash returns the record's bcrypt hash, hashing its plain
+// text password if it has one
+func importedPasswordHash(record *domain.UserRecord) (string, error) {
+	if record.PasswordHash != "" {
+		return record.PasswordHash, nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(record.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// ExportUsers writes every user that is not deleted to w, one at a time
+func (s *BulkService) ExportUsers(ctx context.Context, w io.Writer, opts ExportOptions) error {
+	writer, err := newRecordWriter(opts.Format, w, s.schema, opts.IncludePasswordHashes)
+	if err != nil {
+		return err
+	}
+
+	err = s.userRepo.Each(ctx, func(user *domain.User) error {
+		createdAt := user.CreatedAt
+		record := &domain.UserRecord{
+			ID:        user.ID.String(),
+			Name:      user.Name,
+			Email:     user.Email,
+			Status:    user.CurrentStatus(),
+			Roles:     user.Roles,
+			CreatedAt: &createdAt,
+			Profile:   user.Profile,
+			// Attributes no longer declared are left out
+			Attributes: s.schema.Visible(user.Attributes, domain.AudienceAdmin),
+		}
+		if opts.IncludePasswordHashes {
+			record.PasswordHash = user.Password
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"sort"
+	"strings"
+)
+
+// EmailChange is a stored email that NormalizeEmails rewrites
+type EmailChange struct {
+	UserID domain.UserID `json:"userId"`
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	// KeptBy is the user who keeps the normalized email when this user
+	// shares it with others, and zero otherwise
+	KeptBy domain.UserID `json:"keptBy,omitempty"`
+}
+
+// IsDuplicate reports whether the change moves a duplicate out of the way
+func (c EmailChange) IsDuplicate() bool {
+	return !c.KeptBy.IsZero()
+}
+
+// EmailMigrationReport lists the changes of NormalizeEmails. Unless Applied
+// is set they were only planned.
+type EmailMigrationReport struct {
+	Applied bool          `json:"applied"`
+	Users   int           `json:"users"`
+	Changes []EmailChange `json:"changes"`
+	// Duplicates counts the normalized emails that several users share
+	Duplicates int `json:"duplicates"`
+}
+
+// EmailMigrationService brings the emails stored before they were
+// normalized into normalized form, so they can be given a unique index
+type EmailMigrationService struct {
+	store ports.UserEmailStore
+}
+
+func NewEmailMigrationService(store ports.UserEmailStore) *EmailMigrationService {
+	return &EmailMigrationService{
+		store: store,
+	}
+}
+
+// NormalizeEmails plans, and if apply is set makes, the changes that leave
+// every stored email normalized and unique. When several users share a
+// normalized email, the one still in use keeps it, preferring users that
+// are not deleted and then the oldest. The others are given the address
+// with a "+duplicate-<id>" tag, which still reaches the same mailbox, so
+// their accounts can be merged or removed by hand.
+func (s *EmailMigrationService) NormalizeEmails(ctx context.Context, apply bool) (*EmailMigrationReport, error) {
+	groups := make(map[string][]*domain.User)
+	report := &EmailMigrationReport{Changes: []EmailChange{}}
+	err := s.store.EachIncludingDeleted(ctx, func(user *domain.User) error {
+		report.Users++
+		email := domain.NormalizeEmail(user.Email)
+		groups[email] = append(groups[email], user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make([]string, 0, len(groups))
+	for email := range groups {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+
+	for _, email := range emails {
+		users := groups[email]
+		sort.SliceStable(users, func(i, j int) bool {
+			a, b := users[i], users[j]
+			if a.IsDeleted() != b.IsDeleted() {
+				return !a.IsDeleted()
+			}
+			return a.CreatedAt.Before(b.CreatedAt)
+		})
+		if len(users) > 1 {
+			report.Duplicates++
+		}
+
+		// Duplicates move out of the way before the keeper takes the
+		// normalized email
+		keeper := users[0]
+		for _, user := range users[1:] {
+			report.Changes = append(report.Changes, EmailChange{
+				UserID: user.ID,
+				From:   user.Email,
+				To:     duplicateEmail(email, user.ID),
+				KeptBy: keeper.ID,
+			})
+		}
+		if keeper.Email != email {
+			report.Changes = append(report.Changes, EmailChange{UserID: keeper.ID, From: keeper.Email, To: email})
+		}
+	}
+
+	if !apply {
+		return report, nil
+	}
+	for _, change := range report.Changes {
+		if err := s.store.SetEmail(ctx, change.UserID, change.To); err != nil {
+			return report, err
+		}
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// duplicateEmail tags the local part of an email with the ID of the user
+// who can't keep it
+func duplicateEmail(email string, id domain.UserID) string {
+	tag := "+duplicate-" + id.String()
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email + tag
+	}
+	return email[:at] + tag + email[at:]
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// relayBatchSize is how many events the relay reads from the outbox at once
+const relayBatchSize = 100
+
+// OutboxRelay publishes the events of the outbox in the order they were
+// appended. An event is marked published only once it was delivered, so
+// every event is delivered at least once; one that fails holds back the
+// events after it until it is delivered.
+type OutboxRelay struct {
+	outbox    ports.OutboxRepository
+	publisher ports.EventPublisher
+	retention time.Duration
+}
+
+func NewOutboxRelay(outbox ports.OutboxRepository, publisher ports.EventPublisher) *OutboxRelay {
+	return &OutboxRelay{
+		outbox:    outbox,
+		publisher: publisher,
+		retention: 7 * 24 * time.Hour,
+	}
+}
+
+// WithRetention sets how long published events are kept before Run
+// deletes them
+func (r *OutboxRelay) WithRetention(retention time.Duration) *OutboxRelay {
+	r.retention = retention
+	return r
+}
+
+// RelayPending publishes the unpublished events until none is left or one
+// fails, and returns how many it published
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		events, err := r.outbox.Unpublished(ctx, relayBatchSize)
+		if err != nil {
+			return published, err
+		}
+
+		var ids []string
+		var publishErr error
+		for _, event := range events {
+			if err := r.publisher.Publish(ctx, event); err != nil {
+				publishErr = fmt.Errorf("publish %s %s: %w", event.Type, event.ID, err)
+				break
+			}
+			ids = append(ids, event.ID)
+		}
+
+		// Mark what was delivered even if the rest failed, with a context
+		// of its own so a shutdown doesn't get them delivered again
+		markCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		err = r.outbox.MarkPublished(markCtx, ids, time.Now())
+		cancel()
+		if err != nil {
+			return published, err
+		}
+		published += len(ids)
+
+		if publishErr != nil {
+			return published, publishErr
+		}
+		if len(events) < relayBatchSize {
+			return published, nil
+		}
+	}
+}
+
+// Run relays the pending events every interval and deletes the published
+// ones older than the retention, until ctx is done
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		if _, err := r.RelayPending(ctx); err != nil && ctx.Err() == nil {
+			log.Println("outbox relay error:", err)
+		}
+
+		if time.Since(lastCleanup) >= time.Hour {
+			deleted, err := r.outbox.DeletePublished(ctx, time.Now().Add(-r.retention))
+			if err != nil && ctx.Err() == nil {
+				log.Println("outbox cleanup error:", err)
+			} else if deleted > 0 {
+				log.Printf("deleted %d published outbox events\n", deleted)
+			}
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// noOutbox drops events, for services that were not given an outbox
+type noOutbox struct{}
+
+func (noOutbox) Append(ctx context.Context, events ...*domain.Event) error {
+	return nil
+}
+
+func (noOutbox) Unpublished(ctx context.Context, limit int) ([]*domain.Event, error) {
+	return nil, nil
+}
+
+func (noOutbox) MarkPublished(ctx context.Context, ids []string, at time.Time) error {
+	return nil
+}
+
+func (noOutbox) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (noOutbox) Name() string {
+	return ports.OutboxStoreName
+}
+
+func (noOutbox) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	return nil, nil
+}
+
+func (noOutbox) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	return nil
+}
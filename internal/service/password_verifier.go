@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// PasswordVerifier checks credentials against the bcrypt hash stored on
+// the user record. It is the default credential backend.
+type PasswordVerifier struct {
+	userRepo ports.UserRepository
+}
+
+func NewPasswordVerifier(userRepo ports.UserRepository) *PasswordVerifier {
+	return &PasswordVerifier{
+		userRepo: userRepo,
+	}
+}
+
+func (v *PasswordVerifier) VerifyCredentials(ctx context.Context, login, password string) (*domain.Identity, error) {
+	user, err := v.userRepo.GetByEmail(ctx, domain.NormalizeEmail(login))
+	if errors.Is(err, ports.ErrNotFound) {
+		return nil, ports.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Users provisioned by an external backend have no local password
+	if user.Password == "" {
+		return nil, ports.ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		return nil, ports.ErrInvalidCredentials
+	}
+
+	return &domain.Identity{
+		Email: user.Email,
+		Name:  user.Name,
+		Roles: user.Roles,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownPreferenceNamespace is returned for namespaces the deployment
+// doesn't declare
+var ErrUnknownPreferenceNamespace = domain.NewError(domain.KindNotFound, "unknown_preference_namespace", "unknown preference namespace")
+
+// preferenceWriteAttempts bounds how often a write is retried after losing
+// a race with another write to the same preferences
+const preferenceWriteAttempts = 3
+
+// PreferenceService stores per-user settings in the namespaces declared by
+// a PreferenceSchema. Reads return the namespace's defaults with the
+// user's own settings merged over them.
+type PreferenceService struct {
+	prefRepo ports.PreferenceRepository
+	schema   *domain.PreferenceSchema
+}
+
+func NewPreferenceService(prefRepo ports.PreferenceRepository, schema *domain.PreferenceSchema) *PreferenceService {
+	return &PreferenceService{
+		prefRepo: prefRepo,
+		schema:   schema,
+	}
+}
+
+// Schema returns the declared namespaces, or nil if there are none
+func (s *PreferenceService) Schema() *domain.PreferenceSchema {
+	return s.schema
+}
+
+// GetPreferences returns the user's preferences in the namespace
+func (s *PreferenceService) GetPreferences(ctx context.Context, userID domain.UserID, namespace string) (map[string]interface{}, error) {
+	ns, err := s.namespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := s.prefRepo.Get(ctx, userID, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if prefs != nil {
+		values = prefs.Values
+	}
+	return ns.Resolve(values), nil
+}
+
+// ReplacePreferences replaces the settings the user has set in the
+// namespace. Settings left out fall back to their defaults.
+func (s *PreferenceService) ReplacePreferences(ctx context.Context, userID domain.UserID, namespace string, values map[string]interface{}) (map[string]interface{}, error) {
+	return s.update(ctx, userID, namespace, func(map[string]interface{}) map[string]interface{} {
+		// Nulls mean "unset" in a replacement too
+		return domain.MergePreferences(nil, values)
+	})
+}
+
+// PatchPreferences merges a JSON Merge Patch into the settings the user has
+// set in the namespace. Setting a key to null returns it to its default.
+func (s *PreferenceService) PatchPreferences(ctx context.Context, userID domain.UserID, namespace string, patch map[string]interface{}) (map[string]interface{}, error) {
+	return s.update(ctx, userID, namespace, func(current map[string]interface{}) map[string]interface{} {
+		return domain.MergePreferences(current, patch)
+	})
+}
+
+// update validates and stores the user's new settings, recomputing them if
+// another write changed the preferences in the meantime
+func (s *PreferenceService) update(ctx context.Context, userID domain.UserID, namespace string, change func(map[string]interface{}) map[string]interface{}) (map[string]interface{}, error) {
+	ns, err := s.namespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		prefs, err := s.prefRepo.Get(ctx, userID, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if prefs == nil {
+			prefs = &domain.Preferences{UserID: userID, Namespace: namespace}
+		}
+
+		values := change(prefs.Values)
+		if err := ns.Validate(values); err != nil {
+			return nil, err
+		}
+		prefs.Values = values
+
+		err = s.prefRepo.Put(ctx, prefs)
+		if errors.Is(err, ports.ErrVersionConflict) && attempt < preferenceWriteAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ns.Resolve(values), nil
+	}
+}
+
+func (s *PreferenceService) namespace(name string) (*domain.PreferenceNamespace, error) {
+	ns, ok := s.schema.Namespace(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPreferenceNamespace, name)
+	}
+	return ns, nil
+}
+
+// Name implements ports.PersonalDataStore
+func (s *PreferenceService) Name() string {
+	return "preferences"
+}
+
+// ExportUserData implements ports.PersonalDataStore with the settings the
+// user has set, one record per namespace
+func (s *PreferenceService) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	all, err := s.prefRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]interface{}, 0, len(all))
+	for _, prefs := range all {
+		records = append(records, prefs)
+	}
+	return records, nil
+}
+
+// EraseUserData implements ports.PersonalDataStore
+func (s *PreferenceService) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	return s.prefRepo.DeleteByUser(ctx, userID)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// usersStoreName identifies the user profiles in erasure tombstones
+const usersStoreName = "users"
+
+// PrivacyService answers data-subject requests: exporting everything held
+// about a user and erasing it
+type PrivacyService struct {
+	userRepo      ports.UserRepository
+	tombstoneRepo ports.TombstoneRepository
+	stores        []ports.PersonalDataStore
+	transactor    ports.Transactor
+	outbox        ports.OutboxRepository
+}
+
+func NewPrivacyService(userRepo ports.UserRepository, tombstoneRepo ports.TombstoneRepository, stores ...ports.PersonalDataStore) *PrivacyService {
+	return &PrivacyService{
+		userRepo:      userRepo,
+		tombstoneRepo: tombstoneRepo,
+		stores:        stores,
+		transactor:    noTransactor{},
+		outbox:        noOutbox{},
+	}
+}
+
+// WithTransactor makes erasures remove the profile and record the tombstone
+// in one transaction, so a user is never erased without a tombstone. The
+// repositories must share the transactor's storage.
+func (s *PrivacyService) WithTransactor(transactor ports.Transactor) *PrivacyService {
+	s.transactor = transactor
+	return s
+}
+
+// WithOutbox makes erasures append a UserErased event. The outbox's events
+// carry personal data too, so it joins the stores: exports include the
+// user's events, and erasures remove the user from them.
+func (s *PrivacyService) WithOutbox(outbox ports.OutboxRepository) *PrivacyService {
+	s.outbox = outbox
+	s.stores = append(s.stores, outbox)
+	return s
+}
+
+// exportManifest describes the contents of a data export
+type exportManifest struct {
+	UserID     string    `json:"userId"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Files      []string  `json:"files"`
+}
+
+// ExportUserData writes a zip archive of the user's data to w. It contains
+// profile.json, one NDJSON file per personal data store and manifest.json
+// listing them.
+func (s *PrivacyService) ExportUserData(ctx context.Context, id domain.UserID, w io.Writer) error {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if errors.Is(err, ports.ErrNotFound) || (err == nil && user == nil) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest := exportManifest{
+		UserID:     id.String(),
+		ExportedAt: time.Now().UTC(),
+	}
+
+	archive := zip.NewWriter(w)
+
+	// The password hash is never serialized
+	if err := writeJSONFile(archive, "profile.json", user); err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, "profile.json")
+
+	for _, store := range s.stores {
+		records, err := store.ExportUserData(ctx, id)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", store.Name(), err)
+		}
+
+		name := store.Name() + ".ndjson"
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return fmt.Errorf("export %s: %w", store.Name(), err)
+			}
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+
+	if err := writeJSONFile(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeJSONFile(archive *zip.Writer, name string, v interface{}) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// EraseUser removes the user from every store, whether or not they were soft
+// deleted, and records a tombstone. Erasing a user again returns the
+// original tombstone.
+func (s *PrivacyService) EraseUser(ctx context.Context, id, requestedBy domain.UserID) (*domain.ErasureTombstone, error) {
+	tombstone, err := s.tombstoneRepo.GetByUserID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if tombstone != nil {
+		return tombstone, nil
+	}
+
+	// The other stores are erased first so that a failed erasure can be
+	// retried while the profile still exists
+	stores := []string{usersStoreName}
+	for _, store := range s.stores {
+		if err := store.EraseUserData(ctx, id); err != nil {
+			return nil, fmt.Errorf("erase %s: %w", store.Name(), err)
+		}
+		stores = append(stores, store.Name())
+	}
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.userRepo.Erase(ctx, id); err != nil {
+			return userWriteError(err)
+		}
+
+		tombstone = &domain.ErasureTombstone{
+			UserID:      id,
+			RequestedBy: requestedBy,
+			Stores:      stores,
+			ErasedAt:    time.Now(),
+		}
+		if err := s.tombstoneRepo.Create(ctx, tombstone); err != nil {
+			return err
+		}
+		return s.outbox.Append(ctx, domain.UserErased(id))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstone, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"backend-hexagonal/internal/ports"
+)
+
+// maxSearchQueryLength keeps pathological queries away from the index
+const maxSearchQueryLength = 200
+
+type SearchService struct {
+	search ports.UserSearch
+}
+
+func NewSearchService(search ports.UserSearch) *SearchService {
+	return &SearchService{
+		search: search,
+	}
+}
+
+// SearchUsers returns the users best matching a free-text query over name
+// and email
+func (s *SearchService) SearchUsers(ctx context.Context, query string, limit int) ([]*ports.UserSearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: a search query is required", ErrInvalidQuery)
+	}
+	if len(query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("%w: search query is too long", ErrInvalidQuery)
+	}
+
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	results, err := s.search.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []*ports.UserSearchResult{}
+	}
+	return results, nil
+}
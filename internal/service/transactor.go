@@ -0,0 +1,11 @@
+package service
+
+import "context"
+
+// noTransactor runs functions as they are, for services that were not
+// given a ports.Transactor
+type noTransactor struct{}
+
+func (noTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
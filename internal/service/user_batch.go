@@ -0,0 +1,267 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"fmt"
+)
+
+// MaxBatchSize is the most users a batch operation may name
+const MaxBatchSize = 100
+
+// ErrInvalidBatch is returned for batches that name too many users or the
+// same user twice
+var ErrInvalidBatch = domain.NewError(domain.KindInvalidArgument, "invalid_batch", "invalid batch")
+
+// BatchResult is the outcome of one item of a batch operation. Results are
+// in the order of the items.
+type BatchResult struct {
+	ID domain.UserID
+	// User is the user read or updated, and nil for deletes and failures
+	User *domain.User
+	Err  error
+}
+
+// UserUpdate is one item of a batch update. A Version in the patch must be
+// the version the user is at.
+type UserUpdate struct {
+	ID    domain.UserID
+	Patch domain.UserPatch
+}
+
+// UserDelete is one item of a batch delete. Unless ExpectedVersion is zero
+// the user is only deleted while at that version.
+type UserDelete struct {
+	ID              domain.UserID
+	ExpectedVersion int64
+}
+
+// checkBatch returns ErrInvalidBatch if there are too many IDs or one of
+// them repeats
+func checkBatch(ids []domain.UserID) error {
+	if len(ids) > MaxBatchSize {
+		return fmt.Errorf("%w: at most %d users can be named at once", ErrInvalidBatch, MaxBatchSize)
+	}
+	seen := make(map[domain.UserID]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return fmt.Errorf("%w: user %s is named twice", ErrInvalidBatch, id.String())
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// usersByID reads the users with the given IDs in one query
+func (s *UserService) usersByID(ctx context.Context, ids []domain.UserID) (map[domain.UserID]*domain.User, error) {
+	users, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[domain.UserID]*domain.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	return byID, nil
+}
+
+// GetUsers reads several users at once. Users that don't exist have
+// ErrUserNotFound as their result.
+func (s *UserService) GetUsers(ctx context.Context, ids []domain.UserID) ([]BatchResult, error) {
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+	users, err := s.usersByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(ids))
+	for i, id := range ids {
+		results[i] = BatchResult{ID: id, User: users[id]}
+		if results[i].User == nil {
+			results[i].Err = ErrUserNotFound
+		}
+	}
+	return results, nil
+}
+
+// PatchUsers applies a partial update to each of several users, checking
+// every patch like PatchUser and writing the valid ones as writePatches
+// does. Each result has the updated user, or the error that kept the patch
+// from applying.
+func (s *UserService) PatchUsers(ctx context.Context, updates []UserUpdate) ([]BatchResult, error) {
+	ids := make([]domain.UserID, len(updates))
+	for i, u := range updates {
+		ids[i] = u.ID
+	}
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+	current, err := s.usersByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(updates))
+	patches := make(map[domain.UserID]domain.UserPatch)
+	// Emails given within the batch, which EmailExists doesn't know about
+	emails := make(map[string]bool)
+	for i, u := range updates {
+		results[i].ID = u.ID
+		patch, err := s.checkBatchPatch(ctx, current[u.ID], u, emails)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if patch.IsEmpty() {
+			results[i].User = current[u.ID]
+			continue
+		}
+
+		// The checks hold only while the user is at the version they ran
+		// against
+		patch.Version = current[u.ID].Version
+		patches[u.ID] = patch
+		if patch.Email != nil {
+			emails[*patch.Email] = true
+		}
+	}
+
+	updated, err := s.writePatches(ctx, patches)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if _, ok := patches[results[i].ID]; !ok {
+			continue
+		}
+		// A patch that didn't apply lost a race with another write, which
+		// may have taken the email it sets
+		results[i].User = updated[results[i].ID]
+		if results[i].User != nil {
+			continue
+		}
+		results[i].Err = ports.ErrVersionConflict
+		if email := patches[results[i].ID].Email; email != nil {
+			exists, err := s.userRepo.EmailExists(ctx, *email)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				results[i].Err = ErrUserExists
+			}
+		}
+	}
+	return results, nil
+}
+
+// writePatches applies checked patches in one bulk write and returns the
+// users they changed, appending their events in the same transaction.
+// Emails are checked before, so a patch only loses a race for one to a
+// write made in between; depending on the storage that patch is skipped or
+// the whole batch fails, changing nothing.
+func (s *UserService) writePatches(ctx context.Context, patches map[domain.UserID]domain.UserPatch) (map[domain.UserID]*domain.User, error) {
+	var updated map[domain.UserID]*domain.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		changed, err := s.userRepo.PatchMany(ctx, patches)
+		if err != nil {
+			return userWriteError(err)
+		}
+		updated, err = s.usersByID(ctx, changed)
+		if err != nil {
+			return err
+		}
+
+		var events []*domain.Event
+		for _, id := range changed {
+			if user := updated[id]; user != nil {
+				events = append(events, patchEvents(user, patches[id])...)
+			}
+		}
+		return s.outbox.Append(ctx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *UserService) checkBatchPatch(ctx context.Context, current *domain.User, update UserUpdate, emails map[string]bool) (domain.UserPatch, error) {
+	patch, err := s.preparePatch(ctx, update.ID, update.Patch)
+	if err != nil {
+		return patch, err
+	}
+	if current == nil {
+		return patch, ErrUserNotFound
+	}
+	if patch.Version != 0 && patch.Version != current.Version {
+		return patch, ports.ErrVersionConflict
+	}
+	if patch.Email != nil && emails[*patch.Email] {
+		return patch, ErrUserExists
+	}
+	return patch, s.checkEmailChange(ctx, current, patch)
+}
+
+// DeleteUsers soft deletes several users at once. Each result has the
+// error that kept the user from being deleted, if any.
+func (s *UserService) DeleteUsers(ctx context.Context, deletes []UserDelete) ([]BatchResult, error) {
+	ids := make([]domain.UserID, len(deletes))
+	for i, d := range deletes {
+		ids[i] = d.ID
+	}
+	if err := checkBatch(ids); err != nil {
+		return nil, err
+	}
+	current, err := s.usersByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, len(deletes))
+	versions := make(map[domain.UserID]int64)
+	for i, d := range deletes {
+		results[i].ID = d.ID
+		user := current[d.ID]
+		switch {
+		case user == nil:
+			results[i].Err = ErrUserNotFound
+		case d.ExpectedVersion != 0 && d.ExpectedVersion != user.Version:
+			results[i].Err = ports.ErrVersionConflict
+		default:
+			versions[d.ID] = d.ExpectedVersion
+		}
+	}
+
+	var deleted []domain.UserID
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		deleted, err = s.userRepo.DeleteMany(ctx, versions)
+		if err != nil {
+			return err
+		}
+		events := make([]*domain.Event, len(deleted))
+		for i, id := range deleted {
+			events[i] = domain.UserDeleted(id)
+		}
+		return s.outbox.Append(ctx, events...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[domain.UserID]bool, len(deleted))
+	for _, id := range deleted {
+		done[id] = true
+	}
+
+	for i := range results {
+		if _, ok := versions[results[i].ID]; ok && !done[results[i].ID] {
+			// Another write changed or deleted the user in the meantime
+			results[i].Err = ports.ErrVersionConflict
+		}
+	}
+	return results, nil
+}
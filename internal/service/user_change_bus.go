@@ -0,0 +1,121 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrSubscriptionLagged ends a subscription that fell further behind the
+// changes than its buffer
+var ErrSubscriptionLagged = domain.NewError(domain.KindUnavailable, "subscription_lagged", "subscriber fell behind the user changes")
+
+// UserChangeBus hands the changes to users to the parts of the process that
+// follow them: handlers, which it calls with every change, and
+// subscriptions, which receive them on a channel. Slow subscribers don't
+// hold the others back; they are dropped instead.
+type UserChangeBus struct {
+	mu            sync.Mutex
+	handlers      []func(domain.UserChange)
+	subscriptions map[*UserChangeSubscription]bool
+}
+
+func NewUserChangeBus() *UserChangeBus {
+	return &UserChangeBus{
+		subscriptions: make(map[*UserChangeSubscription]bool),
+	}
+}
+
+// Handle makes fn called with every change from now on. fn must return
+// quickly, since changes wait for it.
+func (b *UserChangeBus) Handle(fn func(domain.UserChange)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// Subscribe returns a subscription receiving the changes from now on. It is
+// ended if more than buffer changes wait for it.
+func (b *UserChangeBus) Subscribe(buffer int) *UserChangeSubscription {
+	c := make(chan domain.UserChange, buffer)
+	subscription := &UserChangeSubscription{C: c, c: c, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[subscription] = true
+	return subscription
+}
+
+// Publish hands a change to the handlers and subscriptions. It never fails,
+// and has an error result to serve as the function of a UserChangeStream.
+func (b *UserChangeBus) Publish(change domain.UserChange) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, handle := range b.handlers {
+		handle(change)
+	}
+	for subscription := range b.subscriptions {
+		select {
+		case subscription.c <- change:
+		default:
+			subscription.end(ErrSubscriptionLagged)
+		}
+	}
+	return nil
+}
+
+// Run publishes the changes of stream until ctx is done, watching it again
+// every retry after it fails
+func (b *UserChangeBus) Run(ctx context.Context, stream ports.UserChangeStream, retry time.Duration) {
+	for {
+		err := stream.Watch(ctx, b.Publish)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Println("user change stream error:", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// UserChangeSubscription receives changes on C until it is closed or falls
+// behind, which closes C
+type UserChangeSubscription struct {
+	C   <-chan domain.UserChange
+	c   chan domain.UserChange
+	bus *UserChangeBus
+	err error
+}
+
+// Close ends the subscription. It can be called more than once.
+func (s *UserChangeSubscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.end(nil)
+}
+
+// Err returns ErrSubscriptionLagged once the subscription was ended for
+// falling behind, and nil otherwise
+func (s *UserChangeSubscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.err
+}
+
+// end closes C with the given reason. It is called with the bus locked.
+func (s *UserChangeSubscription) end(err error) {
+	if !s.bus.subscriptions[s] {
+		return
+	}
+	delete(s.bus.subscriptions, s)
+	s.err = err
+	close(s.c)
+}
@@ -4,30 +4,150 @@ import (
 	"backend-hexagonal/internal/domain"
 	"backend-hexagonal/internal/ports"
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrUserExists is returned when an email is already taken by another user
+var ErrUserExists = domain.NewError(domain.KindConflict, "user_exists", "user already exists")
+
+// ErrUserNotFound is returned when no user has the requested ID
+var ErrUserNotFound = domain.NewError(domain.KindNotFound, "user_not_found", "user not found")
+
+// ErrInvalidQuery is returned for user listings with an unknown sort field
+// or an empty created-at range
+var ErrInvalidQuery = domain.NewError(domain.KindInvalidArgument, "invalid_query", "invalid query")
+
+// Page sizes for user listings
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// ErrInvalidStatusTransition is returned when an account cannot move from
+// its current status to the requested one
+var ErrInvalidStatusTransition = domain.NewError(domain.KindConflict, "invalid_status_transition", "invalid status transition")
+
 type UserService struct {
-	userRepo ports.UserRepository
+	userRepo   ports.UserRepository
+	schema     *domain.AttributeSchema
+	transactor ports.Transactor
+	outbox     ports.OutboxRepository
 }
 
 func NewUserService(userRepo ports.UserRepository) *UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:   userRepo,
+		transactor: noTransactor{},
+		outbox:     noOutbox{},
 	}
 }
 
+// WithAttributeSchema declares the custom attributes users can have.
+// Without a schema none can be set.
+func (s *UserService) WithAttributeSchema(schema *domain.AttributeSchema) *UserService {
+	s.schema = schema
+	return s
+}
+
+// WithTransactor makes every change to a user, with its checks and events,
+// happen in one transaction of the user repository's storage
+func (s *UserService) WithTransactor(transactor ports.Transactor) *UserService {
+	s.transactor = transactor
+	return s
+}
+
+// WithOutbox makes every change to a user append its events to the outbox.
+// They are stored only with the change when the outbox shares the storage
+// of the transactor.
+func (s *UserService) WithOutbox(outbox ports.OutboxRepository) *UserService {
+	s.outbox = outbox
+	return s
+}
+
+// AttributeSchema returns the declared custom attributes, or nil if there
+// are none
+func (s *UserService) AttributeSchema() *domain.AttributeSchema {
+	return s.schema
+}
+
 func (s *UserService) CreateUser(ctx context.Context, name, email, password string) (*domain.User, error) {
 	user := &domain.User{
 		Name:      name,
-		Email:     email,
+		Email:     domain.NormalizeEmail(email),
 		Password:  password, // In production, hash this password
+		Status:    domain.UserStatusActive,
 		CreatedAt: time.Now(),
 	}
 
-	err := s.userRepo.Create(ctx, user)
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserRegistered(user))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ProvisionUser creates a user on behalf of an external provisioning client.
+// The password is optional; users provisioned without one cannot log in with
+// a password until it is set. Unless status is empty the account starts in
+// it, for the given reason, which must be a status an active account can
+// move to.
+func (s *UserService) ProvisionUser(ctx context.Context, name, email, password string, status domain.UserStatus, reason string) (*domain.User, error) {
+	if err := domain.ValidateName(name); err != nil {
+		return nil, err
+	}
+	email = domain.NormalizeEmail(email)
+	if err := domain.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &domain.User{
+		Name:      name,
+		Email:     email,
+		Status:    domain.UserStatusActive,
+		CreatedAt: now,
+	}
+	if status != "" && status != domain.UserStatusActive {
+		if !domain.UserStatusActive.CanTransitionTo(status) {
+			return nil, fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, domain.UserStatusActive, status)
+		}
+		user.Status = status
+		user.StatusReason = reason
+		user.StatusChangedAt = &now
+	}
+
+	if password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = string(hashedPassword)
+	}
+
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		exists, err := s.userRepo.EmailExists(ctx, email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrUserExists
+		}
+
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserRegistered(user))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -35,28 +155,355 @@ func (s *UserService) CreateUser(ctx context.Context, name, email, password stri
 	return user, nil
 }
 
-func (s *UserService) GetUserByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
-	return s.userRepo.GetByID(ctx, id)
+func (s *UserService) GetUserByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	return s.getUser(ctx, id)
+}
+
+// getUser reads a user, returning ErrUserNotFound if they don't exist or
+// are deleted
+func (s *UserService) getUser(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if errors.Is(err, ports.ErrNotFound) || (err == nil && user == nil) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (s *UserService) GetAllUsers(ctx context.Context) ([]*domain.User, error) {
 	return s.userRepo.GetAll(ctx)
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, id primitive.ObjectID, name, email string) (*domain.User, error) {
-	user := &domain.User{
+// ListUsers returns a page of users, filling in the default sort order and
+// page size
+func (s *UserService) ListUsers(ctx context.Context, query ports.UserQuery) (*ports.UserPage, error) {
+	if query.SortBy == "" {
+		query.SortBy = ports.SortByCreatedAt
+	}
+	if !query.SortBy.IsValid() {
+		return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, query.SortBy)
+	}
+	if query.CreatedAfter != nil && query.CreatedBefore != nil && !query.CreatedAfter.Before(*query.CreatedBefore) {
+		return nil, fmt.Errorf("%w: created-after must be before created-before", ErrInvalidQuery)
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = DefaultListLimit
+	}
+	if query.Limit > MaxListLimit {
+		query.Limit = MaxListLimit
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	page, err := s.userRepo.List(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if page.Users == nil {
+		page.Users = []*domain.User{}
+	}
+	return page, nil
+}
+
+// UpdateUser replaces a user's name and email
+func (s *UserService) UpdateUser(ctx context.Context, id domain.UserID, name, email string) (*domain.User, error) {
+	if err := domain.ValidateName(name); err != nil {
+		return nil, err
+	}
+	email = domain.NormalizeEmail(email)
+	if err := domain.ValidateEmail(email); err != nil {
+		return nil, err
+	}
+
+	var updated *domain.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = s.updateUser(ctx, id, name, email)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// updateUser writes a validated name and email and appends the update to
+// the outbox. It runs in the caller's transaction.
+func (s *UserService) updateUser(ctx context.Context, id domain.UserID, name, email string) (*domain.User, error) {
+	err := s.userRepo.Update(ctx, id, &domain.User{
 		Name:  name,
 		Email: email,
+	})
+	if err != nil {
+		return nil, userWriteError(err)
+	}
+
+	updated, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return updated, s.outbox.Append(ctx, domain.UserUpdated(updated))
+}
+
+// ReplaceProvisionedUser replaces a user's name and email and, unless
+// status is empty, moves their account to it. Provisioning clients send the
+// whole account at once, so it is all applied in one transaction or not at
+// all. Unless expectedVersion is zero the user must be at that version
+// until the writes land, or ports.ErrVersionConflict is returned.
+func (s *UserService) ReplaceProvisionedUser(ctx context.Context, id domain.UserID, expectedVersion int64, name, email string, status domain.UserStatus, reason string) (*domain.User, error) {
+	if err := domain.ValidateName(name); err != nil {
+		return nil, err
+	}
+	email = domain.NormalizeEmail(email)
+	if err := domain.ValidateEmail(email); err != nil {
+		return nil, err
 	}
 
-	err := s.userRepo.Update(ctx, id, user)
+	var updated *domain.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		current, err := s.getUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != 0 && current.Version != expectedVersion {
+			return ports.ErrVersionConflict
+		}
+		patch := domain.UserPatch{Name: &name, Email: &email}
+		if err := s.checkEmailChange(ctx, current, patch); err != nil {
+			return err
+		}
+		if status != "" {
+			if current, err = s.changeStatus(ctx, current, status, reason); err != nil {
+				return err
+			}
+		}
+
+		// The checks hold only while the user is at the version they ran
+		// against
+		patch.Version = current.Version
+		updated, err = s.writePatch(ctx, id, patch)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return s.userRepo.GetByID(ctx, id)
+	return updated, nil
+}
+
+// PatchUser applies a partial update, changing only the fields the patch
+// sets. Callers check that the custom attributes it sets are writable by
+// whoever asked for the change.
+func (s *UserService) PatchUser(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	patch, err := s.preparePatch(ctx, id, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *domain.User
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		current, err := s.getUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		if patch.Version != 0 && patch.Version != current.Version {
+			return ports.ErrVersionConflict
+		}
+		if err := s.checkEmailChange(ctx, current, patch); err != nil {
+			return err
+		}
+
+		user, err = s.writePatch(ctx, id, patch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// writePatch applies a checked patch and appends its events to the outbox
+func (s *UserService) writePatch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	user, err := s.userRepo.Patch(ctx, id, patch)
+	if err != nil {
+		return nil, userWriteError(err)
+	}
+
+	return user, s.outbox.Append(ctx, patchEvents(user, patch)...)
+}
+
+// patchEvents returns the events of a patch applied to user
+func patchEvents(user *domain.User, patch domain.UserPatch) []*domain.Event {
+	events := []*domain.Event{domain.UserUpdated(user)}
+	if patch.Password != nil {
+		events = append(events, domain.PasswordChanged(user.ID))
+	}
+	return events
+}
+
+// preparePatch validates a patch of the user with the given ID and
+// normalizes the email and custom attributes it sets
+func (s *UserService) preparePatch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (domain.UserPatch, error) {
+	if patch.Email != nil {
+		email := domain.NormalizeEmail(*patch.Email)
+		patch.Email = &email
+	}
+	if err := patch.Validate(); err != nil {
+		return patch, err
+	}
+	attributes, err := normalizeAttributes(ctx, s.userRepo, s.schema, patch.Attributes, id)
+	if err != nil {
+		return patch, err
+	}
+	patch.Attributes = attributes
+	return patch, nil
+}
+
+// checkEmailChange returns ErrUserExists if the patch gives the user an
+// email that is taken. Deleted users keep their email until they are
+// purged, so this also checks against them.
+func (s *UserService) checkEmailChange(ctx context.Context, current *domain.User, patch domain.UserPatch) error {
+	if patch.Email == nil || *patch.Email == current.Email {
+		return nil
+	}
+	exists, err := s.userRepo.EmailExists(ctx, *patch.Email)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrUserExists
+	}
+	return nil
+}
+
+// userWriteError reports a write the repository rejected because another
+// user took the email in the meantime as ErrUserExists, and one that found
+// no user as ErrUserNotFound
+func userWriteError(err error) error {
+	if errors.Is(err, ports.ErrEmailTaken) {
+		return ErrUserExists
+	}
+	if errors.Is(err, ports.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// DeleteUser soft deletes a user. They can be restored until they are
+// purged.
+func (s *UserService) DeleteUser(ctx context.Context, id domain.UserID) error {
+	return s.DeleteUserAtVersion(ctx, id, 0)
+}
+
+// DeleteUserAtVersion soft deletes a user only if they are still at the
+// expected version, returning ports.ErrVersionConflict otherwise. A user
+// who doesn't exist or is already deleted is not deleted again, and no event
+// is appended; it returns ErrUserNotFound instead.
+func (s *UserService) DeleteUserAtVersion(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	return s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := s.userRepo.Delete(ctx, id, expectedVersion); err != nil {
+			return userWriteError(err)
+		}
+		return s.outbox.Append(ctx, domain.UserDeleted(id))
+	})
+}
+
+func (s *UserService) GetDeletedUsers(ctx context.Context) ([]*domain.User, error) {
+	return s.userRepo.GetDeleted(ctx)
+}
+
+// RestoreUser undoes a soft delete. Downstream systems learn of it as an
+// update with the whole user.
+func (s *UserService) RestoreUser(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	var user *domain.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := s.userRepo.Restore(ctx, id)
+		if errors.Is(err, ports.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		user, err = s.getUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		return s.outbox.Append(ctx, domain.UserUpdated(user))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// PurgeDeletedUsers permanently removes users that were deleted more than
+// retention ago, freeing their emails for re-registration. Their deletion
+// was published when they were soft deleted, so purging publishes nothing.
+func (s *UserService) PurgeDeletedUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.userRepo.Purge(ctx, time.Now().Add(-retention))
+}
+
+// ChangeUserStatus moves an account to a new lifecycle status, recording
+// when and why it happened
+func (s *UserService) ChangeUserStatus(ctx context.Context, id domain.UserID, status domain.UserStatus, reason string) (*domain.User, error) {
+	var user *domain.User
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		current, err := s.getUser(ctx, id)
+		if err != nil {
+			return err
+		}
+		user, err = s.changeStatus(ctx, current, status, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// changeStatus checks that user may move to status and writes it while
+// they are still at the version that was checked, so a concurrent change
+// fails with ports.ErrVersionConflict instead of landing a transition that
+// isn't allowed. It appends the update to the outbox and runs in the
+// caller's transaction.
+func (s *UserService) changeStatus(ctx context.Context, user *domain.User, status domain.UserStatus, reason string) (*domain.User, error) {
+	if !user.CurrentStatus().CanTransitionTo(status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, user.CurrentStatus(), status)
+	}
+
+	now := time.Now()
+	updated, err := s.userRepo.UpdateStatus(ctx, user.ID, &domain.User{
+		Status:          status,
+		StatusReason:    reason,
+		StatusChangedAt: &now,
+		Version:         user.Version,
+	})
+	if err != nil {
+		return nil, userWriteError(err)
+	}
+	return updated, s.outbox.Append(ctx, domain.UserUpdated(updated))
+}
+
+// SuspendUser blocks an active account until it is reactivated
+func (s *UserService) SuspendUser(ctx context.Context, id domain.UserID, reason string) (*domain.User, error) {
+	return s.ChangeUserStatus(ctx, id, domain.UserStatusSuspended, reason)
+}
+
+// DeactivateUser closes an account while keeping its data
+func (s *UserService) DeactivateUser(ctx context.Context, id domain.UserID, reason string) (*domain.User, error) {
+	return s.ChangeUserStatus(ctx, id, domain.UserStatusDeactivated, reason)
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, id primitive.ObjectID) error {
-	return s.userRepo.Delete(ctx, id)
+// ReactivateUser returns a pending, suspended or deactivated account to active
+func (s *UserService) ReactivateUser(ctx context.Context, id domain.UserID, reason string) (*domain.User, error) {
+	return s.ChangeUserStatus(ctx, id, domain.UserStatusActive, reason)
 }
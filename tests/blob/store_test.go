@@ -0,0 +1,199 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"backend-hexagonal/internal/adapters/blob"
+	"backend-hexagonal/internal/ports"
+)
+
+// fakeS3 is an in-memory S3-compatible server handling path-style object
+// PUT, GET and DELETE requests. It doesn't check signatures.
+type fakeS3 struct {
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	fake := &fakeS3{
+		objects:      make(map[string][]byte),
+		contentTypes: make(map[string]string),
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Path-style requests address /<bucket>/<key>
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+		f.contentTypes[key] = r.Header.Get("Content-Type")
+		w.Header().Set("ETag", `"fake"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Type", f.contentTypes[key])
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newS3Store(t *testing.T) *blob.S3Store {
+	server := newFakeS3(t)
+	store, err := blob.NewS3Store(blob.S3Config{
+		Endpoint:        server.URL,
+		Region:          "us-east-1",
+		Bucket:          "avatars",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		UsePathStyle:    true,
+		BaseURL:         "https://cdn.example.com/",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return store
+}
+
+func newFileSystemStore(t *testing.T) (*blob.FileSystemStore, string) {
+	root := t.TempDir()
+	store, err := blob.NewFileSystemStore(root, "/media/")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return store, root
+}
+
+// testStore checks the behavior every BlobStore shares
+func testStore(t *testing.T, store ports.BlobStore) {
+	ctx := context.Background()
+	key := "avatars/123/abc/64.png"
+
+	if err := store.Put(ctx, key, strings.NewReader("first"), "image/png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Non-seekable readers are accepted too
+	if err := store.Put(ctx, key, io.MultiReader(strings.NewReader("sec"), strings.NewReader("ond")), "image/png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	blob, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(data) != "second" {
+		t.Errorf("Expected the replaced blob, got %q", data)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ports.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Expected deleting a missing blob to succeed, got %v", err)
+	}
+	if _, err := store.Get(ctx, "avatars/missing.png"); !errors.Is(err, ports.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func TestFileSystemStore(t *testing.T) {
+	store, _ := newFileSystemStore(t)
+	testStore(t, store)
+
+	if url := store.URL("avatars/1/64.png"); url != "/media/avatars/1/64.png" {
+		t.Errorf("Expected /media/avatars/1/64.png, got %s", url)
+	}
+}
+
+func TestFileSystemStore_RejectsEscapingKeys(t *testing.T) {
+	store, root := newFileSystemStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"../outside", "/etc/passwd", "a/../../b", "", `a\b`} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), "text/plain"); !errors.Is(err, blob.ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ports.ErrBlobNotFound) {
+			t.Errorf("Expected ErrBlobNotFound for %q, got %v", key, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "outside")); err == nil {
+		t.Error("Expected nothing to be written outside the root")
+	}
+}
+
+func TestFileSystemStore_DeleteRemovesEmptyDirectories(t *testing.T) {
+	store, root := newFileSystemStore(t)
+	ctx := context.Background()
+
+	store.Put(ctx, "avatars/1/a/64.png", strings.NewReader("x"), "image/png")
+	store.Put(ctx, "avatars/1/b/64.png", strings.NewReader("x"), "image/png")
+
+	if err := store.Delete(ctx, "avatars/1/a/64.png"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "avatars", "1", "a")); !os.IsNotExist(err) {
+		t.Error("Expected the empty directory to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(root, "avatars", "1", "b", "64.png")); err != nil {
+		t.Errorf("Expected the other blob to remain, got %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("Expected the root to remain, got %v", err)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	store := newS3Store(t)
+	testStore(t, store)
+
+	if url := store.URL("avatars/1/64.png"); url != "https://cdn.example.com/avatars/1/64.png" {
+		t.Errorf("Expected the CDN URL, got %s", url)
+	}
+}
+
+func TestNewS3Store_RequiresBucket(t *testing.T) {
+	if _, err := blob.NewS3Store(blob.S3Config{Region: "us-east-1"}); err == nil {
+		t.Error("Expected an error without a bucket")
+	}
+}
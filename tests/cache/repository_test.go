@@ -0,0 +1,415 @@
+package cache
+
+import (
+	"backend-hexagonal/internal/adapters/cache"
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"backend-hexagonal/tests/conformance"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var config = cache.Config{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute}
+
+// countingRepository counts the reads that reach the repository, and holds
+// back their results until release is closed if it isn't nil. Like a
+// database, it fails reads whose context ended meanwhile.
+type countingRepository struct {
+	ports.UserRepository
+	reads   atomic.Int64
+	release chan struct{}
+}
+
+func (r *countingRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	r.reads.Add(1)
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if r.release != nil {
+		<-r.release
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return user, err
+}
+
+func (r *countingRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.reads.Add(1)
+	return r.UserRepository.GetByEmail(ctx, email)
+}
+
+func newRepository(config cache.Config) (*cache.Repository, *countingRepository) {
+	counting := &countingRepository{UserRepository: memory.NewUserRepository(ids.NewObjectIDGenerator())}
+	return cache.NewRepository(counting, config), counting
+}
+
+func create(t *testing.T, repo ports.UserRepository, email string) *domain.User {
+	t.Helper()
+	user := &domain.User{Name: "Cached User", Email: email, Status: domain.UserStatusActive, CreatedAt: time.Now()}
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return user
+}
+
+func TestRepository_Conformance(t *testing.T) {
+	conformance.RunUserRepository(t, func(t *testing.T) ports.UserRepository {
+		repo, _ := newRepository(config)
+		return repo
+	})
+}
+
+func TestRepository_Hits(t *testing.T) {
+	repo, counting := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "hits@example.com")
+
+	for i := 0; i < 3; i++ {
+		if _, err := repo.GetByID(ctx, user.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := repo.GetByEmail(ctx, user.Email); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if reads := counting.reads.Load(); reads != 2 {
+		t.Errorf("Expected 2 reads of the repository, got %d", reads)
+	}
+	stats := repo.Stats()
+	if stats.Hits != 4 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Expected 4 hits, 2 misses and 2 entries, got %+v", stats)
+	}
+
+	// Callers get copies
+	cached, _ := repo.GetByID(ctx, user.ID)
+	cached.Name = "Changed"
+	cached.Roles = append(cached.Roles, "admin")
+	if again, _ := repo.GetByID(ctx, user.ID); again.Name != "Cached User" || len(again.Roles) != 0 {
+		t.Errorf("Expected the cached user to be unchanged, got %+v", again)
+	}
+}
+
+func TestRepository_Invalidation(t *testing.T) {
+	repo, _ := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "old@example.com")
+	repo.GetByID(ctx, user.ID)
+	repo.GetByEmail(ctx, "old@example.com")
+
+	email := "new@example.com"
+	name := "Renamed User"
+	if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: &name, Email: &email}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, _ := repo.GetByID(ctx, user.ID); got.Name != name {
+		t.Errorf("Expected the patched name, got %s", got.Name)
+	}
+	if got, _ := repo.GetByEmail(ctx, "old@example.com"); got != nil {
+		t.Errorf("Expected no user with the old email, got %s", got.ID.String())
+	}
+	if got, _ := repo.GetByEmail(ctx, email); got == nil || got.ID != user.ID {
+		t.Errorf("Expected the user by the new email, got %+v", got)
+	}
+
+	if err := repo.Delete(ctx, user.ID, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after the delete, got %v", err)
+	}
+	if got, _ := repo.GetByEmail(ctx, email); got != nil {
+		t.Errorf("Expected no user by email after the delete, got %s", got.ID.String())
+	}
+
+	// Both lookups were cached as missing while the user was deleted
+	if err := repo.Restore(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, user.ID); err != nil {
+		t.Errorf("Expected the restored user, got %v", err)
+	}
+	if got, _ := repo.GetByEmail(ctx, email); got == nil {
+		t.Error("Expected the restored user by email")
+	}
+}
+
+func TestRepository_NegativeTTL(t *testing.T) {
+	repo, counting := newRepository(cache.Config{Size: 100, TTL: time.Minute, NegativeTTL: 50 * time.Millisecond})
+	ctx := context.Background()
+	id := ids.NewObjectIDGenerator().NewUserID()
+
+	for i := 0; i < 3; i++ {
+		if _, err := repo.GetByID(ctx, id); !errors.Is(err, ports.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+	}
+	if reads := counting.reads.Load(); reads != 1 {
+		t.Errorf("Expected the missing user to be read once, got %d", reads)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	repo.GetByID(ctx, id)
+	if reads := counting.reads.Load(); reads != 2 {
+		t.Errorf("Expected the missing user to be read again once expired, got %d", reads)
+	}
+
+	// Registering the email drops its lookup cached as missing
+	if got, _ := repo.GetByEmail(ctx, "late@example.com"); got != nil {
+		t.Fatalf("Expected no user, got %s", got.ID.String())
+	}
+	user := create(t, repo, "late@example.com")
+	if got, _ := repo.GetByEmail(ctx, "late@example.com"); got == nil || got.ID != user.ID {
+		t.Errorf("Expected the new user, got %+v", got)
+	}
+}
+
+func TestRepository_Eviction(t *testing.T) {
+	repo, counting := newRepository(cache.Config{Size: 2, TTL: time.Minute, NegativeTTL: time.Minute})
+	ctx := context.Background()
+	first := create(t, repo, "first@example.com")
+	second := create(t, repo, "second@example.com")
+	third := create(t, repo, "third@example.com")
+
+	repo.GetByID(ctx, first.ID)
+	repo.GetByID(ctx, second.ID)
+	repo.GetByID(ctx, first.ID)
+	repo.GetByID(ctx, third.ID)
+
+	// second was the least recently used
+	counting.reads.Store(0)
+	repo.GetByID(ctx, first.ID)
+	repo.GetByID(ctx, third.ID)
+	if reads := counting.reads.Load(); reads != 0 {
+		t.Errorf("Expected first and third to be cached, got %d reads", reads)
+	}
+	repo.GetByID(ctx, second.ID)
+	if reads := counting.reads.Load(); reads != 1 {
+		t.Errorf("Expected second to be evicted, got %d reads", reads)
+	}
+	if entries := repo.Stats().Entries; entries != 2 {
+		t.Errorf("Expected 2 entries, got %d", entries)
+	}
+}
+
+func TestRepository_ConcurrentMisses(t *testing.T) {
+	repo, counting := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "concurrent@example.com")
+	counting.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := repo.GetByID(ctx, user.ID); err != nil || got.ID != user.ID {
+				t.Errorf("Expected the user, got %v", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+
+	if reads := counting.reads.Load(); reads != 1 {
+		t.Errorf("Expected the concurrent misses to share one read, got %d", reads)
+	}
+}
+
+func TestRepository_CanceledWhileLoading(t *testing.T) {
+	repo, counting := newRepository(config)
+	user := create(t, repo, "canceled@example.com")
+	counting.release = make(chan struct{})
+
+	// The first caller starts the load, and gives up while it runs
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := repo.GetByID(ctx, user.ID)
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	second := make(chan error, 1)
+	go func() {
+		_, err := repo.GetByID(context.Background(), user.ID)
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-first:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the canceled caller to stop waiting")
+	}
+
+	// The caller sharing the load still gets the user
+	close(counting.release)
+	if err := <-second; err != nil {
+		t.Errorf("Expected the user for the other caller, got %v", err)
+	}
+	if reads := counting.reads.Load(); reads != 1 {
+		t.Errorf("Expected the callers to share one read, got %d", reads)
+	}
+}
+
+func TestRepository_WriteDuringLoad(t *testing.T) {
+	repo, counting := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "racing@example.com")
+	counting.release = make(chan struct{})
+
+	// A read that started before a write doesn't cache what it read
+	done := make(chan struct{})
+	go func() {
+		repo.GetByID(ctx, user.ID)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	name := "Written Meanwhile"
+	if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: &name}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	close(counting.release)
+	<-done
+
+	if got, _ := repo.GetByID(ctx, user.ID); got.Name != name {
+		t.Errorf("Expected the written name, got %s", got.Name)
+	}
+}
+
+func TestRepository_Invalidate(t *testing.T) {
+	repo, counting := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "before@example.com")
+	repo.GetByID(ctx, user.ID)
+	repo.GetByEmail(ctx, "before@example.com")
+	repo.GetByEmail(ctx, "after@example.com")
+
+	// Another server changes the user, which this cache doesn't see
+	email := "after@example.com"
+	updated, err := counting.UserRepository.Patch(ctx, user.ID, domain.UserPatch{Email: &email})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, _ := repo.GetByEmail(ctx, email); got != nil {
+		t.Fatalf("Expected the stale miss before the change arrives, got %s", got.ID.String())
+	}
+
+	repo.Invalidate(domain.UserChange{Type: domain.ChangeUpdated, UserID: user.ID, User: updated})
+	if got, _ := repo.GetByID(ctx, user.ID); got.Email != email {
+		t.Errorf("Expected the new email, got %s", got.Email)
+	}
+	if got, _ := repo.GetByEmail(ctx, "before@example.com"); got != nil {
+		t.Errorf("Expected no user with the old email, got %s", got.ID.String())
+	}
+	if got, _ := repo.GetByEmail(ctx, email); got == nil || got.ID != user.ID {
+		t.Errorf("Expected the user by the new email, got %+v", got)
+	}
+
+	// An erased user's email is known from the index
+	if _, err := counting.UserRepository.Erase(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo.Invalidate(domain.UserChange{Type: domain.ChangeDeleted, UserID: user.ID})
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after the erase, got %v", err)
+	}
+	if got, _ := repo.GetByEmail(ctx, email); got != nil {
+		t.Errorf("Expected no user by email after the erase, got %s", got.ID.String())
+	}
+}
+
+// rollbackTransactor runs fn without a transaction and, when it fails,
+// calls undo to stand in for the rollback
+type rollbackTransactor struct {
+	undo func()
+}
+
+func (t *rollbackTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if err != nil {
+		t.undo()
+	}
+	return err
+}
+
+// failingOutbox fails to append events, aborting the transaction
+type failingOutbox struct {
+	ports.OutboxRepository
+}
+
+func (failingOutbox) Append(ctx context.Context, events ...*domain.Event) error {
+	return errors.New("outbox unavailable")
+}
+
+func TestRepository_Rollback(t *testing.T) {
+	repo, counting := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "rollback@example.com")
+	repo.GetByID(ctx, user.ID)
+
+	transactor := repo.Transactor(&rollbackTransactor{undo: func() {
+		name := "Cached User"
+		counting.UserRepository.Patch(ctx, user.ID, domain.UserPatch{Name: &name})
+	}})
+	reads := counting.reads.Load()
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		name := "Uncommitted"
+		if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: &name}); err != nil {
+			return err
+		}
+		// Reads within the transaction see its writes but aren't cached
+		for i := 0; i < 2; i++ {
+			got, err := repo.GetByID(ctx, user.ID)
+			if err != nil || got.Name != name {
+				t.Errorf("Expected the uncommitted name within the transaction, got %+v, %v", got, err)
+			}
+		}
+		return errors.New("rolled back")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction to fail")
+	}
+	if got := counting.reads.Load() - reads; got != 2 {
+		t.Errorf("Expected both reads within the transaction to reach the repository, got %d", got)
+	}
+
+	if got, _ := repo.GetByID(ctx, user.ID); got.Name != "Cached User" {
+		t.Errorf("Expected the name from before the transaction, got %s", got.Name)
+	}
+}
+
+func TestRepository_RollbackOfRestore(t *testing.T) {
+	repo, counting := newRepository(config)
+	ctx := context.Background()
+	user := create(t, repo, "restore@example.com")
+	if err := repo.Delete(ctx, user.ID, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The restore is rolled back when its event can't be stored
+	transactor := repo.Transactor(&rollbackTransactor{undo: func() {
+		counting.UserRepository.Delete(ctx, user.ID, 0)
+	}})
+	userService := service.NewUserService(repo).WithTransactor(transactor).WithOutbox(failingOutbox{})
+	if _, err := userService.RestoreUser(ctx, user.ID); err == nil {
+		t.Fatal("Expected the restore to fail")
+	}
+
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected the user to stay deleted, got %v", err)
+	}
+	if got, _ := repo.GetByEmail(ctx, "restore@example.com"); got != nil {
+		t.Errorf("Expected no user by email, got %s", got.ID.String())
+	}
+}
@@ -0,0 +1,432 @@
+// Package conformance checks that adapters honour the contracts documented
+// on the ports they implement. An adapter's tests run a suite against fresh,
+// empty stores, so every adapter handles missing records, duplicate emails,
+// ordering and concurrent writes the same way.
+package conformance
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NewUserRepository returns an empty repository for one test. It registers
+// any cleanup with t.
+type NewUserRepository func(t *testing.T) ports.UserRepository
+
+// RunUserRepository runs the ports.UserRepository suite
+func RunUserRepository(t *testing.T, newRepo NewUserRepository) {
+	t.Run("Create", func(t *testing.T) { testCreate(t, newRepo(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newRepo(t)) })
+	t.Run("Deleted", func(t *testing.T) { testDeleted(t, newRepo(t)) })
+	t.Run("DuplicateEmails", func(t *testing.T) { testDuplicateEmails(t, newRepo(t)) })
+	t.Run("MissingWrites", func(t *testing.T) { testMissingWrites(t, newRepo(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newRepo(t)) })
+	t.Run("Ordering", func(t *testing.T) { testOrdering(t, newRepo(t)) })
+	t.Run("ConcurrentWrites", func(t *testing.T) { testConcurrentWrites(t, newRepo(t)) })
+}
+
+// newID returns an ID in a format every adapter accepts
+var newID = ids.NewObjectIDGenerator().NewUserID
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// create stores a new active user, failing the test if it can't
+func create(t *testing.T, repo ports.UserRepository, name, email string) *domain.User {
+	t.Helper()
+	user := &domain.User{Name: name, Email: email, Status: domain.UserStatusActive, CreatedAt: time.Now()}
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatalf("Expected no error creating %s, got %v", email, err)
+	}
+	return user
+}
+
+// get reads a user, failing the test if it can't
+func get(t *testing.T, repo ports.UserRepository, id domain.UserID) *domain.User {
+	t.Helper()
+	user, err := repo.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Expected user %s, got %v", id, err)
+	}
+	return user
+}
+
+func testCreate(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+
+	user := create(t, repo, "John Doe", "john@example.com")
+	if user.ID.IsZero() || user.Version != 1 {
+		t.Fatalf("Expected an ID and version 1, got %q, %d", user.ID, user.Version)
+	}
+	found := get(t, repo, user.ID)
+	if found.ID != user.ID || found.Name != "John Doe" || found.Email != "john@example.com" || found.Version != 1 {
+		t.Errorf("Expected the created user back, got %+v", found)
+	}
+
+	id := newID()
+	given := &domain.User{ID: id, Name: "Jane Doe", Email: "jane@example.com", CreatedAt: time.Now()}
+	if err := repo.Create(ctx, given); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if given.ID != id {
+		t.Errorf("Expected the given ID %s to be kept, got %s", id, given.ID)
+	}
+	get(t, repo, id)
+
+	// Reads return copies, so changing them changes nothing stored
+	found.Name = "Changed"
+	if again := get(t, repo, user.ID); again.Name != "John Doe" {
+		t.Errorf("Expected the stored name to be unchanged, got %s", again.Name)
+	}
+}
+
+func testNotFound(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+	existing := create(t, repo, "John Doe", "john@example.com")
+	missing := newID()
+
+	if user, err := repo.GetByID(ctx, missing); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected GetByID to return ErrNotFound, got %v, %v", user, err)
+	}
+	users, err := repo.GetByIDs(ctx, []domain.UserID{missing, existing.ID})
+	if err != nil || len(users) != 1 || users[0].ID != existing.ID {
+		t.Errorf("Expected GetByIDs to skip missing users, got %d users, %v", len(users), err)
+	}
+	if user, err := repo.GetByEmail(ctx, "nobody@example.com"); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected GetByEmail to return ErrNotFound, got %v, %v", user, err)
+	}
+	if err := repo.Restore(ctx, missing); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected Restore to return ErrNotFound, got %v", err)
+	}
+	if err := repo.Restore(ctx, existing.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected Restore of a user who isn't deleted to return ErrNotFound, got %v", err)
+	}
+	if user, err := repo.Patch(ctx, missing, domain.UserPatch{Name: strPtr("Nobody")}); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected Patch to return ErrNotFound, got %v, %v", user, err)
+	}
+	if user, err := repo.SetAvatar(ctx, missing, nil); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected SetAvatar to return ErrNotFound, got %v, %v", user, err)
+	}
+	if user, err := repo.Erase(ctx, missing); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected Erase to return ErrNotFound, got %v, %v", user, err)
+	}
+}
+
+func testDeleted(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+	user := create(t, repo, "John Doe", "john@example.com")
+	if err := repo.Delete(ctx, user.ID, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected deleted users to be hidden from GetByID, got %v", err)
+	}
+	if found, _ := repo.GetByEmail(ctx, user.Email); found != nil {
+		t.Error("Expected deleted users to be hidden from GetByEmail")
+	}
+	if all, _ := repo.GetAll(ctx); len(all) != 0 {
+		t.Errorf("Expected deleted users to be hidden from GetAll, got %d users", len(all))
+	}
+	deleted, err := repo.GetDeleted(ctx)
+	if err != nil || len(deleted) != 1 || deleted[0].ID != user.ID || !deleted[0].IsDeleted() {
+		t.Errorf("Expected GetDeleted to return the user, got %d users, %v", len(deleted), err)
+	}
+
+	if err := repo.Restore(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if restored := get(t, repo, user.ID); restored.IsDeleted() || restored.Version != 3 {
+		t.Errorf("Expected the user restored at version 3, got version %d", restored.Version)
+	}
+
+	erased, err := repo.Erase(ctx, user.ID)
+	if err != nil || erased == nil || erased.ID != user.ID {
+		t.Fatalf("Expected Erase to return the user, got %v, %v", erased, err)
+	}
+	if exists, _ := repo.EmailExists(ctx, user.Email); exists {
+		t.Error("Expected an erased user's email to be free")
+	}
+}
+
+func testDuplicateEmails(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+	john := create(t, repo, "John Doe", "john@example.com")
+	jane := create(t, repo, "Jane Doe", "jane@example.com")
+
+	duplicate := &domain.User{Name: "Other John", Email: "john@example.com", CreatedAt: time.Now()}
+	if err := repo.Create(ctx, duplicate); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected Create to return ErrEmailTaken, got %v", err)
+	}
+	if err := repo.Update(ctx, jane.ID, &domain.User{Name: "Jane Doe", Email: "john@example.com"}); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected Update to return ErrEmailTaken, got %v", err)
+	}
+	if _, err := repo.Patch(ctx, jane.ID, domain.UserPatch{Email: strPtr("john@example.com")}); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected Patch to return ErrEmailTaken, got %v", err)
+	}
+	changed, err := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{
+		jane.ID: {Email: strPtr("john@example.com")},
+	})
+	if err != nil || len(changed) != 0 {
+		t.Errorf("Expected PatchMany to skip the patch, got %v, %v", changed, err)
+	}
+	if found := get(t, repo, jane.ID); found.Email != "jane@example.com" {
+		t.Errorf("Expected jane@example.com to be kept, got %s", found.Email)
+	}
+
+	// A deleted user's email stays reserved until they are purged
+	if err := repo.Delete(ctx, john.ID, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if exists, _ := repo.EmailExists(ctx, "john@example.com"); !exists {
+		t.Error("Expected EmailExists to count deleted users")
+	}
+	if err := repo.Create(ctx, duplicate); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected the email of a deleted user to be taken, got %v", err)
+	}
+	purged, err := repo.Purge(ctx, time.Now().Add(time.Second))
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected one user purged, got %d, %v", purged, err)
+	}
+	if err := repo.Create(ctx, duplicate); err != nil {
+		t.Errorf("Expected a purged user's email to be free, got %v", err)
+	}
+}
+
+func testMissingWrites(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+	deleted := create(t, repo, "Gone", "gone@example.com")
+	if err := repo.Delete(ctx, deleted.ID, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for name, id := range map[string]domain.UserID{"missing": newID(), "deleted": deleted.ID} {
+		if err := repo.Update(ctx, id, &domain.User{Name: "Nobody", Email: "nobody@example.com"}); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("Expected Update of a %s user to return ErrNotFound, got %v", name, err)
+		}
+		if _, err := repo.UpdateStatus(ctx, id, &domain.User{Status: domain.UserStatusSuspended}); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("Expected UpdateStatus of a %s user to return ErrNotFound, got %v", name, err)
+		}
+		if _, err := repo.UpdateStatus(ctx, id, &domain.User{Status: domain.UserStatusSuspended, Version: 3}); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("Expected versioned UpdateStatus of a %s user to return ErrNotFound, got %v", name, err)
+		}
+		if err := repo.Delete(ctx, id, 0); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("Expected Delete of a %s user to return ErrNotFound, got %v", name, err)
+		}
+		if err := repo.Delete(ctx, id, 3); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("Expected versioned Delete of a %s user to return ErrNotFound, got %v", name, err)
+		}
+		changed, err := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{id: {Name: strPtr("Nobody")}})
+		if err != nil || len(changed) != 0 {
+			t.Errorf("Expected PatchMany to skip a %s user, got %v, %v", name, changed, err)
+		}
+		removed, err := repo.DeleteMany(ctx, map[domain.UserID]int64{id: 0})
+		if err != nil || len(removed) != 0 {
+			t.Errorf("Expected DeleteMany to skip a %s user, got %v, %v", name, removed, err)
+		}
+	}
+
+	if exists, _ := repo.EmailExists(ctx, "nobody@example.com"); exists {
+		t.Error("Expected writes to missing users to store nothing")
+	}
+	if all, _ := repo.GetDeleted(ctx); len(all) != 1 || all[0].Version != 2 {
+		t.Error("Expected writes to a deleted user to leave them unchanged")
+	}
+}
+
+func testVersions(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+	user := create(t, repo, "John Doe", "john@example.com")
+
+	if err := repo.Update(ctx, user.ID, &domain.User{Name: "John", Email: "john@example.com"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	suspended, err := repo.UpdateStatus(ctx, user.ID, &domain.User{Status: domain.UserStatusSuspended, StatusReason: "spam", Version: 2})
+	if err != nil || suspended.Version != 3 || suspended.Status != domain.UserStatusSuspended || suspended.Name != "John" {
+		t.Fatalf("Expected the status change to apply at version 2, got %+v, %v", suspended, err)
+	}
+	patched, err := repo.Patch(ctx, user.ID, domain.UserPatch{DisplayName: strPtr("Johnny"), Version: 3})
+	if err != nil || patched == nil || patched.Version != 4 {
+		t.Fatalf("Expected the patch to apply at version 3, got %v, %v", patched, err)
+	}
+	if patched.Name != "John" || patched.Status != domain.UserStatusSuspended || patched.DisplayName != "Johnny" {
+		t.Errorf("Expected every write to be kept, got %+v", patched)
+	}
+
+	if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr("Stale"), Version: 3}); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected a stale Patch to return ErrVersionConflict, got %v", err)
+	}
+	if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Version: 3}); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected a stale empty Patch to return ErrVersionConflict, got %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID, 3); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected a stale Delete to return ErrVersionConflict, got %v", err)
+	}
+	if _, err := repo.UpdateStatus(ctx, user.ID, &domain.User{Status: domain.UserStatusDeactivated, Version: 3}); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected a stale UpdateStatus to return ErrVersionConflict, got %v", err)
+	}
+	changed, _ := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{user.ID: {Name: strPtr("Stale"), Version: 3}})
+	if len(changed) != 0 {
+		t.Errorf("Expected PatchMany to skip a stale patch, got %v", changed)
+	}
+	if found := get(t, repo, user.ID); found.Name != "John" || found.Version != 4 {
+		t.Errorf("Expected stale writes to change nothing, got %s at version %d", found.Name, found.Version)
+	}
+
+	if err := repo.Delete(ctx, user.ID, 4); err != nil {
+		t.Errorf("Expected Delete at the current version to succeed, got %v", err)
+	}
+}
+
+func testOrdering(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+
+	// Repeated names check that ties are broken by ID
+	names := []string{"Dave", "Bob", "Alice", "Carol", "Bob", "Erin", "Alice"}
+	var created []*domain.User
+	for i, name := range names {
+		created = append(created, create(t, repo, name, fmt.Sprintf("user%d@example.com", i)))
+	}
+
+	var each []domain.UserID
+	err := repo.Each(ctx, func(user *domain.User) error {
+		each = append(each, user.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !sort.SliceIsSorted(each, func(i, j int) bool { return each[i] < each[j] }) || len(each) != len(names) {
+		t.Errorf("Expected Each to visit every user in ID order, got %v", each)
+	}
+
+	for _, descending := range []bool{false, true} {
+		want := make([]*domain.User, len(created))
+		copy(want, created)
+		sort.Slice(want, func(i, j int) bool {
+			a, b := want[i], want[j]
+			if descending {
+				a, b = b, a
+			}
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.ID < b.ID
+		})
+
+		query := ports.UserQuery{Limit: 3, SortBy: ports.SortByName, Descending: descending}
+		var got []*domain.User
+		for pages := 0; pages < len(names); pages++ {
+			page, err := repo.List(ctx, query)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if page.Total != int64(len(names)) {
+				t.Errorf("Expected a total of %d, got %d", len(names), page.Total)
+			}
+			got = append(got, page.Users...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d users across the pages, got %d", len(want), len(got))
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID {
+				t.Errorf("Expected %s (%s) at position %d when descending is %v, got %s (%s)",
+					want[i].Name, want[i].ID, i, descending, got[i].Name, got[i].ID)
+			}
+		}
+	}
+
+	page, err := repo.List(ctx, ports.UserQuery{Limit: 2, Offset: 6, SortBy: ports.SortByName})
+	if err != nil || len(page.Users) != 1 || page.NextCursor != "" {
+		t.Errorf("Expected the last user alone on the last offset page, got %v", err)
+	}
+	if _, err := repo.List(ctx, ports.UserQuery{Limit: 2, SortBy: ports.SortByName, Cursor: "bogus"}); !errors.Is(err, ports.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func testConcurrentWrites(t *testing.T, repo ports.UserRepository) {
+	ctx := context.Background()
+	const writers = 10
+
+	// Only one of the users registering the same email gets it
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	created := 0
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := &domain.User{Name: fmt.Sprintf("Racer %d", i), Email: "racer@example.com", CreatedAt: time.Now()}
+			err := repo.Create(ctx, user)
+			if err != nil && !errors.Is(err, ports.ErrEmailTaken) {
+				t.Errorf("Expected ErrEmailTaken, got %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("Expected exactly one user to be created, got %d", created)
+	}
+
+	// Unversioned writes all apply, and none of their increments is lost
+	user := create(t, repo, "John Doe", "john@example.com")
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr(fmt.Sprintf("John %d", i))}); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if found := get(t, repo, user.ID); found.Version != 1+writers {
+		t.Errorf("Expected version %d, got %d", 1+writers, found.Version)
+	}
+
+	// Only one of the writes expecting the same version applies
+	applied := 0
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr(fmt.Sprintf("Jane %d", i)), Version: 1 + writers})
+			if err != nil && !errors.Is(err, ports.ErrVersionConflict) {
+				t.Errorf("Expected ErrVersionConflict, got %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				applied++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if applied != 1 {
+		t.Errorf("Expected exactly one versioned write to apply, got %d", applied)
+	}
+	if found := get(t, repo, user.ID); found.Version != 2+writers {
+		t.Errorf("Expected version %d, got %d", 2+writers, found.Version)
+	}
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/domain"
+	"errors"
+	"testing"
+)
+
+// newID returns a fresh user ID
+var newID = ids.NewObjectIDGenerator().NewUserID
+
+func TestParseAttributeSchema(t *testing.T) {
+	schema, err := domain.ParseAttributeSchema([]byte(`{"attributes": [
+		{"name": "employeeId", "type": "string", "unique": true, "visibility": "public"},
+		{"name": "salaryBand", "type": "number", "visibility": "admin"},
+		{"name": "shirtSize", "type": "string"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	definitions := schema.Definitions()
+	if len(definitions) != 3 || definitions[0].Name != "employeeId" {
+		t.Fatalf("Expected 3 definitions sorted by name, got %v", definitions)
+	}
+
+	// Visibility defaults to private
+	if d, _ := schema.Definition("shirtSize"); d.Visibility != domain.VisibilityPrivate {
+		t.Errorf("Expected private visibility, got %s", d.Visibility)
+	}
+
+	invalid := []string{
+		`{"attributes": [{"name": "1st", "type": "string"}]}`,
+		`{"attributes": [{"name": "a", "type": "string"}, {"name": "a", "type": "number"}]}`,
+		`{"attributes": [{"name": "a", "type": "list"}]}`,
+		`{"attributes": [{"name": "a", "type": "string", "visibility": "secret"}]}`,
+		`not json`,
+	}
+	for _, data := range invalid {
+		if _, err := domain.ParseAttributeSchema([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+}
+
+func TestAttributeSchema_Visibility(t *testing.T) {
+	schema, _ := domain.NewAttributeSchema([]domain.AttributeDefinition{
+		{Name: "team", Type: domain.AttributeTypeString, Visibility: domain.VisibilityPublic},
+		{Name: "shirtSize", Type: domain.AttributeTypeString, Visibility: domain.VisibilityPrivate},
+		{Name: "salaryBand", Type: domain.AttributeTypeNumber, Visibility: domain.VisibilityAdmin},
+	})
+
+	user := &domain.User{
+		ID: newID(),
+		Attributes: map[string]interface{}{
+			"team":       "core",
+			"shirtSize":  "M",
+			"salaryBand": float64(4),
+			"retired":    "no longer declared",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		callerID domain.UserID
+		roles    []string
+		want     []string
+	}{
+		{"other user", newID(), nil, []string{"team"}},
+		{"self", user.ID, nil, []string{"team", "shirtSize"}},
+		{"admin", newID(), []string{domain.RoleAdmin}, []string{"team", "shirtSize", "salaryBand"}},
+	}
+
+	for _, tt := range tests {
+		audience := domain.AudienceFor(tt.callerID, tt.roles, user)
+		visible := schema.Visible(user.Attributes, audience)
+		if len(visible) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, visible)
+			continue
+		}
+		for _, name := range tt.want {
+			if _, ok := visible[name]; !ok {
+				t.Errorf("%s: expected %s to be visible, got %v", tt.name, name, visible)
+			}
+		}
+	}
+
+	// Only admins can write admin attributes
+	write := map[string]interface{}{"salaryBand": float64(5)}
+	if err := schema.CheckWritable(write, domain.AudienceSelf); !errors.Is(err, domain.ErrAttributeNotWritable) {
+		t.Errorf("Expected ErrAttributeNotWritable, got %v", err)
+	}
+	if err := schema.CheckWritable(write, domain.AudienceAdmin); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := schema.CheckWritable(map[string]interface{}{"shirtSize": "L"}, domain.AudiencePublic); !errors.Is(err, domain.ErrAttributeNotWritable) {
+		t.Errorf("Expected other users not to write private attributes, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"backend-hexagonal/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	notFound := domain.NewError(domain.KindNotFound, "thing_not_found", "thing not found")
+	tests := []struct {
+		err  error
+		kind domain.ErrorKind
+		code string
+	}{
+		{notFound, domain.KindNotFound, "thing_not_found"},
+		{fmt.Errorf("%w: with id 1", notFound), domain.KindNotFound, "thing_not_found"},
+		{fmt.Errorf("%w: name is required", domain.ErrInvalidUser), domain.KindInvalidArgument, "invalid_user"},
+		{domain.Unavailable(context.DeadlineExceeded), domain.KindUnavailable, "unavailable"},
+		{errors.New("boom"), domain.KindInternal, "internal"},
+		{nil, domain.KindInternal, "internal"},
+	}
+
+	for _, tt := range tests {
+		if kind := domain.KindOf(tt.err); kind != tt.kind {
+			t.Errorf("Expected kind %s for %v, got %s", tt.kind, tt.err, kind)
+		}
+		if code := domain.CodeOf(tt.err); code != tt.code {
+			t.Errorf("Expected code %q for %v, got %q", tt.code, tt.err, code)
+		}
+	}
+}
+
+func TestUnavailable_KeepsCause(t *testing.T) {
+	err := domain.Unavailable(context.DeadlineExceeded)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the cause to stay in the chain, got %v", err)
+	}
+	if err.Error() != "service unavailable: context deadline exceeded" {
+		t.Errorf("Expected the cause in the message, got %q", err.Error())
+	}
+}
@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"backend-hexagonal/internal/domain"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const uiPreferences = `{"namespaces": {"ui": {
+	"schema": {
+		"type": "object",
+		"properties": {
+			"theme": {"enum": ["light", "dark"]},
+			"fontSize": {"type": "integer", "minimum": 8, "maximum": 32},
+			"notifications": {
+				"type": "object",
+				"properties": {"email": {"type": "boolean"}, "push": {"type": "boolean"}},
+				"additionalProperties": false
+			}
+		},
+		"required": ["theme"],
+		"additionalProperties": false
+	},
+	"defaults": {"theme": "light", "notifications": {"email": true, "push": false}}
+}}}`
+
+func TestParsePreferenceSchema(t *testing.T) {
+	schema, err := domain.ParsePreferenceSchema([]byte(uiPreferences))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if names := schema.Names(); len(names) != 1 || names[0] != "ui" {
+		t.Fatalf("Expected the ui namespace, got %v", names)
+	}
+	if _, ok := schema.Namespace("other"); ok {
+		t.Error("Expected undeclared namespaces to be unknown")
+	}
+
+	invalid := []string{
+		`{"namespaces": {"Bad Name": {"schema": {}}}}`,
+		`{"namespaces": {"ui": {}}}`,
+		`{"namespaces": {"ui": {"schema": {"type": "nonsense"}}}}`,
+		// The defaults must match the schema themselves
+		`{"namespaces": {"ui": {"schema": {"properties": {"theme": {"type": "string"}}}, "defaults": {"theme": 1}}}}`,
+		`not json`,
+	}
+	for _, data := range invalid {
+		if _, err := domain.ParsePreferenceSchema([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+
+	// A nil schema declares nothing
+	var none *domain.PreferenceSchema
+	if _, ok := none.Namespace("ui"); ok || len(none.Names()) != 0 {
+		t.Error("Expected a nil schema to declare no namespaces")
+	}
+}
+
+func TestPreferenceNamespace_ResolveAndValidate(t *testing.T) {
+	schema, _ := domain.ParsePreferenceSchema([]byte(uiPreferences))
+	ui, _ := schema.Namespace("ui")
+
+	resolved := ui.Resolve(map[string]interface{}{
+		"theme":         "dark",
+		"notifications": map[string]interface{}{"push": true},
+	})
+	notifications := resolved["notifications"].(map[string]interface{})
+	if resolved["theme"] != "dark" || notifications["email"] != true || notifications["push"] != true {
+		t.Errorf("Expected the settings merged over the defaults, got %v", resolved)
+	}
+	if ui.Defaults["notifications"].(map[string]interface{})["push"] != false {
+		t.Error("Expected resolving to leave the defaults unchanged")
+	}
+
+	valid := []map[string]interface{}{
+		nil,
+		{"fontSize": float64(14)},
+		{"notifications": map[string]interface{}{"email": false}},
+	}
+	for _, values := range valid {
+		if err := ui.Validate(values); err != nil {
+			t.Errorf("Expected %v to be valid, got %v", values, err)
+		}
+	}
+
+	invalid := []map[string]interface{}{
+		{"theme": "blue"},
+		{"fontSize": 12.5},
+		{"fontSize": float64(64)},
+		{"unknown": true},
+		{"notifications": map[string]interface{}{"sms": true}},
+		{"bio": strings.Repeat("x", domain.MaxPreferencesBytes)},
+	}
+	for _, values := range invalid {
+		if err := ui.Validate(values); !errors.Is(err, domain.ErrInvalidPreferences) {
+			t.Errorf("Expected ErrInvalidPreferences for %v, got %v", values, err)
+		}
+	}
+
+	err := ui.Validate(map[string]interface{}{"fontSize": float64(64)})
+	if err == nil || !strings.Contains(err.Error(), "/fontSize") {
+		t.Errorf("Expected the error to name the setting, got %v", err)
+	}
+}
+
+func TestMergePreferences(t *testing.T) {
+	target := map[string]interface{}{
+		"theme":         "dark",
+		"notifications": map[string]interface{}{"email": true, "push": true},
+	}
+	merged := domain.MergePreferences(target, map[string]interface{}{
+		"theme":         nil,
+		"notifications": map[string]interface{}{"push": nil},
+		"fontSize":      float64(12),
+	})
+
+	if _, ok := merged["theme"]; ok {
+		t.Error("Expected null to remove the setting")
+	}
+	notifications := merged["notifications"].(map[string]interface{})
+	if _, ok := notifications["push"]; ok || notifications["email"] != true {
+		t.Errorf("Expected nested objects to merge, got %v", notifications)
+	}
+	if merged["fontSize"] != float64(12) {
+		t.Errorf("Expected the new setting, got %v", merged["fontSize"])
+	}
+	if target["theme"] != "dark" || len(target["notifications"].(map[string]interface{})) != 2 {
+		t.Error("Expected the target to be left unchanged")
+	}
+}
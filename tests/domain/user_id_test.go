@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"backend-hexagonal/internal/domain"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseUserID(t *testing.T) {
+	id := newID()
+	parsed, err := domain.ParseUserID(id.String())
+	if err != nil || parsed != id {
+		t.Fatalf("Expected %s to round trip, got %q, %v", id, parsed, err)
+	}
+	if parsed.IsZero() {
+		t.Error("Expected a parsed ID not to be zero")
+	}
+
+	invalid := []string{"", "has space", "../etc/passwd", "a/b", strings.Repeat("a", 65)}
+	for _, s := range invalid {
+		if _, err := domain.ParseUserID(s); !errors.Is(err, domain.ErrInvalidUserID) {
+			t.Errorf("Expected ErrInvalidUserID for %q, got %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	grpcadapter "backend-hexagonal/internal/adapters/grpc"
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roleVerifier accepts any password, granting the admin role to logins
+// that start with "admin"
+type roleVerifier struct{}
+
+func (roleVerifier) VerifyCredentials(ctx context.Context, login, password string) (*domain.Identity, error) {
+	identity := &domain.Identity{Email: login, Name: "Gateway User"}
+	if strings.HasPrefix(login, "admin") {
+		identity.Roles = []string{domain.RoleAdmin}
+	}
+	return identity, nil
+}
+
+// gateway is an HTTP gateway over memory storage
+type gateway struct {
+	server  *grpcadapter.Server
+	handler http.Handler
+	users   *service.UserService
+	auth    *service.AuthService
+}
+
+func newGateway(t *testing.T) *gateway {
+	t.Helper()
+	userRepo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	users := service.NewUserService(userRepo)
+	auth := service.NewAuthServiceWithVerifier(userRepo, roleVerifier{})
+	server := grpcadapter.NewServer(users, auth,
+		service.NewSearchService(search.NewIndex()),
+		service.NewPreferenceService(memory.NewPreferenceRepository(), nil),
+		":0")
+	return &gateway{server: server, handler: server.HTTPHandler(), users: users, auth: auth}
+}
+
+// token logs in as login, returning a bearer token
+func (g *gateway) token(t *testing.T, login string) string {
+	t.Helper()
+	resp, err := g.auth.Login(context.Background(), &domain.AuthRequest{Email: login, Password: "secret"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return resp.Token
+}
+
+func (g *gateway) post(path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	g.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGateway_BatchAuthorization(t *testing.T) {
+	g := newGateway(t)
+	ctx := context.Background()
+	target, err := g.users.CreateUser(ctx, "Target User", "target@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	userToken := g.token(t, "member@example.com")
+	adminToken := g.token(t, "admin@example.com")
+	getBody := `{"ids": ["` + target.ID.String() + `"]}`
+	deleteBody := `{"deletes": [{"id": "` + target.ID.String() + `"}]}`
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"get without token", "/grpc/users/batch/get", "", getBody, http.StatusUnauthorized},
+		{"get with invalid token", "/grpc/users/batch/get", "invalid", getBody, http.StatusUnauthorized},
+		{"get as user", "/grpc/users/batch/get", userToken, getBody, http.StatusOK},
+		{"delete without token", "/grpc/users/batch/delete", "", deleteBody, http.StatusUnauthorized},
+		{"delete as user", "/grpc/users/batch/delete", userToken, deleteBody, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if rec := g.post(tt.path, tt.token, tt.body); rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+	}
+	if _, err := g.users.GetUserByID(ctx, target.ID); err != nil {
+		t.Fatalf("Expected the target to survive unauthorized deletes, got %v", err)
+	}
+
+	if rec := g.post("/grpc/users/batch/delete", adminToken, deleteBody); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for an admin, got %d", rec.Code)
+	}
+	if _, err := g.users.GetUserByID(ctx, target.ID); err == nil {
+		t.Error("Expected the admin's delete to apply")
+	}
+}
+
+// watch opens a watch of user changes on a running gateway
+func watch(t *testing.T, url, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestGateway_WatchUsers(t *testing.T) {
+	g := newGateway(t)
+	userToken := g.token(t, "member@example.com")
+	adminToken := g.token(t, "admin@example.com")
+	server := httptest.NewServer(g.handler)
+	// Cleanups run last first, so the watches end before the server closes
+	t.Cleanup(server.Close)
+
+	// Without the change stream the server has nothing to watch
+	if resp := watch(t, server.URL+"/grpc/users/watch", adminToken); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 without user changes, got %d", resp.StatusCode)
+	}
+
+	bus := service.NewUserChangeBus()
+	g.server.WithUserChanges(bus)
+	if resp := watch(t, server.URL+"/grpc/users/watch", userToken); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a user, got %d", resp.StatusCode)
+	}
+	if resp := watch(t, server.URL+"/grpc/users/watch?ids=not%20an%20id", adminToken); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid ID, got %d", resp.StatusCode)
+	}
+
+	watched, err := g.users.CreateUser(context.Background(), "Watched User", "watched@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	other := ids.NewObjectIDGenerator().NewUserID()
+	resp := watch(t, server.URL+"/grpc/users/watch?ids="+watched.ID.String(), adminToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 for an admin, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Expected newline delimited JSON, got %s", got)
+	}
+
+	// The response has subscribed once its headers arrive; changes of
+	// users not watched are left out
+	now := time.Now()
+	bus.Publish(domain.UserChange{Type: domain.ChangeDeleted, UserID: other, OccurredAt: now})
+	bus.Publish(domain.UserChange{Type: domain.ChangeUpdated, UserID: watched.ID, User: watched, OccurredAt: now})
+
+	lines := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		if scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	select {
+	case line := <-lines:
+		var change grpcadapter.UserChange
+		if err := json.Unmarshal([]byte(line), &change); err != nil {
+			t.Fatalf("Expected a JSON change, got %q: %v", line, err)
+		}
+		if change.Type != string(domain.ChangeUpdated) || change.UserID != watched.ID.String() || change.User == nil || change.User.Email != "watched@example.com" {
+			t.Errorf("Expected the update of the watched user, got %+v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change to be streamed")
+	}
+}
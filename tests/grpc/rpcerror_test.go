@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"backend-hexagonal/internal/adapters/grpc/rpcerror"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{service.ErrUserNotFound, codes.NotFound},
+		{service.ErrUserExists, codes.AlreadyExists},
+		{fmt.Errorf("%w: name is required", domain.ErrInvalidUser), codes.InvalidArgument},
+		{service.ErrInvalidToken, codes.Unauthenticated},
+		{domain.ErrAttributeNotWritable, codes.PermissionDenied},
+		{domain.Unavailable(context.DeadlineExceeded), codes.Unavailable},
+		{ports.ErrVersionConflict, codes.Aborted},
+		{service.ErrInvalidStatusTransition, codes.FailedPrecondition},
+		{errors.New("boom"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		if code := rpcerror.Code(tt.err); code != tt.code {
+			t.Errorf("Expected %s for %v, got %s", tt.code, tt.err, code)
+		}
+	}
+}
+
+func TestStatus_Details(t *testing.T) {
+	err := rpcerror.Status(fmt.Errorf("%w: %s", service.ErrUserExists, "jane@example.com"))
+
+	st := status.Convert(err)
+	if st.Code() != codes.AlreadyExists || st.Message() != "user already exists: jane@example.com" {
+		t.Errorf("Expected AlreadyExists with the error message, got %s %q", st.Code(), st.Message())
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("Expected one detail, got %d", len(details))
+	}
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	if !ok || info.Reason != "USER_EXISTS" || info.Domain != rpcerror.Domain {
+		t.Errorf("Expected an ErrorInfo naming USER_EXISTS, got %v", details[0])
+	}
+	if reason := rpcerror.Reason(err); reason != "user_exists" {
+		t.Errorf("Expected reason user_exists, got %q", reason)
+	}
+}
+
+func TestStatus_HidesCauses(t *testing.T) {
+	st := status.Convert(rpcerror.Status(domain.Unavailable(errors.New("dial tcp 10.0.0.5:5432: connection refused"))))
+	if st.Code() != codes.Unavailable || st.Message() != "service unavailable" {
+		t.Errorf("Expected Unavailable without the cause, got %s %q", st.Code(), st.Message())
+	}
+
+	st = status.Convert(rpcerror.Status(errors.New("secret internals")))
+	if st.Code() != codes.Internal || st.Message() != "internal error" {
+		t.Errorf("Expected Internal without the cause, got %s %q", st.Code(), st.Message())
+	}
+}
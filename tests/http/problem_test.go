@@ -0,0 +1,120 @@
+package http
+
+import (
+	"backend-hexagonal/internal/adapters/http/problem"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{service.ErrUserNotFound, fiber.StatusNotFound},
+		{service.ErrUserExists, fiber.StatusConflict},
+		{service.ErrInvalidQuery, fiber.StatusBadRequest},
+		{fmt.Errorf("%w: name is required", domain.ErrInvalidUser), fiber.StatusUnprocessableEntity},
+		{ports.ErrInvalidCredentials, fiber.StatusUnauthorized},
+		{service.ErrAccountInactive, fiber.StatusForbidden},
+		{domain.Unavailable(context.DeadlineExceeded), fiber.StatusServiceUnavailable},
+		{ports.ErrVersionConflict, fiber.StatusPreconditionFailed},
+		{service.ErrAvatarTooLarge, fiber.StatusRequestEntityTooLarge},
+		{errors.New("boom"), fiber.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if status := problem.Status(tt.err); status != tt.status {
+			t.Errorf("Expected %d for %v, got %d", tt.status, tt.err, status)
+		}
+	}
+}
+
+// respond serves one request with a handler that fails with err and
+// returns the response with its decoded problem
+func respond(t *testing.T, err error) (int, string, problem.Details) {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Get("/write", func(c *fiber.Ctx) error { return problem.Write(c, err) })
+	app.Get("/return", func(c *fiber.Ctx) error { return err })
+
+	var results []problem.Details
+	var status int
+	var contentType string
+	for _, path := range []string{"/write?x=1", "/return?x=1"} {
+		resp, testErr := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+		if testErr != nil {
+			t.Fatalf("Failed to send request: %v", testErr)
+		}
+		var details problem.Details
+		if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+			t.Fatalf("Failed to decode problem: %v", err)
+		}
+		details.Instance = ""
+		results = append(results, details)
+		status, contentType = resp.StatusCode, resp.Header.Get(fiber.HeaderContentType)
+	}
+	if results[0] != results[1] {
+		t.Errorf("Expected returned errors to be written like written ones, got %+v and %+v", results[1], results[0])
+	}
+	return status, contentType, results[0]
+}
+
+func TestWrite(t *testing.T) {
+	status, contentType, details := respond(t, fmt.Errorf("%w (suspended)", service.ErrAccountInactive))
+	if status != fiber.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", status)
+	}
+	if contentType != problem.ContentType {
+		t.Errorf("Expected content type %s, got %s", problem.ContentType, contentType)
+	}
+	want := problem.Details{
+		Type:   "about:blank",
+		Title:  "Forbidden",
+		Status: fiber.StatusForbidden,
+		Detail: "account is not active (suspended)",
+		Code:   "account_inactive",
+	}
+	if details != want {
+		t.Errorf("Expected %+v, got %+v", want, details)
+	}
+}
+
+func TestWrite_HidesCauses(t *testing.T) {
+	status, _, details := respond(t, domain.Unavailable(errors.New("dial tcp 10.0.0.5:27017: connection refused")))
+	if status != fiber.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", status)
+	}
+	if details.Detail != "" || details.Code != "unavailable" {
+		t.Errorf("Expected only the kind of an unavailable error, got %+v", details)
+	}
+
+	_, _, details = respond(t, errors.New("secret internals"))
+	if details.Detail != "" || details.Code != "internal" {
+		t.Errorf("Expected only the kind of an internal error, got %+v", details)
+	}
+}
+
+func TestErrorHandler_FiberErrors(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/missing", nil))
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	var details problem.Details
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound || details.Status != fiber.StatusNotFound || details.Instance != "/missing" {
+		t.Errorf("Expected a 404 problem for /missing, got %d %+v", resp.StatusCode, details)
+	}
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"backend-hexagonal/internal/adapters/blob"
+	httpadapter "backend-hexagonal/internal/adapters/http"
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// roleVerifier accepts any password, granting the admin role to logins
+// that start with "admin"
+type roleVerifier struct{}
+
+func (roleVerifier) VerifyCredentials(ctx context.Context, login, password string) (*domain.Identity, error) {
+	identity := &domain.Identity{Email: login, Name: "Route User"}
+	if strings.HasPrefix(login, "admin") {
+		identity.Roles = []string{domain.RoleAdmin}
+	}
+	return identity, nil
+}
+
+// api is the REST API over memory storage
+type api struct {
+	app   *fiber.App
+	users *service.UserService
+	auth  *service.AuthService
+}
+
+func newAPI(t *testing.T) *api {
+	t.Helper()
+	userRepo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	users := service.NewUserService(userRepo)
+	auth := service.NewAuthServiceWithVerifier(userRepo, roleVerifier{})
+	blobs, err := blob.NewFileSystemStore(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	preferences := service.NewPreferenceService(memory.NewPreferenceRepository(), nil)
+
+	app := fiber.New()
+	httpadapter.RegisterRoutes(app,
+		httpadapter.NewUserHandler(users),
+		httpadapter.NewAuthHandler(auth),
+		httpadapter.NewAdminHandler(users),
+		httpadapter.NewPrivacyHandler(service.NewPrivacyService(userRepo, memory.NewTombstoneRepository())),
+		httpadapter.NewSearchHandler(service.NewSearchService(search.NewIndex()), nil),
+		httpadapter.NewAvatarHandler(service.NewAvatarService(userRepo, blobs, 1<<20), nil),
+		httpadapter.NewBulkHandler(service.NewBulkService(userRepo)),
+		httpadapter.NewPreferenceHandler(preferences),
+		auth)
+	return &api{app: app, users: users, auth: auth}
+}
+
+// token logs in as login, returning a bearer token
+func (a *api) token(t *testing.T, login string) string {
+	t.Helper()
+	resp, err := a.auth.Login(context.Background(), &domain.AuthRequest{Email: login, Password: "secret"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return resp.Token
+}
+
+func (a *api) post(t *testing.T, path, token, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestRoutes_BatchDeleteIsAdminOnly(t *testing.T) {
+	a := newAPI(t)
+	ctx := context.Background()
+	target, err := a.users.CreateUser(ctx, "Target User", "target@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	body := `{"deletes": [{"id": "` + target.ID.String() + `"}]}`
+
+	if status := a.post(t, "/api/v1/users/batch/delete", a.token(t, "member@example.com"), body); status != fiber.StatusForbidden {
+		t.Errorf("Expected status 403 for a user, got %d", status)
+	}
+	if _, err := a.users.GetUserByID(ctx, target.ID); err != nil {
+		t.Fatalf("Expected the target to survive, got %v", err)
+	}
+
+	if status := a.post(t, "/api/v1/users/batch/delete", a.token(t, "admin@example.com"), body); status != fiber.StatusOK {
+		t.Fatalf("Expected status 200 for an admin, got %d", status)
+	}
+	if _, err := a.users.GetUserByID(ctx, target.ID); err == nil {
+		t.Error("Expected the admin's delete to apply")
+	}
+}
@@ -0,0 +1,142 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jimlambrt/gldap"
+	"github.com/jimlambrt/gldap/testdirectory"
+
+	ldapadapter "backend-hexagonal/internal/adapters/ldap"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+)
+
+// startDirectory runs an in-process directory where alice has a memberOf
+// attribute for the admins group and bob is a member of the developers
+// group. Every user's password is "password".
+func startDirectory(t *testing.T) *testdirectory.Directory {
+	users := testdirectory.NewUsers(t, []string{"alice"}, testdirectory.WithMembersOf(t, "admins"))
+	users = append(users, testdirectory.NewUsers(t, []string{"bob"})...)
+
+	return testdirectory.Start(t,
+		testdirectory.WithNoTLS(t),
+		testdirectory.WithDefaults(t, &testdirectory.Defaults{
+			Users:  users,
+			Groups: []*gldap.Entry{testdirectory.NewGroup(t, "developers", []string{"bob"})},
+		}),
+	)
+}
+
+func newVerifier(t *testing.T, config ldapadapter.Config) *ldapadapter.CredentialVerifier {
+	config.EmailAttribute = "email"
+	config.NameAttribute = "name"
+	config.GroupRoles = map[string]string{
+		"admins":     "admin",
+		"developers": "developer",
+	}
+
+	verifier, err := ldapadapter.NewCredentialVerifier(config)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	return verifier
+}
+
+func TestCredentialVerifier_BindAsUser(t *testing.T) {
+	dir := startDirectory(t)
+	verifier := newVerifier(t, ldapadapter.Config{
+		URL:            fmt.Sprintf("ldap://%s:%d", dir.Host(), dir.Port()),
+		UserDNTemplate: "cn={username}," + testdirectory.DefaultUserDN,
+	})
+
+	identity, err := verifier.VerifyCredentials(context.Background(), "alice", "password")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if identity.Email != "alice@example.com" {
+		t.Errorf("Expected email alice@example.com, got %s", identity.Email)
+	}
+	if identity.Name != "alice" {
+		t.Errorf("Expected name alice, got %s", identity.Name)
+	}
+	if len(identity.Roles) != 1 || identity.Roles[0] != "admin" {
+		t.Errorf("Expected roles [admin], got %v", identity.Roles)
+	}
+}
+
+func TestCredentialVerifier_SearchThenBind(t *testing.T) {
+	dir := startDirectory(t)
+	verifier := newVerifier(t, ldapadapter.Config{
+		URL:         fmt.Sprintf("ldap://%s:%d", dir.Host(), dir.Port()),
+		UserBaseDN:  testdirectory.DefaultUserDN,
+		UserFilter:  "(cn={username})",
+		GroupBaseDN: testdirectory.DefaultGroupDN,
+		GroupFilter: "(member={dn})",
+	})
+
+	identity, err := verifier.VerifyCredentials(context.Background(), "bob", "password")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if identity.Email != "bob@example.com" {
+		t.Errorf("Expected email bob@example.com, got %s", identity.Email)
+	}
+	if len(identity.Roles) != 1 || identity.Roles[0] != "developer" {
+		t.Errorf("Expected roles [developer], got %v", identity.Roles)
+	}
+}
+
+func TestCredentialVerifier_InvalidCredentials(t *testing.T) {
+	dir := startDirectory(t)
+	url := fmt.Sprintf("ldap://%s:%d", dir.Host(), dir.Port())
+
+	bindVerifier := newVerifier(t, ldapadapter.Config{
+		URL:            url,
+		UserDNTemplate: "cn={username}," + testdirectory.DefaultUserDN,
+	})
+	searchVerifier := newVerifier(t, ldapadapter.Config{
+		URL:        url,
+		UserBaseDN: testdirectory.DefaultUserDN,
+		UserFilter: "(cn={username})",
+	})
+
+	tests := []struct {
+		name     string
+		verifier *ldapadapter.CredentialVerifier
+		login    string
+		password string
+	}{
+		{"wrong password", bindVerifier, "alice", "wrong"},
+		{"empty password", bindVerifier, "alice", ""},
+		{"unknown user bind", bindVerifier, "mallory", "password"},
+		{"unknown user search", searchVerifier, "mallory", "password"},
+		{"wrong password search", searchVerifier, "bob", "wrong"},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.verifier.VerifyCredentials(context.Background(), tt.login, tt.password)
+		if !errors.Is(err, ports.ErrInvalidCredentials) {
+			t.Errorf("%s: expected ErrInvalidCredentials, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestCredentialVerifier_Unreachable(t *testing.T) {
+	verifier := newVerifier(t, ldapadapter.Config{
+		URL:            fmt.Sprintf("ldap://localhost:%d", testdirectory.FreePort(t)),
+		UserDNTemplate: "cn={username}," + testdirectory.DefaultUserDN,
+	})
+
+	_, err := verifier.VerifyCredentials(context.Background(), "alice", "password")
+	if err == nil || errors.Is(err, ports.ErrInvalidCredentials) {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+	if kind := domain.KindOf(err); kind != domain.KindUnavailable {
+		t.Errorf("Expected an unavailable error, got %s", kind)
+	}
+}
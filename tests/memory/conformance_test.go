@@ -0,0 +1,15 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/tests/conformance"
+	"testing"
+)
+
+func TestUserRepository_Conformance(t *testing.T) {
+	conformance.RunUserRepository(t, func(t *testing.T) ports.UserRepository {
+		return memory.NewUserRepository(ids.NewObjectIDGenerator())
+	})
+}
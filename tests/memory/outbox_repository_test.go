@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOutboxRepository(t *testing.T) {
+	outbox := memory.NewOutboxRepository()
+	ctx := context.Background()
+
+	user := newUser("Outbox User", "outbox@example.com")
+	first := domain.UserRegistered(user)
+	second := domain.UserUpdated(user)
+	if err := outbox.Append(ctx, first, second); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Stored events are copies
+	first.Type = domain.EventUserDeleted
+	events, _ := outbox.Unpublished(ctx, 10)
+	if len(events) != 2 || events[0].ID != first.ID || events[1].ID != second.ID {
+		t.Fatalf("Expected both events in order, got %v", events)
+	}
+	if events[0].Type != domain.EventUserRegistered {
+		t.Errorf("Expected the stored event to be unchanged, got %s", events[0].Type)
+	}
+
+	publishedAt := time.Now().Add(-time.Hour)
+	outbox.MarkPublished(ctx, []string{first.ID}, publishedAt)
+	if events, _ := outbox.Unpublished(ctx, 10); len(events) != 1 || events[0].ID != second.ID {
+		t.Fatalf("Expected only the second event left, got %v", events)
+	}
+
+	deleted, _ := outbox.DeletePublished(ctx, publishedAt)
+	if deleted != 0 {
+		t.Errorf("Expected nothing published before the cutoff, got %d", deleted)
+	}
+	deleted, _ = outbox.DeletePublished(ctx, time.Now())
+	if deleted != 1 {
+		t.Errorf("Expected 1 event deleted, got %d", deleted)
+	}
+	if events, _ := outbox.Unpublished(ctx, 10); len(events) != 1 {
+		t.Errorf("Expected the unpublished event to be kept, got %v", events)
+	}
+}
+
+func TestOutboxRepository_EraseUserData(t *testing.T) {
+	outbox := memory.NewOutboxRepository()
+	ctx := context.Background()
+
+	user := newUser("Erased User", "erased@example.com")
+	user.ID = newID()
+	other := newUser("Other User", "other@example.com")
+	other.ID = newID()
+	if err := outbox.Append(ctx, domain.UserRegistered(user), domain.UserUpdated(user), domain.UserRegistered(other)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records, err := outbox.ExportUserData(ctx, user.ID)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected the user's 2 events exported, got %d, %v", len(records), err)
+	}
+
+	if err := outbox.EraseUserData(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	events, _ := outbox.Unpublished(ctx, 10)
+	if len(events) != 3 {
+		t.Fatalf("Expected the events to still be delivered, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.UserID == user.ID && event.User != nil {
+			t.Errorf("Expected the erased user to be removed from %s, got %+v", event.Type, event.User)
+		}
+		if event.UserID == other.ID && (event.User == nil || event.User.Email != other.Email) {
+			t.Errorf("Expected other users' events to be kept, got %+v", event.User)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPreferenceRepository_Put(t *testing.T) {
+	repo := memory.NewPreferenceRepository()
+	ctx := context.Background()
+	userID := newID()
+
+	prefs := &domain.Preferences{UserID: userID, Namespace: "ui", Values: map[string]interface{}{"theme": "dark"}}
+	if err := repo.Put(ctx, prefs); err != nil || prefs.Version != 1 {
+		t.Fatalf("Expected version 1, got %d, %v", prefs.Version, err)
+	}
+
+	// A second insert lost the race
+	stale := &domain.Preferences{UserID: userID, Namespace: "ui", Values: map[string]interface{}{"theme": "light"}}
+	if err := repo.Put(ctx, stale); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	prefs.Values["theme"] = "changed"
+	stored, _ := repo.Get(ctx, userID, "ui")
+	if stored.Values["theme"] != "dark" {
+		t.Errorf("Expected the stored values to be unchanged, got %v", stored.Values)
+	}
+
+	// Storing nothing removes the record
+	stored.Values = nil
+	if err := repo.Put(ctx, stored); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored, _ := repo.Get(ctx, userID, "ui"); stored != nil {
+		t.Errorf("Expected no preferences, got %+v", stored)
+	}
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/memory"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransactor(t *testing.T) {
+	transactor := memory.NewTransactor()
+	ctx := context.Background()
+
+	// Nested transactions join the outer one instead of waiting for it
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		return transactor.WithinTransaction(ctx, func(ctx context.Context) error { return nil })
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Transactions run one at a time
+	var wg sync.WaitGroup
+	running, overlapped := 0, false
+	var mu sync.Mutex
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+				mu.Lock()
+				running++
+				overlapped = overlapped || running > 1
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if overlapped {
+		t.Error("Expected transactions not to overlap")
+	}
+}
@@ -0,0 +1,215 @@
+package memory
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newID returns a fresh user ID
+var newID = ids.NewObjectIDGenerator().NewUserID
+
+func newUser(name, email string) *domain.User {
+	return &domain.User{Name: name, Email: email, Status: domain.UserStatusActive, CreatedAt: time.Now()}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestUserRepository_NotFound(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	if _, err := repo.GetByID(ctx, newID()); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := repo.Restore(ctx, newID()); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if user, err := repo.GetByEmail(ctx, "nobody@example.com"); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v, %v", user, err)
+	}
+
+	user := newUser("John Doe", "john@example.com")
+	repo.Create(ctx, user)
+	repo.Delete(ctx, user.ID, 0)
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a deleted user, got %v", err)
+	}
+}
+
+func TestUserRepository_ReturnsCopies(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	user := newUser("John Doe", "john@example.com")
+	user.Attributes = map[string]interface{}{"team": "core"}
+	repo.Create(ctx, user)
+
+	user.Name = "Changed"
+	user.Attributes["team"] = "changed"
+	found, _ := repo.GetByID(ctx, user.ID)
+	found.Roles = append(found.Roles, "admin")
+
+	again, _ := repo.GetByID(ctx, user.ID)
+	if again.Name != "John Doe" || again.Attributes["team"] != "core" || len(again.Roles) != 0 {
+		t.Errorf("Expected the stored user to be unchanged, got %+v", again)
+	}
+}
+
+func TestUserRepository_UniqueEmails(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	john := newUser("John Doe", "john@example.com")
+	jane := newUser("Jane Doe", "jane@example.com")
+	repo.Create(ctx, john)
+	repo.Create(ctx, jane)
+
+	if err := repo.Create(ctx, newUser("Other", "john@example.com")); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+	if _, err := repo.Patch(ctx, jane.ID, domain.UserPatch{Email: strPtr("john@example.com")}); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+	if err := repo.Update(ctx, jane.ID, &domain.User{Name: "Jane", Email: "john@example.com"}); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+
+	// Deleted users keep their email until they are purged
+	repo.Delete(ctx, john.ID, 0)
+	if err := repo.Create(ctx, newUser("Other", "john@example.com")); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken for a deleted user's email, got %v", err)
+	}
+	repo.Purge(ctx, time.Now().Add(time.Minute))
+	if err := repo.Create(ctx, newUser("Other", "john@example.com")); err != nil {
+		t.Errorf("Expected a purged user's email to be free, got %v", err)
+	}
+
+	// A changed email frees the old one
+	repo.Patch(ctx, jane.ID, domain.UserPatch{Email: strPtr("janet@example.com")})
+	if exists, _ := repo.EmailExists(ctx, "jane@example.com"); exists {
+		t.Error("Expected the old email to be free")
+	}
+}
+
+func TestUserRepository_Versions(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	user := newUser("John Doe", "john@example.com")
+	repo.Create(ctx, user)
+	if user.Version != 1 {
+		t.Fatalf("Expected version 1, got %d", user.Version)
+	}
+
+	patched, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr("Johnny"), Version: 1})
+	if err != nil || patched.Version != 2 {
+		t.Fatalf("Expected version 2, got %v, %v", patched, err)
+	}
+	if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr("Stale"), Version: 1}); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID, 1); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	// Writes to users who don't exist find no user
+	if user, err := repo.Patch(ctx, newID(), domain.UserPatch{Name: strPtr("Nobody"), Version: 1}); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v, %v", user, err)
+	}
+	if err := repo.Delete(ctx, newID(), 3); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	changed, _ := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{
+		user.ID: {Name: strPtr("John"), Version: 2},
+		newID(): {Name: strPtr("Nobody")},
+	})
+	if len(changed) != 1 || changed[0] != user.ID {
+		t.Errorf("Expected only the existing user to change, got %v", changed)
+	}
+}
+
+func TestUserRepository_List(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	names := []string{"Carol", "alice", "Bob", "Dave", "Erin"}
+	for i, name := range names {
+		user := newUser(name, fmt.Sprintf("%s@example.com", name))
+		user.CreatedAt = time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		repo.Create(ctx, user)
+	}
+
+	for _, descending := range []bool{false, true} {
+		query := ports.UserQuery{Limit: 2, SortBy: ports.SortByCreatedAt, Descending: descending}
+		var seen []string
+		for {
+			page, err := repo.List(ctx, query)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if page.Total != 5 {
+				t.Errorf("Expected a total of 5, got %d", page.Total)
+			}
+			for _, user := range page.Users {
+				seen = append(seen, user.Name)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+
+		want := fmt.Sprint(names)
+		if descending {
+			want = "[Erin Dave Bob alice Carol]"
+		}
+		if fmt.Sprint(seen) != want {
+			t.Errorf("Expected %s, got %v", want, seen)
+		}
+	}
+
+	page, _ := repo.List(ctx, ports.UserQuery{Limit: 10, SortBy: ports.SortByName, NameContains: "A"})
+	if page.Total != 3 || page.Users[0].Name != "Carol" || page.Users[2].Name != "alice" {
+		t.Errorf("Expected Carol, Dave and alice by name, got %d users", page.Total)
+	}
+
+	if _, err := repo.List(ctx, ports.UserQuery{Limit: 2, SortBy: ports.SortByName, Cursor: "bogus"}); !errors.Is(err, ports.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestUserRepository_ConcurrentCreates(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := repo.Create(ctx, newUser("Racer", "racer@example.com")); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("Expected exactly one user to be created, got %d", created)
+	}
+}
@@ -0,0 +1,273 @@
+package migrations
+
+import (
+	"backend-hexagonal/internal/migrations"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Mock store keeping the records and the lock in memory
+type mockStore struct {
+	records   map[int]migrations.Record
+	lockOwner string
+	lockUntil time.Time
+	unlocks   int
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{records: make(map[int]migrations.Record)}
+}
+
+func (m *mockStore) Applied(ctx context.Context) ([]migrations.Record, error) {
+	var records []migrations.Record
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
+}
+
+func (m *mockStore) Record(ctx context.Context, record migrations.Record) error {
+	m.records[record.Version] = record
+	return nil
+}
+
+func (m *mockStore) Remove(ctx context.Context, version int) error {
+	delete(m.records, version)
+	return nil
+}
+
+func (m *mockStore) Lock(ctx context.Context, owner string, ttl time.Duration) error {
+	if m.lockOwner != "" && m.lockOwner != owner && time.Now().Before(m.lockUntil) {
+		return migrations.ErrLocked
+	}
+	m.lockOwner, m.lockUntil = owner, time.Now().Add(ttl)
+	return nil
+}
+
+func (m *mockStore) Unlock(ctx context.Context, owner string) error {
+	if m.lockOwner == owner {
+		m.lockOwner = ""
+		m.unlocks++
+	}
+	return nil
+}
+
+// journal lists the steps the migrations ran, e.g. "up 1" and "down 2"
+type journal []string
+
+func (j *journal) migration(version int, name string, failUp bool) migrations.Migration {
+	step := func(direction string, fail bool) func(context.Context) error {
+		return func(ctx context.Context) error {
+			if fail {
+				return errors.New("step failed")
+			}
+			*j = append(*j, direction+" "+name)
+			return nil
+		}
+	}
+	return migrations.Migration{
+		Version: version,
+		Name:    name,
+		Up:      step("up", failUp),
+		Down:    step("down", false),
+	}
+}
+
+func assertJournal(t *testing.T, got journal, expected ...string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected steps %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected steps %v, got %v", expected, got)
+		}
+	}
+}
+
+func assertApplied(t *testing.T, store *mockStore, expected ...int) {
+	t.Helper()
+	records, _ := store.Applied(context.Background())
+	if len(records) != len(expected) {
+		t.Fatalf("Expected versions %v applied, got %v", expected, records)
+	}
+	for i, version := range expected {
+		if records[i].Version != version {
+			t.Fatalf("Expected versions %v applied, got %v", expected, records)
+		}
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	var steps journal
+	// Listed out of order on purpose
+	migrator := migrations.New(store, []migrations.Migration{
+		steps.migration(2, "second", false),
+		steps.migration(1, "first", false),
+		steps.migration(3, "third", false),
+	})
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(applied) != 3 {
+		t.Errorf("Expected 3 migrations applied, got %d", len(applied))
+	}
+	assertJournal(t, steps, "up first", "up second", "up third")
+	assertApplied(t, store, 1, 2, 3)
+	if store.lockOwner != "" || store.unlocks != 1 {
+		t.Errorf("Expected the lock to be released once, got owner %q after %d unlocks", store.lockOwner, store.unlocks)
+	}
+
+	// Nothing is left to apply
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected nothing applied, got %d (%v)", len(applied), err)
+	}
+}
+
+func TestMigrator_Up_StopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	var steps journal
+	migrator := migrations.New(store, []migrations.Migration{
+		steps.migration(1, "first", false),
+		steps.migration(2, "broken", true),
+		steps.migration(3, "third", false),
+	})
+
+	applied, err := migrator.Up(ctx)
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+	if len(applied) != 1 {
+		t.Errorf("Expected 1 migration applied, got %d", len(applied))
+	}
+	assertApplied(t, store, 1)
+	if store.lockOwner != "" {
+		t.Errorf("Expected the lock to be released, got owner %q", store.lockOwner)
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(pending) != 2 || pending[0].Version != 2 {
+		t.Errorf("Expected versions 2 and 3 pending, got %v", pending)
+	}
+}
+
+func TestMigrator_DownAndTo(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	var steps journal
+	migrator := migrations.New(store, []migrations.Migration{
+		steps.migration(1, "first", false),
+		steps.migration(2, "second", false),
+		steps.migration(3, "third", false),
+	})
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	steps = nil
+
+	reverted, err := migrator.Down(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reverted == nil || reverted.Version != 3 {
+		t.Errorf("Expected version 3 reverted, got %v", reverted)
+	}
+	assertApplied(t, store, 1, 2)
+
+	if _, err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertApplied(t, store)
+
+	if _, err := migrator.To(ctx, 2); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertApplied(t, store, 1, 2)
+	assertJournal(t, steps, "down third", "down second", "down first", "up first", "up second")
+
+	if _, err := migrator.To(ctx, 7); !errors.Is(err, migrations.ErrUnknownVersion) {
+		t.Errorf("Expected ErrUnknownVersion, got %v", err)
+	}
+
+	reverted, err = migrations.New(newMockStore(), nil).Down(ctx)
+	if err != nil || reverted != nil {
+		t.Errorf("Expected nothing reverted, got %v (%v)", reverted, err)
+	}
+}
+
+func TestMigrator_NewerRelease(t *testing.T) {
+	ctx := context.Background()
+	store := newMockStore()
+	store.records[4] = migrations.Record{Version: 4, Name: "from_the_future", AppliedAt: time.Now()}
+	var steps journal
+	migrator := migrations.New(store, []migrations.Migration{steps.migration(1, "first", false)})
+
+	// Up leaves migrations it doesn't know alone
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertApplied(t, store, 1, 4)
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(statuses) != 2 || statuses[1].Version != 4 || !statuses[1].Applied || statuses[1].Up != nil {
+		t.Errorf("Expected version 4 listed as applied and unknown, got %+v", statuses)
+	}
+
+	// It can't be reverted without its Down
+	if _, err := migrator.Down(ctx); !errors.Is(err, migrations.ErrUnknownVersion) {
+		t.Errorf("Expected ErrUnknownVersion, got %v", err)
+	}
+}
+
+func TestMigrator_WaitsForLock(t *testing.T) {
+	store := newMockStore()
+	store.lockOwner, store.lockUntil = "another-instance", time.Now().Add(time.Hour)
+	var steps journal
+	migrator := migrations.New(store, []migrations.Migration{steps.migration(1, "first", false)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := migrator.Up(ctx); !errors.Is(err, migrations.ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	assertJournal(t, steps)
+	if store.lockOwner != "another-instance" {
+		t.Errorf("Expected the lock to stay with its owner, got %q", store.lockOwner)
+	}
+
+	// An expired lock is taken over
+	store.lockUntil = time.Now().Add(-time.Second)
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertApplied(t, store, 1)
+}
+
+func TestNew_RejectsDuplicateVersions(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic, got none")
+		}
+	}()
+	var steps journal
+	migrations.New(newMockStore(), []migrations.Migration{
+		steps.migration(1, "first", false),
+		steps.migration(1, "again", false),
+	})
+}
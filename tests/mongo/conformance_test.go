@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/config"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/tests/conformance"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// connect connects to the mongod at MONGO_URI, skipping the test if there
+// is none
+func connect(t *testing.T) *mongo.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(config.MongoURI()).
+		SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skipf("Skipping, cannot connect to %s: %v", config.MongoURI(), err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		t.Skipf("Skipping, no mongod at %s: %v", config.MongoURI(), err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client
+}
+
+func TestUserRepository_Conformance(t *testing.T) {
+	client := connect(t)
+	conformance.RunUserRepository(t, func(t *testing.T) ports.UserRepository {
+		// Every test gets a database of its own, dropped when it ends
+		db := client.Database("conformance_" + ids.NewID())
+		t.Cleanup(func() { db.Drop(context.Background()) })
+
+		repo := mongoadapter.NewUserRepository(db)
+		if err := repo.EnsureEmailIndex(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return repo
+	})
+}
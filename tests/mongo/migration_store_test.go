@@ -0,0 +1,66 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/migrations"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigrationStore_Lock(t *testing.T) {
+	client := connect(t)
+	ctx := context.Background()
+	db := client.Database("migrations_" + ids.NewID())
+	t.Cleanup(func() { db.Drop(context.Background()) })
+	store := mongoadapter.NewMigrationStore(db)
+
+	if err := store.Lock(ctx, "a", time.Minute); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Lock(ctx, "a", time.Minute); err != nil {
+		t.Errorf("Expected the owner to extend the lock, got %v", err)
+	}
+	if err := store.Lock(ctx, "b", time.Minute); !errors.Is(err, migrations.ErrLocked) {
+		t.Errorf("Expected ErrLocked, got %v", err)
+	}
+	if err := store.Unlock(ctx, "a"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Lock(ctx, "b", -time.Second); err != nil {
+		t.Errorf("Expected the released lock to be free, got %v", err)
+	}
+	if err := store.Lock(ctx, "c", time.Minute); err != nil {
+		t.Errorf("Expected an expired lock to be taken over, got %v", err)
+	}
+}
+
+func TestMigrations_UpAndDown(t *testing.T) {
+	client := connect(t)
+	ctx := context.Background()
+	db := client.Database("migrations_" + ids.NewID())
+	t.Cleanup(func() { db.Drop(context.Background()) })
+	migrator := migrations.New(mongoadapter.NewMigrationStore(db), mongoadapter.Migrations(db))
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %d (%v)", len(pending), err)
+	}
+	if _, err := migrator.To(ctx, 0); err != nil {
+		t.Fatalf("Expected every migration to revert, got %v", err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			t.Errorf("Expected migration %d to be reverted", s.Version)
+		}
+	}
+}
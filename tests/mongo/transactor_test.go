@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransactor(t *testing.T) {
+	client := connect(t)
+	ctx := context.Background()
+	db := client.Database("transactor_" + ids.NewID())
+	t.Cleanup(func() { db.Drop(context.Background()) })
+
+	// Collections can't be created inside transactions before MongoDB 4.4
+	users := mongoadapter.NewUserRepository(db)
+	if err := users.EnsureEmailIndex(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	transactor, err := mongoadapter.NewTransactor(ctx, client, false)
+	if errors.Is(err, mongoadapter.ErrNoTransactions) {
+		t.Skip("Skipping, mongod is standalone")
+	}
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	user := &domain.User{Name: "Tx User", Email: "tx@example.com", Status: domain.UserStatusActive, CreatedAt: time.Now()}
+	err = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := users.Create(ctx, user); err != nil {
+			return err
+		}
+		// Nested transactions join the outer one
+		return transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			exists, err := users.EmailExists(ctx, "tx@example.com")
+			if !exists {
+				t.Error("Expected the user to be visible in the transaction")
+			}
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if exists, _ := users.EmailExists(ctx, "tx@example.com"); !exists {
+		t.Error("Expected the user to be committed")
+	}
+}
+
+func TestNewTransactor_Standalone(t *testing.T) {
+	client := connect(t)
+	ctx := context.Background()
+
+	_, err := mongoadapter.NewTransactor(ctx, client, false)
+	if err == nil {
+		t.Skip("Skipping, mongod runs transactions")
+	}
+	if !errors.Is(err, mongoadapter.ErrNoTransactions) {
+		t.Fatalf("Expected ErrNoTransactions, got %v", err)
+	}
+
+	transactor, err := mongoadapter.NewTransactor(ctx, client, true)
+	if err != nil {
+		t.Fatalf("Expected no error when allowed, got %v", err)
+	}
+	called := false
+	err = transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if err != nil || !called {
+		t.Errorf("Expected fn to run without a transaction, got called=%v err=%v", called, err)
+	}
+}
@@ -0,0 +1,120 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// requireReplicaSet skips the test unless client is connected to a replica
+// set or a sharded cluster, which change streams need
+func requireReplicaSet(t *testing.T, client *mongo.Client) {
+	t.Helper()
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		t.Skip("Skipping, change streams need a replica set")
+	}
+}
+
+// watch runs stream until it has handled n changes, and returns them
+func watch(t *testing.T, stream *mongoadapter.UserChangeStream, n int) []domain.UserChange {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var changes []domain.UserChange
+	err := stream.Watch(ctx, func(change domain.UserChange) error {
+		changes = append(changes, change)
+		if len(changes) == n {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(changes) != n {
+		t.Fatalf("Expected %d changes, got %d", n, len(changes))
+	}
+	return changes
+}
+
+func TestUserChangeStream(t *testing.T) {
+	client := connect(t)
+	requireReplicaSet(t, client)
+	ctx := context.Background()
+	db := client.Database("change_stream_" + ids.NewID())
+	t.Cleanup(func() { db.Drop(context.Background()) })
+
+	users := mongoadapter.NewUserRepository(db)
+	if err := users.EnsureEmailIndex(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stream := mongoadapter.NewUserChangeStream(db, "test")
+
+	// A first watch without changes saves where the stream starts
+	startCtx, cancel := context.WithTimeout(ctx, 1500*time.Millisecond)
+	defer cancel()
+	if err := stream.Watch(startCtx, func(domain.UserChange) error { return nil }); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// So the changes made while nothing watches are not missed. Updates
+	// carry the user as they are when read, so each is read before the next.
+	user := &domain.User{Name: "Streamed User", Email: "streamed@example.com", Status: domain.UserStatusActive, CreatedAt: time.Now()}
+	if err := users.Create(ctx, user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	name := "Renamed User"
+	if _, err := users.Patch(ctx, user.ID, domain.UserPatch{Name: &name}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes := watch(t, stream, 2)
+	if changes[0].Type != domain.ChangeCreated || changes[0].UserID != user.ID || changes[0].User == nil {
+		t.Errorf("Expected the creation of %s, got %+v", user.ID.String(), changes[0])
+	}
+	if changes[1].Type != domain.ChangeUpdated || changes[1].User == nil || changes[1].User.Name != name {
+		t.Errorf("Expected the renamed user, got %+v", changes[1])
+	}
+
+	// Soft deletes are reported as deletes, with the user
+	if err := users.Delete(ctx, user.ID, 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes = watch(t, stream, 1)
+	if changes[0].Type != domain.ChangeDeleted || changes[0].User == nil || !changes[0].User.IsDeleted() {
+		t.Errorf("Expected the soft deleted user, got %+v", changes[0])
+	}
+
+	// Erases without
+	if _, err := users.Erase(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes = watch(t, stream, 1)
+	if changes[0].Type != domain.ChangeDeleted || changes[0].UserID != user.ID || changes[0].User != nil {
+		t.Errorf("Expected the erase of %s without the user, got %+v", user.ID.String(), changes[0])
+	}
+
+	// A restarted watch carries on after the changes already handled
+	other := &domain.User{Name: "Later User", Email: "later@example.com", Status: domain.UserStatusActive, CreatedAt: time.Now()}
+	if err := users.Create(ctx, other); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	changes = watch(t, stream, 1)
+	if changes[0].Type != domain.ChangeCreated || changes[0].UserID != other.ID {
+		t.Errorf("Expected the creation of %s, got %s of %s", other.ID.String(), changes[0].Type, changes[0].UserID.String())
+	}
+}
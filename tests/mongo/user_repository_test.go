@@ -0,0 +1,59 @@
+package mongo
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	mongoadapter "backend-hexagonal/internal/adapters/mongo"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestUserRepository_PatchManyWriteErrors(t *testing.T) {
+	client := connect(t)
+	ctx := context.Background()
+	db := client.Database("patch_many_" + ids.NewID())
+	t.Cleanup(func() { db.Drop(context.Background()) })
+
+	// A validator rejects one name, as a failing write other than a
+	// duplicate key would
+	validator := bson.M{"name": bson.M{"$ne": "Rejected"}}
+	if err := db.CreateCollection(ctx, "users", options.CreateCollection().SetValidator(validator)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	repo := mongoadapter.NewUserRepository(db)
+	if err := repo.EnsureEmailIndex(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var users []*domain.User
+	for _, email := range []string{"one@example.com", "two@example.com", "taken@example.com"} {
+		user := &domain.User{Name: "Patched User", Email: email, Status: domain.UserStatusActive, CreatedAt: time.Now()}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		users = append(users, user)
+	}
+
+	// A duplicate email only skips its patch
+	renamed, taken := "Renamed", "taken@example.com"
+	changed, err := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{
+		users[0].ID: {Name: &renamed},
+		users[1].ID: {Email: &taken},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error for a duplicate email, got %v", err)
+	}
+	if len(changed) != 1 || changed[0] != users[0].ID {
+		t.Errorf("Expected only the rename to apply, got %v", changed)
+	}
+
+	// Any other failed write fails the bulk write
+	rejected := "Rejected"
+	if _, err := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{users[1].ID: {Name: &rejected}}); err == nil {
+		t.Error("Expected the rejected write to fail the bulk write")
+	}
+}
@@ -0,0 +1,222 @@
+package scim
+
+import (
+	httpadapter "backend-hexagonal/internal/adapters/http"
+	"backend-hexagonal/internal/adapters/http/scim"
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const token = "provisioning-token"
+
+func newApp(t *testing.T) (*fiber.App, *service.UserService) {
+	t.Helper()
+	return newAppWithRepository(t, memory.NewUserRepository(ids.NewObjectIDGenerator()))
+}
+
+func newAppWithRepository(t *testing.T, repo ports.UserRepository) (*fiber.App, *service.UserService) {
+	t.Helper()
+	userSvc := service.NewUserService(repo)
+	app := fiber.New()
+	httpadapter.RegisterSCIMRoutes(app, scim.NewHandler(userSvc), token)
+	return app, userSvc
+}
+
+func provision(t *testing.T, userSvc *service.UserService, name, email string) *domain.User {
+	t.Helper()
+	user, err := userSvc.ProvisionUser(context.Background(), name, email, "", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return user
+}
+
+// send serves a SCIM request and decodes the response body into out
+func send(t *testing.T, app *fiber.App, method, path, body string, out interface{}) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(fiber.HeaderContentType, scim.ContentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderETag)
+}
+
+func TestHandler_ListUsers(t *testing.T) {
+	app, userSvc := newApp(t)
+	// More users than a page of the repository
+	for i := 0; i < 150; i++ {
+		provision(t, userSvc, fmt.Sprintf("Member %03d", i), fmt.Sprintf("member%03d@example.com", i))
+	}
+	provision(t, userSvc, "Somchai Jaidee", "somchai@example.com")
+
+	tests := []struct {
+		filter     string
+		startIndex int
+		count      int
+		total      int
+		items      int
+	}{
+		{"", 1, 200, 151, 151},
+		{"", 101, 20, 151, 20},
+		{"", 151, 20, 151, 1},
+		{`userName sw "member1"`, 1, 200, 50, 50},
+		{`userName sw "member1"`, 41, 20, 50, 10},
+		{`userName eq "SOMCHAI@example.com"`, 1, 10, 1, 1},
+		{`displayName co "member" and userName sw "member14"`, 1, 5, 10, 5},
+		{`displayName ew "9"`, 1, 200, 15, 15},
+		{`displayName ew "9"`, 11, 200, 15, 5},
+		{`userName eq "nobody@example.com"`, 1, 10, 0, 0},
+	}
+
+	for _, tt := range tests {
+		query := url.Values{}
+		if tt.filter != "" {
+			query.Set("filter", tt.filter)
+		}
+		query.Set("startIndex", strconv.Itoa(tt.startIndex))
+		query.Set("count", strconv.Itoa(tt.count))
+
+		var list struct {
+			TotalResults int         `json:"totalResults"`
+			ItemsPerPage int         `json:"itemsPerPage"`
+			Resources    []scim.User `json:"Resources"`
+		}
+		status, _ := send(t, app, fiber.MethodGet, "/scim/v2/Users?"+query.Encode(), "", &list)
+		if status != fiber.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d", tt.filter, status)
+		}
+		if list.TotalResults != tt.total || len(list.Resources) != tt.items || list.ItemsPerPage != tt.items {
+			t.Errorf("%q from %d: expected %d of %d results, got %d of %d", tt.filter, tt.startIndex, tt.items, tt.total, len(list.Resources), list.TotalResults)
+		}
+	}
+}
+
+func TestHandler_ReplaceUser(t *testing.T) {
+	app, userSvc := newApp(t)
+	user := provision(t, userSvc, "Old Name", "old@example.com")
+	provision(t, userSvc, "Other User", "taken@example.com")
+	path := "/scim/v2/Users/" + user.ID.String()
+
+	// The ETag is the user's version, like the REST API's
+	var resource scim.User
+	_, tag := send(t, app, fiber.MethodGet, path, "", &resource)
+	if want := `"` + strconv.FormatInt(user.Version, 10) + `"`; tag != want || resource.Meta.Version != want {
+		t.Errorf("Expected ETag %s, got %s and version %s", want, tag, resource.Meta.Version)
+	}
+
+	// A taken email fails the whole replacement, including the status
+	body := `{"schemas":["` + scim.UserSchema + `"],"userName":"taken@example.com","displayName":"New Name","emails":[{"value":"taken@example.com","primary":true}],"active":false}`
+	if status, _ := send(t, app, fiber.MethodPut, path, body, nil); status != fiber.StatusConflict {
+		t.Fatalf("Expected status 409, got %d", status)
+	}
+	if current, _ := userSvc.GetUserByID(context.Background(), user.ID); !current.IsActive() {
+		t.Errorf("Expected the user to stay active, got %s", current.CurrentStatus())
+	}
+
+	body = strings.ReplaceAll(body, "taken@", "new@")
+	status, newTag := send(t, app, fiber.MethodPut, path, body, &resource)
+	if status != fiber.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if resource.UserName != "new@example.com" || resource.DisplayName != "New Name" || *resource.Active {
+		t.Errorf("Expected the replaced and suspended user, got %+v", resource)
+	}
+	current, _ := userSvc.GetUserByID(context.Background(), user.ID)
+	if want := `"` + strconv.FormatInt(current.Version, 10) + `"`; newTag != want || newTag == tag {
+		t.Errorf("Expected the new ETag %s, got %s", want, newTag)
+	}
+}
+
+func TestHandler_CreateUser_Inactive(t *testing.T) {
+	app, userSvc := newApp(t)
+
+	body := `{"schemas":["` + scim.UserSchema + `"],"userName":"later@example.com","displayName":"Later User","emails":[{"value":"later@example.com","primary":true}],"active":false}`
+	var resource scim.User
+	status, _ := send(t, app, fiber.MethodPost, "/scim/v2/Users", body, &resource)
+	if status != fiber.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+	if resource.Active == nil || *resource.Active {
+		t.Errorf("Expected an inactive user, got %+v", resource)
+	}
+
+	// The account is created suspended in one write
+	id, _ := domain.ParseUserID(resource.ID)
+	user, err := userSvc.GetUserByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Status != domain.UserStatusSuspended || user.Version != 1 {
+		t.Errorf("Expected a suspended user at version 1, got %s at version %d", user.Status, user.Version)
+	}
+
+	// Names are validated like other writes
+	body = `{"schemas":["` + scim.UserSchema + `"],"userName":"blank@example.com","displayName":"   ","emails":[{"value":"blank@example.com","primary":true}]}`
+	if status, _ := send(t, app, fiber.MethodPost, "/scim/v2/Users", body, nil); status != fiber.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a blank name, got %d", status)
+	}
+}
+
+// racingRepository renames a user right after the first read of them, as
+// a concurrent request would between the If-Match check and the write
+type racingRepository struct {
+	ports.UserRepository
+	raced bool
+}
+
+func (r *racingRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err == nil && !r.raced {
+		r.raced = true
+		name := "Concurrent Name"
+		r.UserRepository.Patch(ctx, id, domain.UserPatch{Name: &name})
+	}
+	return user, err
+}
+
+func TestHandler_ConcurrentWrites(t *testing.T) {
+	repo := &racingRepository{UserRepository: memory.NewUserRepository(ids.NewObjectIDGenerator())}
+	app, userSvc := newAppWithRepository(t, repo)
+	ctx := context.Background()
+
+	// The replacement was checked against the user before the concurrent
+	// rename, so it must not overwrite it
+	user := provision(t, userSvc, "Old Name", "old@example.com")
+	repo.raced = false
+	body := `{"schemas":["` + scim.UserSchema + `"],"userName":"old@example.com","displayName":"New Name","emails":[{"value":"old@example.com","primary":true}]}`
+	if status, _ := send(t, app, fiber.MethodPut, "/scim/v2/Users/"+user.ID.String(), body, nil); status != fiber.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a replacement that lost a race, got %d", status)
+	}
+	if current, _ := userSvc.GetUserByID(ctx, user.ID); current.Name != "Concurrent Name" {
+		t.Errorf("Expected the concurrent name to stay, got %s", current.Name)
+	}
+
+	repo.raced = false
+	if status, _ := send(t, app, fiber.MethodDelete, "/scim/v2/Users/"+user.ID.String(), "", nil); status != fiber.StatusPreconditionFailed {
+		t.Errorf("Expected status 412 for a delete that lost a race, got %d", status)
+	}
+	if _, err := userSvc.GetUserByID(ctx, user.ID); err != nil {
+		t.Errorf("Expected the user to survive, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package scim
+
+import (
+	"backend-hexagonal/internal/adapters/http/scim"
+	"testing"
+)
+
+func testResource() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":     []interface{}{scim.UserSchema},
+		"id":          "650000000000000000000001",
+		"userName":    "Somchai@Example.com",
+		"displayName": "Somchai Jaidee",
+		"name":        map[string]interface{}{"formatted": "Somchai Jaidee"},
+		"emails": []interface{}{
+			map[string]interface{}{"value": "Somchai@Example.com", "type": "work", "primary": true},
+		},
+		"active": true,
+		"meta": map[string]interface{}{
+			"resourceType": "User",
+			"created":      "2024-03-01T10:00:00Z",
+		},
+	}
+}
+
+func TestParseFilter_Match(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "somchai@example.com"`, true},
+		{`userName eq "other@example.com"`, false},
+		{`userName ne "other@example.com"`, true},
+		{`emails co "example.com"`, true},
+		{`emails.value sw "somchai"`, true},
+		{`displayName ew "Jaidee"`, true},
+		{`name.formatted co "chai"`, true},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		{`emails[type eq "home"]`, false},
+		{`externalId pr`, false},
+		{`displayName pr`, true},
+		{`active eq true`, true},
+		{`meta.created gt "2024-01-01T00:00:00Z"`, true},
+		{`meta.created lt "2024-01-01T00:00:00+07:00"`, false},
+		{`not (userName eq "somchai@example.com")`, false},
+		{`userName eq "x" or (displayName co "somchai" and active eq true)`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "somchai@example.com"`, true},
+		{`id eq "650000000000000000000001"`, true},
+	}
+
+	for _, tt := range tests {
+		f, err := scim.ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) returned error: %v", tt.filter, err)
+			continue
+		}
+		if got := f.Match(testResource()); got != tt.want {
+			t.Errorf("ParseFilter(%q).Match() = %v, expected %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	filters := []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName foo "x"`,
+		`userName eq "unterminated`,
+		`(userName eq "x"`,
+		`emails[type eq "work"`,
+		`userName eq "x" and`,
+		`not userName eq "x"`,
+	}
+
+	for _, filter := range filters {
+		if _, err := scim.ParseFilter(filter); err == nil {
+			t.Errorf("Expected ParseFilter(%q) to fail", filter)
+		}
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	resource := testResource()
+
+	err := scim.ApplyPatch(resource, []scim.PatchOperation{
+		{Op: "Replace", Path: "displayName", Value: "Somchai J."},
+		{Op: "add", Path: "name.givenName", Value: "Somchai"},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "somchai@gmail.com"},
+		{Op: "add", Value: map[string]interface{}{"externalId": "hr-42"}},
+		{Op: "remove", Path: "name.formatted"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if resource["displayName"] != "Somchai J." {
+		t.Errorf("Expected displayName to be replaced, got %v", resource["displayName"])
+	}
+	if resource["externalId"] != "hr-42" {
+		t.Errorf("Expected externalId to be added, got %v", resource["externalId"])
+	}
+
+	name := resource["name"].(map[string]interface{})
+	if name["givenName"] != "Somchai" {
+		t.Errorf("Expected givenName Somchai, got %v", name["givenName"])
+	}
+	if _, exists := name["formatted"]; exists {
+		t.Error("Expected name.formatted to be removed")
+	}
+
+	email := resource["emails"].([]interface{})[0].(map[string]interface{})
+	if email["value"] != "somchai@gmail.com" {
+		t.Errorf("Expected work email to be replaced, got %v", email["value"])
+	}
+}
+
+func TestApplyPatch_Errors(t *testing.T) {
+	tests := []struct {
+		op       scim.PatchOperation
+		scimType string
+	}{
+		{scim.PatchOperation{Op: "move", Path: "userName"}, "invalidSyntax"},
+		{scim.PatchOperation{Op: "remove"}, "noTarget"},
+		{scim.PatchOperation{Op: "replace", Value: "not an object"}, "invalidValue"},
+		{scim.PatchOperation{Op: "replace", Path: "emails[type eq", Value: "x"}, "invalidPath"},
+		{scim.PatchOperation{Op: "remove", Path: `emails[type eq "home"]`}, "noTarget"},
+	}
+
+	for _, tt := range tests {
+		err := scim.ApplyPatch(testResource(), []scim.PatchOperation{tt.op})
+		patchErr, ok := err.(*scim.PatchError)
+		if !ok {
+			t.Errorf("Expected PatchError for %+v, got %v", tt.op, err)
+			continue
+		}
+		if patchErr.ScimType != tt.scimType {
+			t.Errorf("Expected scimType %s for %+v, got %s", tt.scimType, tt.op, patchErr.ScimType)
+		}
+	}
+}
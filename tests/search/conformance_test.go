@@ -0,0 +1,19 @@
+package search
+
+import (
+	"testing"
+
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/tests/conformance"
+)
+
+// Keeping the index up to date must not change what the wrapped repository
+// does
+func TestIndexedRepository_Conformance(t *testing.T) {
+	conformance.RunUserRepository(t, func(t *testing.T) ports.UserRepository {
+		return search.NewIndexedRepository(memory.NewUserRepository(ids.NewObjectIDGenerator()), search.NewIndex())
+	})
+}
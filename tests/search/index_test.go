@@ -0,0 +1,139 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/domain"
+)
+
+// newID returns a fresh user ID
+var newID = ids.NewObjectIDGenerator().NewUserID
+
+func newUser(name, email string) *domain.User {
+	return &domain.User{
+		ID:        newID(),
+		Name:      name,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+}
+
+func newIndex(users ...*domain.User) *search.Index {
+	index := search.NewIndex()
+	index.Rebuild(users)
+	return index
+}
+
+func TestIndex_Search_Ranking(t *testing.T) {
+	gmail := newUser("Somchai Jaidee", "somchai.j@gmail.com")
+	work := newUser("Somchai Rakthai", "somchai@corp.example")
+	other := newUser("Jane Doe", "jane@gmail.com")
+	index := newIndex(gmail, work, other)
+
+	results, err := index.Search(context.Background(), "somchai gmail", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	// Matching both words ranks above matching one
+	if results[0].User.ID != gmail.ID {
+		t.Errorf("Expected %s first, got %s", gmail.Email, results[0].User.Email)
+	}
+
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("Expected results ordered by score, got %v before %v", results[i-1].Score, results[i].Score)
+		}
+	}
+}
+
+func TestIndex_Search_Typos(t *testing.T) {
+	somchai := newUser("Somchai Jaidee", "somchai.j@gmail.com")
+	index := newIndex(somchai, newUser("Jane Doe", "jane@example.com"))
+
+	queries := []string{"smochai", "somchia", "somcha", "SOMCHAI", "jaide", "gmial"}
+	for _, q := range queries {
+		results, err := index.Search(context.Background(), q, 10)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", q, err)
+		}
+		if len(results) != 1 || results[0].User.ID != somchai.ID {
+			t.Errorf("%s: expected only %s, got %d results", q, somchai.Name, len(results))
+		}
+	}
+
+	// Short words must match exactly
+	results, _ := index.Search(context.Background(), "jo", 10)
+	if len(results) != 0 {
+		t.Errorf("Expected no results for jo, got %d", len(results))
+	}
+}
+
+func TestIndex_AddAndRemove(t *testing.T) {
+	user := newUser("Old Name", "person@example.com")
+	index := newIndex(user)
+
+	// Renaming replaces the indexed words
+	renamed := *user
+	renamed.Name = "New Name"
+	index.Add(&renamed)
+
+	results, _ := index.Search(context.Background(), "old", 10)
+	if len(results) != 0 {
+		t.Errorf("Expected the old name to be forgotten, got %d results", len(results))
+	}
+
+	results, _ = index.Search(context.Background(), "new", 10)
+	if len(results) != 1 {
+		t.Errorf("Expected the new name to be found, got %d results", len(results))
+	}
+
+	// Deleted users are never returned
+	deletedAt := time.Now()
+	renamed.DeletedAt = &deletedAt
+	index.Add(&renamed)
+
+	results, _ = index.Search(context.Background(), "new", 10)
+	if len(results) != 0 {
+		t.Errorf("Expected deleted user to be removed, got %d results", len(results))
+	}
+}
+
+func TestIndex_Apply(t *testing.T) {
+	index := newIndex()
+	user := newUser("Changed Elsewhere", "elsewhere@example.com")
+
+	index.Apply(domain.UserChange{Type: domain.ChangeCreated, UserID: user.ID, User: user})
+	results, _ := index.Search(context.Background(), "elsewhere", 10)
+	if len(results) != 1 {
+		t.Fatalf("Expected the created user to be found, got %d results", len(results))
+	}
+
+	// Changes without the user remove them
+	index.Apply(domain.UserChange{Type: domain.ChangeDeleted, UserID: user.ID})
+	results, _ = index.Search(context.Background(), "elsewhere", 10)
+	if len(results) != 0 {
+		t.Errorf("Expected the erased user to be removed, got %d results", len(results))
+	}
+}
+
+func TestIndex_Search_Limit(t *testing.T) {
+	index := newIndex(
+		newUser("Anna One", "anna1@example.com"),
+		newUser("Anna Two", "anna2@example.com"),
+		newUser("Anna Three", "anna3@example.com"),
+	)
+
+	results, _ := index.Search(context.Background(), "anna", 2)
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+}
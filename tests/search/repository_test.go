@@ -0,0 +1,103 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/domain"
+)
+
+// rollbackTransactor runs fn without a transaction and, when it fails,
+// calls undo to stand in for the rollback
+type rollbackTransactor struct {
+	undo func()
+}
+
+func (t *rollbackTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if err != nil {
+		t.undo()
+	}
+	return err
+}
+
+func found(t *testing.T, index *search.Index, query string) bool {
+	t.Helper()
+	results, err := index.Search(context.Background(), query, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return len(results) > 0
+}
+
+func TestIndexedRepository_Rollback(t *testing.T) {
+	ctx := context.Background()
+	users := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	index := search.NewIndex()
+	repo := search.NewIndexedRepository(users, index)
+	user := newUser("Alice Original", "rollback@example.com")
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	created := newUser("Bob Temporary", "uncommitted@example.com")
+	transactor := repo.Transactor(&rollbackTransactor{undo: func() {
+		name := "Alice Original"
+		users.Patch(ctx, user.ID, domain.UserPatch{Name: &name})
+		users.Erase(ctx, created.ID)
+	}})
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		name := "Alice Replaced"
+		if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: &name}); err != nil {
+			return err
+		}
+		if err := repo.Create(ctx, created); err != nil {
+			return err
+		}
+		// The index doesn't see the writes until the transaction ends
+		if found(t, index, "Replaced") || found(t, index, "Temporary") {
+			t.Error("Expected the uncommitted writes to stay out of the index")
+		}
+		return errors.New("rolled back")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction to fail")
+	}
+
+	if !found(t, index, "Original") {
+		t.Error("Expected the committed name to stay indexed")
+	}
+	if found(t, index, "Replaced") || found(t, index, "Temporary") {
+		t.Error("Expected the rolled back writes to stay out of the index")
+	}
+}
+
+func TestIndexedRepository_Commit(t *testing.T) {
+	ctx := context.Background()
+	index := search.NewIndex()
+	repo := search.NewIndexedRepository(memory.NewUserRepository(ids.NewObjectIDGenerator()), index)
+	user := newUser("Before Commit", "commit@example.com")
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	transactor := repo.Transactor(memory.NewTransactor())
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		name := "After Commit"
+		_, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: &name})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !found(t, index, "After") {
+		t.Error("Expected the committed name to be indexed")
+	}
+	if found(t, index, "Before") {
+		t.Error("Expected the old name to be dropped from the index")
+	}
+}
@@ -2,11 +2,27 @@ package service
 
 import (
 	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
 	"backend-hexagonal/internal/service"
 	"context"
+	"errors"
 	"testing"
 )
 
+// Stub credential backend that accepts a single login
+type stubCredentialVerifier struct {
+	login    string
+	password string
+	identity *domain.Identity
+}
+
+func (v *stubCredentialVerifier) VerifyCredentials(ctx context.Context, login, password string) (*domain.Identity, error) {
+	if login != v.login || password != v.password {
+		return nil, ports.ErrInvalidCredentials
+	}
+	return v.identity, nil
+}
+
 func TestAuthService_Register(t *testing.T) {
 	repo := newMockUserRepository()
 	authService := service.NewAuthService(repo)
@@ -41,6 +57,132 @@ func TestAuthService_Register(t *testing.T) {
 	}
 }
 
+// Mock transactor counting the transactions and failing them after fn
+// when err is set
+type mockTransactor struct {
+	calls int
+	err   error
+}
+
+func (m *mockTransactor) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.calls++
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return m.err
+}
+
+func TestAuthService_Register_Transaction(t *testing.T) {
+	transactor := &mockTransactor{}
+	authService := service.NewAuthService(newMockUserRepository()).WithTransactor(transactor)
+	ctx := context.Background()
+
+	_, err := authService.Register(ctx, &domain.RegisterRequest{Name: "Tx", Email: "tx@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if transactor.calls != 1 {
+		t.Errorf("Expected 1 transaction, got %d", transactor.calls)
+	}
+
+	// A failed commit fails the registration
+	transactor.err = domain.Unavailable(errors.New("commit failed"))
+	_, err = authService.Register(ctx, &domain.RegisterRequest{Name: "Tx", Email: "tx2@example.com", Password: "password123"})
+	if domain.KindOf(err) != domain.KindUnavailable {
+		t.Errorf("Expected the commit error, got %v", err)
+	}
+
+	// Duplicates are still rejected inside the transaction
+	transactor.err = nil
+	_, err = authService.Register(ctx, &domain.RegisterRequest{Name: "Tx", Email: "tx@example.com", Password: "password123"})
+	if !errors.Is(err, service.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+}
+
+func TestAuthService_Register_NormalizesEmail(t *testing.T) {
+	repo := newMockUserRepository()
+	authService := service.NewAuthService(repo)
+	ctx := context.Background()
+
+	response, err := authService.Register(ctx, &domain.RegisterRequest{
+		Name:     "John Doe",
+		Email:    " John@Example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.User.Email != "john@example.com" {
+		t.Errorf("Expected the email in lower case, got %q", response.User.Email)
+	}
+
+	// The same address in another case belongs to the same user
+	_, err = authService.Register(ctx, &domain.RegisterRequest{
+		Name:     "Other John",
+		Email:    "JOHN@example.com",
+		Password: "password123",
+	})
+	if !errors.Is(err, service.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+
+	login, err := authService.Login(ctx, &domain.AuthRequest{Email: "JOHN@EXAMPLE.COM", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if login.User.ID != response.User.ID {
+		t.Error("Expected to log in as the registered user")
+	}
+}
+
+func TestAuthService_Register_Attributes(t *testing.T) {
+	schema, err := domain.NewAttributeSchema([]domain.AttributeDefinition{
+		{Name: "employeeId", Type: domain.AttributeTypeString, Required: true, Unique: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	repo := newMockUserRepository()
+	authService := service.NewAuthService(repo).WithAttributeSchema(schema)
+
+	ctx := context.Background()
+
+	_, err = authService.Register(ctx, &domain.RegisterRequest{
+		Name:     "No Attributes",
+		Email:    "none@example.com",
+		Password: "password123",
+	})
+	if !errors.Is(err, domain.ErrInvalidUser) {
+		t.Errorf("Expected ErrInvalidUser for a missing required attribute, got %v", err)
+	}
+
+	response, err := authService.Register(ctx, &domain.RegisterRequest{
+		Name:       "Employee",
+		Email:      "employee@example.com",
+		Password:   "password123",
+		Profile:    domain.Profile{Timezone: "Asia/Bangkok"},
+		Attributes: map[string]interface{}{"employeeId": "E1"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if response.User.Timezone != "Asia/Bangkok" || response.User.Attributes["employeeId"] != "E1" {
+		t.Errorf("Expected the profile and attributes to be stored, got %+v", response.User)
+	}
+
+	_, err = authService.Register(ctx, &domain.RegisterRequest{
+		Name:       "Duplicate",
+		Email:      "duplicate@example.com",
+		Password:   "password123",
+		Attributes: map[string]interface{}{"employeeId": "E1"},
+	})
+	if !errors.Is(err, service.ErrAttributeTaken) {
+		t.Errorf("Expected ErrAttributeTaken, got %v", err)
+	}
+}
+
 func TestAuthService_Login(t *testing.T) {
 	repo := newMockUserRepository()
 	authService := service.NewAuthService(repo)
@@ -93,8 +235,11 @@ func TestAuthService_Login_InvalidCredentials(t *testing.T) {
 
 	_, err := authService.Login(ctx, loginReq)
 
-	if err == nil {
-		t.Error("Expected error for invalid credentials")
+	if !errors.Is(err, ports.ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if kind := domain.KindOf(err); kind != domain.KindUnauthenticated {
+		t.Errorf("Expected an unauthenticated error, got %s", kind)
 	}
 }
 
@@ -127,3 +272,157 @@ func TestAuthService_ValidateToken(t *testing.T) {
 		t.Errorf("Expected email %s, got %s", registerReq.Email, claims.Email)
 	}
 }
+
+func TestAuthService_Login_ExternalVerifier(t *testing.T) {
+	repo := newMockUserRepository()
+	verifier := &stubCredentialVerifier{
+		login:    "somchai",
+		password: "directory-secret",
+		identity: &domain.Identity{
+			Email: "somchai@corp.example",
+			Name:  "Somchai Jaidee",
+			Roles: []string{"admin"},
+		},
+	}
+	authService := service.NewAuthServiceWithVerifier(repo, verifier)
+
+	ctx := context.Background()
+	loginReq := &domain.AuthRequest{
+		Email:    "somchai",
+		Password: "directory-secret",
+	}
+
+	// First login creates the local user from the directory attributes
+	response, err := authService.Login(ctx, loginReq)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.User.Email != "somchai@corp.example" {
+		t.Errorf("Expected email somchai@corp.example, got %s", response.User.Email)
+	}
+
+	stored, _ := repo.GetByEmail(ctx, "somchai@corp.example")
+	if stored == nil {
+		t.Fatal("Expected user to be created on first login")
+	}
+	if len(stored.Roles) != 1 || stored.Roles[0] != "admin" {
+		t.Errorf("Expected roles [admin], got %v", stored.Roles)
+	}
+
+	claims, err := authService.ValidateToken(response.Token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "admin" {
+		t.Errorf("Expected token roles [admin], got %v", claims.Roles)
+	}
+
+	// Second login reuses the same user
+	second, err := authService.Login(ctx, loginReq)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if second.User.ID != response.User.ID {
+		t.Errorf("Expected the same user on second login, got %s and %s", response.User.ID.String(), second.User.ID.String())
+	}
+
+	// Wrong directory password is rejected
+	_, err = authService.Login(ctx, &domain.AuthRequest{Email: "somchai", Password: "wrong"})
+	if err == nil {
+		t.Error("Expected error for invalid credentials")
+	}
+}
+
+func TestAuthService_SuspendedUser(t *testing.T) {
+	repo := newMockUserRepository()
+	authService := service.NewAuthService(repo)
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	registerReq := &domain.RegisterRequest{
+		Name:     "Suspended User",
+		Email:    "suspended@example.com",
+		Password: "password123",
+	}
+
+	registered, err := authService.Register(ctx, registerReq)
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// The token is accepted while the account is active
+	claims, err := authService.Authenticate(ctx, registered.Token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = userService.SuspendUser(ctx, claims.UserID, "")
+	if err != nil {
+		t.Fatalf("Failed to suspend user: %v", err)
+	}
+
+	// Existing tokens are rejected once the account is suspended
+	_, err = authService.Authenticate(ctx, registered.Token)
+	if !errors.Is(err, service.ErrAccountInactive) {
+		t.Errorf("Expected ErrAccountInactive, got %v", err)
+	}
+
+	// And so are new logins
+	loginReq := &domain.AuthRequest{
+		Email:    "suspended@example.com",
+		Password: "password123",
+	}
+
+	_, err = authService.Login(ctx, loginReq)
+	if !errors.Is(err, service.ErrAccountInactive) {
+		t.Errorf("Expected ErrAccountInactive, got %v", err)
+	}
+}
+
+// Repository whose reads fail as if the database were down
+type unavailableUserRepository struct {
+	*mockUserRepository
+}
+
+func (r unavailableUserRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	return nil, domain.Unavailable(context.DeadlineExceeded)
+}
+
+func TestAuthService_Authenticate_Errors(t *testing.T) {
+	repo := newMockUserRepository()
+	authService := service.NewAuthService(repo)
+
+	ctx := context.Background()
+
+	registered, err := authService.Register(ctx, &domain.RegisterRequest{
+		Name:     "Erased User",
+		Email:    "erased@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	// Outages are reported as such rather than as a bad token
+	down := service.NewAuthService(unavailableUserRepository{repo})
+	_, err = down.Authenticate(ctx, registered.Token)
+	if kind := domain.KindOf(err); kind != domain.KindUnavailable {
+		t.Errorf("Expected an unavailable error, got %v", err)
+	}
+
+	// Tokens of users who no longer exist are invalid
+	if _, err := repo.Erase(ctx, registered.User.ID); err != nil {
+		t.Fatalf("Failed to erase user: %v", err)
+	}
+	_, err = authService.Authenticate(ctx, registered.Token)
+	if !errors.Is(err, service.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	_, err = authService.Authenticate(ctx, "not-a-token")
+	if !errors.Is(err, service.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// mockBlobStore keeps blobs in memory
+type mockBlobStore struct {
+	blobs map[string][]byte
+}
+
+func newMockBlobStore() *mockBlobStore {
+	return &mockBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (m *mockBlobStore) Put(ctx context.Context, key string, data io.Reader, contentType string) error {
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	m.blobs[key] = b
+	return nil
+}
+
+func (m *mockBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := m.blobs[key]
+	if !ok {
+		return nil, ports.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *mockBlobStore) Delete(ctx context.Context, key string) error {
+	delete(m.blobs, key)
+	return nil
+}
+
+func (m *mockBlobStore) URL(key string) string {
+	return "/media/" + key
+}
+
+func newTestImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeJPEGWithOrientation encodes a JPEG with an EXIF segment holding the
+// orientation tag
+func encodeJPEGWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// A big-endian TIFF header and an IFD with the orientation entry
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, uint16(0x0112))
+	binary.Write(&tiff, binary.BigEndian, uint16(3))
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, orientation)
+	binary.Write(&tiff, binary.BigEndian, uint16(0))
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	// Insert the segment right after the start of image marker
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func newAvatarTestService(t *testing.T) (*service.AvatarService, *mockUserRepository, *mockBlobStore, *domain.User) {
+	repo := newMockUserRepository()
+	user := &domain.User{Name: "John Doe", Email: "john@example.com"}
+	if err := repo.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	blobs := newMockBlobStore()
+	return service.NewAvatarService(repo, blobs, 1<<20), repo, blobs, user
+}
+
+func decodeBlob(t *testing.T, blobs *mockBlobStore, url string) (image.Image, string) {
+	data, ok := blobs.blobs[strings.TrimPrefix(url, "/media/")]
+	if !ok {
+		t.Fatalf("Expected a blob for %s", url)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a decodable image, got %v", err)
+	}
+	return img, format
+}
+
+func TestAvatarService_UploadAvatar(t *testing.T) {
+	avatarService, _, blobs, user := newAvatarTestService(t)
+	ctx := context.Background()
+
+	updated, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, newTestImage(2000, 1000))))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.Avatar == nil || updated.Avatar.URL == "" {
+		t.Fatal("Expected the user to have an avatar URL")
+	}
+	if updated.Version != user.Version+1 {
+		t.Errorf("Expected version %d, got %d", user.Version+1, updated.Version)
+	}
+
+	original, format := decodeBlob(t, blobs, updated.Avatar.URL)
+	if format != "png" {
+		t.Errorf("Expected png, got %s", format)
+	}
+	if b := original.Bounds(); b.Dx() != service.MaxAvatarDimension || b.Dy() != service.MaxAvatarDimension/2 {
+		t.Errorf("Expected the image to be scaled down to fit, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	if len(updated.Avatar.Thumbnails) != len(service.AvatarThumbnailSizes) {
+		t.Fatalf("Expected %d thumbnails, got %d", len(service.AvatarThumbnailSizes), len(updated.Avatar.Thumbnails))
+	}
+	for size, url := range updated.Avatar.Thumbnails {
+		thumbnail, _ := decodeBlob(t, blobs, url)
+		if b := thumbnail.Bounds(); b.Dx() != b.Dy() || strconv.Itoa(b.Dx()) != size {
+			t.Errorf("Expected a %s pixel square thumbnail, got %dx%d", size, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestAvatarService_UploadAvatar_AppliesOrientationAndStripsEXIF(t *testing.T) {
+	avatarService, _, blobs, user := newAvatarTestService(t)
+
+	// Orientation 6 means the image is displayed rotated 90 degrees clockwise
+	upload := encodeJPEGWithOrientation(t, newTestImage(40, 20), 6)
+	updated, err := avatarService.UploadAvatar(context.Background(), user.ID, bytes.NewReader(upload))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	original, format := decodeBlob(t, blobs, updated.Avatar.URL)
+	if format != "jpeg" {
+		t.Errorf("Expected jpeg, got %s", format)
+	}
+	if b := original.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Errorf("Expected the image to be rotated to 20x40, got %dx%d", b.Dx(), b.Dy())
+	}
+	if updated.Avatar.ContentType != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %s", updated.Avatar.ContentType)
+	}
+
+	for _, key := range updated.Avatar.Keys {
+		if bytes.Contains(blobs.blobs[key], []byte("Exif")) {
+			t.Errorf("Expected EXIF to be stripped from %s", key)
+		}
+	}
+}
+
+func TestAvatarService_UploadAvatar_Rejected(t *testing.T) {
+	avatarService, repo, blobs, user := newAvatarTestService(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"too large", bytes.Repeat([]byte{0}, 1<<20+1), service.ErrAvatarTooLarge},
+		{"not an image", []byte("<html><body>hello</body></html>"), service.ErrUnsupportedImage},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), service.ErrUnsupportedImage},
+		{"truncated png", encodePNG(t, newTestImage(10, 10))[:40], service.ErrInvalidImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if len(blobs.blobs) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d blobs", len(blobs.blobs))
+	}
+	if stored, _ := repo.GetByID(ctx, user.ID); stored.Avatar != nil {
+		t.Error("Expected the user to have no avatar")
+	}
+}
+
+func TestAvatarService_ReplaceAndDeleteAvatar(t *testing.T) {
+	avatarService, _, blobs, user := newAvatarTestService(t)
+	ctx := context.Background()
+
+	first, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, newTestImage(100, 100))))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	second, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, newTestImage(120, 100))))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.Avatar.URL == second.Avatar.URL {
+		t.Error("Expected a new avatar to have a new URL")
+	}
+	for _, key := range first.Avatar.Keys {
+		if _, ok := blobs.blobs[key]; ok {
+			t.Errorf("Expected the replaced blob %s to be deleted", key)
+		}
+	}
+
+	// Uploading the same image again keeps its blobs
+	again, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, newTestImage(120, 100))))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(blobs.blobs) != len(again.Avatar.Keys) {
+		t.Errorf("Expected %d blobs, got %d", len(again.Avatar.Keys), len(blobs.blobs))
+	}
+
+	deleted, err := avatarService.DeleteAvatar(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if deleted.Avatar != nil {
+		t.Error("Expected the avatar to be removed")
+	}
+	if len(blobs.blobs) != 0 {
+		t.Errorf("Expected the blobs to be deleted, got %d", len(blobs.blobs))
+	}
+}
+
+func TestAvatarService_Events(t *testing.T) {
+	avatarService, _, _, user := newAvatarTestService(t)
+	transactor := &mockTransactor{}
+	outbox := memory.NewOutboxRepository()
+	avatarService.WithTransactor(transactor).WithOutbox(outbox)
+	ctx := context.Background()
+
+	if _, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, newTestImage(10, 10)))); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := avatarService.DeleteAvatar(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if transactor.calls != 2 {
+		t.Errorf("Expected each change in a transaction, got %d", transactor.calls)
+	}
+
+	events, _ := outbox.Unpublished(ctx, 10)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.Type != domain.EventUserUpdated || event.UserID != user.ID {
+			t.Errorf("Expected an update of the user, got %s of %s", event.Type, event.UserID.String())
+		}
+	}
+}
+
+func TestAvatarService_UploadAvatar_UserNotFound(t *testing.T) {
+	avatarService, _, _, _ := newAvatarTestService(t)
+
+	_, err := avatarService.UploadAvatar(context.Background(), newID(), bytes.NewReader(encodePNG(t, newTestImage(10, 10))))
+	if !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestAvatarService_EraseUserData(t *testing.T) {
+	avatarService, repo, blobs, user := newAvatarTestService(t)
+	ctx := context.Background()
+
+	if _, err := avatarService.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, newTestImage(10, 10)))); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tombstoneRepo := newMockTombstoneRepository()
+	privacyService := service.NewPrivacyService(repo, tombstoneRepo, avatarService)
+
+	tombstone, err := privacyService.EraseUser(ctx, user.ID, user.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(blobs.blobs) != 0 {
+		t.Errorf("Expected the avatar blobs to be erased, got %d", len(blobs.blobs))
+	}
+	if len(tombstone.Stores) != 2 || tombstone.Stores[1] != "avatars" {
+		t.Errorf("Expected the tombstone to list the avatars store, got %v", tombstone.Stores)
+	}
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func importUsers(t *testing.T, bulkService *service.BulkService, format service.BulkFormat, input string, dryRun bool) *service.ImportReport {
+	t.Helper()
+	report, err := bulkService.ImportUsers(context.Background(), strings.NewReader(input), service.ImportOptions{
+		Format: format,
+		DryRun: dryRun,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return report
+}
+
+func TestBulkService_ImportUsers_CSV(t *testing.T) {
+	repo := newMockUserRepository()
+	bulkService := service.NewBulkService(repo)
+	ctx := context.Background()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("imported-secret"), bcrypt.MinCost)
+	input := "name,email,password,passwordHash,timezone\n" +
+		"John Doe,john@example.com,password123,,Asia/Bangkok\n" +
+		"Jane Doe,jane@example.com,," + string(hash) + ",\n"
+
+	report := importUsers(t, bulkService, service.BulkFormatCSV, input, false)
+	if report.Records != 2 || report.Created != 2 || report.Failed != 0 {
+		t.Fatalf("Expected 2 users created, got %+v", report)
+	}
+
+	jane, _ := repo.GetByEmail(ctx, "jane@example.com")
+	if jane == nil || jane.Password != string(hash) {
+		t.Fatal("Expected the pre-hashed password to be stored as is")
+	}
+	john, _ := repo.GetByEmail(ctx, "john@example.com")
+	if bcrypt.CompareHashAndPassword([]byte(john.Password), []byte("password123")) != nil {
+		t.Error("Expected the plain password to be hashed")
+	}
+	if john.Timezone != "Asia/Bangkok" || john.Status != domain.UserStatusActive {
+		t.Errorf("Expected an active user in Asia/Bangkok, got %s in %q", john.Status, john.Timezone)
+	}
+}
+
+func TestBulkService_ImportUsers_UpsertsByEmail(t *testing.T) {
+	repo := newMockUserRepository()
+	bulkService := service.NewBulkService(repo)
+	ctx := context.Background()
+
+	importUsers(t, bulkService, service.BulkFormatCSV, "name,email,password\nJohn Doe,john@example.com,password123\n", false)
+	john, _ := repo.GetByEmail(ctx, "john@example.com")
+	version, password := john.Version, john.Password
+
+	// Importing the same record again changes nothing
+	report := importUsers(t, bulkService, service.BulkFormatCSV, "name,email,password\nJohn Doe,john@example.com,password123\n", false)
+	if report.Unchanged != 1 || report.Updated != 0 {
+		t.Errorf("Expected the user to be unchanged, got %+v", report)
+	}
+
+	report = importUsers(t, bulkService, service.BulkFormatCSV, "name,email,bio\nJohnny Doe,john@example.com,Hello\n", false)
+	if report.Updated != 1 || report.Created != 0 {
+		t.Fatalf("Expected the user to be updated, got %+v", report)
+	}
+
+	updated, _ := repo.GetByID(ctx, john.ID)
+	if updated.Name != "Johnny Doe" || updated.Bio != "Hello" {
+		t.Errorf("Expected the record's fields, got %q and %q", updated.Name, updated.Bio)
+	}
+	if updated.Password != password {
+		t.Error("Expected the password to be kept when the record has none")
+	}
+	if updated.Version != version+1 {
+		t.Errorf("Expected version %d, got %d", version+1, updated.Version)
+	}
+}
+
+func TestBulkService_ImportUsers_DryRun(t *testing.T) {
+	repo := newMockUserRepository()
+	bulkService := service.NewBulkService(repo)
+
+	input := "name,email,password\nJohn Doe,john@example.com,password123\nJane Doe,not-an-email,password123\n"
+	report := importUsers(t, bulkService, service.BulkFormatCSV, input, true)
+
+	if !report.DryRun || report.Created != 1 || report.Failed != 1 {
+		t.Errorf("Expected 1 user to be created and 1 to fail, got %+v", report)
+	}
+	if len(repo.users) != 0 {
+		t.Errorf("Expected a dry run to write nothing, got %d users", len(repo.users))
+	}
+}
+
+func TestBulkService_ImportUsers_RecordErrors(t *testing.T) {
+	repo := newMockUserRepository()
+	bulkService := service.NewBulkService(repo)
+
+	input := strings.Join([]string{
+		"name,email,password,passwordHash",
+		"John Doe,john@example.com,password123,",
+		"John Again,john@example.com,password123,",
+		",nameless@example.com,password123,",
+		"No Password,nopass@example.com,,",
+		"Short,short@example.com,abc,",
+		"Bad Hash,badhash@example.com,,not-a-hash",
+		`Broken,"broken@example.com,password123,`,
+	}, "\n")
+
+	report := importUsers(t, bulkService, service.BulkFormatCSV, input, false)
+	if report.Created != 1 {
+		t.Errorf("Expected 1 user to be created, got %d", report.Created)
+	}
+	if report.Failed != 6 || len(report.Errors) != 6 {
+		t.Fatalf("Expected 6 failed records, got %+v", report)
+	}
+
+	wantLines := []int{3, 4, 5, 6, 7, 8}
+	for i, e := range report.Errors {
+		if e.Line != wantLines[i] {
+			t.Errorf("Expected error %d on line %d, got line %d: %s", i, wantLines[i], e.Line, e.Error)
+		}
+	}
+	if report.Errors[0].Email != "john@example.com" || !strings.Contains(report.Errors[0].Error, "line 2") {
+		t.Errorf("Expected the duplicate to name the first line, got %+v", report.Errors[0])
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected a valid CSV report, got %v", err)
+	}
+	if len(rows) != 7 || strings.Join(rows[0], ",") != "line,email,error" {
+		t.Errorf("Expected a header and 6 rows, got %v", rows)
+	}
+}
+
+func TestBulkService_ImportUsers_InvalidImport(t *testing.T) {
+	bulkService := service.NewBulkService(newMockUserRepository())
+
+	inputs := []string{
+		"",
+		"name,email,favouriteColour\n",
+		"name,password\n",
+		"name,email,email\n",
+	}
+	for _, input := range inputs {
+		_, err := bulkService.ImportUsers(context.Background(), strings.NewReader(input), service.ImportOptions{Format: service.BulkFormatCSV})
+		if !errors.Is(err, service.ErrInvalidImport) {
+			t.Errorf("Expected ErrInvalidImport for %q, got %v", input, err)
+		}
+	}
+
+	if _, err := service.ParseBulkFormat("xml"); !errors.Is(err, service.ErrInvalidImport) {
+		t.Errorf("Expected ErrInvalidImport for an unknown format, got %v", err)
+	}
+}
+
+func TestBulkService_ImportUsers_NDJSONAttributes(t *testing.T) {
+	schema, _ := domain.NewAttributeSchema([]domain.AttributeDefinition{
+		{Name: "employeeId", Type: domain.AttributeTypeString, Unique: true},
+		{Name: "level", Type: domain.AttributeTypeNumber},
+	})
+	repo := newMockUserRepository()
+	bulkService := service.NewBulkService(repo).WithAttributeSchema(schema)
+	ctx := context.Background()
+
+	input := `{"name":"John Doe","email":"john@example.com","password":"password123","attributes":{"employeeId":"E001","level":3}}
+
+{"name":"Jane Doe","email":"jane@example.com","password":"password123","attributes":{"employeeId":"E001"}}
+{"name":"Bad","email":"bad@example.com","password":"password123","favouriteColour":"blue"}
+{"name":"Broken",
+`
+	report := importUsers(t, bulkService, service.BulkFormatNDJSON, input, false)
+	if report.Created != 1 || report.Failed != 3 {
+		t.Fatalf("Expected 1 created and 3 failed, got %+v", report)
+	}
+	if report.Errors[0].Line != 3 || !strings.Contains(report.Errors[0].Error, "already taken") {
+		t.Errorf("Expected the taken employeeId on line 3, got %+v", report.Errors[0])
+	}
+	if report.Errors[1].Line != 4 || report.Errors[2].Line != 5 {
+		t.Errorf("Expected malformed records on lines 4 and 5, got %+v", report.Errors[1:])
+	}
+
+	john, _ := repo.GetByEmail(ctx, "john@example.com")
+	if john.Attributes["employeeId"] != "E001" || john.Attributes["level"] != float64(3) {
+		t.Errorf("Expected the attributes to be imported, got %v", john.Attributes)
+	}
+
+	// CSV cells are converted to the attribute's type
+	report = importUsers(t, bulkService, service.BulkFormatCSV, "name,email,attributes.level\nJohn Doe,john@example.com,4\n", false)
+	if report.Updated != 1 {
+		t.Fatalf("Expected the user to be updated, got %+v", report)
+	}
+	john, _ = repo.GetByEmail(ctx, "john@example.com")
+	if john.Attributes["level"] != float64(4) || john.Attributes["employeeId"] != "E001" {
+		t.Errorf("Expected level 4 and the employeeId kept, got %v", john.Attributes)
+	}
+}
+
+func TestBulkService_ExportUsers(t *testing.T) {
+	schema, _ := domain.NewAttributeSchema([]domain.AttributeDefinition{
+		{Name: "level", Type: domain.AttributeTypeNumber},
+	})
+	repo := newMockUserRepository()
+	bulkService := service.NewBulkService(repo).WithAttributeSchema(schema)
+	ctx := context.Background()
+
+	importUsers(t, bulkService, service.BulkFormatNDJSON, `{"name":"John Doe","email":"john@example.com","password":"password123","bio":"Hi, there","attributes":{"level":2.5}}
+{"name":"Jane Doe","email":"jane@example.com","password":"password123"}
+`, false)
+
+	var ndjson bytes.Buffer
+	if err := bulkService.ExportUsers(ctx, &ndjson, service.ExportOptions{Format: service.BulkFormatNDJSON}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var record domain.UserRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record, got %v", err)
+		}
+		if record.ID == "" || record.Status != domain.UserStatusActive || record.PasswordHash != "" {
+			t.Errorf("Expected an ID, a status and no password hash, got %+v", record)
+		}
+	}
+
+	var csvExport bytes.Buffer
+	if err := bulkService.ExportUsers(ctx, &csvExport, service.ExportOptions{Format: service.BulkFormatCSV, IncludePasswordHashes: true}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(csvExport.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(rows) != 3 || !strings.Contains(strings.Join(rows[0], ","), "passwordHash") || rows[0][len(rows[0])-1] != "attributes.level" {
+		t.Fatalf("Expected a header with passwordHash and attributes.level and 2 rows, got %v", rows)
+	}
+
+	// The export imports back into an empty store, passwords included
+	other := newMockUserRepository()
+	report := importUsers(t, service.NewBulkService(other).WithAttributeSchema(schema), service.BulkFormatCSV, csvExport.String(), false)
+	if report.Created != 2 || report.Failed != 0 {
+		t.Fatalf("Expected the export to import cleanly, got %+v", report)
+	}
+	john, _ := other.GetByEmail(ctx, "john@example.com")
+	if john.Bio != "Hi, there" || john.Attributes["level"] != 2.5 {
+		t.Errorf("Expected the bio and attributes to round trip, got %q and %v", john.Bio, john.Attributes)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(john.Password), []byte("password123")) != nil {
+		t.Error("Expected the password hash to round trip")
+	}
+}
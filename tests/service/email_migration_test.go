@@ -0,0 +1,89 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"context"
+	"testing"
+	"time"
+)
+
+// Mock email store holding users stored before emails were normalized
+type mockUserEmailStore struct {
+	users []*domain.User
+}
+
+func (m *mockUserEmailStore) add(email string, createdAt time.Time, deleted bool) *domain.User {
+	user := &domain.User{ID: newID(), Email: email, CreatedAt: createdAt}
+	if deleted {
+		deletedAt := createdAt.Add(time.Hour)
+		user.DeletedAt = &deletedAt
+	}
+	m.users = append(m.users, user)
+	return user
+}
+
+func (m *mockUserEmailStore) EachIncludingDeleted(ctx context.Context, fn func(*domain.User) error) error {
+	for _, user := range m.users {
+		found := *user
+		if err := fn(&found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockUserEmailStore) SetEmail(ctx context.Context, id domain.UserID, email string) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			user.Email = email
+		}
+	}
+	return nil
+}
+
+func TestEmailMigrationService_NormalizeEmails(t *testing.T) {
+	store := &mockUserEmailStore{}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	clean := store.add("clean@example.com", day, false)
+	mixed := store.add("Mixed@Example.com", day, false)
+	// The oldest user who is not deleted keeps a shared email
+	deleted := store.add("foo@example.com", day, true)
+	newer := store.add("foo@example.com", day.Add(48*time.Hour), false)
+	keeper := store.add("Foo@Example.com", day.Add(24*time.Hour), false)
+
+	migration := service.NewEmailMigrationService(store)
+	report, err := migration.NormalizeEmails(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Applied || report.Users != 5 || report.Duplicates != 1 || len(report.Changes) != 4 {
+		t.Fatalf("Expected 4 planned changes and 1 duplicate, got %+v", report)
+	}
+	if mixed.Email != "Mixed@Example.com" {
+		t.Error("Expected a dry run to change nothing")
+	}
+
+	if _, err := migration.NormalizeEmails(context.Background(), true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := map[*domain.User]string{
+		clean:   "clean@example.com",
+		mixed:   "mixed@example.com",
+		keeper:  "foo@example.com",
+		newer:   "foo+duplicate-" + newer.ID.String() + "@example.com",
+		deleted: "foo+duplicate-" + deleted.ID.String() + "@example.com",
+	}
+	for user, email := range want {
+		if user.Email != email {
+			t.Errorf("Expected %s, got %s", email, user.Email)
+		}
+	}
+
+	// Running it again finds nothing left to do
+	report, _ = migration.NormalizeEmails(context.Background(), true)
+	if len(report.Changes) != 0 || report.Duplicates != 0 {
+		t.Errorf("Expected no changes, got %+v", report.Changes)
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// mockPublisher records the events it delivers, and fails those whose
+// user is in failing
+type mockPublisher struct {
+	published []*domain.Event
+	failing   map[domain.UserID]bool
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, event *domain.Event) error {
+	if m.failing[event.UserID] {
+		return errors.New("unreachable")
+	}
+	m.published = append(m.published, event)
+	return nil
+}
+
+func TestOutboxRelay_RelayPending(t *testing.T) {
+	outbox := memory.NewOutboxRepository()
+	publisher := &mockPublisher{failing: map[domain.UserID]bool{}}
+	relay := service.NewOutboxRelay(outbox, publisher)
+	ctx := context.Background()
+
+	// More events than the relay reads at once
+	var userIDs []domain.UserID
+	for i := 0; i < 250; i++ {
+		userIDs = append(userIDs, newID())
+		outbox.Append(ctx, domain.PasswordChanged(userIDs[i]))
+	}
+
+	// A failure holds back the events after it
+	publisher.failing[userIDs[120]] = true
+	published, err := relay.RelayPending(ctx)
+	if err == nil {
+		t.Fatal("Expected the failure to be returned")
+	}
+	if published != 120 || len(publisher.published) != 120 {
+		t.Fatalf("Expected the 120 events before the failure published, got %d", published)
+	}
+	for i, event := range publisher.published {
+		if event.UserID != userIDs[i] {
+			t.Fatalf("Expected event %d to be of user %s, got %s", i, userIDs[i].String(), event.UserID.String())
+		}
+	}
+
+	// The next run starts at the failed event, without redelivering
+	delete(publisher.failing, userIDs[120])
+	published, err = relay.RelayPending(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if published != 130 || len(publisher.published) != 250 {
+		t.Fatalf("Expected the other 130 events published, got %d", published)
+	}
+	if publisher.published[120].UserID != userIDs[120] {
+		t.Errorf("Expected the failed event to be published next, got %s", publisher.published[120].UserID.String())
+	}
+
+	if published, _ := relay.RelayPending(ctx); published != 0 {
+		t.Errorf("Expected nothing left to publish, got %d", published)
+	}
+}
+
+func TestOutboxRelay_Run(t *testing.T) {
+	outbox := memory.NewOutboxRepository()
+	publisher := &mockPublisher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	outbox.Append(ctx, domain.PasswordChanged(newID()))
+
+	done := make(chan struct{})
+	go func() {
+		service.NewOutboxRelay(outbox, publisher).WithRetention(time.Nanosecond).Run(ctx, time.Hour)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	// The first run publishes the event, then cleans it up
+	if len(publisher.published) != 1 {
+		t.Fatalf("Expected 1 event published, got %d", len(publisher.published))
+	}
+	if deleted, _ := outbox.DeletePublished(context.Background(), time.Now()); deleted != 0 {
+		t.Errorf("Expected the published event to be cleaned up already, got %d deleted", deleted)
+	}
+}
+
+func TestUserService_Events(t *testing.T) {
+	repo := newMockUserRepository()
+	outbox := memory.NewOutboxRepository()
+	transactor := &mockTransactor{}
+	userService := service.NewUserService(repo).WithTransactor(transactor).WithOutbox(outbox)
+	ctx := context.Background()
+
+	user, err := userService.CreateUser(ctx, "Event User", "event@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	password := "new-password"
+	name := "Renamed User"
+	if _, err := userService.PatchUser(ctx, user.ID, domain.UserPatch{Name: &name, Password: &password}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := userService.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	events, _ := outbox.Unpublished(ctx, 10)
+	expected := []domain.EventType{domain.EventUserRegistered, domain.EventUserUpdated, domain.EventPasswordChanged, domain.EventUserDeleted}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+	for i, event := range events {
+		if event.Type != expected[i] || event.UserID != user.ID {
+			t.Errorf("Expected event %d to be %s of %s, got %s of %s", i, expected[i], user.ID.String(), event.Type, event.UserID.String())
+		}
+	}
+	if events[1].User == nil || events[1].User.Name != name {
+		t.Errorf("Expected the updated event to carry the renamed user, got %+v", events[1].User)
+	}
+	if transactor.calls != 3 {
+		t.Errorf("Expected every write in a transaction, got %d transactions", transactor.calls)
+	}
+
+	// An event that can't be stored fails the write with it
+	transactor.err = errors.New("commit failed")
+	if _, err := userService.CreateUser(ctx, "Other User", "other@example.com", "password123"); err == nil {
+		t.Error("Expected the failed transaction to fail the write")
+	}
+}
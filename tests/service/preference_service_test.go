@@ -0,0 +1,207 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// Mock preference repository for testing
+type mockPreferenceRepository struct {
+	prefs  map[string]domain.Preferences
+	writes int
+}
+
+func newMockPreferenceRepository() *mockPreferenceRepository {
+	return &mockPreferenceRepository{
+		prefs: make(map[string]domain.Preferences),
+	}
+}
+
+func preferenceKey(userID domain.UserID, namespace string) string {
+	return userID.String() + "/" + namespace
+}
+
+func (m *mockPreferenceRepository) Get(ctx context.Context, userID domain.UserID, namespace string) (*domain.Preferences, error) {
+	prefs, ok := m.prefs[preferenceKey(userID, namespace)]
+	if !ok {
+		return nil, nil
+	}
+	return &prefs, nil
+}
+
+func (m *mockPreferenceRepository) Put(ctx context.Context, prefs *domain.Preferences) error {
+	key := preferenceKey(prefs.UserID, prefs.Namespace)
+	if m.prefs[key].Version != prefs.Version {
+		return ports.ErrVersionConflict
+	}
+	m.writes++
+	if len(prefs.Values) == 0 {
+		delete(m.prefs, key)
+		prefs.Version = 0
+		return nil
+	}
+	prefs.Version++
+	m.prefs[key] = *prefs
+	return nil
+}
+
+func (m *mockPreferenceRepository) ListByUser(ctx context.Context, userID domain.UserID) ([]*domain.Preferences, error) {
+	var all []*domain.Preferences
+	for _, prefs := range m.prefs {
+		if prefs.UserID == userID {
+			prefs := prefs
+			all = append(all, &prefs)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Namespace < all[j].Namespace })
+	return all, nil
+}
+
+func (m *mockPreferenceRepository) DeleteByUser(ctx context.Context, userID domain.UserID) error {
+	for key, prefs := range m.prefs {
+		if prefs.UserID == userID {
+			delete(m.prefs, key)
+		}
+	}
+	return nil
+}
+
+func newTestPreferenceService(t *testing.T, repo ports.PreferenceRepository) *service.PreferenceService {
+	t.Helper()
+	schema, err := domain.ParsePreferenceSchema([]byte(`{"namespaces": {
+		"ui": {
+			"schema": {
+				"type": "object",
+				"properties": {
+					"theme": {"enum": ["light", "dark"]},
+					"fontSize": {"type": "integer", "minimum": 8}
+				},
+				"additionalProperties": false
+			},
+			"defaults": {"theme": "light"}
+		},
+		"mobile": {"schema": {"type": "object"}}
+	}}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return service.NewPreferenceService(repo, schema)
+}
+
+func TestPreferenceService_GetPreferences_Defaults(t *testing.T) {
+	prefService := newTestPreferenceService(t, newMockPreferenceRepository())
+
+	values, err := prefService.GetPreferences(context.Background(), newID(), "ui")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(values) != 1 || values["theme"] != "light" {
+		t.Errorf("Expected the defaults, got %v", values)
+	}
+}
+
+func TestPreferenceService_ReplaceAndPatch(t *testing.T) {
+	repo := newMockPreferenceRepository()
+	prefService := newTestPreferenceService(t, repo)
+	ctx := context.Background()
+	userID := newID()
+
+	values, err := prefService.ReplacePreferences(ctx, userID, "ui", map[string]interface{}{
+		"theme":    "dark",
+		"fontSize": float64(14),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if values["theme"] != "dark" || values["fontSize"] != float64(14) {
+		t.Errorf("Expected the new settings, got %v", values)
+	}
+
+	// Null returns a setting to its default
+	values, err = prefService.PatchPreferences(ctx, userID, "ui", map[string]interface{}{"theme": nil})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if values["theme"] != "light" || values["fontSize"] != float64(14) {
+		t.Errorf("Expected the default theme and the font size kept, got %v", values)
+	}
+
+	stored, _ := repo.Get(ctx, userID, "ui")
+	if stored == nil || stored.Version != 2 {
+		t.Fatalf("Expected the preferences at version 2, got %+v", stored)
+	}
+	if _, ok := stored.Values["theme"]; ok {
+		t.Error("Expected the defaults not to be stored")
+	}
+
+	// Replacing with nothing removes the record
+	if _, err := prefService.ReplacePreferences(ctx, userID, "ui", map[string]interface{}{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored, _ := repo.Get(ctx, userID, "ui"); stored != nil {
+		t.Errorf("Expected the preferences to be removed, got %+v", stored)
+	}
+}
+
+func TestPreferenceService_Errors(t *testing.T) {
+	repo := newMockPreferenceRepository()
+	prefService := newTestPreferenceService(t, repo)
+	ctx := context.Background()
+	userID := newID()
+
+	if _, err := prefService.GetPreferences(ctx, userID, "desktop"); !errors.Is(err, service.ErrUnknownPreferenceNamespace) {
+		t.Errorf("Expected ErrUnknownPreferenceNamespace, got %v", err)
+	}
+	if _, err := prefService.PatchPreferences(ctx, userID, "desktop", map[string]interface{}{"a": 1}); !errors.Is(err, service.ErrUnknownPreferenceNamespace) {
+		t.Errorf("Expected ErrUnknownPreferenceNamespace, got %v", err)
+	}
+
+	_, err := prefService.PatchPreferences(ctx, userID, "ui", map[string]interface{}{"fontSize": float64(2)})
+	if !errors.Is(err, domain.ErrInvalidPreferences) {
+		t.Errorf("Expected ErrInvalidPreferences, got %v", err)
+	}
+	if repo.writes != 0 {
+		t.Errorf("Expected nothing to be stored, got %d writes", repo.writes)
+	}
+
+	// A deployment without a schema declares no namespaces
+	bare := service.NewPreferenceService(repo, nil)
+	if _, err := bare.GetPreferences(ctx, userID, "ui"); !errors.Is(err, service.ErrUnknownPreferenceNamespace) {
+		t.Errorf("Expected ErrUnknownPreferenceNamespace, got %v", err)
+	}
+}
+
+func TestPreferenceService_PersonalData(t *testing.T) {
+	repo := newMockPreferenceRepository()
+	prefService := newTestPreferenceService(t, repo)
+	ctx := context.Background()
+	userID := newID()
+	other := newID()
+
+	prefService.PatchPreferences(ctx, userID, "ui", map[string]interface{}{"theme": "dark"})
+	prefService.PatchPreferences(ctx, userID, "mobile", map[string]interface{}{"haptics": true})
+	prefService.PatchPreferences(ctx, other, "ui", map[string]interface{}{"theme": "dark"})
+
+	records, err := prefService.ExportUserData(ctx, userID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+
+	if err := prefService.EraseUserData(ctx, userID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if records, _ := prefService.ExportUserData(ctx, userID); len(records) != 0 {
+		t.Errorf("Expected no records after erasure, got %d", len(records))
+	}
+	if records, _ := prefService.ExportUserData(ctx, other); len(records) != 1 {
+		t.Errorf("Expected other users' preferences to be kept, got %d", len(records))
+	}
+}
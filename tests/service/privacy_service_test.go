@@ -0,0 +1,215 @@
+package service
+
+import (
+	"archive/zip"
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Mock tombstone repository for testing
+type mockTombstoneRepository struct {
+	tombstones map[domain.UserID]*domain.ErasureTombstone
+}
+
+func newMockTombstoneRepository() *mockTombstoneRepository {
+	return &mockTombstoneRepository{
+		tombstones: make(map[domain.UserID]*domain.ErasureTombstone),
+	}
+}
+
+func (m *mockTombstoneRepository) Create(ctx context.Context, tombstone *domain.ErasureTombstone) error {
+	tombstone.ID = ids.NewID()
+	m.tombstones[tombstone.UserID] = tombstone
+	return nil
+}
+
+func (m *mockTombstoneRepository) GetByUserID(ctx context.Context, userID domain.UserID) (*domain.ErasureTombstone, error) {
+	return m.tombstones[userID], nil
+}
+
+// Stub personal data store holding free-form records per user
+type stubPersonalDataStore struct {
+	records map[domain.UserID][]interface{}
+}
+
+func (s *stubPersonalDataStore) Name() string {
+	return "notes"
+}
+
+func (s *stubPersonalDataStore) ExportUserData(ctx context.Context, userID domain.UserID) ([]interface{}, error) {
+	return s.records[userID], nil
+}
+
+func (s *stubPersonalDataStore) EraseUserData(ctx context.Context, userID domain.UserID) error {
+	delete(s.records, userID)
+	return nil
+}
+
+func TestPrivacyService_ExportUserData(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	user, _ := userService.ProvisionUser(ctx, "Export User", "export@example.com", "password123", "", "")
+
+	store := &stubPersonalDataStore{
+		records: map[domain.UserID][]interface{}{
+			user.ID: {map[string]string{"note": "first"}, map[string]string{"note": "second"}},
+		},
+	}
+	privacyService := service.NewPrivacyService(repo, newMockTombstoneRepository(), store)
+
+	var archive bytes.Buffer
+	err := privacyService.ExportUserData(ctx, user.ID, &archive)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip archive, got %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, f := range reader.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	var profile domain.User
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil {
+		t.Fatalf("Expected profile.json to be valid JSON, got %v", err)
+	}
+
+	if profile.Email != "export@example.com" {
+		t.Errorf("Expected email export@example.com, got %s", profile.Email)
+	}
+
+	if strings.Contains(files["profile.json"], "password") {
+		t.Error("Expected password to be left out of the export")
+	}
+
+	if lines := strings.Split(strings.TrimSpace(files["notes.ndjson"]), "\n"); len(lines) != 2 {
+		t.Errorf("Expected 2 notes, got %d", len(lines))
+	}
+
+	if _, ok := files["manifest.json"]; !ok {
+		t.Error("Expected manifest.json in the export")
+	}
+}
+
+func TestPrivacyService_EraseUser(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	user, _ := userService.ProvisionUser(ctx, "Erase User", "erase@example.com", "", "", "")
+	adminID := newID()
+
+	store := &stubPersonalDataStore{
+		records: map[domain.UserID][]interface{}{
+			user.ID: {map[string]string{"note": "private"}},
+		},
+	}
+	privacyService := service.NewPrivacyService(repo, newMockTombstoneRepository(), store)
+
+	// Soft deleted users are erased too
+	userService.DeleteUser(ctx, user.ID)
+
+	tombstone, err := privacyService.EraseUser(ctx, user.ID, adminID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if tombstone.UserID != user.ID || tombstone.RequestedBy != adminID {
+		t.Errorf("Expected tombstone for user %s requested by %s, got %+v", user.ID.String(), adminID.String(), tombstone)
+	}
+
+	if len(tombstone.Stores) != 2 {
+		t.Errorf("Expected users and notes to be erased, got %v", tombstone.Stores)
+	}
+
+	if _, exists := repo.users[user.ID]; exists {
+		t.Error("Expected user to be removed")
+	}
+
+	if _, exists := store.records[user.ID]; exists {
+		t.Error("Expected notes to be removed")
+	}
+
+	// The email is free again
+	exists, _ := repo.EmailExists(ctx, "erase@example.com")
+	if exists {
+		t.Error("Expected email to be released")
+	}
+
+	// Erasing again returns the same tombstone
+	again, err := privacyService.EraseUser(ctx, user.ID, adminID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if again.ID != tombstone.ID {
+		t.Errorf("Expected tombstone %s, got %s", tombstone.ID, again.ID)
+	}
+
+	// Unknown users can't be erased
+	_, err = privacyService.EraseUser(ctx, newID(), adminID)
+	if !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestPrivacyService_EraseUser_Transaction(t *testing.T) {
+	repo := newMockUserRepository()
+	ctx := context.Background()
+	user, _ := service.NewUserService(repo).ProvisionUser(ctx, "Erase User", "erase@example.com", "", "", "")
+
+	transactor := &mockTransactor{err: domain.Unavailable(errors.New("commit failed"))}
+	privacyService := service.NewPrivacyService(repo, newMockTombstoneRepository()).WithTransactor(transactor)
+
+	tombstone, err := privacyService.EraseUser(ctx, user.ID, newID())
+	if domain.KindOf(err) != domain.KindUnavailable || tombstone != nil {
+		t.Errorf("Expected the commit error and no tombstone, got %v, %v", tombstone, err)
+	}
+	if transactor.calls != 1 {
+		t.Errorf("Expected 1 transaction, got %d", transactor.calls)
+	}
+}
+
+func TestPrivacyService_EraseUser_Outbox(t *testing.T) {
+	repo := newMockUserRepository()
+	outbox := memory.NewOutboxRepository()
+	ctx := context.Background()
+	user, _ := service.NewUserService(repo).WithOutbox(outbox).CreateUser(ctx, "Erase User", "erase@example.com", "password123")
+
+	privacyService := service.NewPrivacyService(repo, newMockTombstoneRepository()).WithOutbox(outbox)
+	tombstone, err := privacyService.EraseUser(ctx, user.ID, newID())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(strings.Join(tombstone.Stores, ","), "events") {
+		t.Errorf("Expected the events to be erased, got %v", tombstone.Stores)
+	}
+
+	events, _ := outbox.Unpublished(ctx, 10)
+	if len(events) != 2 || events[1].Type != domain.EventUserErased || events[1].UserID != user.ID {
+		t.Fatalf("Expected the registration followed by the erasure, got %v", events)
+	}
+	if events[0].User != nil {
+		t.Errorf("Expected the user to be removed from their registration, got %+v", events[0].User)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"backend-hexagonal/internal/adapters/search"
+	"backend-hexagonal/internal/service"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSearchService_SearchUsers(t *testing.T) {
+	index := search.NewIndex()
+	repo := search.NewIndexedRepository(newMockUserRepository(), index)
+	userService := service.NewUserService(repo)
+	searchService := service.NewSearchService(index)
+
+	ctx := context.Background()
+
+	// Writes through the repository keep the index up to date
+	user, _ := userService.ProvisionUser(ctx, "Somchai Jaidee", "somchai@gmail.com", "password123", "", "")
+	userService.ProvisionUser(ctx, "Jane Doe", "jane@example.com", "", "", "")
+
+	results, err := searchService.SearchUsers(ctx, "somchia", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != 1 || results[0].User.ID != user.ID {
+		t.Fatalf("Expected to find %s, got %d results", user.Name, len(results))
+	}
+
+	if results[0].User.Password != "" {
+		t.Error("Expected password to be left out of search results")
+	}
+
+	userService.UpdateUser(ctx, user.ID, "Somchai Rakthai", user.Email)
+
+	results, _ = searchService.SearchUsers(ctx, "rakthai", 0)
+	if len(results) != 1 {
+		t.Errorf("Expected the renamed user to be found, got %d results", len(results))
+	}
+
+	userService.DeleteUser(ctx, user.ID)
+
+	results, _ = searchService.SearchUsers(ctx, "somchai", 0)
+	if len(results) != 0 {
+		t.Errorf("Expected deleted user to be left out, got %d results", len(results))
+	}
+
+	_, err = searchService.SearchUsers(ctx, "   ", 0)
+	if !errors.Is(err, service.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery, got %v", err)
+	}
+}
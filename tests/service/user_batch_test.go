@@ -0,0 +1,232 @@
+package service
+
+import (
+	"backend-hexagonal/internal/adapters/memory"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/internal/service"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUserService_GetUsers(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+	ctx := context.Background()
+
+	john, _ := userService.CreateUser(ctx, "John Doe", "john@example.com", "password123")
+	jane, _ := userService.CreateUser(ctx, "Jane Doe", "jane@example.com", "password123")
+	deleted, _ := userService.CreateUser(ctx, "Gone", "gone@example.com", "password123")
+	userService.DeleteUser(ctx, deleted.ID)
+	missing := newID()
+
+	results, err := userService.GetUsers(ctx, []domain.UserID{jane.ID, missing, john.ID, deleted.ID})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+
+	// Results follow the order of the request
+	if results[0].User == nil || results[0].User.Email != "jane@example.com" {
+		t.Errorf("Expected Jane first, got %+v", results[0])
+	}
+	if results[2].User == nil || results[2].User.Email != "john@example.com" {
+		t.Errorf("Expected John third, got %+v", results[2])
+	}
+	for _, i := range []int{1, 3} {
+		if !errors.Is(results[i].Err, service.ErrUserNotFound) || results[i].User != nil {
+			t.Errorf("Expected result %d to be not found, got %+v", i, results[i])
+		}
+	}
+}
+
+func TestUserService_GetUsers_InvalidBatch(t *testing.T) {
+	userService := service.NewUserService(newMockUserRepository())
+	ctx := context.Background()
+
+	id := newID()
+	if _, err := userService.GetUsers(ctx, []domain.UserID{id, id}); !errors.Is(err, service.ErrInvalidBatch) {
+		t.Errorf("Expected ErrInvalidBatch for a repeated ID, got %v", err)
+	}
+
+	ids := make([]domain.UserID, service.MaxBatchSize+1)
+	for i := range ids {
+		ids[i] = newID()
+	}
+	if _, err := userService.GetUsers(ctx, ids); !errors.Is(err, service.ErrInvalidBatch) {
+		t.Errorf("Expected ErrInvalidBatch for %d IDs, got %v", len(ids), err)
+	}
+	if _, err := userService.DeleteUsers(ctx, []service.UserDelete{{ID: id}, {ID: id}}); !errors.Is(err, service.ErrInvalidBatch) {
+		t.Errorf("Expected ErrInvalidBatch for a repeated delete, got %v", err)
+	}
+}
+
+func TestUserService_PatchUsers(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+	ctx := context.Background()
+
+	john, _ := userService.CreateUser(ctx, "John Doe", "john@example.com", "password123")
+	jane, _ := userService.CreateUser(ctx, "Jane Doe", "jane@example.com", "password123")
+	bob, _ := userService.CreateUser(ctx, "Bob", "bob@example.com", "password123")
+	alice, _ := userService.CreateUser(ctx, "Alice", "alice@example.com", "password123")
+	userService.CreateUser(ctx, "Taken", "taken@example.com", "password123")
+	eve, _ := userService.CreateUser(ctx, "Eve", "eve@example.com", "password123")
+	missing := newID()
+
+	results, err := userService.PatchUsers(ctx, []service.UserUpdate{
+		{ID: john.ID, Patch: domain.UserPatch{Name: strPtr("Johnny"), Version: 1}},
+		{ID: jane.ID, Patch: domain.UserPatch{Email: strPtr("new@example.com")}},
+		{ID: bob.ID, Patch: domain.UserPatch{Email: strPtr("new@example.com")}},
+		{ID: alice.ID, Patch: domain.UserPatch{Name: strPtr("Alicia"), Version: 7}},
+		{ID: missing, Patch: domain.UserPatch{Name: strPtr("Nobody")}},
+		{ID: eve.ID, Patch: domain.UserPatch{Email: strPtr("taken@example.com")}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []error{nil, nil, service.ErrUserExists, ports.ErrVersionConflict, service.ErrUserNotFound, service.ErrUserExists}
+	for i, r := range results {
+		if !errors.Is(r.Err, want[i]) {
+			t.Errorf("Result %d: expected %v, got %v", i, want[i], r.Err)
+		}
+	}
+
+	if results[0].User == nil || results[0].User.Name != "Johnny" || results[0].User.Version != 2 {
+		t.Errorf("Expected Johnny at version 2, got %+v", results[0].User)
+	}
+	if results[1].User == nil || results[1].User.Email != "new@example.com" {
+		t.Errorf("Expected Jane's new email, got %+v", results[1].User)
+	}
+
+	// Failed items change nothing
+	unchanged, _ := repo.GetByID(ctx, alice.ID)
+	if unchanged.Name != "Alice" || unchanged.Version != 1 {
+		t.Errorf("Expected Alice to be unchanged, got %s at version %d", unchanged.Name, unchanged.Version)
+	}
+	unchanged, _ = repo.GetByID(ctx, bob.ID)
+	if unchanged.Email != "bob@example.com" {
+		t.Errorf("Expected Bob's email to be unchanged, got %s", unchanged.Email)
+	}
+}
+
+func TestUserService_PatchUsers_ValidatesEachPatch(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+	ctx := context.Background()
+
+	john, _ := userService.CreateUser(ctx, "John Doe", "john@example.com", "password123")
+	jane, _ := userService.CreateUser(ctx, "Jane Doe", "jane@example.com", "password123")
+
+	results, err := userService.PatchUsers(ctx, []service.UserUpdate{
+		{ID: john.ID, Patch: domain.UserPatch{Name: strPtr("  ")}},
+		{ID: jane.ID, Patch: domain.UserPatch{}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !errors.Is(results[0].Err, domain.ErrInvalidUser) {
+		t.Errorf("Expected ErrInvalidUser, got %v", results[0].Err)
+	}
+	// An empty patch succeeds without a write
+	if results[1].Err != nil || results[1].User == nil || results[1].User.Version != 1 {
+		t.Errorf("Expected Jane unchanged at version 1, got %+v", results[1])
+	}
+}
+
+func TestUserService_DeleteUsers(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+	ctx := context.Background()
+
+	john, _ := userService.CreateUser(ctx, "John Doe", "john@example.com", "password123")
+	jane, _ := userService.CreateUser(ctx, "Jane Doe", "jane@example.com", "password123")
+	bob, _ := userService.CreateUser(ctx, "Bob", "bob@example.com", "password123")
+	missing := newID()
+
+	results, err := userService.DeleteUsers(ctx, []service.UserDelete{
+		{ID: john.ID},
+		{ID: jane.ID, ExpectedVersion: 1},
+		{ID: bob.ID, ExpectedVersion: 5},
+		{ID: missing},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []error{nil, nil, ports.ErrVersionConflict, service.ErrUserNotFound}
+	for i, r := range results {
+		if !errors.Is(r.Err, want[i]) {
+			t.Errorf("Result %d: expected %v, got %v", i, want[i], r.Err)
+		}
+	}
+
+	for _, id := range []domain.UserID{john.ID, jane.ID} {
+		if user, _ := repo.GetByID(ctx, id); user != nil {
+			t.Errorf("Expected user %s to be deleted", id.String())
+		}
+	}
+	if user, _ := repo.GetByID(ctx, bob.ID); user == nil {
+		t.Error("Expected Bob to be kept")
+	}
+
+	// Deleted users can be restored like any other
+	if _, err := userService.RestoreUser(ctx, john.ID); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestUserService_PatchUsers_Events(t *testing.T) {
+	repo := newMockUserRepository()
+	outbox := memory.NewOutboxRepository()
+	transactor := &mockTransactor{}
+	userService := service.NewUserService(repo).WithTransactor(transactor).WithOutbox(outbox)
+	ctx := context.Background()
+
+	john, _ := userService.CreateUser(ctx, "John Doe", "john@example.com", "password123")
+	jane, _ := userService.CreateUser(ctx, "Jane Doe", "jane@example.com", "password123")
+	bob, _ := userService.CreateUser(ctx, "Bob", "bob@example.com", "password123")
+	registered, _ := outbox.Unpublished(ctx, 10)
+	calls := transactor.calls
+
+	results, err := userService.PatchUsers(ctx, []service.UserUpdate{
+		{ID: john.ID, Patch: domain.UserPatch{Name: strPtr("Johnny")}},
+		{ID: jane.ID, Patch: domain.UserPatch{Password: strPtr("new-password")}},
+		{ID: bob.ID, Patch: domain.UserPatch{Name: strPtr("Robert"), Version: 9}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || !errors.Is(results[2].Err, ports.ErrVersionConflict) {
+		t.Fatalf("Expected John and Jane patched and Bob in conflict, got %+v", results)
+	}
+	if transactor.calls != calls+1 {
+		t.Errorf("Expected the batch in one transaction, got %d", transactor.calls-calls)
+	}
+
+	events, _ := outbox.Unpublished(ctx, 10)
+	events = events[len(registered):]
+	types := make(map[domain.UserID][]domain.EventType)
+	for _, event := range events {
+		types[event.UserID] = append(types[event.UserID], event.Type)
+	}
+	if len(events) != 3 || len(types[john.ID]) != 1 || len(types[jane.ID]) != 2 || len(types[bob.ID]) != 0 {
+		t.Errorf("Expected an update of John and an update and password change of Jane, got %v", types)
+	}
+	for _, event := range events {
+		if event.Type == domain.EventUserUpdated && (event.User == nil || event.User.Version != 2) {
+			t.Errorf("Expected the updated event to carry the user at version 2, got %+v", event.User)
+		}
+	}
+
+	// A failed transaction fails the batch
+	transactor.err = errors.New("commit failed")
+	if _, err := userService.PatchUsers(ctx, []service.UserUpdate{{ID: john.ID, Patch: domain.UserPatch{Name: strPtr("John")}}}); err == nil {
+		t.Error("Expected the failed transaction to fail the batch")
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/service"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockChangeStream hands each Watch the next of its batches of changes,
+// then fails, or waits for the context once the batches run out
+type mockChangeStream struct {
+	mu      sync.Mutex
+	batches [][]domain.UserChange
+	watches int
+}
+
+func (m *mockChangeStream) Watch(ctx context.Context, fn func(domain.UserChange) error) error {
+	m.mu.Lock()
+	m.watches++
+	if len(m.batches) == 0 {
+		m.mu.Unlock()
+		<-ctx.Done()
+		return nil
+	}
+	batch := m.batches[0]
+	m.batches = m.batches[1:]
+	m.mu.Unlock()
+
+	for _, change := range batch {
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection lost")
+}
+
+func userChange(changeType domain.ChangeType) domain.UserChange {
+	return domain.UserChange{Type: changeType, UserID: newID(), OccurredAt: time.Now()}
+}
+
+func TestUserChangeBus_Publish(t *testing.T) {
+	bus := service.NewUserChangeBus()
+	var handled []domain.UserChange
+	bus.Handle(func(change domain.UserChange) {
+		handled = append(handled, change)
+	})
+	subscription := bus.Subscribe(2)
+
+	created := userChange(domain.ChangeCreated)
+	updated := userChange(domain.ChangeUpdated)
+	bus.Publish(created)
+	bus.Publish(updated)
+
+	if len(handled) != 2 || handled[0].UserID != created.UserID || handled[1].UserID != updated.UserID {
+		t.Errorf("Expected both changes handled in order, got %+v", handled)
+	}
+	for _, want := range []domain.UserChange{created, updated} {
+		if got := <-subscription.C; got.UserID != want.UserID {
+			t.Errorf("Expected the change of %s, got %s", want.UserID.String(), got.UserID.String())
+		}
+	}
+
+	// Closing ends the subscription without an error, and can be repeated
+	subscription.Close()
+	subscription.Close()
+	if _, ok := <-subscription.C; ok {
+		t.Error("Expected the channel to be closed")
+	}
+	if err := subscription.Err(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	bus.Publish(userChange(domain.ChangeDeleted))
+	if len(handled) != 3 {
+		t.Errorf("Expected handlers to get changes after the close, got %d", len(handled))
+	}
+}
+
+func TestUserChangeBus_Lagged(t *testing.T) {
+	bus := service.NewUserChangeBus()
+	slow := bus.Subscribe(1)
+	fast := bus.Subscribe(3)
+
+	for i := 0; i < 3; i++ {
+		bus.Publish(userChange(domain.ChangeUpdated))
+	}
+
+	// The slow subscriber keeps what it had, then learns it fell behind
+	if _, ok := <-slow.C; !ok {
+		t.Fatal("Expected the buffered change before the end")
+	}
+	if _, ok := <-slow.C; ok {
+		t.Fatal("Expected the lagging subscription to be ended")
+	}
+	if !errors.Is(slow.Err(), service.ErrSubscriptionLagged) {
+		t.Errorf("Expected ErrSubscriptionLagged, got %v", slow.Err())
+	}
+
+	// Without holding back the others
+	if len(fast.C) != 3 || fast.Err() != nil {
+		t.Errorf("Expected 3 changes for the fast subscriber, got %d", len(fast.C))
+	}
+}
+
+func TestUserChangeBus_Run(t *testing.T) {
+	stream := &mockChangeStream{batches: [][]domain.UserChange{
+		{userChange(domain.ChangeCreated)},
+		{userChange(domain.ChangeUpdated), userChange(domain.ChangeDeleted)},
+	}}
+	bus := service.NewUserChangeBus()
+	subscription := bus.Subscribe(10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bus.Run(ctx, stream, time.Millisecond)
+		close(done)
+	}()
+
+	// The stream is watched again after each failure
+	for _, want := range []domain.ChangeType{domain.ChangeCreated, domain.ChangeUpdated, domain.ChangeDeleted} {
+		select {
+		case change := <-subscription.C:
+			if change.Type != want {
+				t.Errorf("Expected a %s change, got %s", want, change.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a %s change", want)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once the context is done")
+	}
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.watches < 2 {
+		t.Errorf("Expected a watch per batch, got %d", stream.watches)
+	}
+}
@@ -1,71 +1,341 @@
 package service
 
 import (
+	"backend-hexagonal/internal/adapters/ids"
+	"backend-hexagonal/internal/adapters/memory"
 	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
 	"backend-hexagonal/internal/service"
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 // Mock repository for testing
 type mockUserRepository struct {
-	users map[primitive.ObjectID]*domain.User
+	users map[domain.UserID]*domain.User
 }
 
+// newID returns a fresh user ID
+var newID = ids.NewObjectIDGenerator().NewUserID
+
 func newMockUserRepository() *mockUserRepository {
 	return &mockUserRepository{
-		users: make(map[primitive.ObjectID]*domain.User),
+		users: make(map[domain.UserID]*domain.User),
 	}
 }
 
 func (m *mockUserRepository) Create(ctx context.Context, user *domain.User) error {
-	user.ID = primitive.NewObjectID()
-	m.users[user.ID] = user
+	// Like the unique index on email
+	if exists, _ := m.EmailExists(ctx, user.Email); exists {
+		return ports.ErrEmailTaken
+	}
+	user.ID = newID()
+	user.Version = 1
+	// Store a copy so callers mutating the user afterwards don't change it
+	stored := *user
+	m.users[user.ID] = &stored
 	return nil
 }
 
-func (m *mockUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*domain.User, error) {
+func (m *mockUserRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
 	user, exists := m.users[id]
-	if !exists {
-		return nil, nil
+	if !exists || user.IsDeleted() {
+		return nil, ports.ErrNotFound
 	}
-	return user, nil
+	// Return a copy like a real database would
+	found := *user
+	return &found, nil
+}
+
+func (m *mockUserRepository) GetByIDs(ctx context.Context, ids []domain.UserID) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, id := range ids {
+		if user, _ := m.GetByID(ctx, id); user != nil {
+			users = append(users, user)
+		}
+	}
+	return users, nil
 }
 
 func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	for _, user := range m.users {
-		if user.Email == email {
+		if user.Email == email && !user.IsDeleted() {
 			return user, nil
 		}
 	}
-	return nil, nil
+	return nil, ports.ErrNotFound
 }
 
 func (m *mockUserRepository) GetAll(ctx context.Context) ([]*domain.User, error) {
 	var users []*domain.User
 	for _, user := range m.users {
-		users = append(users, user)
+		if !user.IsDeleted() {
+			users = append(users, user)
+		}
 	}
 	return users, nil
 }
 
-func (m *mockUserRepository) Update(ctx context.Context, id primitive.ObjectID, user *domain.User) error {
+func (m *mockUserRepository) Each(ctx context.Context, fn func(*domain.User) error) error {
+	users, _ := m.GetAll(ctx)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.String() < users[j].ID.String() })
+	for _, user := range users {
+		found := *user
+		if err := fn(&found); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) List(ctx context.Context, query ports.UserQuery) (*ports.UserPage, error) {
+	var users []*domain.User
+	for _, user := range m.users {
+		if user.IsDeleted() {
+			continue
+		}
+		if query.EmailPrefix != "" && !strings.HasPrefix(strings.ToLower(user.Email), strings.ToLower(query.EmailPrefix)) {
+			continue
+		}
+		if query.NameContains != "" && !strings.Contains(strings.ToLower(user.Name), strings.ToLower(query.NameContains)) {
+			continue
+		}
+		if query.CreatedAfter != nil && user.CreatedAt.Before(*query.CreatedAfter) {
+			continue
+		}
+		if query.CreatedBefore != nil && !user.CreatedAt.Before(*query.CreatedBefore) {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	// Users sort by the same key their page tokens hold
+	before := func(a, b *ports.Cursor) bool {
+		if a.Value == b.Value {
+			a, b = &ports.Cursor{Value: a.ID}, &ports.Cursor{Value: b.ID}
+		}
+		if query.Descending {
+			return a.Value > b.Value
+		}
+		return a.Value < b.Value
+	}
+	key := func(user *domain.User) *ports.Cursor {
+		return ports.CursorAfter(query, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return before(key(users[i]), key(users[j])) })
+
+	page := &ports.UserPage{Total: int64(len(users))}
+
+	start := query.Offset
+	if query.Cursor != "" {
+		cursor, err := ports.DecodeCursor(query)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(users), func(i int) bool { return before(cursor, key(users[i])) })
+	}
+	if start > len(users) {
+		start = len(users)
+	}
+
+	end := start + query.Limit
+	if end < len(users) {
+		page.NextCursor = ports.CursorAfter(query, users[end-1]).Encode()
+	} else {
+		end = len(users)
+	}
+	page.Users = users[start:end]
+	return page, nil
+}
+
+func (m *mockUserRepository) Update(ctx context.Context, id domain.UserID, user *domain.User) error {
 	existing, exists := m.users[id]
-	if !exists {
-		return nil
+	if !exists || existing.IsDeleted() {
+		return ports.ErrNotFound
 	}
 	existing.Name = user.Name
 	existing.Email = user.Email
+	existing.Version++
 	return nil
 }
 
-func (m *mockUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	delete(m.users, id)
+func (m *mockUserRepository) Patch(ctx context.Context, id domain.UserID, patch domain.UserPatch) (*domain.User, error) {
+	existing, exists := m.users[id]
+	if !exists || existing.IsDeleted() {
+		return nil, ports.ErrNotFound
+	}
+	if patch.Version != 0 && patch.Version != existing.Version {
+		return nil, ports.ErrVersionConflict
+	}
+	if patch.IsEmpty() {
+		return m.GetByID(ctx, id)
+	}
+	if patch.Name != nil {
+		existing.Name = *patch.Name
+	}
+	if patch.Email != nil && *patch.Email != existing.Email {
+		if exists, _ := m.EmailExists(ctx, *patch.Email); exists {
+			return nil, ports.ErrEmailTaken
+		}
+		existing.Email = *patch.Email
+	}
+	profile := []struct{ value, field *string }{
+		{patch.DisplayName, &existing.DisplayName},
+		{patch.Locale, &existing.Locale},
+		{patch.Timezone, &existing.Timezone},
+		{patch.Phone, &existing.Phone},
+		{patch.Bio, &existing.Bio},
+	}
+	for _, p := range profile {
+		if p.value != nil {
+			*p.field = *p.value
+		}
+	}
+	if patch.Password != nil {
+		existing.Password = *patch.Password
+	}
+	for name, value := range patch.Attributes {
+		if existing.Attributes == nil {
+			existing.Attributes = make(map[string]interface{})
+		}
+		if value == nil {
+			delete(existing.Attributes, name)
+		} else {
+			existing.Attributes[name] = value
+		}
+	}
+	existing.Version++
+	return m.GetByID(ctx, id)
+}
+
+func (m *mockUserRepository) PatchMany(ctx context.Context, patches map[domain.UserID]domain.UserPatch) ([]domain.UserID, error) {
+	var changed []domain.UserID
+	for id, patch := range patches {
+		if patch.IsEmpty() {
+			continue
+		}
+		if user, err := m.Patch(ctx, id, patch); err == nil && user != nil {
+			changed = append(changed, id)
+		}
+	}
+	return changed, nil
+}
+
+func (m *mockUserRepository) UpdateStatus(ctx context.Context, id domain.UserID, user *domain.User) (*domain.User, error) {
+	existing, exists := m.users[id]
+	if !exists || existing.IsDeleted() {
+		return nil, ports.ErrNotFound
+	}
+	if user.Version != 0 && user.Version != existing.Version {
+		return nil, ports.ErrVersionConflict
+	}
+	existing.Status = user.Status
+	existing.StatusReason = user.StatusReason
+	existing.StatusChangedAt = user.StatusChangedAt
+	existing.Version++
+	return m.GetByID(ctx, id)
+}
+
+func (m *mockUserRepository) SetAvatar(ctx context.Context, id domain.UserID, avatar *domain.Avatar) (*domain.User, error) {
+	existing, exists := m.users[id]
+	if !exists || existing.IsDeleted() {
+		return nil, ports.ErrNotFound
+	}
+	existing.Avatar = avatar
+	existing.Version++
+	return m.GetByID(ctx, id)
+}
+
+func (m *mockUserRepository) Delete(ctx context.Context, id domain.UserID, expectedVersion int64) error {
+	existing, exists := m.users[id]
+	if !exists || existing.IsDeleted() {
+		return ports.ErrNotFound
+	}
+	if expectedVersion != 0 && expectedVersion != existing.Version {
+		return ports.ErrVersionConflict
+	}
+	now := time.Now()
+	existing.DeletedAt = &now
+	existing.Version++
 	return nil
 }
 
+func (m *mockUserRepository) DeleteMany(ctx context.Context, expectedVersions map[domain.UserID]int64) ([]domain.UserID, error) {
+	var deleted []domain.UserID
+	for id, version := range expectedVersions {
+		if user, _ := m.GetByID(ctx, id); user == nil {
+			continue
+		}
+		if err := m.Delete(ctx, id, version); err == nil {
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, nil
+}
+
+func (m *mockUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockUserRepository) AttributeExists(ctx context.Context, name string, value interface{}, exceptID domain.UserID) (bool, error) {
+	for id, user := range m.users {
+		if id != exceptID && user.Attributes[name] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockUserRepository) GetDeleted(ctx context.Context) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, user := range m.users {
+		if user.IsDeleted() {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *mockUserRepository) Restore(ctx context.Context, id domain.UserID) error {
+	existing, exists := m.users[id]
+	if !exists || !existing.IsDeleted() {
+		return ports.ErrNotFound
+	}
+	existing.DeletedAt = nil
+	existing.Version++
+	return nil
+}
+
+func (m *mockUserRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	for id, user := range m.users {
+		if user.IsDeleted() && user.DeletedAt.Before(deletedBefore) {
+			delete(m.users, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *mockUserRepository) Erase(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, exists := m.users[id]
+	if !exists {
+		return nil, ports.ErrNotFound
+	}
+	delete(m.users, id)
+	return user, nil
+}
+
 func TestUserService_CreateUser(t *testing.T) {
 	repo := newMockUserRepository()
 	userService := service.NewUserService(repo)
@@ -98,6 +368,26 @@ func TestUserService_CreateUser(t *testing.T) {
 	}
 }
 
+func TestUserService_CreateUser_EmailTaken(t *testing.T) {
+	userService := service.NewUserService(newMockUserRepository())
+	ctx := context.Background()
+
+	userService.CreateUser(ctx, "John Doe", "john@example.com", "password123")
+
+	// The repository rejects the write, as the unique index does when two
+	// sign-ups race past the existence check
+	_, err := userService.CreateUser(ctx, "John Again", "John@Example.com", "password123")
+	if !errors.Is(err, service.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+
+	jane, _ := userService.CreateUser(ctx, "Jane Doe", "jane@example.com", "password123")
+	_, err = userService.PatchUser(ctx, jane.ID, domain.UserPatch{Email: strPtr("JOHN@example.com")})
+	if !errors.Is(err, service.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists for a patch, got %v", err)
+	}
+}
+
 func TestUserService_GetUserByID(t *testing.T) {
 	repo := newMockUserRepository()
 	userService := service.NewUserService(repo)
@@ -115,7 +405,7 @@ func TestUserService_GetUserByID(t *testing.T) {
 	}
 
 	if user.ID != createdUser.ID {
-		t.Errorf("Expected ID %s, got %s", createdUser.ID.Hex(), user.ID.Hex())
+		t.Errorf("Expected ID %s, got %s", createdUser.ID.String(), user.ID.String())
 	}
 
 	if user.Name != "Jane Doe" {
@@ -192,3 +482,515 @@ func TestUserService_DeleteUser(t *testing.T) {
 		t.Error("Expected user to be deleted, but it still exists")
 	}
 }
+
+func TestUserService_ChangeUserStatus(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	createdUser, _ := userService.CreateUser(ctx, "Status User", "status@example.com", "password123")
+
+	// Suspend the user
+	suspendedUser, err := userService.SuspendUser(ctx, createdUser.ID, "Abuse report")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if suspendedUser.Status != domain.UserStatusSuspended {
+		t.Errorf("Expected status suspended, got %s", suspendedUser.Status)
+	}
+
+	if suspendedUser.StatusReason != "Abuse report" {
+		t.Errorf("Expected reason Abuse report, got %s", suspendedUser.StatusReason)
+	}
+
+	if suspendedUser.StatusChangedAt == nil {
+		t.Error("Expected status change time to be recorded")
+	}
+
+	// Suspending twice is not a valid transition
+	_, err = userService.SuspendUser(ctx, createdUser.ID, "")
+	if !errors.Is(err, service.ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition, got %v", err)
+	}
+
+	// Reactivate the user
+	reactivatedUser, err := userService.ReactivateUser(ctx, createdUser.ID, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !reactivatedUser.IsActive() {
+		t.Errorf("Expected user to be active, got %s", reactivatedUser.Status)
+	}
+}
+
+// racingRepository changes the status of the users it reads right after
+// reading them, as a concurrent request would
+type racingRepository struct {
+	ports.UserRepository
+	status domain.UserStatus
+}
+
+func (r *racingRepository) GetByID(ctx context.Context, id domain.UserID) (*domain.User, error) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err == nil {
+		r.UserRepository.UpdateStatus(ctx, id, &domain.User{Status: r.status})
+	}
+	return user, err
+}
+
+func TestUserService_ChangeUserStatus_Concurrent(t *testing.T) {
+	repo := memory.NewUserRepository(ids.NewObjectIDGenerator())
+	ctx := context.Background()
+	createdUser, err := service.NewUserService(repo).CreateUser(ctx, "Racing User", "racing@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Deactivated accounts can't be suspended, so the suspension checked
+	// against the active user must not land
+	racing := &racingRepository{UserRepository: repo, status: domain.UserStatusDeactivated}
+	_, err = service.NewUserService(racing).SuspendUser(ctx, createdUser.ID, "Abuse report")
+	if !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	stored, _ := repo.GetByID(ctx, createdUser.ID)
+	if stored.Status != domain.UserStatusDeactivated {
+		t.Errorf("Expected the user to stay deactivated, got %s", stored.Status)
+	}
+
+	// The version returned is the one stored
+	reactivated, err := service.NewUserService(repo).ReactivateUser(ctx, createdUser.ID, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored, _ = repo.GetByID(ctx, createdUser.ID)
+	if reactivated.Version != stored.Version {
+		t.Errorf("Expected version %d, got %d", stored.Version, reactivated.Version)
+	}
+}
+
+func TestUserService_RestoreUser(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	createdUser, _ := userService.CreateUser(ctx, "To Restore", "restore@example.com", "password123")
+
+	err := userService.DeleteUser(ctx, createdUser.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Deleted users are only listed as deleted
+	users, _ := userService.GetAllUsers(ctx)
+	if len(users) != 0 {
+		t.Errorf("Expected 0 users, got %d", len(users))
+	}
+
+	deletedUsers, _ := userService.GetDeletedUsers(ctx)
+	if len(deletedUsers) != 1 {
+		t.Fatalf("Expected 1 deleted user, got %d", len(deletedUsers))
+	}
+
+	// Restore the user
+	restoredUser, err := userService.RestoreUser(ctx, createdUser.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if restoredUser == nil || restoredUser.IsDeleted() {
+		t.Fatal("Expected user to be restored")
+	}
+
+	// Restoring a user that isn't deleted fails
+	_, err = userService.RestoreUser(ctx, createdUser.ID)
+	if err == nil {
+		t.Error("Expected error restoring a user that isn't deleted")
+	}
+}
+
+func TestUserService_PurgeDeletedUsers(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	oldUser, _ := userService.ProvisionUser(ctx, "Old", "old@example.com", "", "", "")
+	recentUser, _ := userService.ProvisionUser(ctx, "Recent", "recent@example.com", "", "", "")
+
+	userService.DeleteUser(ctx, oldUser.ID)
+	userService.DeleteUser(ctx, recentUser.ID)
+
+	// Backdate the first deletion past the retention window
+	deletedAt := time.Now().Add(-48 * time.Hour)
+	repo.users[oldUser.ID].DeletedAt = &deletedAt
+
+	// The email stays taken until the user is purged
+	_, err := userService.ProvisionUser(ctx, "Old Again", "old@example.com", "", "", "")
+	if !errors.Is(err, service.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+
+	purged, err := userService.PurgeDeletedUsers(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if purged != 1 {
+		t.Errorf("Expected 1 user purged, got %d", purged)
+	}
+
+	deletedUsers, _ := userService.GetDeletedUsers(ctx)
+	if len(deletedUsers) != 1 || deletedUsers[0].ID != recentUser.ID {
+		t.Errorf("Expected only the recently deleted user to remain, got %v", deletedUsers)
+	}
+
+	// The purged email can be registered again
+	_, err = userService.ProvisionUser(ctx, "Old Again", "old@example.com", "", "", "")
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestUserService_ListUsers(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		userService.CreateUser(ctx, fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), "password123")
+	}
+	userService.CreateUser(ctx, "Other", "other@example.org", "password123")
+
+	// Walk the filtered users two at a time
+	query := ports.UserQuery{Limit: 2, SortBy: ports.SortByEmail, Descending: true, EmailPrefix: "USER"}
+
+	var emails []string
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("Expected 3 pages")
+		}
+
+		page, err := userService.ListUsers(ctx, query)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if page.Total != 5 {
+			t.Errorf("Expected total 5, got %d", page.Total)
+		}
+
+		for _, user := range page.Users {
+			emails = append(emails, user.Email)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	expected := "user4@example.com,user3@example.com,user2@example.com,user1@example.com,user0@example.com"
+	if got := strings.Join(emails, ","); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// Page tokens can't be reused with a different sort order
+	query.Descending = false
+	_, err := userService.ListUsers(ctx, query)
+	if !errors.Is(err, ports.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestUserService_ListUsers_InvalidQuery(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	_, err := userService.ListUsers(ctx, ports.UserQuery{SortBy: "password"})
+	if !errors.Is(err, service.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for an unknown sort field, got %v", err)
+	}
+
+	now := time.Now()
+	_, err = userService.ListUsers(ctx, ports.UserQuery{CreatedAfter: &now, CreatedBefore: &now})
+	if !errors.Is(err, service.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for an empty range, got %v", err)
+	}
+
+	// Defaults apply to an empty query
+	page, err := userService.ListUsers(ctx, ports.UserQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if page.Users == nil || len(page.Users) != 0 {
+		t.Errorf("Expected an empty page, got %v", page.Users)
+	}
+}
+
+func TestUserService_PatchUser(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	createdUser, _ := userService.CreateUser(ctx, "Patch Me", "patch@example.com", "password123")
+	userService.CreateUser(ctx, "Taken", "taken@example.com", "password123")
+
+	// Only the supplied field changes
+	name := "Patched"
+	patchedUser, err := userService.PatchUser(ctx, createdUser.ID, domain.UserPatch{Name: &name})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if patchedUser.Name != "Patched" {
+		t.Errorf("Expected name Patched, got %s", patchedUser.Name)
+	}
+
+	if patchedUser.Email != "patch@example.com" {
+		t.Errorf("Expected email to be unchanged, got %s", patchedUser.Email)
+	}
+
+	tests := []struct {
+		name  string
+		patch domain.UserPatch
+		want  error
+	}{
+		{"blank name", domain.UserPatch{Name: strPtr("  ")}, domain.ErrInvalidUser},
+		{"invalid email", domain.UserPatch{Email: strPtr("not-an-email")}, domain.ErrInvalidUser},
+		{"display name email", domain.UserPatch{Email: strPtr("Jane <jane@example.com>")}, domain.ErrInvalidUser},
+		{"taken email", domain.UserPatch{Email: strPtr("taken@example.com")}, service.ErrUserExists},
+	}
+
+	for _, tt := range tests {
+		_, err := userService.PatchUser(ctx, createdUser.ID, tt.patch)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Rejected patches change nothing
+	user, _ := userService.GetUserByID(ctx, createdUser.ID)
+	if user.Name != "Patched" || user.Email != "patch@example.com" {
+		t.Errorf("Expected user to be unchanged, got %s <%s>", user.Name, user.Email)
+	}
+
+	_, err = userService.PatchUser(ctx, newID(), domain.UserPatch{Name: &name})
+	if !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUserService_Versions(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	createdUser, _ := userService.CreateUser(ctx, "Versioned", "versioned@example.com", "password123")
+	if createdUser.Version != 1 {
+		t.Fatalf("Expected a new user at version 1, got %d", createdUser.Version)
+	}
+
+	// Each write increments the version
+	patchedUser, err := userService.PatchUser(ctx, createdUser.ID, domain.UserPatch{Name: strPtr("First"), Version: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if patchedUser.Version != 2 {
+		t.Errorf("Expected version 2, got %d", patchedUser.Version)
+	}
+
+	suspendedUser, err := userService.SuspendUser(ctx, createdUser.ID, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if suspendedUser.Version != 3 {
+		t.Errorf("Expected version 3, got %d", suspendedUser.Version)
+	}
+
+	// A write based on a stale read loses instead of overwriting
+	_, err = userService.PatchUser(ctx, createdUser.ID, domain.UserPatch{Name: strPtr("Second"), Version: 2})
+	if !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	err = userService.DeleteUserAtVersion(ctx, createdUser.ID, 2)
+	if !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	user, _ := userService.GetUserByID(ctx, createdUser.ID)
+	if user == nil || user.Name != "First" {
+		t.Fatalf("Expected the user to be unchanged, got %v", user)
+	}
+
+	if err := userService.DeleteUserAtVersion(ctx, createdUser.ID, 3); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestUserService_DeleteUser_Missing(t *testing.T) {
+	repo := newMockUserRepository()
+	outbox := memory.NewOutboxRepository()
+	userService := service.NewUserService(repo).WithOutbox(outbox)
+	ctx := context.Background()
+
+	user, _ := userService.CreateUser(ctx, "Deleted Once", "once@example.com", "password123")
+	if err := userService.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Deleting again, or a user who never existed, finds nobody to delete
+	for _, id := range []domain.UserID{user.ID, newID()} {
+		if err := userService.DeleteUser(ctx, id); !errors.Is(err, service.ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+	}
+
+	events, _ := outbox.Unpublished(ctx, 10)
+	deletes := 0
+	for _, event := range events {
+		if event.Type == domain.EventUserDeleted {
+			deletes++
+		}
+	}
+	if deletes != 1 {
+		t.Errorf("Expected one deleted event, got %d", deletes)
+	}
+}
+
+func TestUserService_PatchUser_Profile(t *testing.T) {
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo)
+
+	ctx := context.Background()
+
+	createdUser, _ := userService.CreateUser(ctx, "Profile", "profile@example.com", "password123")
+
+	patchedUser, err := userService.PatchUser(ctx, createdUser.ID, domain.UserPatch{
+		DisplayName: strPtr("Pro"),
+		Locale:      strPtr("th-TH"),
+		Timezone:    strPtr("Asia/Bangkok"),
+		Phone:       strPtr("+66812345678"),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if patchedUser.DisplayName != "Pro" || patchedUser.Locale != "th-TH" || patchedUser.Timezone != "Asia/Bangkok" || patchedUser.Phone != "+66812345678" {
+		t.Errorf("Expected the profile to be set, got %+v", patchedUser.Profile)
+	}
+
+	// Empty values clear optional fields
+	patchedUser, err = userService.PatchUser(ctx, createdUser.ID, domain.UserPatch{Phone: strPtr("")})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if patchedUser.Phone != "" || patchedUser.Locale != "th-TH" {
+		t.Errorf("Expected only the phone to be cleared, got %+v", patchedUser.Profile)
+	}
+
+	tests := []struct {
+		name  string
+		patch domain.UserPatch
+	}{
+		{"invalid locale", domain.UserPatch{Locale: strPtr("not a locale")}},
+		{"unknown timezone", domain.UserPatch{Timezone: strPtr("Mars/Olympus_Mons")}},
+		{"local timezone", domain.UserPatch{Timezone: strPtr("Local")}},
+		{"phone without country code", domain.UserPatch{Phone: strPtr("0812345678")}},
+		{"long bio", domain.UserPatch{Bio: strPtr(strings.Repeat("a", domain.MaxBioLength+1))}},
+		{"undeclared attribute", domain.UserPatch{Attributes: map[string]interface{}{"employeeId": "E1"}}},
+	}
+
+	for _, tt := range tests {
+		_, err := userService.PatchUser(ctx, createdUser.ID, tt.patch)
+		if !errors.Is(err, domain.ErrInvalidUser) {
+			t.Errorf("%s: expected ErrInvalidUser, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestUserService_PatchUser_Attributes(t *testing.T) {
+	schema, err := domain.NewAttributeSchema([]domain.AttributeDefinition{
+		{Name: "employeeId", Type: domain.AttributeTypeString, Required: true, Unique: true},
+		{Name: "level", Type: domain.AttributeTypeNumber},
+		{Name: "hiredAt", Type: domain.AttributeTypeDateTime},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	repo := newMockUserRepository()
+	userService := service.NewUserService(repo).WithAttributeSchema(schema)
+
+	ctx := context.Background()
+
+	first, _ := userService.CreateUser(ctx, "First", "first@example.com", "password123")
+	second, _ := userService.CreateUser(ctx, "Second", "second@example.com", "password123")
+
+	patchedUser, err := userService.PatchUser(ctx, first.ID, domain.UserPatch{Attributes: map[string]interface{}{
+		"employeeId": "E1",
+		"level":      3,
+		"hiredAt":    "2024-01-02T10:00:00+07:00",
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Values are stored in their normalized form
+	if patchedUser.Attributes["level"] != float64(3) {
+		t.Errorf("Expected level 3 as a float64, got %#v", patchedUser.Attributes["level"])
+	}
+	if patchedUser.Attributes["hiredAt"] != "2024-01-02T03:00:00Z" {
+		t.Errorf("Expected hiredAt in UTC, got %v", patchedUser.Attributes["hiredAt"])
+	}
+
+	_, err = userService.PatchUser(ctx, second.ID, domain.UserPatch{Attributes: map[string]interface{}{"employeeId": "E1"}})
+	if !errors.Is(err, service.ErrAttributeTaken) {
+		t.Errorf("Expected ErrAttributeTaken, got %v", err)
+	}
+
+	// Users keep their own unique values
+	_, err = userService.PatchUser(ctx, first.ID, domain.UserPatch{Attributes: map[string]interface{}{"employeeId": "E1"}})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		attributes map[string]interface{}
+	}{
+		{"wrong type", map[string]interface{}{"level": "three"}},
+		{"invalid datetime", map[string]interface{}{"hiredAt": "yesterday"}},
+		{"removing a required attribute", map[string]interface{}{"employeeId": nil}},
+	}
+
+	for _, tt := range tests {
+		_, err := userService.PatchUser(ctx, first.ID, domain.UserPatch{Attributes: tt.attributes})
+		if !errors.Is(err, domain.ErrInvalidUser) {
+			t.Errorf("%s: expected ErrInvalidUser, got %v", tt.name, err)
+		}
+	}
+
+	// Optional attributes can be removed
+	patchedUser, err = userService.PatchUser(ctx, first.ID, domain.UserPatch{Attributes: map[string]interface{}{"level": nil}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := patchedUser.Attributes["level"]; ok {
+		t.Errorf("Expected level to be removed, got %v", patchedUser.Attributes)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
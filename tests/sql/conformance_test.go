@@ -0,0 +1,15 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/ports"
+	"backend-hexagonal/tests/conformance"
+	"testing"
+)
+
+func TestUserRepository_Conformance(t *testing.T) {
+	conformance.RunUserRepository(t, func(t *testing.T) ports.UserRepository {
+		return sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	})
+}
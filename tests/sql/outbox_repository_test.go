@@ -0,0 +1,124 @@
+package sql
+
+import (
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOutboxRepository(t *testing.T) {
+	db := openDB(t)
+	outbox := sqladapter.NewOutboxRepository(db)
+	ctx := context.Background()
+
+	user := newUser("Outbox User", "outbox@example.com")
+	user.ID = newID()
+	user.Attributes = map[string]interface{}{"department": "sales"}
+	first := domain.UserRegistered(user)
+	second := domain.PasswordChanged(user.ID)
+	third := domain.UserErased(user.ID)
+	if err := outbox.Append(ctx, first, second); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := outbox.Append(ctx, third); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("Expected distinct IDs to be assigned, got %q and %q", first.ID, second.ID)
+	}
+
+	events, err := outbox.Unpublished(ctx, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(events) != 2 || events[0].ID != first.ID || events[1].ID != second.ID {
+		t.Fatalf("Expected the first two events in order, got %v", events)
+	}
+	if events[0].Type != domain.EventUserRegistered || events[0].User == nil || events[0].User.Email != user.Email {
+		t.Errorf("Expected the registered event with its user, got %+v", events[0])
+	}
+	if events[0].User.Status != domain.UserStatusActive || events[0].User.Version != user.Version {
+		t.Errorf("Expected the status and version of the user, got %+v", events[0].User)
+	}
+
+	publishedAt := time.Now().Add(-time.Hour)
+	if err := outbox.MarkPublished(ctx, []string{first.ID, second.ID}, publishedAt); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	events, _ = outbox.Unpublished(ctx, 10)
+	if len(events) != 1 || events[0].ID != third.ID || events[0].Type != domain.EventUserErased {
+		t.Fatalf("Expected only the erased event left, got %v", events)
+	}
+
+	// Only events published before the cutoff are deleted
+	deleted, err := outbox.DeletePublished(ctx, publishedAt.Add(-time.Minute))
+	if err != nil || deleted != 0 {
+		t.Errorf("Expected nothing deleted, got %d, %v", deleted, err)
+	}
+	deleted, err = outbox.DeletePublished(ctx, time.Now())
+	if err != nil || deleted != 2 {
+		t.Errorf("Expected 2 events deleted, got %d, %v", deleted, err)
+	}
+	if events, _ := outbox.Unpublished(ctx, 10); len(events) != 1 {
+		t.Errorf("Expected the unpublished event to be kept, got %v", events)
+	}
+}
+
+func TestOutboxRepository_EraseUserData(t *testing.T) {
+	db := openDB(t)
+	outbox := sqladapter.NewOutboxRepository(db)
+	ctx := context.Background()
+
+	user := newUser("Erased User", "erased@example.com")
+	user.ID = newID()
+	other := newUser("Other User", "other@example.com")
+	other.ID = newID()
+	if err := outbox.Append(ctx, domain.UserRegistered(user), domain.UserUpdated(user), domain.UserRegistered(other)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records, err := outbox.ExportUserData(ctx, user.ID)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected the user's 2 events exported, got %d, %v", len(records), err)
+	}
+
+	if err := outbox.EraseUserData(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	events, _ := outbox.Unpublished(ctx, 10)
+	if len(events) != 3 {
+		t.Fatalf("Expected the events to still be delivered, got %d", len(events))
+	}
+	for _, event := range events {
+		if event.UserID == user.ID && event.User != nil {
+			t.Errorf("Expected the erased user to be removed from %s, got %+v", event.Type, event.User)
+		}
+		if event.UserID == other.ID && (event.User == nil || event.User.Email != other.Email) {
+			t.Errorf("Expected other users' events to be kept, got %+v", event.User)
+		}
+	}
+}
+
+func TestOutboxRepository_Transaction(t *testing.T) {
+	db := openDB(t)
+	outbox := sqladapter.NewOutboxRepository(db)
+	transactor := sqladapter.NewTransactor(db)
+	ctx := context.Background()
+
+	failure := errors.New("failure")
+	err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := outbox.Append(ctx, domain.PasswordChanged(newID())); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+	if events, _ := outbox.Unpublished(ctx, 10); len(events) != 0 {
+		t.Errorf("Expected the event to be rolled back, got %v", events)
+	}
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPreferenceRepository_Put(t *testing.T) {
+	repo := sqladapter.NewPreferenceRepository(openDB(t))
+	ctx := context.Background()
+	userID := newID()
+
+	prefs := &domain.Preferences{UserID: userID, Namespace: "ui", Values: map[string]interface{}{
+		"theme": "dark",
+		"panes": []interface{}{"left", "right"},
+	}}
+	if err := repo.Put(ctx, prefs); err != nil || prefs.Version != 1 {
+		t.Fatalf("Expected version 1, got %d, %v", prefs.Version, err)
+	}
+
+	// A second insert lost the race
+	stale := &domain.Preferences{UserID: userID, Namespace: "ui", Values: map[string]interface{}{"theme": "light"}}
+	if err := repo.Put(ctx, stale); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	stored, _ := repo.Get(ctx, userID, "ui")
+	if stored.Values["theme"] != "dark" || len(stored.Values["panes"].([]interface{})) != 2 {
+		t.Errorf("Expected the stored values, got %v", stored.Values)
+	}
+
+	stored.Values["theme"] = "light"
+	if err := repo.Put(ctx, stored); err != nil || stored.Version != 2 {
+		t.Fatalf("Expected version 2, got %d, %v", stored.Version, err)
+	}
+	prefs.Values["theme"] = "blue"
+	if err := repo.Put(ctx, prefs); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	repo.Put(ctx, &domain.Preferences{UserID: userID, Namespace: "editor", Values: map[string]interface{}{"tabs": float64(2)}})
+	all, _ := repo.ListByUser(ctx, userID)
+	if len(all) != 2 || all[0].Namespace != "editor" || all[1].Namespace != "ui" {
+		t.Errorf("Expected editor and ui, got %d namespaces", len(all))
+	}
+
+	// Storing nothing removes the record
+	stored.Values = nil
+	if err := repo.Put(ctx, stored); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored, _ := repo.Get(ctx, userID, "ui"); stored != nil {
+		t.Errorf("Expected no preferences, got %+v", stored)
+	}
+
+	repo.DeleteByUser(ctx, userID)
+	if all, _ := repo.ListByUser(ctx, userID); len(all) != 0 {
+		t.Errorf("Expected no preferences, got %d", len(all))
+	}
+}
+
+func TestTombstoneRepository(t *testing.T) {
+	repo := sqladapter.NewTombstoneRepository(openDB(t))
+	ctx := context.Background()
+	userID := newID()
+
+	if tombstone, err := repo.GetByUserID(ctx, userID); tombstone != nil || err != nil {
+		t.Errorf("Expected no tombstone and no error, got %v, %v", tombstone, err)
+	}
+
+	tombstone := &domain.ErasureTombstone{
+		UserID:      userID,
+		RequestedBy: newID(),
+		Stores:      []string{"avatars", "preferences"},
+		ErasedAt:    time.Now(),
+	}
+	if err := repo.Create(ctx, tombstone); err != nil || tombstone.ID == "" {
+		t.Fatalf("Expected an ID, got %v", err)
+	}
+
+	found, err := repo.GetByUserID(ctx, userID)
+	if err != nil || found.ID != tombstone.ID || found.RequestedBy != tombstone.RequestedBy || len(found.Stores) != 2 {
+		t.Errorf("Expected the stored tombstone, got %+v, %v", found, err)
+	}
+}
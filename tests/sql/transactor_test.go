@@ -0,0 +1,66 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/domain"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransactor(t *testing.T) {
+	db := openDB(t)
+	users := sqladapter.NewUserRepository(db, ids.NewObjectIDGenerator())
+	tombstones := sqladapter.NewTombstoneRepository(db)
+	transactor := sqladapter.NewTransactor(db)
+	ctx := context.Background()
+
+	// writeBoth creates a user and a tombstone for them, and fails with
+	// failure if it isn't nil
+	writeBoth := func(email string, failure error) (*domain.User, error) {
+		user := newUser("Tx User", email)
+		err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+			if err := users.Create(ctx, user); err != nil {
+				return err
+			}
+			// The transaction sees its own writes
+			if exists, err := users.EmailExists(ctx, email); err != nil || !exists {
+				t.Errorf("Expected the user to be visible in the transaction, got %v, %v", exists, err)
+			}
+			// Nested transactions join the outer one
+			err := transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+				return tombstones.Create(ctx, &domain.ErasureTombstone{UserID: user.ID, RequestedBy: user.ID, ErasedAt: time.Now()})
+			})
+			if err != nil {
+				return err
+			}
+			return failure
+		})
+		return user, err
+	}
+
+	failure := errors.New("failure")
+	rolledBack, err := writeBoth("rollback@example.com", failure)
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+	if exists, _ := users.EmailExists(ctx, "rollback@example.com"); exists {
+		t.Error("Expected the user to be rolled back")
+	}
+	if tombstone, _ := tombstones.GetByUserID(ctx, rolledBack.ID); tombstone != nil {
+		t.Error("Expected the tombstone to be rolled back")
+	}
+
+	committed, err := writeBoth("commit@example.com", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if exists, _ := users.EmailExists(ctx, "commit@example.com"); !exists {
+		t.Error("Expected the user to be committed")
+	}
+	if tombstone, _ := tombstones.GetByUserID(ctx, committed.ID); tombstone == nil {
+		t.Error("Expected the tombstone to be committed")
+	}
+}
@@ -0,0 +1,403 @@
+package sql
+
+import (
+	"backend-hexagonal/internal/adapters/ids"
+	sqladapter "backend-hexagonal/internal/adapters/sql"
+	"backend-hexagonal/internal/domain"
+	"backend-hexagonal/internal/ports"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openDB opens a migrated SQLite database in a temporary directory
+func openDB(t *testing.T) *sqladapter.DB {
+	t.Helper()
+	db, err := sqladapter.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return db
+}
+
+// newID returns a fresh user ID
+var newID = ids.NewObjectIDGenerator().NewUserID
+
+func newUser(name, email string) *domain.User {
+	return &domain.User{Name: name, Email: email, Status: domain.UserStatusActive, CreatedAt: time.Now()}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestDB_MigrateTwice(t *testing.T) {
+	db := openDB(t)
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Errorf("Expected migrating again to do nothing, got %v", err)
+	}
+}
+
+func TestUserRepository_RoundTrip(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	changedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	user := newUser("John Doe", "john@example.com")
+	user.Password = "hash"
+	user.Roles = []string{domain.RoleAdmin}
+	user.StatusReason = "welcome back"
+	user.StatusChangedAt = &changedAt
+	user.Profile = domain.Profile{DisplayName: "Johnny", Locale: "en-GB", Timezone: "Europe/London", Phone: "+441234567890", Bio: "Hi"}
+	user.Attributes = map[string]interface{}{"team": "core", "level": float64(3), "remote": true}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.ID.IsZero() || user.Version != 1 {
+		t.Fatalf("Expected an ID and version 1, got %s, %d", user.ID.String(), user.Version)
+	}
+
+	found, err := repo.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if found.Name != user.Name || found.Email != user.Email || found.Password != "hash" || !found.HasRole(domain.RoleAdmin) {
+		t.Errorf("Expected the stored account fields, got %+v", found)
+	}
+	if found.Status != domain.UserStatusActive || found.StatusReason != "welcome back" || !found.StatusChangedAt.Equal(changedAt) {
+		t.Errorf("Expected the stored status, got %+v", found)
+	}
+	if found.Profile != user.Profile {
+		t.Errorf("Expected profile %+v, got %+v", user.Profile, found.Profile)
+	}
+	if fmt.Sprint(found.Attributes) != fmt.Sprint(user.Attributes) {
+		t.Errorf("Expected attributes %v, got %v", user.Attributes, found.Attributes)
+	}
+	if !found.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("Expected createdAt %v, got %v", user.CreatedAt, found.CreatedAt)
+	}
+
+	avatar := &domain.Avatar{
+		URL:         "/avatars/a.png",
+		Thumbnails:  map[string]string{"64": "/avatars/a-64.png"},
+		ContentType: "image/png",
+		Keys:        []string{"a.png", "a-64.png"},
+		UpdatedAt:   changedAt,
+	}
+	updated, err := repo.SetAvatar(ctx, user.ID, avatar)
+	if err != nil || updated.Version != 2 {
+		t.Fatalf("Expected version 2, got %v, %v", updated, err)
+	}
+	found, _ = repo.GetByID(ctx, user.ID)
+	if found.Avatar == nil || len(found.Avatar.Keys) != 2 || found.Avatar.Thumbnails["64"] != avatar.Thumbnails["64"] {
+		t.Errorf("Expected the avatar with its keys, got %+v", found.Avatar)
+	}
+}
+
+func TestUserRepository_NotFound(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	if _, err := repo.GetByID(ctx, newID()); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := repo.Restore(ctx, newID()); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if user, err := repo.GetByEmail(ctx, "nobody@example.com"); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v, %v", user, err)
+	}
+	if user, err := repo.Erase(ctx, newID()); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v, %v", user, err)
+	}
+
+	user := newUser("John Doe", "john@example.com")
+	repo.Create(ctx, user)
+	repo.Delete(ctx, user.ID, 0)
+	if _, err := repo.GetByID(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a deleted user, got %v", err)
+	}
+	if err := repo.Restore(ctx, user.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := repo.Restore(ctx, user.ID); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a user who is not deleted, got %v", err)
+	}
+
+	erased, err := repo.Erase(ctx, user.ID)
+	if err != nil || erased == nil || erased.Email != user.Email {
+		t.Errorf("Expected the erased user, got %v, %v", erased, err)
+	}
+}
+
+func TestUserRepository_Unavailable(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	if _, err := repo.GetByID(ctx, newID()); domain.KindOf(err) != domain.KindUnavailable {
+		t.Errorf("Expected an unavailable error, got %v", err)
+	}
+	if err := repo.Create(ctx, newUser("John Doe", "john@example.com")); domain.KindOf(err) != domain.KindUnavailable {
+		t.Errorf("Expected an unavailable error, got %v", err)
+	}
+	if _, err := repo.List(ctx, ports.UserQuery{SortBy: ports.SortByCreatedAt, Limit: 10}); domain.KindOf(err) != domain.KindUnavailable {
+		t.Errorf("Expected an unavailable error, got %v", err)
+	}
+}
+
+func TestUserRepository_UniqueEmails(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	john := newUser("John Doe", "john@example.com")
+	jane := newUser("Jane Doe", "jane@example.com")
+	repo.Create(ctx, john)
+	repo.Create(ctx, jane)
+
+	if err := repo.Create(ctx, newUser("Other", "john@example.com")); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+	if _, err := repo.Patch(ctx, jane.ID, domain.UserPatch{Email: strPtr("john@example.com")}); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+	if err := repo.Update(ctx, jane.ID, &domain.User{Name: "Jane", Email: "john@example.com"}); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+
+	// Deleted users keep their email until they are purged
+	repo.Delete(ctx, john.ID, 0)
+	if err := repo.Create(ctx, newUser("Other", "john@example.com")); !errors.Is(err, ports.ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken for a deleted user's email, got %v", err)
+	}
+	if purged, _ := repo.Purge(ctx, time.Now().Add(time.Minute)); purged != 1 {
+		t.Errorf("Expected 1 user to be purged, got %d", purged)
+	}
+	if err := repo.Create(ctx, newUser("Other", "john@example.com")); err != nil {
+		t.Errorf("Expected a purged user's email to be free, got %v", err)
+	}
+
+	// A changed email frees the old one
+	repo.Patch(ctx, jane.ID, domain.UserPatch{Email: strPtr("janet@example.com")})
+	if exists, _ := repo.EmailExists(ctx, "jane@example.com"); exists {
+		t.Error("Expected the old email to be free")
+	}
+}
+
+func TestUserRepository_Versions(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	user := newUser("John Doe", "john@example.com")
+	repo.Create(ctx, user)
+
+	patched, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr("Johnny"), Version: 1})
+	if err != nil || patched.Version != 2 || patched.Name != "Johnny" {
+		t.Fatalf("Expected Johnny at version 2, got %v, %v", patched, err)
+	}
+	if _, err := repo.Patch(ctx, user.ID, domain.UserPatch{Name: strPtr("Stale"), Version: 1}); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID, 1); !errors.Is(err, ports.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+
+	// Writes to users who don't exist find no user
+	if user, err := repo.Patch(ctx, newID(), domain.UserPatch{Name: strPtr("Nobody"), Version: 1}); user != nil || !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v, %v", user, err)
+	}
+	if err := repo.Delete(ctx, newID(), 3); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	changed, _ := repo.PatchMany(ctx, map[domain.UserID]domain.UserPatch{
+		user.ID: {Name: strPtr("John"), Version: 2},
+		newID(): {Name: strPtr("Nobody")},
+	})
+	if len(changed) != 1 || changed[0] != user.ID {
+		t.Errorf("Expected only the existing user to change, got %v", changed)
+	}
+
+	deleted, _ := repo.DeleteMany(ctx, map[domain.UserID]int64{user.ID: 2})
+	if len(deleted) != 0 {
+		t.Errorf("Expected a stale delete to be skipped, got %v", deleted)
+	}
+	deleted, _ = repo.DeleteMany(ctx, map[domain.UserID]int64{user.ID: 3})
+	if len(deleted) != 1 {
+		t.Errorf("Expected the user to be deleted, got %v", deleted)
+	}
+}
+
+func TestUserRepository_PatchAttributes(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	user := newUser("John Doe", "john@example.com")
+	user.DisplayName = "Johnny"
+	user.Attributes = map[string]interface{}{"team": "core", "level": float64(3)}
+	repo.Create(ctx, user)
+
+	patched, err := repo.Patch(ctx, user.ID, domain.UserPatch{
+		DisplayName: strPtr(""),
+		Attributes:  map[string]interface{}{"team": nil, "remote": true},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if patched.DisplayName != "" || fmt.Sprint(patched.Attributes) != "map[level:3 remote:true]" {
+		t.Errorf("Expected the display name and team cleared, got %q, %v", patched.DisplayName, patched.Attributes)
+	}
+}
+
+func TestUserRepository_Attributes(t *testing.T) {
+	db := openDB(t)
+	repo := sqladapter.NewUserRepository(db, ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	schema, _ := domain.NewAttributeSchema([]domain.AttributeDefinition{
+		{Name: "employeeId", Type: domain.AttributeTypeString, Unique: true},
+		{Name: "level", Type: domain.AttributeTypeNumber},
+		{Name: "remote", Type: domain.AttributeTypeBoolean},
+	})
+	if err := repo.EnsureAttributeIndexes(ctx, schema); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	john := newUser("John Doe", "john@example.com")
+	john.Attributes = map[string]interface{}{"employeeId": "E1", "level": float64(3), "remote": true}
+	repo.Create(ctx, john)
+
+	if exists, err := repo.AttributeExists(ctx, "employeeId", "E1", ""); !exists || err != nil {
+		t.Errorf("Expected E1 to exist, got %v, %v", exists, err)
+	}
+	if exists, _ := repo.AttributeExists(ctx, "employeeId", "E1", john.ID); exists {
+		t.Error("Expected the user's own value not to count")
+	}
+	if exists, _ := repo.AttributeExists(ctx, "level", float64(3), ""); !exists {
+		t.Error("Expected level 3 to exist")
+	}
+	if exists, _ := repo.AttributeExists(ctx, "level", float64(4), ""); exists {
+		t.Error("Expected level 4 not to exist")
+	}
+	if exists, _ := repo.AttributeExists(ctx, "remote", true, ""); !exists {
+		t.Error("Expected remote to exist")
+	}
+	if exists, _ := repo.AttributeExists(ctx, "remote", false, ""); exists {
+		t.Error("Expected no user who isn't remote")
+	}
+
+	// The index rejects a duplicate that slipped past AttributeExists, but
+	// not users without the attribute
+	jane := newUser("Jane Doe", "jane@example.com")
+	jane.Attributes = map[string]interface{}{"employeeId": "E1"}
+	if err := repo.Create(ctx, jane); err == nil {
+		t.Error("Expected the duplicate employeeId to be rejected")
+	}
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if err := repo.Create(ctx, newUser("No ID", email)); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+}
+
+func TestUserRepository_List(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	names := []string{"Carol", "alice", "Bob", "Dave", "Erin"}
+	for i, name := range names {
+		user := newUser(name, fmt.Sprintf("%s@example.com", name))
+		user.CreatedAt = time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		repo.Create(ctx, user)
+	}
+
+	for _, descending := range []bool{false, true} {
+		query := ports.UserQuery{Limit: 2, SortBy: ports.SortByCreatedAt, Descending: descending}
+		var seen []string
+		for {
+			page, err := repo.List(ctx, query)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if page.Total != 5 {
+				t.Errorf("Expected a total of 5, got %d", page.Total)
+			}
+			for _, user := range page.Users {
+				seen = append(seen, user.Name)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+
+		want := fmt.Sprint(names)
+		if descending {
+			want = "[Erin Dave Bob alice Carol]"
+		}
+		if fmt.Sprint(seen) != want {
+			t.Errorf("Expected %s, got %v", want, seen)
+		}
+	}
+
+	page, _ := repo.List(ctx, ports.UserQuery{Limit: 10, SortBy: ports.SortByName, NameContains: "A"})
+	if page.Total != 3 || page.Users[0].Name != "Carol" || page.Users[2].Name != "alice" {
+		t.Errorf("Expected Carol, Dave and alice by name, got %d users", page.Total)
+	}
+
+	after := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	page, _ = repo.List(ctx, ports.UserQuery{Limit: 1, Offset: 1, SortBy: ports.SortByEmail, CreatedAfter: &after})
+	if page.Total != 4 || len(page.Users) != 1 || page.Users[0].Name != "Dave" {
+		t.Errorf("Expected Dave second of 4 by email, got %d users", page.Total)
+	}
+
+	// Wildcards in filters match literally
+	page, _ = repo.List(ctx, ports.UserQuery{Limit: 10, SortBy: ports.SortByName, EmailPrefix: "%"})
+	if page.Total != 0 {
+		t.Errorf("Expected no users, got %d", page.Total)
+	}
+
+	if _, err := repo.List(ctx, ports.UserQuery{Limit: 2, SortBy: ports.SortByName, Cursor: "bogus"}); !errors.Is(err, ports.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestUserRepository_Each(t *testing.T) {
+	repo := sqladapter.NewUserRepository(openDB(t), ids.NewObjectIDGenerator())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		repo.Create(ctx, newUser("User", fmt.Sprintf("user%d@example.com", i)))
+	}
+	deleted := newUser("Deleted", "deleted@example.com")
+	repo.Create(ctx, deleted)
+	repo.Delete(ctx, deleted.ID, 0)
+
+	// fn can write while Each runs
+	count := 0
+	err := repo.Each(ctx, func(user *domain.User) error {
+		count++
+		_, err := repo.Patch(ctx, user.ID, domain.UserPatch{Bio: strPtr("seen")})
+		return err
+	})
+	if err != nil || count != 3 {
+		t.Errorf("Expected 3 users and no error, got %d, %v", count, err)
+	}
+
+	count = 0
+	repo.EachIncludingDeleted(ctx, func(user *domain.User) error {
+		count++
+		return nil
+	})
+	if count != 4 {
+		t.Errorf("Expected 4 users including the deleted one, got %d", count)
+	}
+}